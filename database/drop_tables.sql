@@ -1,7 +1,23 @@
+DROP TABLE label_purchases;
+DROP TABLE order_items;
+DROP TABLE promotion_redemptions;
+DROP TABLE promotion_tiers;
 DROP TABLE financials;
+DROP TABLE tracking_events;
 DROP TABLE shipping;
+DROP TABLE manifests;
+DROP TABLE plate_instances;
 DROP TABLE stl_files;
 DROP TABLE print_jobs;
+DROP TABLE plates;
+DROP TABLE printers;
 DROP TABLE orders;
+DROP TABLE checkouts;
+DROP TABLE promotions;
 DROP TABLE cart_items;
+DROP TABLE idempotency_keys;
+DROP TABLE tax_rates;
+DROP TABLE boxes;
 DROP TABLE designs;
+DROP TABLE prices;
+DROP TABLE products;
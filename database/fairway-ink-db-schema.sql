@@ -1,13 +1,79 @@
 
+CREATE TABLE products (
+    product_id INT AUTO_INCREMENT PRIMARY KEY,
+    template_type VARCHAR(20) NOT NULL,
+    size_variant VARCHAR(20) NOT NULL DEFAULT 'standard',
+    unit_weight_oz DECIMAL(5,2) NOT NULL DEFAULT 0.50,
+    customs_description VARCHAR(255) NOT NULL DEFAULT 'Plastic golf ball markers',
+    hs_tariff_number VARCHAR(10) NOT NULL DEFAULT '950639',
+    filament_color VARCHAR(30) NULL,
+    name VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (template_type, size_variant)
+);
+
+CREATE TABLE prices (
+    price_id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    unit_amount_cents INT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    effective_from TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    effective_to TIMESTAMP NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+);
+
 CREATE TABLE cart_items (
     id  INT AUTO_INCREMENT PRIMARY KEY,
     browser_ssid VARCHAR(255) NOT NULL,
     stl_url VARCHAR(255) NOT NULL,
     quantity INT NOT NULL,
     template_type VARCHAR(20) NOT NULL,
+    size_variant VARCHAR(20) NOT NULL DEFAULT 'standard',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE promotions (
+    promo_id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    discount_type ENUM('percent_off', 'fixed_off', 'free_shipping') NOT NULL,
+    discount_value INT NOT NULL DEFAULT 0,
+    template_type VARCHAR(20) NULL,
+    min_quantity INT NOT NULL DEFAULT 1,
+    starts_at TIMESTAMP NULL,
+    expires_at TIMESTAMP NULL,
+    max_redemptions INT NULL,
+    one_per_email BOOLEAN NOT NULL DEFAULT FALSE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE checkouts (
+    checkout_id INT AUTO_INCREMENT PRIMARY KEY,
+    stripe_ssid VARCHAR(255) UNIQUE NOT NULL,
+    browser_ssid VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NULL,
+    promo_id INT NULL,
+    subtotal_cents INT NOT NULL,
+    shipping_cents INT NOT NULL DEFAULT 0,
+    discount_cents INT NOT NULL DEFAULT 0,
+    tax_cents INT NOT NULL DEFAULT 0,
+    total_cents INT NOT NULL,
+    shipment_id VARCHAR(255) NULL,
+    rate_id VARCHAR(255) NULL,
+    address_1 VARCHAR(255) NULL,
+    address_2 VARCHAR(255) NULL,
+    city VARCHAR(255) NULL,
+    state VARCHAR(255) NULL,
+    zipcode VARCHAR(15) NULL,
+    country VARCHAR(2) NULL,
+    status ENUM('open', 'voided') NOT NULL DEFAULT 'open',
+    failure_reason TEXT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (promo_id) REFERENCES promotions(promo_id)
+);
+
 CREATE TABLE orders (
     order_id       INT AUTO_INCREMENT PRIMARY KEY,
     purchaser_email VARCHAR(255) NOT NULL,
@@ -21,19 +87,68 @@ CREATE TABLE orders (
     browser_ssid VARCHAR(255) NOT NULL,
     stripe_ssid VARCHAR(255) UNIQUE NOT NULL,
     total_amount   DECIMAL(10,2) NOT NULL,
+    shipping_cents INT NOT NULL DEFAULT 0,
+    tax_cents INT NOT NULL DEFAULT 0,
     payment_status VARCHAR(20) NOT NULL,
+    order_token_hash CHAR(64) NULL,
     created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE printers (
+    printer_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    bed_x_mm DECIMAL(6,1) NOT NULL,
+    bed_y_mm DECIMAL(6,1) NOT NULL,
+    bed_z_mm DECIMAL(6,1) NOT NULL,
+    nozzle_mm DECIMAL(3,2) NOT NULL DEFAULT 0.40,
+    filament_colors VARCHAR(255) NOT NULL,
+    status ENUM('idle', 'printing', 'offline', 'maintenance') NOT NULL DEFAULT 'idle',
+    last_seen_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE plates (
+    plate_id INT AUTO_INCREMENT PRIMARY KEY,
+    status ENUM('created', 'claimed', 'printing', 'completed', 'failed') NOT NULL DEFAULT 'created',
+    worker_id VARCHAR(255) NULL,
+    printer_id INT NULL,
+    lease_expires_at TIMESTAMP NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    bed_x_mm DECIMAL(6,1) NOT NULL,
+    bed_y_mm DECIMAL(6,1) NOT NULL,
+    filament_colors VARCHAR(255) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    failure_reason VARCHAR(512) NULL
+);
+
 CREATE TABLE print_jobs (
     job_id INT AUTO_INCREMENT PRIMARY KEY,
     order_id INT NOT NULL,
-    status         ENUM('queued', 'printing', 'completed', 'failed') DEFAULT 'queued',
-    estimated_completion_time INT NULL,
+    status         ENUM('queued', 'claimed', 'printing', 'completed', 'failed') DEFAULT 'queued',
+    worker_id VARCHAR(255) NULL,
+    printer_id INT NULL,
+    plate_id INT NULL,
+    lease_expires_at TIMESTAMP NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    failure_reason VARCHAR(512) NULL,
+    estimated_print_seconds INT NULL,
+    estimated_completion_time TIMESTAMP NULL,
+    size_x_mm DECIMAL(6,1) NULL,
+    size_y_mm DECIMAL(6,1) NULL,
+    size_z_mm DECIMAL(6,1) NULL,
+    filament_colors VARCHAR(255) NULL,
+    nozzle_mm DECIMAL(3,2) NULL,
+    slice_attempts INT NOT NULL DEFAULT 0,
+    slice_next_attempt_at TIMESTAMP NULL,
+    slice_error VARCHAR(512) NULL,
     started_at     TIMESTAMP NULL,
     completed_at   TIMESTAMP NULL,
     created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (printer_id) REFERENCES printers(printer_id) ON DELETE SET NULL,
+    FOREIGN KEY (plate_id) REFERENCES plates(plate_id) ON DELETE SET NULL,
+    INDEX idx_print_jobs_queue (status, lease_expires_at)
 );
 
 CREATE TABLE stl_files (
@@ -41,9 +156,63 @@ CREATE TABLE stl_files (
     browser_ssid       VARCHAR(255) NOT NULL,
     file_name VARCHAR(255) NOT NULL,
     quantity INT NOT NULL,
+    price_id INT NULL,
+    unit_price_cents INT NULL,
+    gcode_file_name VARCHAR(255) NULL,
+    gcode_print_seconds INT NULL,
+    gcode_filament_mm DECIMAL(10,1) NULL,
+    gcode_filament_g DECIMAL(8,2) NULL,
+    sliced_at TIMESTAMP NULL,
+    job_id INT NOT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (job_id) REFERENCES print_jobs(job_id) ON DELETE CASCADE,
+    FOREIGN KEY (price_id) REFERENCES prices(price_id)
+);
+
+CREATE TABLE plate_instances (
+    instance_id INT AUTO_INCREMENT PRIMARY KEY,
+    plate_id INT NOT NULL,
+    stl_id INT NOT NULL,
     job_id INT NOT NULL,
+    order_id INT NOT NULL,
+    copy_number INT NOT NULL,
+    x_mm DECIMAL(6,1) NOT NULL,
+    y_mm DECIMAL(6,1) NOT NULL,
+    rotated BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (plate_id) REFERENCES plates(plate_id) ON DELETE CASCADE,
+    FOREIGN KEY (stl_id) REFERENCES stl_files(stl_id) ON DELETE CASCADE,
+    FOREIGN KEY (job_id) REFERENCES print_jobs(job_id) ON DELETE CASCADE,
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+);
+
+CREATE TABLE order_items (
+    order_item_id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    stl_id INT NULL,
+    template_type VARCHAR(20) NULL,
+    size_variant VARCHAR(20) NULL,
+    file_name VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    price_id INT NULL,
+    unit_price_cents INT NULL,
+    discount_cents INT NOT NULL DEFAULT 0,
     created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (job_id) REFERENCES print_jobs(job_id) ON DELETE CASCADE
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (stl_id) REFERENCES stl_files(stl_id) ON DELETE SET NULL,
+    FOREIGN KEY (price_id) REFERENCES prices(price_id)
+);
+
+CREATE TABLE manifests (
+    manifest_id INT AUTO_INCREMENT PRIMARY KEY,
+    carrier VARCHAR(255) NOT NULL,
+    manifest_date DATE NOT NULL,
+    easypost_scan_form_id VARCHAR(255) NOT NULL UNIQUE,
+    easypost_batch_id VARCHAR(255) NULL,
+    form_url VARCHAR(2083) NULL,
+    status VARCHAR(20) NOT NULL,
+    shipment_count INT NOT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_manifests_date (manifest_date)
 );
 
 CREATE TABLE shipping (
@@ -56,8 +225,28 @@ CREATE TABLE shipping (
     ship_rate VARCHAR(15) NOT NULL,
     shipping_label_url VARCHAR(2083),
     shipping_status ENUM('pending', 'shipped', 'delivered') DEFAULT 'pending',
+    manifest_id INT NULL,
+    handed_off_at TIMESTAMP NULL,
     created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (manifest_id) REFERENCES manifests(manifest_id),
+    INDEX idx_shipping_easypost_id (easypost_id),
+    INDEX idx_shipping_manifest (manifest_id, created_at)
+);
+
+CREATE TABLE tracking_events (
+    tracking_event_id INT AUTO_INCREMENT PRIMARY KEY,
+    shipment_id INT NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    status_detail VARCHAR(100) NULL,
+    message VARCHAR(255) NULL,
+    city VARCHAR(100) NULL,
+    state VARCHAR(50) NULL,
+    country VARCHAR(2) NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_tracking_event (shipment_id, occurred_at, status),
+    FOREIGN KEY (shipment_id) REFERENCES shipping(shipment_id) ON DELETE CASCADE
 );
 
 CREATE TABLE financials (
@@ -73,9 +262,107 @@ CREATE TABLE financials (
 
 );
 
+CREATE TABLE promotion_tiers (
+    tier_id INT AUTO_INCREMENT PRIMARY KEY,
+    promo_id INT NOT NULL,
+    min_quantity INT NOT NULL,
+    discount_value INT NOT NULL,
+    UNIQUE KEY uq_promotion_tier (promo_id, min_quantity),
+    FOREIGN KEY (promo_id) REFERENCES promotions(promo_id) ON DELETE CASCADE
+);
+
+CREATE TABLE promotion_redemptions (
+    redemption_id INT AUTO_INCREMENT PRIMARY KEY,
+    promo_id INT NOT NULL,
+    order_id INT NOT NULL,
+    stripe_ssid VARCHAR(255) UNIQUE NOT NULL,
+    purchaser_email VARCHAR(255) NOT NULL,
+    discount_cents INT NOT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (promo_id) REFERENCES promotions(promo_id),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+);
+
+CREATE TABLE idempotency_keys (
+    idempotency_id INT AUTO_INCREMENT PRIMARY KEY,
+    idempotency_key VARCHAR(255) NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    response_status INT NULL,
+    response_body MEDIUMBLOB NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at   TIMESTAMP NULL,
+    UNIQUE (idempotency_key, route)
+);
+
+CREATE TABLE tax_rates (
+    tax_rate_id INT AUTO_INCREMENT PRIMARY KEY,
+    country VARCHAR(2) NOT NULL DEFAULT 'US',
+    state VARCHAR(2) NOT NULL,
+    zip_prefix VARCHAR(5) NOT NULL DEFAULT '',
+    rate DECIMAL(6,5) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (country, state, zip_prefix)
+);
+
+CREATE TABLE boxes (
+    box_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    length_in DECIMAL(5,2) NOT NULL,
+    width_in DECIMAL(5,2) NOT NULL,
+    height_in DECIMAL(5,2) NOT NULL,
+    tare_weight_oz DECIMAL(6,2) NOT NULL,
+    max_markers INT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE label_purchases (
+    label_purchase_id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL UNIQUE,
+    shipment_id VARCHAR(255) NULL,
+    rate_id VARCHAR(255) NULL,
+    rate_policy JSON NULL,
+    box_id INT NULL,
+    length_in DECIMAL(5,2) NOT NULL,
+    width_in DECIMAL(5,2) NOT NULL,
+    height_in DECIMAL(5,2) NOT NULL,
+    weight_oz DECIMAL(6,2) NOT NULL,
+    customs_items JSON NULL,
+    status ENUM('waiting', 'queued', 'purchasing', 'purchased', 'failed') NOT NULL DEFAULT 'waiting',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(512) NULL,
+    next_attempt_at TIMESTAMP NULL,
+    claimed_at TIMESTAMP NULL,
+    claimed_shipment_id VARCHAR(255) NULL,
+    purchased_at TIMESTAMP NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (box_id) REFERENCES boxes(box_id),
+    INDEX idx_label_purchases_due (status, next_attempt_at)
+);
+
 CREATE TABLE designs (
     design_id INT AUTO_INCREMENT PRIMARY KEY,
     item_name VARCHAR(255) NOT NULL,
     file_name VARCHAR(255) NOT NULL,
     created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+
+INSERT INTO products (template_type, size_variant, unit_weight_oz, name) VALUES
+    ('solid', 'standard', 0.45, 'Solid ball marker'),
+    ('text', 'standard', 0.50, 'Text ball marker'),
+    ('custom', 'standard', 0.55, 'Custom ball marker');
+
+INSERT INTO prices (product_id, unit_amount_cents)
+    SELECT product_id, CASE template_type WHEN 'solid' THEN 1499 WHEN 'text' THEN 1899 WHEN 'custom' THEN 1599 END
+    FROM products;
+
+INSERT INTO boxes (name, length_in, width_in, height_in, tare_weight_oz, max_markers) VALUES
+    ('Padded mailer', 8, 7, 1.25, 1.50, 4),
+    ('Small box', 8, 6, 4, 4.00, 20),
+    ('Medium box', 12, 10, 6, 8.50, 60),
+    ('Large box', 16, 12, 8, 14.00, 150);
+
+INSERT INTO tax_rates (state, rate) VALUES ('OH', 0.05750);
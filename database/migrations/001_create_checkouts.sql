@@ -0,0 +1,8 @@
+CREATE TABLE checkouts (
+    checkout_id INT AUTO_INCREMENT PRIMARY KEY,
+    stripe_ssid VARCHAR(255) UNIQUE NOT NULL,
+    browser_ssid VARCHAR(255) NOT NULL,
+    subtotal_cents INT NOT NULL,
+    total_cents INT NOT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
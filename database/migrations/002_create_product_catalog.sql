@@ -0,0 +1,36 @@
+CREATE TABLE products (
+    product_id INT AUTO_INCREMENT PRIMARY KEY,
+    template_type VARCHAR(20) NOT NULL,
+    size_variant VARCHAR(20) NOT NULL DEFAULT 'standard',
+    name VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (template_type, size_variant)
+);
+
+CREATE TABLE prices (
+    price_id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    unit_amount_cents INT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    effective_from TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    effective_to TIMESTAMP NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+);
+
+INSERT INTO products (template_type, size_variant, name) VALUES
+    ('solid', 'standard', 'Solid ball marker'),
+    ('text', 'standard', 'Text ball marker'),
+    ('custom', 'standard', 'Custom ball marker');
+
+INSERT INTO prices (product_id, unit_amount_cents)
+    SELECT product_id, CASE template_type WHEN 'solid' THEN 1499 WHEN 'text' THEN 1899 WHEN 'custom' THEN 1599 END
+    FROM products;
+
+ALTER TABLE cart_items ADD COLUMN size_variant VARCHAR(20) NOT NULL DEFAULT 'standard' AFTER template_type;
+
+ALTER TABLE stl_files
+    ADD COLUMN price_id INT NULL AFTER quantity,
+    ADD COLUMN unit_price_cents INT NULL AFTER price_id,
+    ADD FOREIGN KEY (price_id) REFERENCES prices(price_id);
@@ -0,0 +1,32 @@
+CREATE TABLE promotions (
+    promo_id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    discount_type ENUM('percent_off', 'fixed_off', 'free_shipping') NOT NULL,
+    discount_value INT NOT NULL DEFAULT 0,
+    template_type VARCHAR(20) NULL,
+    min_quantity INT NOT NULL DEFAULT 1,
+    starts_at TIMESTAMP NULL,
+    expires_at TIMESTAMP NULL,
+    max_redemptions INT NULL,
+    one_per_email BOOLEAN NOT NULL DEFAULT FALSE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE promotion_redemptions (
+    redemption_id INT AUTO_INCREMENT PRIMARY KEY,
+    promo_id INT NOT NULL,
+    order_id INT NOT NULL,
+    stripe_ssid VARCHAR(255) UNIQUE NOT NULL,
+    purchaser_email VARCHAR(255) NOT NULL,
+    discount_cents INT NOT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (promo_id) REFERENCES promotions(promo_id),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+);
+
+ALTER TABLE checkouts
+    ADD COLUMN email VARCHAR(255) NULL AFTER browser_ssid,
+    ADD COLUMN promo_id INT NULL AFTER email,
+    ADD COLUMN discount_cents INT NOT NULL DEFAULT 0 AFTER subtotal_cents,
+    ADD FOREIGN KEY (promo_id) REFERENCES promotions(promo_id);
@@ -0,0 +1,3 @@
+ALTER TABLE checkouts
+    ADD COLUMN status ENUM('open', 'voided') NOT NULL DEFAULT 'open' AFTER total_cents,
+    ADD COLUMN failure_reason TEXT NULL AFTER status;
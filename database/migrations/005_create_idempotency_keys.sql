@@ -0,0 +1,11 @@
+CREATE TABLE idempotency_keys (
+    idempotency_id INT AUTO_INCREMENT PRIMARY KEY,
+    idempotency_key VARCHAR(255) NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    response_status INT NULL,
+    response_body MEDIUMBLOB NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at   TIMESTAMP NULL,
+    UNIQUE (idempotency_key, route)
+);
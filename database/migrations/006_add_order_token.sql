@@ -0,0 +1,2 @@
+ALTER TABLE orders
+    ADD COLUMN order_token_hash CHAR(64) NULL AFTER payment_status;
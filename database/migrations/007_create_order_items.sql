@@ -0,0 +1,24 @@
+CREATE TABLE order_items (
+    order_item_id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    stl_id INT NULL,
+    template_type VARCHAR(20) NULL,
+    size_variant VARCHAR(20) NULL,
+    file_name VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    price_id INT NULL,
+    unit_price_cents INT NULL,
+    discount_cents INT NOT NULL DEFAULT 0,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (stl_id) REFERENCES stl_files(stl_id) ON DELETE SET NULL,
+    FOREIGN KEY (price_id) REFERENCES prices(price_id)
+);
+
+INSERT INTO order_items (order_id, stl_id, template_type, size_variant, file_name, quantity, price_id, unit_price_cents, created_at)
+    SELECT j.order_id, f.stl_id, pr.template_type, pr.size_variant, f.file_name, f.quantity, f.price_id, f.unit_price_cents, f.created_at
+    FROM stl_files f
+    JOIN print_jobs j ON j.job_id = f.job_id
+    LEFT JOIN prices p ON p.price_id = f.price_id
+    LEFT JOIN products pr ON pr.product_id = p.product_id
+    ORDER BY f.stl_id;
@@ -0,0 +1,16 @@
+CREATE TABLE tax_rates (
+    tax_rate_id INT AUTO_INCREMENT PRIMARY KEY,
+    country VARCHAR(2) NOT NULL DEFAULT 'US',
+    state VARCHAR(2) NOT NULL,
+    zip_prefix VARCHAR(5) NOT NULL DEFAULT '',
+    rate DECIMAL(6,5) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (country, state, zip_prefix)
+);
+
+INSERT INTO tax_rates (state, rate) VALUES ('OH', 0.05750);
+
+ALTER TABLE checkouts ADD COLUMN tax_cents INT NOT NULL DEFAULT 0 AFTER discount_cents;
+
+ALTER TABLE orders ADD COLUMN tax_cents INT NOT NULL DEFAULT 0 AFTER total_amount;
@@ -0,0 +1,6 @@
+ALTER TABLE checkouts
+    ADD COLUMN shipping_cents INT NOT NULL DEFAULT 0 AFTER subtotal_cents,
+    ADD COLUMN shipment_id VARCHAR(255) NULL AFTER total_cents,
+    ADD COLUMN rate_id VARCHAR(255) NULL AFTER shipment_id;
+
+ALTER TABLE orders ADD COLUMN shipping_cents INT NOT NULL DEFAULT 0 AFTER total_amount;
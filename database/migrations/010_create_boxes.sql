@@ -0,0 +1,21 @@
+CREATE TABLE boxes (
+    box_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    length_in DECIMAL(5,2) NOT NULL,
+    width_in DECIMAL(5,2) NOT NULL,
+    height_in DECIMAL(5,2) NOT NULL,
+    tare_weight_oz DECIMAL(6,2) NOT NULL,
+    max_markers INT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO boxes (name, length_in, width_in, height_in, tare_weight_oz, max_markers) VALUES
+    ('Padded mailer', 8, 7, 1.25, 1.50, 4),
+    ('Small box', 8, 6, 4, 4.00, 20),
+    ('Medium box', 12, 10, 6, 8.50, 60),
+    ('Large box', 16, 12, 8, 14.00, 150);
+
+ALTER TABLE products ADD COLUMN unit_weight_oz DECIMAL(5,2) NOT NULL DEFAULT 0.50 AFTER size_variant;
+
+UPDATE products SET unit_weight_oz = CASE template_type WHEN 'solid' THEN 0.45 WHEN 'text' THEN 0.50 WHEN 'custom' THEN 0.55 ELSE unit_weight_oz END;
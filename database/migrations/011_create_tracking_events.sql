@@ -0,0 +1,16 @@
+CREATE TABLE tracking_events (
+    tracking_event_id INT AUTO_INCREMENT PRIMARY KEY,
+    shipment_id INT NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    status_detail VARCHAR(100) NULL,
+    message VARCHAR(255) NULL,
+    city VARCHAR(100) NULL,
+    state VARCHAR(50) NULL,
+    country VARCHAR(2) NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_tracking_event (shipment_id, occurred_at, status),
+    FOREIGN KEY (shipment_id) REFERENCES shipping(shipment_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_shipping_easypost_id ON shipping (easypost_id);
@@ -0,0 +1,21 @@
+CREATE TABLE label_purchases (
+    label_purchase_id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL UNIQUE,
+    shipment_id VARCHAR(255) NULL,
+    rate_id VARCHAR(255) NULL,
+    rate_policy JSON NULL,
+    box_id INT NULL,
+    length_in DECIMAL(5,2) NOT NULL,
+    width_in DECIMAL(5,2) NOT NULL,
+    height_in DECIMAL(5,2) NOT NULL,
+    weight_oz DECIMAL(6,2) NOT NULL,
+    status ENUM('waiting', 'queued', 'purchasing', 'purchased', 'failed') NOT NULL DEFAULT 'waiting',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(512) NULL,
+    next_attempt_at TIMESTAMP NULL,
+    purchased_at TIMESTAMP NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (box_id) REFERENCES boxes(box_id),
+    INDEX idx_label_purchases_due (status, next_attempt_at)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE products
+    ADD COLUMN customs_description VARCHAR(255) NOT NULL DEFAULT 'Plastic golf ball markers' AFTER unit_weight_oz,
+    ADD COLUMN hs_tariff_number VARCHAR(10) NOT NULL DEFAULT '950639' AFTER customs_description;
+
+ALTER TABLE label_purchases ADD COLUMN customs_items JSON NULL AFTER weight_oz;
@@ -0,0 +1,18 @@
+CREATE TABLE manifests (
+    manifest_id INT AUTO_INCREMENT PRIMARY KEY,
+    carrier VARCHAR(255) NOT NULL,
+    manifest_date DATE NOT NULL,
+    easypost_scan_form_id VARCHAR(255) NOT NULL UNIQUE,
+    easypost_batch_id VARCHAR(255) NULL,
+    form_url VARCHAR(2083) NULL,
+    status VARCHAR(20) NOT NULL,
+    shipment_count INT NOT NULL,
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_manifests_date (manifest_date)
+);
+
+ALTER TABLE shipping
+    ADD COLUMN manifest_id INT NULL AFTER shipping_status,
+    ADD COLUMN handed_off_at TIMESTAMP NULL AFTER manifest_id,
+    ADD FOREIGN KEY (manifest_id) REFERENCES manifests(manifest_id),
+    ADD INDEX idx_shipping_manifest (manifest_id, created_at);
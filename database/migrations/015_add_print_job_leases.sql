@@ -0,0 +1,7 @@
+ALTER TABLE print_jobs
+    MODIFY COLUMN status ENUM('queued', 'claimed', 'printing', 'completed', 'failed') DEFAULT 'queued',
+    ADD COLUMN worker_id VARCHAR(255) NULL AFTER status,
+    ADD COLUMN lease_expires_at TIMESTAMP NULL AFTER worker_id,
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0 AFTER lease_expires_at,
+    ADD COLUMN failure_reason VARCHAR(512) NULL AFTER attempts,
+    ADD INDEX idx_print_jobs_queue (status, lease_expires_at);
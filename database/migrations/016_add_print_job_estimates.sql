@@ -0,0 +1,3 @@
+ALTER TABLE print_jobs
+    ADD COLUMN estimated_print_seconds INT NULL AFTER failure_reason,
+    MODIFY COLUMN estimated_completion_time TIMESTAMP NULL;
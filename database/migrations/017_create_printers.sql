@@ -0,0 +1,23 @@
+CREATE TABLE printers (
+    printer_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    bed_x_mm DECIMAL(6,1) NOT NULL,
+    bed_y_mm DECIMAL(6,1) NOT NULL,
+    bed_z_mm DECIMAL(6,1) NOT NULL,
+    nozzle_mm DECIMAL(3,2) NOT NULL DEFAULT 0.40,
+    filament_colors VARCHAR(255) NOT NULL,
+    status ENUM('idle', 'printing', 'offline', 'maintenance') NOT NULL DEFAULT 'idle',
+    last_seen_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE products
+    ADD COLUMN filament_color VARCHAR(30) NULL AFTER hs_tariff_number;
+
+ALTER TABLE print_jobs
+    ADD COLUMN printer_id INT NULL AFTER worker_id,
+    ADD COLUMN size_x_mm DECIMAL(6,1) NULL AFTER estimated_completion_time,
+    ADD COLUMN size_y_mm DECIMAL(6,1) NULL AFTER size_x_mm,
+    ADD COLUMN size_z_mm DECIMAL(6,1) NULL AFTER size_y_mm,
+    ADD COLUMN filament_colors VARCHAR(255) NULL AFTER size_z_mm,
+    ADD FOREIGN KEY (printer_id) REFERENCES printers(printer_id) ON DELETE SET NULL;
@@ -0,0 +1,29 @@
+CREATE TABLE plates (
+    plate_id INT AUTO_INCREMENT PRIMARY KEY,
+    status ENUM('created', 'completed') NOT NULL DEFAULT 'created',
+    bed_x_mm DECIMAL(6,1) NOT NULL,
+    bed_y_mm DECIMAL(6,1) NOT NULL,
+    filament_colors VARCHAR(255) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL
+);
+
+ALTER TABLE print_jobs
+    ADD COLUMN plate_id INT NULL AFTER printer_id,
+    ADD FOREIGN KEY (plate_id) REFERENCES plates(plate_id) ON DELETE SET NULL;
+
+CREATE TABLE plate_instances (
+    instance_id INT AUTO_INCREMENT PRIMARY KEY,
+    plate_id INT NOT NULL,
+    stl_id INT NOT NULL,
+    job_id INT NOT NULL,
+    order_id INT NOT NULL,
+    copy_number INT NOT NULL,
+    x_mm DECIMAL(6,1) NOT NULL,
+    y_mm DECIMAL(6,1) NOT NULL,
+    rotated BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (plate_id) REFERENCES plates(plate_id) ON DELETE CASCADE,
+    FOREIGN KEY (stl_id) REFERENCES stl_files(stl_id) ON DELETE CASCADE,
+    FOREIGN KEY (job_id) REFERENCES print_jobs(job_id) ON DELETE CASCADE,
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+ALTER TABLE stl_files
+    ADD COLUMN gcode_file_name VARCHAR(255) NULL AFTER unit_price_cents,
+    ADD COLUMN gcode_print_seconds INT NULL AFTER gcode_file_name,
+    ADD COLUMN gcode_filament_mm DECIMAL(10,1) NULL AFTER gcode_print_seconds,
+    ADD COLUMN gcode_filament_g DECIMAL(8,2) NULL AFTER gcode_filament_mm,
+    ADD COLUMN sliced_at TIMESTAMP NULL AFTER gcode_filament_g;
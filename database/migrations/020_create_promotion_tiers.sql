@@ -0,0 +1,8 @@
+CREATE TABLE promotion_tiers (
+    tier_id INT AUTO_INCREMENT PRIMARY KEY,
+    promo_id INT NOT NULL,
+    min_quantity INT NOT NULL,
+    discount_value INT NOT NULL,
+    UNIQUE KEY uq_promotion_tier (promo_id, min_quantity),
+    FOREIGN KEY (promo_id) REFERENCES promotions(promo_id) ON DELETE CASCADE
+);
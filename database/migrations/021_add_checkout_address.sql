@@ -0,0 +1,7 @@
+ALTER TABLE checkouts
+    ADD COLUMN address_1 VARCHAR(255) NULL AFTER rate_id,
+    ADD COLUMN address_2 VARCHAR(255) NULL AFTER address_1,
+    ADD COLUMN city VARCHAR(255) NULL AFTER address_2,
+    ADD COLUMN state VARCHAR(255) NULL AFTER city,
+    ADD COLUMN zipcode VARCHAR(15) NULL AFTER state,
+    ADD COLUMN country VARCHAR(2) NULL AFTER zipcode;
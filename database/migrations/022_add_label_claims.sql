@@ -0,0 +1,3 @@
+ALTER TABLE label_purchases
+    ADD COLUMN claimed_at TIMESTAMP NULL AFTER next_attempt_at,
+    ADD COLUMN claimed_shipment_id VARCHAR(255) NULL AFTER claimed_at;
@@ -0,0 +1,2 @@
+ALTER TABLE print_jobs
+    ADD COLUMN nozzle_mm DECIMAL(3,2) NULL AFTER filament_colors;
@@ -0,0 +1,3 @@
+ALTER TABLE plates
+    MODIFY COLUMN status ENUM('created', 'completed', 'failed') NOT NULL DEFAULT 'created',
+    ADD COLUMN failure_reason VARCHAR(512) NULL AFTER completed_at;
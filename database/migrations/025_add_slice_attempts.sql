@@ -0,0 +1,4 @@
+ALTER TABLE print_jobs
+    ADD COLUMN slice_attempts INT NOT NULL DEFAULT 0 AFTER nozzle_mm,
+    ADD COLUMN slice_next_attempt_at TIMESTAMP NULL AFTER slice_attempts,
+    ADD COLUMN slice_error VARCHAR(512) NULL AFTER slice_next_attempt_at;
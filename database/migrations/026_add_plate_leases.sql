@@ -0,0 +1,6 @@
+ALTER TABLE plates
+    MODIFY COLUMN status ENUM('created', 'claimed', 'printing', 'completed', 'failed') NOT NULL DEFAULT 'created',
+    ADD COLUMN worker_id VARCHAR(255) NULL AFTER status,
+    ADD COLUMN printer_id INT NULL AFTER worker_id,
+    ADD COLUMN lease_expires_at TIMESTAMP NULL AFTER printer_id,
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0 AFTER lease_expires_at;
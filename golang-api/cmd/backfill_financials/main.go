@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"go.uber.org/zap"
+)
+
+// backfill_financials writes financials rows for orders placed before they were recorded
+// at capture time, it is safe to run again since orders that already have a row are skipped
+func main() {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("could not initialize zap logger: %v", err)
+	}
+	defer logger.Sync()
+
+	config.LoadEnv()
+
+	db, err := config.ConnectDB()
+	if err != nil {
+		logger.Fatal("failed to connect to the db", zap.Error(err))
+	}
+	defer db.Close()
+
+	financials := services.NewFinancialService(db, services.NewStripeService(config.STRIPE_KEY), logger.Sugar())
+
+	recorded, err := financials.BackfillTransactions()
+	if err != nil {
+		// a non-zero exit lets the scheduler see the run failed, rerunning picks up the rest
+		logger.Fatal("some orders could not be backfilled", zap.Int("recorded", recorded), zap.Error(err))
+	}
+
+	logger.Info("financials backfilled", zap.Int("recorded", recorded))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"go.uber.org/zap"
+)
+
+// create_manifests hands the day's shipping labels off to their carriers with an EasyPost scan
+// form per carrier, it is meant to run before the pickup and only takes labels not yet handed off
+func main() {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("could not initialize zap logger: %v", err)
+	}
+	defer logger.Sync()
+
+	config.LoadEnv()
+
+	db, err := config.ConnectDB()
+	if err != nil {
+		logger.Fatal("failed to connect to the db", zap.Error(err))
+	}
+	defer db.Close()
+
+	easypostClient := services.NewEasyPostClient(config.EASYPOST_KEY)
+	if config.USE_FAKES {
+		easypostClient = services.NewFakeEasyPostClient()
+	}
+	manifests := services.NewManifestService(db, easypostClient)
+
+	created, err := manifests.CreateManifests(time.Now().UTC())
+	for _, manifest := range created {
+		logger.Info("manifest created",
+			zap.String("carrier", manifest.Carrier),
+			zap.Int("shipments", manifest.ShipmentCount),
+			zap.String("form_url", manifest.FormURL),
+		)
+	}
+	if err != nil {
+		logger.Error("some manifests could not be created", zap.Int("created", len(created)), zap.Error(err))
+		return
+	}
+
+	logger.Info("manifests created", zap.Int("created", len(created)))
+}
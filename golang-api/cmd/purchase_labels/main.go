@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"go.uber.org/zap"
+)
+
+// purchase_labels retries the deferred shipping labels EasyPost failed to sell when their
+// print job completed, it is meant to run on a schedule and only buys labels that are due
+func main() {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("could not initialize zap logger: %v", err)
+	}
+	defer logger.Sync()
+
+	config.LoadEnv()
+
+	db, err := config.ConnectDB()
+	if err != nil {
+		logger.Fatal("failed to connect to the db", zap.Error(err))
+	}
+	defer db.Close()
+
+	easypostClient := services.NewEasyPostClient(config.EASYPOST_KEY)
+	if config.USE_FAKES {
+		easypostClient = services.NewFakeEasyPostClient()
+	}
+	rateSelector, err := services.NewRateSelector(config.RATE_POLICY)
+	if err != nil {
+		logger.Fatal("invalid RATE_POLICY", zap.Error(err))
+	}
+	pricingService := services.NewPricingService(db)
+	cartService := services.NewCartService(db, pricingService)
+	orders := services.NewOrderService(
+		db,
+		easypostClient,
+		pricingService,
+		services.NewPromotionService(db, pricingService),
+		services.NewPackagingService(db, cartService, pricingService),
+		services.NewPrintScheduler(db, config.PRINTER_COUNT),
+		// buying labels never slices
+		nil,
+		rateSelector,
+		config.DEFER_LABELS,
+	)
+
+	purchased, err := orders.PurchaseQueuedLabels()
+	if err != nil {
+		logger.Fatal("some labels could not be purchased", zap.Int("purchased", purchased), zap.Error(err))
+	}
+
+	logger.Info("queued labels purchased", zap.Int("purchased", purchased))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"go.uber.org/zap"
+)
+
+// slice_jobs slices the STLs of queued print jobs so placing an order never waits on the
+// slicer, it is meant to run on a schedule and picks up files that failed on an earlier run
+func main() {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("could not initialize zap logger: %v", err)
+	}
+	defer logger.Sync()
+
+	config.LoadEnv()
+	if config.SLICER_PATH == "" && !config.USE_FAKES {
+		logger.Fatal("Environment variable missing: SLICER_PATH, set USE_FAKES=true to estimate jobs instead")
+	}
+
+	db, err := config.ConnectDB()
+	if err != nil {
+		logger.Fatal("failed to connect to the db", zap.Error(err))
+	}
+	defer db.Close()
+
+	easypostClient := services.NewEasyPostClient(config.EASYPOST_KEY)
+	if config.USE_FAKES {
+		easypostClient = services.NewFakeEasyPostClient()
+	}
+	slicer := services.NewCliSlicer(config.SLICER_ENGINE, config.SLICER_PATH, config.SLICER_CONFIG)
+	if config.USE_FAKES && config.SLICER_PATH == "" {
+		slicer = services.NewFakeSlicer()
+	}
+	rateSelector, err := services.NewRateSelector(config.RATE_POLICY)
+	if err != nil {
+		logger.Fatal("invalid RATE_POLICY", zap.Error(err))
+	}
+	pricingService := services.NewPricingService(db)
+	cartService := services.NewCartService(db, pricingService)
+	orders := services.NewOrderService(
+		db,
+		easypostClient,
+		pricingService,
+		services.NewPromotionService(db, pricingService),
+		services.NewPackagingService(db, cartService, pricingService),
+		services.NewPrintScheduler(db, config.PRINTER_COUNT),
+		slicer,
+		rateSelector,
+		config.DEFER_LABELS,
+	)
+
+	sliced, err := orders.SliceQueuedJobs()
+	if err != nil {
+		logger.Fatal("some print jobs could not be sliced", zap.Int("sliced", sliced), zap.Error(err))
+	}
+
+	logger.Info("queued print jobs sliced", zap.Int("sliced", sliced))
+}
@@ -2,19 +2,30 @@ package config
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"slices"
+	"strconv"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 
 	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
 )
 
 var (
 	STRIPE_KEY string
+	STRIPE_WEBHOOK_SECRET string
 	EASYPOST_KEY string
+	EASYPOST_WEBHOOK_SECRET string
+	DEFER_LABELS bool
+	RATE_POLICY structs.RatePolicy
+	SHIP_TO_COUNTRIES []string
+	INCOTERM string
+	CUSTOMS_SIGNER string
 	STL_S3_BUCKET string
 	S3_REGION string
 	SENDER_ADDRESS easypost.Address
@@ -24,29 +35,101 @@ var (
 	DB_PORT string
 	DB_NAME string
 	APP_ENV string
+	USE_FAKES bool
 	PORT string
+	ADMIN_TOKEN string
+	PRINTER_TOKEN string
+	PRINTER_COUNT int
+	PLATE_BED_X_MM float64
+	PLATE_BED_Y_MM float64
+	SLICER_PATH string
+	SLICER_ENGINE string
+	SLICER_CONFIG string
+	SMTP_HOST string
+	SMTP_PORT string
+	SMTP_USER string
+	SMTP_PASSWORD string
+	MAIL_FROM string
 )
 
 func LoadEnv() {
 	var exists bool
 	APP_ENV, exists = os.LookupEnv("APP_ENV")
 	if !exists {
+		log.Print("Environment variable missing: APP_ENV, running as dev")
 		APP_ENV = "dev"
 	}
 
 	ALLOWED_ENV := []string{"prod", "dev", "designs"}
 	if !slices.Contains(ALLOWED_ENV, APP_ENV) {
+		log.Printf("Invalid APP_ENV %q, expected one of %v, running as dev", APP_ENV, ALLOWED_ENV)
 		APP_ENV = "dev"
 	}
 
+	// local development runs against in-memory fakes of EasyPost and the mail relay, they
+	// have to be asked for so a missing key can't quietly fake a real deployment
+	USE_FAKES = os.Getenv("USE_FAKES") == "true"
+	if USE_FAKES && APP_ENV == "prod" {
+		log.Fatal("USE_FAKES can't be used with APP_ENV=prod")
+	}
+
 	STRIPE_KEY, exists = os.LookupEnv("STRIPE_KEY")
 	if !exists {
 		log.Fatal("Environment variable missing: STRIPE_KEY")
 	}
 
+	// webhook events fail signature verification when no secret is set
+	STRIPE_WEBHOOK_SECRET, exists = os.LookupEnv("STRIPE_WEBHOOK_SECRET")
+	if !exists {
+		log.Print("Environment variable missing: STRIPE_WEBHOOK_SECRET, Stripe webhooks are disabled")
+	}
+
 	EASYPOST_KEY, exists = os.LookupEnv("EASYPOST_KEY")
+	if USE_FAKES {
+		log.Print("USE_FAKES is set, using the local EasyPost fake")
+	} else if !exists {
+		log.Fatal("Environment variable missing: EASYPOST_KEY, set USE_FAKES=true to run against the local fake")
+	}
+
+	// tracking updates fail signature verification when no secret is set
+	EASYPOST_WEBHOOK_SECRET, exists = os.LookupEnv("EASYPOST_WEBHOOK_SECRET")
 	if !exists {
-		log.Fatal("Environment variable missing: EASYPOST_KEY")
+		log.Print("Environment variable missing: EASYPOST_WEBHOOK_SECRET, EasyPost webhooks are disabled")
+	}
+
+	// labels are bought when the print job completes instead of at checkout
+	DEFER_LABELS = os.Getenv("DEFER_LABELS") == "true"
+
+	// which label is bought for orders placed without a quoted rate, as JSON e.g.
+	// {"strategy": "preferred_carrier", "carriers": ["USPS"]}, the cheapest when unset
+	RATE_POLICY = structs.RatePolicy{}
+	if policy, exists := os.LookupEnv("RATE_POLICY"); exists {
+		if err := json.Unmarshal([]byte(policy), &RATE_POLICY); err != nil {
+			log.Fatalf("Invalid RATE_POLICY %q: %v", policy, err)
+		}
+	}
+
+	// comma separated ISO country codes, e.g. "US,CA,GB"
+	countries, exists := os.LookupEnv("SHIP_TO_COUNTRIES")
+	if !exists {
+		countries = "US"
+	}
+	SHIP_TO_COUNTRIES = nil
+	for _, country := range strings.Split(countries, ",") {
+		if country = strings.ToUpper(strings.TrimSpace(country)); country != "" {
+			SHIP_TO_COUNTRIES = append(SHIP_TO_COUNTRIES, country)
+		}
+	}
+
+	// who pays duties on international orders, DDU leaves them to the customer on delivery
+	INCOTERM, exists = os.LookupEnv("INCOTERM")
+	if !exists || !slices.Contains([]string{"DDU", "DDP"}, INCOTERM) {
+		INCOTERM = "DDU"
+	}
+
+	CUSTOMS_SIGNER, exists = os.LookupEnv("CUSTOMS_SIGNER")
+	if !exists {
+		CUSTOMS_SIGNER = "Fairway Ink"
 	}
 
 	STL_S3_BUCKET, exists = os.LookupEnv("STL_S3_BUCKET")
@@ -64,12 +147,80 @@ func LoadEnv() {
 		PORT="5000"
 	}
 
+	// admin routes reject every request when no token is set
+	ADMIN_TOKEN, exists = os.LookupEnv("ADMIN_TOKEN")
+	if !exists {
+		log.Print("Environment variable missing: ADMIN_TOKEN, admin routes are disabled")
+	}
+
+	// printer workers authenticate with their own token so they can't reach admin routes
+	PRINTER_TOKEN, exists = os.LookupEnv("PRINTER_TOKEN")
+	if !exists {
+		log.Print("Environment variable missing: PRINTER_TOKEN, printer routes are disabled")
+	}
+
+	// printers working the queue in parallel until printers register themselves, completion
+	// estimates assume one when unset
+	PRINTER_COUNT = 1
+	if printers, exists := os.LookupEnv("PRINTER_COUNT"); exists {
+		count, err := strconv.Atoi(printers)
+		if err != nil || count < 1 {
+			log.Printf("Invalid PRINTER_COUNT %q, estimating with one printer", printers)
+		} else {
+			PRINTER_COUNT = count
+		}
+	}
+
+	// bed markers are plated onto, WIDTHxDEPTH in millimetres
+	PLATE_BED_X_MM, PLATE_BED_Y_MM = 250, 210
+	if bed, exists := os.LookupEnv("PLATE_BED_SIZE"); exists {
+		x, y, found := strings.Cut(bed, "x")
+		bedX, errX := strconv.ParseFloat(x, 64)
+		bedY, errY := strconv.ParseFloat(y, 64)
+		if !found || errX != nil || errY != nil || bedX <= 0 || bedY <= 0 {
+			log.Printf("Invalid PLATE_BED_SIZE %q, plating onto 250x210", bed)
+		} else {
+			PLATE_BED_X_MM, PLATE_BED_Y_MM = bedX, bedY
+		}
+	}
+
+	// only slice_jobs and the admin slice route run the slicer, they refuse to slice without
+	// it unless USE_FAKES is set, the fake slicer only estimates
+	SLICER_PATH, _ = os.LookupEnv("SLICER_PATH")
+
+	SLICER_ENGINE, exists = os.LookupEnv("SLICER_ENGINE")
+	if !exists {
+		SLICER_ENGINE = "prusaslicer"
+	}
+
+	// printer and filament profile handed to the slicer, its own defaults are used when unset
+	SLICER_CONFIG, _ = os.LookupEnv("SLICER_CONFIG")
+
+	// order tokens are emailed to customers, they fail to send when no relay is set unless
+	// USE_FAKES is set, the local fake logs the emails instead
+	SMTP_HOST, _ = os.LookupEnv("SMTP_HOST")
+
+	SMTP_PORT, exists = os.LookupEnv("SMTP_PORT")
+	if !exists {
+		SMTP_PORT = "587"
+	}
+
+	// left unset for relays that don't authenticate
+	SMTP_USER, _ = os.LookupEnv("SMTP_USER")
+	SMTP_PASSWORD, _ = os.LookupEnv("SMTP_PASSWORD")
+
+	MAIL_FROM, exists = os.LookupEnv("MAIL_FROM")
+	if !exists {
+		MAIL_FROM = "Fairway Ink <orders@fairway-ink.com>"
+	}
+
 	SENDER_ADDRESS = easypost.Address{
 		Company: "Fairway Ink",
 		Street1: "6729 Old Stagecoach Road",
 		City: "Frazeysburg",
 		State: "OH",
 		Zip: "43822",
+		Country: "US",
 	}
 
 	DB_USER, exists = os.LookupEnv("DB_USER")
@@ -100,7 +251,8 @@ func LoadEnv() {
 func ConnectDB() (*sql.DB, error) {
 	var err error
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+	// clientFoundRows makes UPDATE report matched rather than changed rows
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&clientFoundRows=true",
 		DB_USER,
 		DB_PSWD,
 		DB_HOST,
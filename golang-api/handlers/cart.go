@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/ocamp09/fairway-ink-api/golang-api/services"
 	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
@@ -32,6 +34,11 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	}
 
 	err := h.Service.InsertCartItem(reqBody)
+	if errors.Is(err, services.ErrUnknownProduct) {
+		h.Logger.Error("Product is not for sale: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product is not for sale"})
+		return
+	}
 	if err != nil {
 		h.Logger.Error("Unable to insert into DB: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to insert into DB"})
@@ -41,3 +48,92 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	h.Logger.Info("Item successfully added to cart")
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
+
+func (h *CartHandler) GetCart(c *gin.Context) {
+	ssid := c.Param("ssid")
+
+	cart, err := h.Service.GetCartItems(ssid)
+	if err != nil {
+		h.Logger.Error("Unable to read cart from DB: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to read cart"})
+		return
+	}
+
+	h.Logger.Info("Cart successfully retrieved")
+	c.JSON(http.StatusOK, gin.H{"success": true, "cart": cart})
+}
+
+func (h *CartHandler) UpdateCartItem(c *gin.Context) {
+	ssid := c.Param("ssid")
+
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.Logger.Error("Invalid cart item id: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid cart item id"})
+		return
+	}
+
+	var reqBody struct {
+		Quantity int `json:"quantity" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&reqBody); err != nil {
+		h.Logger.Error("Invalid request body: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "A positive quantity is required"})
+		return
+	}
+
+	err = h.Service.UpdateCartItemQuantity(ssid, itemID, reqBody.Quantity)
+	if errors.Is(err, services.ErrCartItemNotFound) {
+		h.Logger.Error("Cart item not found: ", itemID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Cart item not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Error("Unable to update cart item: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to update cart item"})
+		return
+	}
+
+	h.Logger.Info("Cart item quantity updated")
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (h *CartHandler) RemoveCartItem(c *gin.Context) {
+	ssid := c.Param("ssid")
+
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.Logger.Error("Invalid cart item id: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid cart item id"})
+		return
+	}
+
+	err = h.Service.RemoveCartItem(ssid, itemID)
+	if errors.Is(err, services.ErrCartItemNotFound) {
+		h.Logger.Error("Cart item not found: ", itemID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Cart item not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Error("Unable to remove cart item: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to remove cart item"})
+		return
+	}
+
+	h.Logger.Info("Cart item removed")
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (h *CartHandler) ClearCart(c *gin.Context) {
+	ssid := c.Param("ssid")
+
+	if err := h.Service.ClearCart(ssid); err != nil {
+		h.Logger.Error("Unable to clear cart: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to clear cart"})
+		return
+	}
+
+	h.Logger.Info("Cart cleared")
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
 	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
@@ -24,7 +25,11 @@ type CartPayload struct {
 }
 
 type MockCartService struct {
-	InsertCartItemFn func(item structs.CartItem) error
+	InsertCartItemFn         func(item structs.CartItem) error
+	GetCartItemsFn           func(ssid string) ([]structs.CartItem, error)
+	UpdateCartItemQuantityFn func(ssid string, itemID int, quantity int) error
+	RemoveCartItemFn         func(ssid string, itemID int) error
+	ClearCartFn              func(ssid string) error
 }
 
 func (m *MockCartService) InsertCartItem(item structs.CartItem) error {
@@ -35,6 +40,38 @@ func (m *MockCartService) InsertCartItem(item structs.CartItem) error {
 	return nil
 }
 
+func (m *MockCartService) GetCartItems(ssid string) ([]structs.CartItem, error) {
+	if m.GetCartItemsFn != nil {
+		return m.GetCartItemsFn(ssid)
+	}
+
+	return []structs.CartItem{}, nil
+}
+
+func (m *MockCartService) UpdateCartItemQuantity(ssid string, itemID int, quantity int) error {
+	if m.UpdateCartItemQuantityFn != nil {
+		return m.UpdateCartItemQuantityFn(ssid, itemID, quantity)
+	}
+
+	return nil
+}
+
+func (m *MockCartService) RemoveCartItem(ssid string, itemID int) error {
+	if m.RemoveCartItemFn != nil {
+		return m.RemoveCartItemFn(ssid, itemID)
+	}
+
+	return nil
+}
+
+func (m *MockCartService) ClearCart(ssid string) error {
+	if m.ClearCartFn != nil {
+		return m.ClearCartFn(ssid)
+	}
+
+	return nil
+}
+
 func TestAddToCart(t *testing.T) {
 	tests := []struct{
 		desc string
@@ -154,6 +191,32 @@ func TestAddToCart(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "product not for sale",
+			request: CartPayload{
+				SSID: "1234",
+				StlURL: "example.com/test.stl",
+				Quantity: 1,
+				TemplateType: "gold",
+			},
+			mockService: func() *MockCartService {
+				return &MockCartService{
+					InsertCartItemFn: func(item structs.CartItem) error {
+						return services.ErrUnknownProduct
+					},
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+			wantSuccess: false,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level: zapcore.ErrorLevel,
+						Message: "Product is not for sale: ",
+					},
+				},
+			},
+		},
 		{
 			desc: "successful cart upload",
 			request: CartPayload{
@@ -240,4 +303,191 @@ func TestAddToCart(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestCartManagement(t *testing.T) {
+	tests := []struct {
+		desc        string
+		method      string
+		path        string
+		body        string
+		mockService *MockCartService
+		wantStatus  int
+		wantSuccess bool
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:   "get cart",
+			method: "GET",
+			path:   "/cart/1234",
+			mockService: &MockCartService{
+				GetCartItemsFn: func(ssid string) ([]structs.CartItem, error) {
+					return []structs.CartItem{{ItemID: 1, SSID: ssid, Quantity: 2, TemplateType: "solid"}}, nil
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantSuccess: true,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Cart successfully retrieved"}},
+		},
+		{
+			desc:   "get cart db failure",
+			method: "GET",
+			path:   "/cart/1234",
+			mockService: &MockCartService{
+				GetCartItemsFn: func(ssid string) ([]structs.CartItem, error) {
+					return nil, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Unable to read cart from DB: db down"}},
+		},
+		{
+			desc:   "update quantity",
+			method: "PATCH",
+			path:   "/cart/1234/items/7",
+			body:   `{"quantity": 4}`,
+			mockService: &MockCartService{
+				UpdateCartItemQuantityFn: func(ssid string, itemID int, quantity int) error {
+					if ssid != "1234" || itemID != 7 || quantity != 4 {
+						return errors.New("unexpected arguments")
+					}
+					return nil
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantSuccess: true,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Cart item quantity updated"}},
+		},
+		{
+			desc:        "update with invalid item id",
+			method:      "PATCH",
+			path:        "/cart/1234/items/abc",
+			body:        `{"quantity": 4}`,
+			mockService: &MockCartService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Invalid cart item id"}},
+		},
+		{
+			desc:        "update with zero quantity",
+			method:      "PATCH",
+			path:        "/cart/1234/items/7",
+			body:        `{"quantity": 0}`,
+			mockService: &MockCartService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Invalid request body"}},
+		},
+		{
+			desc:   "update missing item",
+			method: "PATCH",
+			path:   "/cart/1234/items/7",
+			body:   `{"quantity": 4}`,
+			mockService: &MockCartService{
+				UpdateCartItemQuantityFn: func(ssid string, itemID int, quantity int) error {
+					return services.ErrCartItemNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Cart item not found"}},
+		},
+		{
+			desc:   "remove item",
+			method: "DELETE",
+			path:   "/cart/1234/items/7",
+			mockService: &MockCartService{
+				RemoveCartItemFn: func(ssid string, itemID int) error {
+					return nil
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantSuccess: true,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Cart item removed"}},
+		},
+		{
+			desc:   "remove missing item",
+			method: "DELETE",
+			path:   "/cart/1234/items/7",
+			mockService: &MockCartService{
+				RemoveCartItemFn: func(ssid string, itemID int) error {
+					return services.ErrCartItemNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Cart item not found"}},
+		},
+		{
+			desc:   "remove item db failure",
+			method: "DELETE",
+			path:   "/cart/1234/items/7",
+			mockService: &MockCartService{
+				RemoveCartItemFn: func(ssid string, itemID int) error {
+					return errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Unable to remove cart item: db down"}},
+		},
+		{
+			desc:   "clear cart",
+			method: "DELETE",
+			path:   "/cart/1234",
+			mockService: &MockCartService{
+				ClearCartFn: func(ssid string) error {
+					return nil
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantSuccess: true,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Cart cleared"}},
+		},
+		{
+			desc:   "clear cart db failure",
+			method: "DELETE",
+			path:   "/cart/1234",
+			mockService: &MockCartService{
+				ClearCartFn: func(ssid string) error {
+					return errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Unable to clear cart: db down"}},
+		},
+	}
+
+	core, observedLogs := observer.New(zap.DebugLevel)
+	sugar := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewCartHandler(tt.mockService, sugar)
+			router.GET("/cart/:ssid", handler.GetCart)
+			router.DELETE("/cart/:ssid", handler.ClearCart)
+			router.PATCH("/cart/:ssid/items/:id", handler.UpdateCartItem)
+			router.DELETE("/cart/:ssid/items/:id", handler.RemoveCartItem)
+
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to create http request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Equal(t, tt.wantSuccess, response["success"], "Success codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level, "Log levels do not match")
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message, "Log messages do not contain expected text")
+			}
+		})
+	}
+}
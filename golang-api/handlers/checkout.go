@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,37 +11,53 @@ import (
 )
 
 type CheckoutHandler struct {
-	StripeService services.StripeService
+	Service services.CheckoutService
 	Logger *zap.SugaredLogger
 }
 
-func NewCheckoutHandler( stripeService services.StripeService, logger *zap.SugaredLogger) *CheckoutHandler {
+func NewCheckoutHandler(checkoutService services.CheckoutService, logger *zap.SugaredLogger) *CheckoutHandler {
 	return &CheckoutHandler{
-		StripeService: stripeService,
+		Service: checkoutService,
 		Logger: logger,
 	}
 }
 
 func(h *CheckoutHandler) BeginCheckout(c *gin.Context) {
-		var requestBody struct {
-		Cart []structs.CartItem `json:"cart"`
-	}
+	var requestBody structs.CheckoutRequest
 
-	if err := c.ShouldBindJSON(&requestBody); err != nil || requestBody.Cart == nil {
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
 		h.Logger.Error("Error parsing request: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "No cart provided"})
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "No browser session provided"})
 		return
 	}
+	requestBody.IdempotencyKey = c.GetHeader("Idempotency-Key")
 
-	cart := requestBody.Cart
-
-	if len(cart) == 0 {
+	intent, err := h.Service.CreateCheckout(requestBody)
+	if errors.Is(err, services.ErrEmptyCart) {
 		h.Logger.Error("Cart is empty")
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Cart is empty"})
 		return
 	}
-
-	intent, err := h.StripeService.CreatePaymentIntent(cart)
+	if errors.Is(err, services.ErrPromotionRejected) {
+		h.Logger.Errorf("promo code %q rejected: %v", requestBody.PromoCode, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrMissingAddress) {
+		h.Logger.Errorf("checkout rejected: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrCountryNotServed) {
+		h.Logger.Errorf("shipping destination rejected: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrRateNotFound) || errors.Is(err, services.ErrQuoteAddressMismatch) || errors.Is(err, services.ErrIncompleteRate) {
+		h.Logger.Errorf("shipping rate rejected: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
 	if err != nil {
 		h.Logger.Error("Error creating Stripe payment intent:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ERROR"})
@@ -48,5 +65,5 @@ func(h *CheckoutHandler) BeginCheckout(c *gin.Context) {
 	}
 
 	h.Logger.Info("Successfully created payment intent")
-	c.JSON(http.StatusOK, gin.H{"success": true, "payment_intent": intent.ID, "client_secret": intent.ClientSecret})
+	c.JSON(http.StatusOK, gin.H{"success": true, "payment_intent": intent.ID, "client_secret": intent.ClientSecret, "amount": intent.Amount})
 }
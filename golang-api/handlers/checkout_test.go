@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
 	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stripe/stripe-go/v75"
@@ -17,19 +18,46 @@ import (
 	"go.uber.org/zap/zaptest/observer"
 )
 
-func (m *MockStripeService) CreatePaymentIntent(cart []structs.CartItem) (*stripe.PaymentIntent, error) {
-	return m.CreatePaymentIntentFn(cart)
+func (m *MockStripeService) CreatePaymentIntent(amount int64, metadata map[string]string, idempotencyKey string) (*stripe.PaymentIntent, error) {
+	return m.CreatePaymentIntentFn(amount, metadata, idempotencyKey)
 }
 
+type MockCheckoutService struct {
+	CreateCheckoutFn func(request structs.CheckoutRequest) (*stripe.PaymentIntent, error)
+	VerifyCheckoutFn func(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error)
+	VoidCheckoutFn   func(intentID string, reason string) error
+}
+
+func (m *MockCheckoutService) CreateCheckout(request structs.CheckoutRequest) (*stripe.PaymentIntent, error) {
+	return m.CreateCheckoutFn(request)
+}
+
+func (m *MockCheckoutService) VerifyCheckout(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error) {
+	if m.VerifyCheckoutFn != nil {
+		return m.VerifyCheckoutFn(intent, ssid, email, address)
+	}
+
+	return structs.Checkout{PaymentIntentID: intent.ID, BrowserSSID: ssid, Total: intent.Amount}, nil
+}
+
+func (m *MockCheckoutService) VoidCheckout(intentID string, reason string) error {
+	if m.VoidCheckoutFn != nil {
+		return m.VoidCheckoutFn(intentID, reason)
+	}
+
+	return nil
+}
 
 type requestPayload struct {
-	Cart []structs.CartItem `json:"cart"`
+	BrowserSSID string `json:"browser_ssid,omitempty"`
+	Email       string `json:"email,omitempty"`
+	PromoCode   string `json:"promo_code,omitempty"`
 }
 
 type testFields struct {
 	desc string
 	request requestPayload
-	stripeService *MockStripeService
+	checkoutService *MockCheckoutService
 	wantStatus int
 	wantSuccess bool
 	wantLogs []observer.LoggedEntry
@@ -54,7 +82,7 @@ func TestPaymentIntent(t *testing.T) {
 		{
 			desc: "Empty cart",
 			request: requestPayload{
-				[]structs.CartItem{},
+				BrowserSSID: "1234",
 			},
 			wantStatus: http.StatusInternalServerError,
 			wantSuccess: false,
@@ -66,16 +94,16 @@ func TestPaymentIntent(t *testing.T) {
 					},
 				},
 			},
+			checkoutService: &MockCheckoutService{
+				CreateCheckoutFn: func(request structs.CheckoutRequest) (*stripe.PaymentIntent, error) {
+					return nil, services.ErrEmptyCart
+				},
+			},
 		},
 		{
 			desc: "Payment intent creation error",
 			request: requestPayload{
-				[]structs.CartItem{
-					{
-						Quantity: 1,
-						TemplateType: "custom",
-					},
-				},
+				BrowserSSID: "1234",
 			},
 			wantStatus: http.StatusInternalServerError,
 			wantSuccess: false,
@@ -87,30 +115,82 @@ func TestPaymentIntent(t *testing.T) {
 					},
 				},
 			},
-			stripeService: &MockStripeService{
-				CreatePaymentIntentFn: func([]structs.CartItem) (*stripe.PaymentIntent, error) {
+			checkoutService: &MockCheckoutService{
+				CreateCheckoutFn: func(request structs.CheckoutRequest) (*stripe.PaymentIntent, error) {
 					return nil, errors.New("stripe error")
 				},
 			},
 		},
 		{
-			desc: "Successful response",
+			desc: "Promo code rejected",
 			request: requestPayload{
-				[]structs.CartItem{
-					{
-						Quantity: 1,
-						TemplateType: "custom",
+				BrowserSSID: "1234",
+				Email: "golfer@example.com",
+				PromoCode: "EXPIRED",
+			},
+			wantStatus: http.StatusBadRequest,
+			wantSuccess: false,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level: zapcore.ErrorLevel,
+						Message: "promo code \"EXPIRED\" rejected",
 					},
-					{
-						Quantity: 3,
-						TemplateType: "solid",
+				},
+			},
+			checkoutService: &MockCheckoutService{
+				CreateCheckoutFn: func(request structs.CheckoutRequest) (*stripe.PaymentIntent, error) {
+					return nil, services.ErrPromotionExpired
+				},
+			},
+		},
+		{
+			desc: "Shipping rate from another quote",
+			request: requestPayload{
+				BrowserSSID: "1234",
+			},
+			wantStatus: http.StatusBadRequest,
+			wantSuccess: false,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level: zapcore.ErrorLevel,
+						Message: "shipping rate rejected",
 					},
-					{
-						Quantity: 2,
-						TemplateType: "text",
+				},
+			},
+			checkoutService: &MockCheckoutService{
+				CreateCheckoutFn: func(request structs.CheckoutRequest) (*stripe.PaymentIntent, error) {
+					return nil, services.ErrRateNotFound
+				},
+			},
+		},
+		{
+			desc: "Checkout without an address",
+			request: requestPayload{
+				BrowserSSID: "1234",
+			},
+			wantStatus: http.StatusBadRequest,
+			wantSuccess: false,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level: zapcore.ErrorLevel,
+						Message: "checkout rejected",
 					},
 				},
 			},
+			checkoutService: &MockCheckoutService{
+				CreateCheckoutFn: func(request structs.CheckoutRequest) (*stripe.PaymentIntent, error) {
+					return nil, services.ErrMissingAddress
+				},
+			},
+		},
+		{
+			desc: "Successful response",
+			request: requestPayload{
+				BrowserSSID: "1234",
+			},
 			wantStatus: http.StatusOK,
 			wantSuccess: true,
 			wantLogs: []observer.LoggedEntry{
@@ -121,11 +201,12 @@ func TestPaymentIntent(t *testing.T) {
 					},
 				},
 			},
-			stripeService: &MockStripeService{
-				CreatePaymentIntentFn: func(cart []structs.CartItem)  (*stripe.PaymentIntent, error) {
+			checkoutService: &MockCheckoutService{
+				CreateCheckoutFn: func(request structs.CheckoutRequest) (*stripe.PaymentIntent, error) {
 					return &stripe.PaymentIntent{
 						ID: "1234",
 						ClientSecret: "test_secret",
+						Amount: 8393,
 					}, nil
 				},
 			},
@@ -143,7 +224,7 @@ func TestPaymentIntent(t *testing.T) {
 
 			// set the router
 			router := gin.Default()
-			checkoutHandler := NewCheckoutHandler(tt.stripeService, sugar)
+			checkoutHandler := NewCheckoutHandler(tt.checkoutService, sugar)
 			router.POST("/create-payment-intent", checkoutHandler.BeginCheckout)
 
 			// convert payload to json
@@ -157,7 +238,7 @@ func TestPaymentIntent(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Failed to create http request: %v", err)
 			}
-			req.Header.Set("Content-TemplateType", "application/json")
+			req.Header.Set("Content-Type", "application/json")
 
 			w := httptest.NewRecorder()
 			router.ServeHTTP(w, req)
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"go.uber.org/zap"
+)
+
+const MANIFEST_DATE_FORMAT = "2006-01-02"
+
+type ManifestHandler struct {
+	Service services.ManifestService
+	Logger  *zap.SugaredLogger
+}
+
+func NewManifestHandler(service services.ManifestService, logger *zap.SugaredLogger) *ManifestHandler {
+	return &ManifestHandler{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// CreateManifests hands the day's labels off to their carriers, date is YYYY-MM-DD and
+// defaults to today. Carriers that fail are left for the next run and reported alongside
+// the manifests that were created
+func (h *ManifestHandler) CreateManifests(c *gin.Context) {
+	day := time.Now().UTC()
+	if date := c.Query("date"); date != "" {
+		var err error
+		day, err = time.Parse(MANIFEST_DATE_FORMAT, date)
+		if err != nil {
+			h.Logger.Errorf("invalid manifest date: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid date"})
+			return
+		}
+	}
+
+	manifests, err := h.Service.CreateManifests(day)
+	if err != nil && len(manifests) == 0 {
+		h.Logger.Errorf("unable to create manifests: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to create manifests"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("some manifests could not be created: %v", err)
+		c.JSON(http.StatusOK, gin.H{"success": true, "manifests": manifests, "error": "Some manifests could not be created"})
+		return
+	}
+
+	h.Logger.Infof("manifests created: date=%s, manifests=%d", day.Format(MANIFEST_DATE_FORMAT), len(manifests))
+	c.JSON(http.StatusOK, gin.H{"success": true, "manifests": manifests})
+}
+
+func (h *ManifestHandler) GetManifest(c *gin.Context) {
+	manifestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid manifest id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid manifest id"})
+		return
+	}
+
+	manifest, err := h.Service.GetManifest(manifestID)
+	if errors.Is(err, services.ErrManifestNotFound) {
+		h.Logger.Errorf("manifest not found: id=%d", manifestID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Manifest not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to get manifest: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to get manifest"})
+		return
+	}
+
+	h.Logger.Infof("manifest retrieved: id=%d", manifestID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "manifest": manifest})
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockManifestService struct {
+	CreateManifestsFn func(day time.Time) ([]structs.Manifest, error)
+	GetManifestFn     func(manifestID int64) (structs.Manifest, error)
+}
+
+func (m *MockManifestService) CreateManifests(day time.Time) ([]structs.Manifest, error) {
+	return m.CreateManifestsFn(day)
+}
+
+func (m *MockManifestService) GetManifest(manifestID int64) (structs.Manifest, error) {
+	return m.GetManifestFn(manifestID)
+}
+
+var uspsManifest = structs.Manifest{ManifestID: 2, Carrier: "USPS", ScanFormID: "sf_usps", FormURL: "https://example.com/sf_usps.pdf", Status: "created", ShipmentCount: 2}
+
+func TestCreateManifests(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc          string
+		query         string
+		mockService   *MockManifestService
+		wantStatus    int
+		wantManifests int
+		wantLog       observer.LoggedEntry
+	}{
+		{
+			desc:  "manifests the requested day",
+			query: "?date=2024-05-02",
+			mockService: &MockManifestService{
+				CreateManifestsFn: func(day time.Time) ([]structs.Manifest, error) {
+					if !day.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)) {
+						return nil, fmt.Errorf("unexpected day %s", day)
+					}
+					return []structs.Manifest{uspsManifest}, nil
+				},
+			},
+			wantStatus:    http.StatusOK,
+			wantManifests: 1,
+			wantLog:       observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "manifests created: date=2024-05-02, manifests=1"}},
+		},
+		{
+			desc: "defaults to today",
+			mockService: &MockManifestService{
+				CreateManifestsFn: func(day time.Time) ([]structs.Manifest, error) {
+					if day.Format(MANIFEST_DATE_FORMAT) != time.Now().UTC().Format(MANIFEST_DATE_FORMAT) {
+						return nil, fmt.Errorf("unexpected day %s", day)
+					}
+					return []structs.Manifest{}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "manifests created"}},
+		},
+		{
+			desc:        "invalid date",
+			query:       "?date=05/02/2024",
+			mockService: &MockManifestService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid manifest date"}},
+		},
+		{
+			desc: "some carriers fail",
+			mockService: &MockManifestService{
+				CreateManifestsFn: func(day time.Time) ([]structs.Manifest, error) {
+					return []structs.Manifest{uspsManifest}, errors.New("UPS manifest: failed to create scan form")
+				},
+			},
+			wantStatus:    http.StatusOK,
+			wantManifests: 1,
+			wantLog:       observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "some manifests could not be created"}},
+		},
+		{
+			desc: "every carrier fails",
+			mockService: &MockManifestService{
+				CreateManifestsFn: func(day time.Time) ([]structs.Manifest, error) {
+					return []structs.Manifest{}, errors.New("failed to list shipments: db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to create manifests"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewManifestHandler(tt.mockService, logger)
+			router.POST("/admin/manifests", handler.CreateManifests)
+
+			req, _ := http.NewRequest("POST", "/admin/manifests"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response struct {
+				Success   bool               `json:"success"`
+				Manifests []structs.Manifest `json:"manifests"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Equal(t, tt.wantStatus == http.StatusOK, response.Success, "Success codes do not match")
+			assert.Len(t, response.Manifests, tt.wantManifests)
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestGetManifest(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		manifestID  string
+		mockService *MockManifestService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:       "manifest found",
+			manifestID: "2",
+			mockService: &MockManifestService{
+				GetManifestFn: func(manifestID int64) (structs.Manifest, error) {
+					return uspsManifest, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "manifest retrieved: id=2"}},
+		},
+		{
+			desc:        "invalid id",
+			manifestID:  "abc",
+			mockService: &MockManifestService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid manifest id"}},
+		},
+		{
+			desc:       "manifest not found",
+			manifestID: "9",
+			mockService: &MockManifestService{
+				GetManifestFn: func(manifestID int64) (structs.Manifest, error) {
+					return structs.Manifest{}, services.ErrManifestNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "manifest not found: id=9"}},
+		},
+		{
+			desc:       "lookup fails",
+			manifestID: "2",
+			mockService: &MockManifestService{
+				GetManifestFn: func(manifestID int64) (structs.Manifest, error) {
+					return structs.Manifest{}, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to get manifest"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewManifestHandler(tt.mockService, logger)
+			router.GET("/admin/manifests/:id", handler.GetManifest)
+
+			req, _ := http.NewRequest("GET", "/admin/manifests/"+tt.manifestID, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
@@ -1,25 +1,40 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ocamp09/fairway-ink-api/golang-api/services"
 	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stripe/stripe-go/v75"
 	"go.uber.org/zap"
 )
 
 type OrderHandler struct {
-	Service       services.OrderService
-	StripeService services.StripeService
-	Logger        *zap.SugaredLogger
+	Service         services.OrderService
+	StripeService   services.StripeService
+	CheckoutService services.CheckoutService
+	Financials      services.FinancialService
+	Shipping        services.ShippingService
+	Notifications   services.NotificationService
+	WebhookSecret   string
+	Logger          *zap.SugaredLogger
 }
 
-func NewOrderHandler(orderService services.OrderService, stripeService services.StripeService, logger *zap.SugaredLogger) *OrderHandler {
+func NewOrderHandler(orderService services.OrderService, stripeService services.StripeService, checkoutService services.CheckoutService, financialService services.FinancialService, shippingService services.ShippingService, notificationService services.NotificationService, webhookSecret string, logger *zap.SugaredLogger) *OrderHandler {
 	return &OrderHandler{
-		Service:       orderService,
-		StripeService: stripeService,
-		Logger:        logger,
+		Service:         orderService,
+		StripeService:   stripeService,
+		CheckoutService: checkoutService,
+		Financials:      financialService,
+		Shipping:        shippingService,
+		Notifications:   notificationService,
+		WebhookSecret:   webhookSecret,
+		Logger:          logger,
 	}
 }
 
@@ -52,6 +67,26 @@ func (h *OrderHandler) HandleOrder(c *gin.Context) {
 		return
 	}
 
+	// the Stripe webhook may have already turned this intent into an order
+	existing, err := h.Service.GetOrderByIntent(requestBody.PaymentIntentID)
+	if err == nil {
+		existing, err = h.settleExistingOrder(intent, existing)
+		if err != nil {
+			h.Logger.Errorf("unable to settle existing order: intentID=%s: %v", requestBody.PaymentIntentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		h.Logger.Infof("Order already processed: intentID=%s", requestBody.PaymentIntentID)
+		c.JSON(http.StatusOK, gin.H{"success": true, "order": orderSummary(existing)})
+		return
+	}
+	if !errors.Is(err, services.ErrOrderNotFound) {
+		h.Logger.Errorf("unable to look up order: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to look up order"})
+		return
+	}
+
 	if intent.Status != "requires_capture" {
 		h.Logger.Errorf("payment not authorized")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment is not authorized"})
@@ -68,25 +103,378 @@ func (h *OrderHandler) HandleOrder(c *gin.Context) {
 		Address:         requestBody.Address,
 	}
 
-	orderInfo, err = h.Service.ProcessOrder(&orderInfo)
-	if err != nil {
-		h.Logger.Errorf("unable to process order: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// a bad address would otherwise only surface when the label is bought after authorization
+	if _, err := h.Shipping.VerifyAddress(orderInfo.Address); err != nil {
+		if errors.Is(err, services.ErrCountryNotServed) {
+			h.Logger.Errorf("shipping destination rejected: intentID=%s: %v", requestBody.PaymentIntentID, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var addressErr *services.AddressError
+		if errors.As(err, &addressErr) {
+			h.Logger.Errorf("undeliverable address: intentID=%s: %v", requestBody.PaymentIntentID, err)
+			respondWithAddressError(c, addressErr)
+			return
+		}
+		h.Logger.Errorf("unable to verify address: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to verify address"})
 		return
 	}
 
-	capturedIntent, err := h.StripeService.CapturePaymentIntent(requestBody.PaymentIntentID)
+	orderInfo, err = h.fulfillOrder(intent, orderInfo)
+	if errors.Is(err, errOrderPlaced) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "order": orderSummary(orderInfo)})
+		return
+	}
 	if err != nil {
-		h.Logger.Errorf("failed to capture payment: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.Logger.Error(err)
+		status := http.StatusBadRequest
+		if errors.Is(err, errCaptureFailed) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	orderInfo.PaymentStatus = string(capturedIntent.Status)
-
 	h.Logger.Infof("Order processed: intentID=%s, email=%s", requestBody.PaymentIntentID, requestBody.Email)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"order":   orderInfo,
 	})
 }
+
+// GetCustomerOrder lets a customer look their order up again with the email it was
+// placed with and the order token emailed to them when it was placed. The token is sent as
+// a bearer token, in the query string it would end up in the access log
+func (h *OrderHandler) GetCustomerOrder(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid order id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid order id"})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	order, err := h.Service.GetCustomerOrder(orderID, c.Query("email"), token)
+	h.respondWithOrder(c, orderID, order, err)
+}
+
+// ResendOrderToken emails a new order token to the address the order was placed with, the
+// response is the same whether or not the email matched so orders can't be probed
+func (h *OrderHandler) ResendOrderToken(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid order id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid order id"})
+		return
+	}
+
+	var requestBody struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		h.Logger.Errorf("invalid token request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "A valid email is required"})
+		return
+	}
+
+	order, err := h.Service.ReissueOrderToken(orderID, requestBody.Email)
+	if errors.Is(err, services.ErrOrderNotFound) {
+		h.Logger.Infof("order token not reissued, no matching order: id=%d", orderID)
+		c.JSON(http.StatusOK, gin.H{"success": true})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to reissue order token: id=%d: %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to send a new order token"})
+		return
+	}
+
+	err = h.Notifications.SendOrderToken(order)
+	if errors.Is(err, services.ErrMailerNotConfigured) {
+		h.Logger.Errorf("unable to email order token: orderID=%d: %v", orderID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "Order tokens can't be emailed right now"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to email order token: orderID=%d: %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to send a new order token"})
+		return
+	}
+
+	h.Logger.Infof("order token reissued: id=%d", orderID)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetOrder is the operator view of any order
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid order id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid order id"})
+		return
+	}
+
+	order, err := h.Service.GetOrder(orderID)
+	h.respondWithOrder(c, orderID, order, err)
+}
+
+func (h *OrderHandler) respondWithOrder(c *gin.Context, orderID int64, order structs.OrderDetails, err error) {
+	if errors.Is(err, services.ErrOrderNotFound) {
+		h.Logger.Errorf("order not found: id=%d", orderID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Order not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to get order: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to get order"})
+		return
+	}
+
+	h.Logger.Infof("order retrieved: id=%d", orderID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "order": order})
+}
+
+// CompletePrintJob is called once a job's markers are printed, orders with a deferred label
+// have it bought now. A label EasyPost won't sell yet comes back queued for a retry
+func (h *OrderHandler) CompletePrintJob(c *gin.Context) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid job id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid job id"})
+		return
+	}
+
+	label, err := h.Service.CompletePrintJob(jobID, "")
+	if errors.Is(err, services.ErrPrintJobNotFound) {
+		h.Logger.Errorf("print job not found: id=%d", jobID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Print job not found"})
+		return
+	}
+	if errors.Is(err, services.ErrJobNotHeld) {
+		h.Logger.Errorf("print job can't be completed: id=%d", jobID)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Print job is no longer open"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to complete print job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to complete print job"})
+		return
+	}
+
+	if label.LabelPurchaseID == 0 {
+		h.Logger.Infof("print job completed: id=%d", jobID)
+		c.JSON(http.StatusOK, gin.H{"success": true})
+		return
+	}
+
+	h.Logger.Infof("print job completed: id=%d, label=%s", jobID, label.Status)
+	c.JSON(http.StatusOK, gin.H{"success": true, "label": label})
+}
+
+// SliceJob slices a job's STLs now instead of waiting for slice_jobs, for jobs whose G-code
+// failed or that need it regenerated after the slicer profile changes
+func (h *OrderHandler) SliceJob(c *gin.Context) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid job id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid job id"})
+		return
+	}
+
+	files, err := h.Service.SliceJob(jobID)
+	if errors.Is(err, services.ErrPrintJobNotFound) {
+		h.Logger.Errorf("print job not found: id=%d", jobID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Print job not found"})
+		return
+	}
+	if errors.Is(err, services.ErrSlicerNotConfigured) {
+		h.Logger.Errorf("unable to slice print job: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "Slicing is unavailable"})
+		return
+	}
+
+	sliced := 0
+	for _, file := range files {
+		if file.Gcode != nil {
+			sliced++
+		}
+	}
+	if err != nil && sliced == 0 {
+		h.Logger.Errorf("unable to slice print job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to slice print job"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("some files could not be sliced: %v", err)
+		c.JSON(http.StatusOK, gin.H{"success": true, "files": files, "error": "Some files could not be sliced"})
+		return
+	}
+
+	h.Logger.Infof("print job sliced: id=%d, files=%d", jobID, sliced)
+	c.JSON(http.StatusOK, gin.H{"success": true, "files": files})
+}
+
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	var filter structs.OrderFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		h.Logger.Errorf("invalid order filter: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid order filter"})
+		return
+	}
+
+	orders, err := h.Service.ListOrders(filter)
+	if err != nil {
+		h.Logger.Errorf("unable to list orders: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to list orders"})
+		return
+	}
+
+	h.Logger.Info("orders listed")
+	c.JSON(http.StatusOK, gin.H{"success": true, "orders": orders})
+}
+
+var (
+	errCaptureFailed = errors.New("failed to capture payment")
+	// another request placed the order for this intent and owns its payment
+	errOrderPlaced = errors.New("order already placed")
+)
+
+// fulfillOrder verifies an authorized intent against its checkout, persists the order and
+// captures the payment. The browser and the Stripe webhook both go through it, if the order
+// can't be persisted the authorization is released rather than left holding the customer's funds
+func (h *OrderHandler) fulfillOrder(intent *stripe.PaymentIntent, orderInfo structs.OrderInfo) (structs.OrderInfo, error) {
+	intentID := orderInfo.PaymentIntentID
+
+	// make sure the authorized amount is the one we priced for this cart
+	checkout, err := h.CheckoutService.VerifyCheckout(intent, orderInfo.BrowserSSID, orderInfo.Email, orderInfo.Address)
+	if err != nil {
+		if isCheckoutRejection(err) {
+			h.voidPayment(intentID, err)
+		}
+		return orderInfo, fmt.Errorf("checkout verification failed: %w", err)
+	}
+
+	orderInfo.PromotionID = checkout.Discount.PromotionID
+	orderInfo.PromoCode = checkout.Discount.Code
+	orderInfo.DiscountAmount = checkout.Discount.Amount
+	orderInfo.TaxAmount = checkout.Tax
+	orderInfo.ShippingAmount = checkout.Shipping
+	orderInfo.ShipmentID = checkout.ShipmentID
+	orderInfo.RateID = checkout.RateID
+
+	orderInfo, err = h.Service.ProcessOrder(&orderInfo)
+	if err != nil {
+		// a concurrent request for the same intent may have placed the order, it owns the
+		// payment so answer with its order instead of releasing the funds
+		if existing, lookupErr := h.Service.GetOrderByIntent(intentID); lookupErr == nil {
+			h.Logger.Infof("Order placed by a concurrent request: intentID=%s", intentID)
+			return existing, errOrderPlaced
+		}
+
+		h.voidPayment(intentID, err)
+		return orderInfo, fmt.Errorf("unable to process order: %w", err)
+	}
+
+	// orders placed from the webhook never reach the browser, the email is how the
+	// customer gets their token
+	if err := h.Notifications.SendOrderToken(orderInfo); err != nil {
+		h.Logger.Errorf("unable to email order token: orderID=%d: %v", orderInfo.OrderID, err)
+	}
+
+	orderInfo.PaymentStatus, err = h.capturePayment(intentID)
+	return orderInfo, err
+}
+
+// checkoutRejections are the verification failures that can't succeed on a retry, the
+// authorization is released for them. Any other error, such as a failed tax lookup, leaves
+// it in place for the retry
+var checkoutRejections = []error{
+	services.ErrCheckoutMismatch,
+	services.ErrAmountMismatch,
+	services.ErrCartChanged,
+	services.ErrPromoEmailMismatch,
+	services.ErrTaxChanged,
+	services.ErrAddressChanged,
+}
+
+func isCheckoutRejection(err error) bool {
+	for _, rejection := range checkoutRejections {
+		if errors.Is(err, rejection) {
+			return true
+		}
+	}
+	return false
+}
+
+// settleExistingOrder captures an order that was persisted but whose capture failed, the
+// order is queued for printing either way so its authorization can't be left to expire
+func (h *OrderHandler) settleExistingOrder(intent *stripe.PaymentIntent, order structs.OrderInfo) (structs.OrderInfo, error) {
+	order.PaymentStatus = string(intent.Status)
+	if intent.Status != stripe.PaymentIntentStatusRequiresCapture {
+		return order, nil
+	}
+
+	status, err := h.capturePayment(intent.ID)
+	if err != nil {
+		return order, err
+	}
+	order.PaymentStatus = status
+	return order, nil
+}
+
+// capturePayment takes the payment for a persisted order. A failure is left for the browser
+// or the webhook to retry, the order exists so the authorization is never released here
+func (h *OrderHandler) capturePayment(intentID string) (string, error) {
+	capturedIntent, err := h.StripeService.CapturePaymentIntent(intentID)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errCaptureFailed, err)
+	}
+	status := string(capturedIntent.Status)
+
+	// the payment is already captured, the status and financials catch up on the next webhook or backfill
+	if err := h.Service.UpdatePaymentStatus(intentID, status); err != nil {
+		h.Logger.Errorf("unable to update payment status: intentID=%s: %v", intentID, err)
+	}
+	if err := h.Financials.RecordTransaction(intentID); err != nil {
+		h.Logger.Errorf("unable to record financials: intentID=%s: %v", intentID, err)
+	}
+
+	return status, nil
+}
+
+// orderSummary is all that's returned for an order found by its intent ID, holding the ID
+// isn't proof of being the purchaser so their details stay out of the response
+func orderSummary(order structs.OrderInfo) gin.H {
+	return gin.H{"order_id": order.OrderID, "payment_status": order.PaymentStatus}
+}
+
+// voidPayment gives the customer their money back after a failed order, cancelling the
+// authorization or refunding it if it was captured, and records why on the checkout
+func (h *OrderHandler) voidPayment(intentID string, cause error) {
+	intent, err := h.StripeService.GetPaymentIntent(intentID)
+	if err != nil {
+		h.Logger.Errorf("unable to release payment for failed order: intentID=%s: %v", intentID, err)
+		return
+	}
+
+	switch intent.Status {
+	case stripe.PaymentIntentStatusRequiresCapture:
+		_, err = h.StripeService.CancelPaymentIntent(intentID)
+	case stripe.PaymentIntentStatusSucceeded:
+		_, err = h.StripeService.RefundPaymentIntent(intentID)
+	default:
+		h.Logger.Infof("no payment to release: intentID=%s, status=%s", intentID, intent.Status)
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to release payment for failed order: intentID=%s: %v", intentID, err)
+		return
+	}
+
+	if err := h.CheckoutService.VoidCheckout(intentID, cause.Error()); err != nil {
+		h.Logger.Errorf("unable to record voided checkout: intentID=%s: %v", intentID, err)
+	}
+
+	h.Logger.Infof("payment released for failed order: intentID=%s, status=%s", intentID, intent.Status)
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
 	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stripe/stripe-go/v75"
@@ -20,7 +22,10 @@ import (
 type MockStripeService struct {
 	GetPaymentIntentFn     func(id string) (*stripe.PaymentIntent, error)
 	CapturePaymentIntentFn func(id string) (*stripe.PaymentIntent, error)
-	CreatePaymentIntentFn func(cart []structs.CartItem) (*stripe.PaymentIntent, error)
+	CreatePaymentIntentFn func(amount int64, metadata map[string]string, idempotencyKey string) (*stripe.PaymentIntent, error)
+	CancelPaymentIntentFn  func(id string) (*stripe.PaymentIntent, error)
+	RefundPaymentIntentFn  func(id string) (*stripe.Refund, error)
+	GetBalanceTransactionFn func(intentID string) (*stripe.BalanceTransaction, error)
 }
 
 func (m *MockStripeService) GetPaymentIntent(id string) (*stripe.PaymentIntent, error) {
@@ -31,14 +36,113 @@ func (m *MockStripeService) CapturePaymentIntent(id string) (*stripe.PaymentInte
 	return m.CapturePaymentIntentFn(id)
 }
 
+func (m *MockStripeService) CancelPaymentIntent(id string) (*stripe.PaymentIntent, error) {
+	return m.CancelPaymentIntentFn(id)
+}
+
+func (m *MockStripeService) RefundPaymentIntent(id string) (*stripe.Refund, error) {
+	return m.RefundPaymentIntentFn(id)
+}
+
+func (m *MockStripeService) GetBalanceTransaction(intentID string) (*stripe.BalanceTransaction, error) {
+	return m.GetBalanceTransactionFn(intentID)
+}
+
+type MockFinancialService struct {
+	RecordTransactionFn    func(intentID string) error
+	BackfillTransactionsFn func() (int, error)
+}
+
+func (m *MockFinancialService) RecordTransaction(intentID string) error {
+	if m.RecordTransactionFn != nil {
+		return m.RecordTransactionFn(intentID)
+	}
+
+	return nil
+}
+
+func (m *MockFinancialService) BackfillTransactions() (int, error) {
+	return m.BackfillTransactionsFn()
+}
+
+type MockNotificationService struct {
+	SendOrderTokenFn func(order structs.OrderInfo) error
+}
+
+func (m *MockNotificationService) SendOrderToken(order structs.OrderInfo) error {
+	if m.SendOrderTokenFn != nil {
+		return m.SendOrderTokenFn(order)
+	}
+
+	return nil
+}
+
 type MockOrderService struct {
-	ProcessOrderFn func(info *structs.OrderInfo) (structs.OrderInfo, error)
+	ProcessOrderFn        func(info *structs.OrderInfo) (structs.OrderInfo, error)
+	GetOrderByIntentFn    func(intentID string) (structs.OrderInfo, error)
+	UpdatePaymentStatusFn func(intentID string, status string) error
+	GetOrderFn            func(orderID int64) (structs.OrderDetails, error)
+	GetCustomerOrderFn    func(orderID int64, email string, token string) (structs.OrderDetails, error)
+	ListOrdersFn          func(filter structs.OrderFilter) ([]structs.OrderDetails, error)
+	CompletePrintJobFn    func(jobID int64, workerID string) (structs.LabelPurchase, error)
+	SliceJobFn            func(jobID int64) ([]structs.PrintFile, error)
+	SliceQueuedJobsFn     func() (int, error)
+	PurchaseQueuedLabelsFn func() (int, error)
+	ReissueOrderTokenFn   func(orderID int64, email string) (structs.OrderInfo, error)
 }
 
 func (m *MockOrderService) ProcessOrder(info *structs.OrderInfo) (structs.OrderInfo, error) {
 	return m.ProcessOrderFn(info)
 }
 
+func (m *MockOrderService) GetOrderByIntent(intentID string) (structs.OrderInfo, error) {
+	if m.GetOrderByIntentFn != nil {
+		return m.GetOrderByIntentFn(intentID)
+	}
+
+	return structs.OrderInfo{}, services.ErrOrderNotFound
+}
+
+func (m *MockOrderService) UpdatePaymentStatus(intentID string, status string) error {
+	if m.UpdatePaymentStatusFn != nil {
+		return m.UpdatePaymentStatusFn(intentID, status)
+	}
+
+	return nil
+}
+
+func (m *MockOrderService) GetOrder(orderID int64) (structs.OrderDetails, error) {
+	return m.GetOrderFn(orderID)
+}
+
+func (m *MockOrderService) GetCustomerOrder(orderID int64, email string, token string) (structs.OrderDetails, error) {
+	return m.GetCustomerOrderFn(orderID, email, token)
+}
+
+func (m *MockOrderService) ReissueOrderToken(orderID int64, email string) (structs.OrderInfo, error) {
+	return m.ReissueOrderTokenFn(orderID, email)
+}
+
+func (m *MockOrderService) ListOrders(filter structs.OrderFilter) ([]structs.OrderDetails, error) {
+	return m.ListOrdersFn(filter)
+}
+
+func (m *MockOrderService) CompletePrintJob(jobID int64, workerID string) (structs.LabelPurchase, error) {
+	return m.CompletePrintJobFn(jobID, workerID)
+}
+
+func (m *MockOrderService) SliceJob(jobID int64) ([]structs.PrintFile, error) {
+	return m.SliceJobFn(jobID)
+}
+
+func (m *MockOrderService) SliceQueuedJobs() (int, error) {
+	return m.SliceQueuedJobsFn()
+}
+
+func (m *MockOrderService) PurchaseQueuedLabels() (int, error) {
+	return m.PurchaseQueuedLabelsFn()
+}
+
 func TestHandleOrder(t *testing.T) {
 	core, observedLogs := observer.New(zap.DebugLevel)
 	logger := zap.New(core).Sugar()
@@ -50,7 +154,13 @@ func TestHandleOrder(t *testing.T) {
 		requestBody   interface{}
 		stripeService *MockStripeService
 		orderService  *MockOrderService
+		checkoutService *MockCheckoutService
+		financialService *MockFinancialService
+		shippingService *MockShippingService
+		notificationService *MockNotificationService
 		wantStatus    int
+		wantBody      string
+		notWantBody   string
 		wantLogs      []observer.LoggedEntry
 	}{
 		{
@@ -128,6 +238,119 @@ func TestHandleOrder(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "undeliverable address is rejected before the order is placed",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"name":         "John",
+				"email":        "john@example.com",
+				"address": gin.H{
+					"line1":       "123 St",
+					"city":        "City",
+					"state":       "ST",
+					"postal_code": "1234",
+					"country":     "US",
+				},
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: "pi_123", Amount: 1000, Status: "requires_capture"}, nil
+				},
+			},
+			checkoutService: &MockCheckoutService{
+				VerifyCheckoutFn: func(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error) {
+					return structs.Checkout{}, errors.New("order should not be verified")
+				},
+			},
+			shippingService: &MockShippingService{
+				VerifyAddressFn: func(address structs.AddressInfo) (structs.AddressVerification, error) {
+					verification := structs.AddressVerification{Errors: []structs.AddressFieldError{{Field: "zip", Message: "Invalid zip code"}}}
+					return verification, &services.AddressError{Verification: verification}
+				},
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "undeliverable address: intentID=pi_123: address is not deliverable: Invalid zip code",
+					},
+				},
+			},
+		},
+		{
+			desc: "address verification unavailable",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"address":      gin.H{"line1": "123 St", "postal_code": "12345", "country": "US"},
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: "pi_123", Amount: 1000, Status: "requires_capture"}, nil
+				},
+			},
+			shippingService: &MockShippingService{
+				VerifyAddressFn: func(address structs.AddressInfo) (structs.AddressVerification, error) {
+					return structs.AddressVerification{}, errors.New("easypost down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "unable to verify address: easypost down",
+					},
+				},
+			},
+		},
+		{
+			desc: "checkout verification fails",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"name":         "John",
+				"email":        "john@example.com",
+				"address": gin.H{
+					"line1":       "123 St",
+					"line2":       "",
+					"city":        "City",
+					"state":       "ST",
+					"postal_code": "12345",
+					"country":     "US",
+				},
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: "pi_123", Amount: 1000, Status: "requires_capture"}, nil
+				},
+				CancelPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "canceled"}, nil
+				},
+			},
+			checkoutService: &MockCheckoutService{
+				VerifyCheckoutFn: func(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error) {
+					return structs.Checkout{}, services.ErrAmountMismatch
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "payment released for failed order: intentID=pi_123, status=requires_capture",
+					},
+				},
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "checkout verification failed: payment amount does not match checkout total",
+					},
+				},
+			},
+		},
 		{
 			desc: "unable to process order info",
 			requestBody: gin.H{
@@ -148,14 +371,152 @@ func TestHandleOrder(t *testing.T) {
 				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
 					return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
 				},
+				CancelPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					if id != "pi_123" {
+						return nil, errors.New("canceled the wrong intent")
+					}
+					return &stripe.PaymentIntent{ID: id, Status: "canceled"}, nil
+				},
 			},
 			orderService: &MockOrderService{
 				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
 					return structs.OrderInfo{}, errors.New("db error")
 				},
 			},
+			checkoutService: &MockCheckoutService{
+				VoidCheckoutFn: func(intentID string, reason string) error {
+					if reason != "db error" {
+						return errors.New("unexpected reason")
+					}
+					return nil
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "payment released for failed order: intentID=pi_123, status=requires_capture",
+					},
+				},
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "unable to process order",
+					},
+				},
+			},
+		},
+		{
+			desc: "failed order refunds a payment captured in the meantime",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"email":        "john@example.com",
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func() func(id string) (*stripe.PaymentIntent, error) {
+					calls := 0
+					return func(id string) (*stripe.PaymentIntent, error) {
+						calls++
+						if calls == 1 {
+							return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
+						}
+						return &stripe.PaymentIntent{Amount: 1000, Status: "succeeded"}, nil
+					}
+				}(),
+				RefundPaymentIntentFn: func(id string) (*stripe.Refund, error) {
+					return &stripe.Refund{ID: "re_123"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					return *info, errors.New("failed to upload STL file")
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "status=succeeded",
+					},
+				},
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "unable to process order: failed to upload STL file",
+					},
+				},
+			},
+		},
+		{
+			desc: "concurrent request already placed the order",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"email":        "john@example.com",
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				GetOrderByIntentFn: func() func(intentID string) (structs.OrderInfo, error) {
+					calls := 0
+					return func(intentID string) (structs.OrderInfo, error) {
+						calls++
+						if calls == 1 {
+							return structs.OrderInfo{}, services.ErrOrderNotFound
+						}
+						return structs.OrderInfo{OrderID: 42, PaymentIntentID: intentID, PaymentStatus: "requires_capture", Email: "john@example.com"}, nil
+					}
+				}(),
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					return *info, errors.New("Duplicate entry 'pi_123' for key 'stripe_ssid'")
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantBody:    `"order":{"order_id":42,"payment_status":"requires_capture"}`,
+			notWantBody: "john@example.com",
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "Order placed by a concurrent request: intentID=pi_123",
+					},
+				},
+			},
+		},
+		{
+			desc: "failed order whose authorization can't be released",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"email":        "john@example.com",
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
+				},
+				CancelPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return nil, errors.New("stripe unavailable")
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					return *info, errors.New("failed to buy shipping label")
+				},
+			},
 			wantStatus: http.StatusBadRequest,
 			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "unable to release payment for failed order: intentID=pi_123: stripe unavailable",
+					},
+				},
 				{
 					Entry: zapcore.Entry{
 						Level:   zapcore.ErrorLevel,
@@ -204,47 +565,268 @@ func TestHandleOrder(t *testing.T) {
 			},
 		},
 		{
-			desc: "successfully processed order",
+			desc: "order already placed by the webhook",
 			requestBody: gin.H{
 				"intent_id":    "pi_123",
 				"browser_ssid": "ssid",
-				"name":         "John",
 				"email":        "john@example.com",
-				"address": gin.H{
-					"line1":       "123 St",
-					"line2":       "",
-					"city":        "City",
-					"state":       "ST",
-					"postal_code": "12345",
-					"country":     "US",
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Amount: 1000, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				GetOrderByIntentFn: func(intentID string) (structs.OrderInfo, error) {
+					return structs.OrderInfo{OrderID: 42, PaymentIntentID: intentID, PaymentStatus: "succeeded", Email: "john@example.com"}, nil
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantBody:    `"order":{"order_id":42,"payment_status":"succeeded"}`,
+			notWantBody: "john@example.com",
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "Order already processed: intentID=pi_123",
+					},
 				},
 			},
+		},
+		{
+			desc: "retry captures an order whose capture failed",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"email":        "john@example.com",
+			},
 			stripeService: &MockStripeService{
 				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
-					return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
+					return &stripe.PaymentIntent{ID: id, Amount: 1000, Status: "requires_capture"}, nil
 				},
 				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
-					return &stripe.PaymentIntent{Amount: 1000, Status: "succeeded"}, nil
+					return &stripe.PaymentIntent{ID: id, Amount: 1000, Status: "succeeded"}, nil
 				},
 			},
 			orderService: &MockOrderService{
-				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
-					return *info, nil
+				GetOrderByIntentFn: func(intentID string) (structs.OrderInfo, error) {
+					return structs.OrderInfo{OrderID: 42, PaymentIntentID: intentID, PaymentStatus: "requires_capture", Email: "john@example.com"}, nil
 				},
 			},
-			wantStatus: http.StatusOK,
+			wantStatus:  http.StatusOK,
+			wantBody:    `"order":{"order_id":42,"payment_status":"succeeded"}`,
+			notWantBody: "john@example.com",
 			wantLogs: []observer.LoggedEntry{
 				{
 					Entry: zapcore.Entry{
 						Level:   zapcore.InfoLevel,
-						Message: "Order processed:",
+						Message: "Order already processed: intentID=pi_123",
 					},
 				},
 			},
 		},
-	}
-
-	for _, tt := range tests {
+		{
+			desc: "retry of an order whose capture keeps failing",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"email":        "john@example.com",
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Amount: 1000, Status: "requires_capture"}, nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return nil, errors.New("stripe unavailable")
+				},
+			},
+			orderService: &MockOrderService{
+				GetOrderByIntentFn: func(intentID string) (structs.OrderInfo, error) {
+					return structs.OrderInfo{OrderID: 42, PaymentIntentID: intentID, PaymentStatus: "requires_capture"}, nil
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "unable to settle existing order: intentID=pi_123: failed to capture payment",
+					},
+				},
+			},
+		},
+		{
+			desc: "successfully processed order",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"name":         "John",
+				"email":        "john@example.com",
+				"address": gin.H{
+					"line1":       "123 St",
+					"line2":       "",
+					"city":        "City",
+					"state":       "ST",
+					"postal_code": "12345",
+					"country":     "US",
+				},
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					return *info, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "Order processed:",
+					},
+				},
+			},
+		},
+		{
+			desc: "customer can't choose the rate policy",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"name":         "John",
+				"email":        "john@example.com",
+				"address": gin.H{
+					"line1":       "123 St",
+					"city":        "City",
+					"state":       "ST",
+					"postal_code": "12345",
+					"country":     "US",
+				},
+				"rate_policy": gin.H{"strategy": "max_delivery_days", "max_delivery_days": 2},
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					if info.RatePolicy != nil {
+						return *info, fmt.Errorf("rate policy taken from the request: %+v", info.RatePolicy)
+					}
+					return *info, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "Order processed:",
+					},
+				},
+			},
+		},
+		{
+			desc: "financials failure does not fail a captured order",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"email":        "john@example.com",
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					return *info, nil
+				},
+			},
+			financialService: &MockFinancialService{
+				RecordTransactionFn: func(intentID string) error {
+					return services.ErrNoBalanceTransaction
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "unable to record financials: intentID=pi_123: payment has no settled charge",
+					},
+				},
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "Order processed:",
+					},
+				},
+			},
+		},
+		{
+			desc: "order token email failure does not fail the order",
+			requestBody: gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"email":        "john@example.com",
+			},
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "requires_capture"}, nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{Amount: 1000, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					info.OrderID = 42
+					info.OrderToken = "token123"
+					return *info, nil
+				},
+			},
+			notificationService: &MockNotificationService{
+				SendOrderTokenFn: func(order structs.OrderInfo) error {
+					if order.OrderToken != "token123" || order.Email != "john@example.com" {
+						return fmt.Errorf("unexpected order %+v", order)
+					}
+					return errors.New("relay refused connection")
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"order_token":"token123"`,
+			wantLogs: []observer.LoggedEntry{
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.ErrorLevel,
+						Message: "unable to email order token: orderID=42: relay refused connection",
+					},
+				},
+				{
+					Entry: zapcore.Entry{
+						Level:   zapcore.InfoLevel,
+						Message: "Order processed:",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
 		t.Run(tt.desc, func(t *testing.T) {
 			observedLogs.TakeAll()
 
@@ -257,7 +839,28 @@ func TestHandleOrder(t *testing.T) {
 			}
 
 			router := gin.Default()
-			handler := NewOrderHandler(tt.orderService, tt.stripeService, logger)
+			checkoutService := tt.checkoutService
+			if checkoutService == nil {
+				checkoutService = &MockCheckoutService{}
+			}
+			orderService := tt.orderService
+			if orderService == nil {
+				orderService = &MockOrderService{}
+			}
+			financialService := tt.financialService
+			if financialService == nil {
+				financialService = &MockFinancialService{}
+			}
+			shippingService := tt.shippingService
+			if shippingService == nil {
+				shippingService = &MockShippingService{}
+			}
+			notificationService := tt.notificationService
+			if notificationService == nil {
+				notificationService = &MockNotificationService{}
+			}
+
+			handler := NewOrderHandler(orderService, tt.stripeService, checkoutService, financialService, shippingService, notificationService, "", logger)
 			router.POST("/order", handler.HandleOrder)
 
 			req, _ := http.NewRequest("POST", "/order", bytes.NewReader(bodyBytes))
@@ -267,6 +870,12 @@ func TestHandleOrder(t *testing.T) {
 			router.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			if tt.wantBody != "" {
+				assert.Contains(t, w.Body.String(), tt.wantBody)
+			}
+			if tt.notWantBody != "" {
+				assert.NotContains(t, w.Body.String(), tt.notWantBody)
+			}
 
 			allLogs := observedLogs.All()
 			assert.Equal(t, len(tt.wantLogs), len(allLogs), "Log counts do not match")
@@ -281,3 +890,598 @@ func TestHandleOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleOrderRejectedCheckout(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		verifyErr   error
+		wantVoided  bool
+		wantLogs    int
+		wantMessage string
+	}{
+		{desc: "cart belongs to another browser", verifyErr: services.ErrCheckoutMismatch, wantVoided: true, wantLogs: 2},
+		{desc: "amount doesn't match the checkout", verifyErr: services.ErrAmountMismatch, wantVoided: true, wantLogs: 2},
+		{desc: "cart changed after checkout", verifyErr: services.ErrCartChanged, wantVoided: true, wantLogs: 2},
+		{desc: "promo redeemed for another email", verifyErr: services.ErrPromoEmailMismatch, wantVoided: true, wantLogs: 2},
+		{desc: "address taxed differently", verifyErr: services.ErrTaxChanged, wantVoided: true, wantLogs: 2},
+		{desc: "ships somewhere other than the quote", verifyErr: services.ErrAddressChanged, wantVoided: true, wantLogs: 2},
+		{desc: "tax lookup fails, the retry may succeed", verifyErr: errors.New("failed to calculate tax: timeout"), wantLogs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			var canceled, voidReason string
+			stripeService := &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Amount: 1000, Status: "requires_capture"}, nil
+				},
+				CancelPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					canceled = id
+					return &stripe.PaymentIntent{ID: id, Status: "canceled"}, nil
+				},
+			}
+			checkoutService := &MockCheckoutService{
+				VerifyCheckoutFn: func(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error) {
+					return structs.Checkout{}, tt.verifyErr
+				},
+				VoidCheckoutFn: func(intentID string, reason string) error {
+					voidReason = reason
+					return nil
+				},
+			}
+			orderService := &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					return structs.OrderInfo{}, errors.New("order should not be processed")
+				},
+			}
+
+			router := gin.Default()
+			handler := NewOrderHandler(orderService, stripeService, checkoutService, &MockFinancialService{}, &MockShippingService{}, &MockNotificationService{}, "", logger)
+			router.POST("/order", handler.HandleOrder)
+
+			body, _ := json.Marshal(gin.H{
+				"intent_id":    "pi_123",
+				"browser_ssid": "ssid",
+				"email":        "john@example.com",
+				"address": gin.H{
+					"line1":       "123 St",
+					"city":        "City",
+					"state":       "ST",
+					"postal_code": "12345",
+					"country":     "US",
+				},
+			})
+			req, _ := http.NewRequest("POST", "/order", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			if tt.wantVoided {
+				assert.Equal(t, "pi_123", canceled, "authorization was not released")
+				assert.Equal(t, tt.verifyErr.Error(), voidReason)
+			} else {
+				assert.Empty(t, canceled, "authorization should be kept for a retry")
+				assert.Empty(t, voidReason)
+			}
+
+			allLogs := observedLogs.All()
+			assert.Equal(t, tt.wantLogs, len(allLogs), "Log counts do not match")
+			last := allLogs[len(allLogs)-1]
+			assert.Equal(t, zapcore.ErrorLevel, last.Entry.Level)
+			assert.Contains(t, last.Entry.Message, "checkout verification failed: "+tt.verifyErr.Error())
+		})
+	}
+}
+
+func TestGetCustomerOrder(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc         string
+		url          string
+		token        string
+		orderService *MockOrderService
+		wantStatus   int
+		wantLog      string
+	}{
+		{
+			desc: "customer with email and token",
+			url:   "/orders/42?email=golfer@example.com",
+			token: "abc123",
+			orderService: &MockOrderService{
+				GetCustomerOrderFn: func(orderID int64, email string, token string) (structs.OrderDetails, error) {
+					if orderID != 42 || email != "golfer@example.com" || token != "abc123" {
+						return structs.OrderDetails{}, services.ErrOrderNotFound
+					}
+					return structs.OrderDetails{OrderID: orderID, PrintStatus: "queued", TrackingNumber: "TRACK123"}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "order retrieved: id=42",
+		},
+		{
+			desc: "wrong token",
+			url:   "/orders/42?email=golfer@example.com",
+			token: "guess",
+			orderService: &MockOrderService{
+				GetCustomerOrderFn: func(orderID int64, email string, token string) (structs.OrderDetails, error) {
+					return structs.OrderDetails{}, services.ErrOrderNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    "order not found: id=42",
+		},
+		{
+			desc: "token in the query string is ignored",
+			url:  "/orders/42?email=golfer@example.com&token=abc123",
+			orderService: &MockOrderService{
+				GetCustomerOrderFn: func(orderID int64, email string, token string) (structs.OrderDetails, error) {
+					if token != "" {
+						return structs.OrderDetails{OrderID: orderID}, nil
+					}
+					return structs.OrderDetails{}, services.ErrOrderNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    "order not found: id=42",
+		},
+		{
+			desc:       "invalid id",
+			url:        "/orders/abc",
+			wantStatus: http.StatusBadRequest,
+			wantLog:    "invalid order id",
+		},
+		{
+			desc: "lookup fails",
+			url:   "/orders/42?email=golfer@example.com",
+			token: "abc123",
+			orderService: &MockOrderService{
+				GetCustomerOrderFn: func(orderID int64, email string, token string) (structs.OrderDetails, error) {
+					return structs.OrderDetails{}, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    "unable to get order: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewOrderHandler(tt.orderService, nil, nil, nil, nil, nil, "", logger)
+			router.GET("/orders/:id", handler.GetCustomerOrder)
+
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1) {
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestResendOrderToken(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		url         string
+		body        string
+		reissueErr  error
+		sendErr     error
+		wantStatus  int
+		wantEmailed bool
+		wantLog     string
+	}{
+		{
+			desc:        "matching email gets a new token",
+			url:         "/orders/42/token",
+			body:        `{"email": "John@Example.com"}`,
+			wantStatus:  http.StatusOK,
+			wantEmailed: true,
+			wantLog:     "order token reissued: id=42",
+		},
+		{
+			desc:       "other email looks the same to the caller",
+			url:        "/orders/42/token",
+			body:       `{"email": "someone@example.com"}`,
+			reissueErr: services.ErrOrderNotFound,
+			wantStatus: http.StatusOK,
+			wantLog:    "order token not reissued, no matching order: id=42",
+		},
+		{
+			desc:       "missing email",
+			url:        "/orders/42/token",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantLog:    "invalid token request",
+		},
+		{
+			desc:       "invalid id",
+			url:        "/orders/abc/token",
+			body:       `{"email": "john@example.com"}`,
+			wantStatus: http.StatusBadRequest,
+			wantLog:    "invalid order id",
+		},
+		{
+			desc:        "email can't be sent",
+			url:         "/orders/42/token",
+			body:        `{"email": "john@example.com"}`,
+			sendErr:     errors.New("relay refused connection"),
+			wantStatus:  http.StatusInternalServerError,
+			wantEmailed: true,
+			wantLog:     "unable to email order token: orderID=42: relay refused connection",
+		},
+		{
+			desc:        "no mail relay configured",
+			url:         "/orders/42/token",
+			body:        `{"email": "john@example.com"}`,
+			sendErr:     services.ErrMailerNotConfigured,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantEmailed: true,
+			wantLog:     "unable to email order token: orderID=42: no mail relay configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			orderService := &MockOrderService{
+				ReissueOrderTokenFn: func(orderID int64, email string) (structs.OrderInfo, error) {
+					if tt.reissueErr != nil {
+						return structs.OrderInfo{}, tt.reissueErr
+					}
+					return structs.OrderInfo{OrderID: orderID, Email: "john@example.com", OrderToken: "newtoken"}, nil
+				},
+			}
+			emailed := false
+			notificationService := &MockNotificationService{
+				SendOrderTokenFn: func(order structs.OrderInfo) error {
+					emailed = order.OrderToken == "newtoken"
+					return tt.sendErr
+				},
+			}
+
+			router := gin.Default()
+			handler := NewOrderHandler(orderService, nil, nil, nil, nil, notificationService, "", logger)
+			router.POST("/orders/:id/token", handler.ResendOrderToken)
+
+			req, _ := http.NewRequest("POST", tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantEmailed, emailed)
+			assert.NotContains(t, w.Body.String(), "newtoken", "the token is only ever emailed")
+
+			allLogs := observedLogs.All()
+			if assert.NotEmpty(t, allLogs) {
+				assert.Contains(t, allLogs[len(allLogs)-1].Entry.Message, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestListOrders(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc         string
+		url          string
+		orderService *MockOrderService
+		wantStatus   int
+		wantLog      string
+	}{
+		{
+			desc: "filtered by payment status",
+			url:  "/admin/orders?payment_status=refunded&limit=10",
+			orderService: &MockOrderService{
+				ListOrdersFn: func(filter structs.OrderFilter) ([]structs.OrderDetails, error) {
+					if filter.PaymentStatus != "refunded" || filter.Limit != 10 {
+						return nil, fmt.Errorf("unexpected filter %+v", filter)
+					}
+					return []structs.OrderDetails{{OrderID: 1}}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "orders listed",
+		},
+		{
+			desc:       "limit out of range",
+			url:        "/admin/orders?limit=1000",
+			wantStatus: http.StatusBadRequest,
+			wantLog:    "invalid order filter",
+		},
+		{
+			desc: "list fails",
+			url:  "/admin/orders",
+			orderService: &MockOrderService{
+				ListOrdersFn: func(filter structs.OrderFilter) ([]structs.OrderDetails, error) {
+					return nil, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    "unable to list orders: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewOrderHandler(tt.orderService, nil, nil, nil, nil, nil, "", logger)
+			router.GET("/admin/orders", handler.ListOrders)
+
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1) {
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestCompletePrintJob(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc         string
+		url          string
+		orderService *MockOrderService
+		wantStatus   int
+		wantLog      string
+		wantBody     string
+	}{
+		{
+			desc: "deferred label bought",
+			url:  "/admin/jobs/9/complete",
+			orderService: &MockOrderService{
+				CompletePrintJobFn: func(jobID int64, workerID string) (structs.LabelPurchase, error) {
+					return structs.LabelPurchase{LabelPurchaseID: 3, OrderID: 42, Status: "purchased", Attempts: 1, TrackingNumber: "TRACK123"}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "print job completed: id=9, label=purchased",
+			wantBody:   `"tracking_number":"TRACK123"`,
+		},
+		{
+			desc: "label queued for a retry",
+			url:  "/admin/jobs/9/complete",
+			orderService: &MockOrderService{
+				CompletePrintJobFn: func(jobID int64, workerID string) (structs.LabelPurchase, error) {
+					return structs.LabelPurchase{LabelPurchaseID: 3, OrderID: 42, Status: "queued", Attempts: 1, LastError: "easypost unavailable"}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "print job completed: id=9, label=queued",
+			wantBody:   `"last_error":"easypost unavailable"`,
+		},
+		{
+			desc: "label bought at checkout",
+			url:  "/admin/jobs/9/complete",
+			orderService: &MockOrderService{
+				CompletePrintJobFn: func(jobID int64, workerID string) (structs.LabelPurchase, error) {
+					return structs.LabelPurchase{}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "print job completed: id=9",
+			wantBody:   `{"success":true}`,
+		},
+		{
+			desc:       "invalid id",
+			url:        "/admin/jobs/abc/complete",
+			wantStatus: http.StatusBadRequest,
+			wantLog:    "invalid job id",
+		},
+		{
+			desc: "no such job",
+			url:  "/admin/jobs/9/complete",
+			orderService: &MockOrderService{
+				CompletePrintJobFn: func(jobID int64, workerID string) (structs.LabelPurchase, error) {
+					return structs.LabelPurchase{}, services.ErrPrintJobNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    "print job not found: id=9",
+		},
+		{
+			desc: "job failed before it was completed",
+			url:  "/admin/jobs/9/complete",
+			orderService: &MockOrderService{
+				CompletePrintJobFn: func(jobID int64, workerID string) (structs.LabelPurchase, error) {
+					if workerID != "" {
+						return structs.LabelPurchase{}, fmt.Errorf("completed as worker %q", workerID)
+					}
+					return structs.LabelPurchase{}, services.ErrJobNotHeld
+				},
+			},
+			wantStatus: http.StatusConflict,
+			wantLog:    "print job can't be completed: id=9",
+		},
+		{
+			desc: "complete fails",
+			url:  "/admin/jobs/9/complete",
+			orderService: &MockOrderService{
+				CompletePrintJobFn: func(jobID int64, workerID string) (structs.LabelPurchase, error) {
+					return structs.LabelPurchase{}, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    "unable to complete print job: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewOrderHandler(tt.orderService, nil, nil, nil, nil, nil, "", logger)
+			router.POST("/admin/jobs/:id/complete", handler.CompletePrintJob)
+
+			req, _ := http.NewRequest("POST", tt.url, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			if tt.wantBody != "" {
+				assert.Contains(t, w.Body.String(), tt.wantBody)
+			}
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1) {
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestSliceJob(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	slicedMarker := structs.PrintFile{StlID: 1, FileName: "marker.stl", Quantity: 3, Gcode: &structs.GcodeFile{
+		GcodeMeta: structs.GcodeMeta{PrintSeconds: 600, FilamentMM: 812.5, FilamentGrams: 2.42},
+		FileName:  "marker.gcode",
+	}}
+
+	tests := []struct {
+		desc         string
+		url          string
+		orderService *MockOrderService
+		wantStatus   int
+		wantLog      string
+		wantBody     string
+	}{
+		{
+			desc: "job sliced",
+			url:  "/admin/jobs/9/slice",
+			orderService: &MockOrderService{
+				SliceJobFn: func(jobID int64) ([]structs.PrintFile, error) {
+					return []structs.PrintFile{slicedMarker}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "print job sliced: id=9, files=1",
+			wantBody:   `"print_seconds":600`,
+		},
+		{
+			desc: "some files fail",
+			url:  "/admin/jobs/9/slice",
+			orderService: &MockOrderService{
+				SliceJobFn: func(jobID int64) ([]structs.PrintFile, error) {
+					return []structs.PrintFile{slicedMarker, {StlID: 2, FileName: "logo.stl", Quantity: 1}}, errors.New("logo.stl: no extrusions")
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "some files could not be sliced: logo.stl: no extrusions",
+			wantBody:   `"error":"Some files could not be sliced"`,
+		},
+		{
+			desc:       "invalid id",
+			url:        "/admin/jobs/abc/slice",
+			wantStatus: http.StatusBadRequest,
+			wantLog:    "invalid job id",
+		},
+		{
+			desc: "no such job",
+			url:  "/admin/jobs/9/slice",
+			orderService: &MockOrderService{
+				SliceJobFn: func(jobID int64) ([]structs.PrintFile, error) {
+					return nil, services.ErrPrintJobNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    "print job not found: id=9",
+		},
+		{
+			desc: "every file fails",
+			url:  "/admin/jobs/9/slice",
+			orderService: &MockOrderService{
+				SliceJobFn: func(jobID int64) ([]structs.PrintFile, error) {
+					return []structs.PrintFile{{StlID: 1, FileName: "marker.stl", Quantity: 3}}, errors.New("marker.stl: slicer not found")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    "unable to slice print job: marker.stl: slicer not found",
+		},
+		{
+			desc: "no slicer configured",
+			url:  "/admin/jobs/9/slice",
+			orderService: &MockOrderService{
+				SliceJobFn: func(jobID int64) ([]structs.PrintFile, error) {
+					return []structs.PrintFile{{StlID: 1, FileName: "marker.stl", Quantity: 3}}, fmt.Errorf("marker.stl: %w", services.ErrSlicerNotConfigured)
+				},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantLog:    "unable to slice print job: marker.stl: no slicer configured",
+			wantBody:   `"error":"Slicing is unavailable"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewOrderHandler(tt.orderService, nil, nil, nil, nil, nil, "", logger)
+			router.POST("/admin/jobs/:id/slice", handler.SliceJob)
+
+			req, _ := http.NewRequest("POST", tt.url, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			if tt.wantBody != "" {
+				assert.Contains(t, w.Body.String(), tt.wantBody)
+			}
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1) {
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog)
+			}
+		})
+	}
+}
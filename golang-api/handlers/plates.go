@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"go.uber.org/zap"
+)
+
+type PlateHandler struct {
+	Service services.PlatingService
+	Logger  *zap.SugaredLogger
+}
+
+func NewPlateHandler(service services.PlatingService, logger *zap.SugaredLogger) *PlateHandler {
+	return &PlateHandler{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// CreatePlate combines queued markers onto one plate, the body can override the configured
+// bed size. A 204 means nothing queued fits on a plate
+func (h *PlateHandler) CreatePlate(c *gin.Context) {
+	var request structs.PlateRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		h.Logger.Errorf("invalid plate request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	plate, err := h.Service.CreatePlate(request.BedX, request.BedY)
+	if errors.Is(err, services.ErrNothingToPlate) {
+		h.Logger.Infof("no print jobs to plate")
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to create plate: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to create plate"})
+		return
+	}
+
+	h.Logger.Infof("plate created: id=%d, jobs=%d, markers=%d", plate.PlateID, len(plate.JobIDs), len(plate.Instances))
+	c.JSON(http.StatusOK, gin.H{"success": true, "plate": plate})
+}
+
+func (h *PlateHandler) GetPlate(c *gin.Context) {
+	plateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid plate id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid plate id"})
+		return
+	}
+
+	plate, err := h.Service.GetPlate(plateID)
+	if err != nil {
+		h.plateError(c, plateID, "unable to get plate", err)
+		return
+	}
+
+	h.Logger.Infof("plate retrieved: id=%d", plateID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "plate": plate})
+}
+
+// CompletePlate marks a printed plate done along with every job on it
+func (h *PlateHandler) CompletePlate(c *gin.Context) {
+	plateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid plate id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid plate id"})
+		return
+	}
+
+	plate, err := h.Service.CompletePlate(plateID)
+	if err != nil {
+		h.plateError(c, plateID, "unable to complete plate", err)
+		return
+	}
+
+	h.Logger.Infof("plate completed: id=%d, jobs=%d", plateID, len(plate.JobIDs))
+	c.JSON(http.StatusOK, gin.H{"success": true, "plate": plate})
+}
+
+// FailPlate gives up on a plate that didn't print and puts its jobs back in the queue
+func (h *PlateHandler) FailPlate(c *gin.Context) {
+	plateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid plate id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid plate id"})
+		return
+	}
+
+	var request structs.PlateFailure
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		h.Logger.Errorf("invalid plate failure: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	plate, err := h.Service.FailPlate(plateID, request.Reason)
+	if err != nil {
+		h.plateError(c, plateID, "unable to fail plate", err)
+		return
+	}
+
+	h.Logger.Infof("plate failed: id=%d, jobs=%d", plateID, len(plate.JobIDs))
+	c.JSON(http.StatusOK, gin.H{"success": true, "plate": plate})
+}
+
+// ClaimPlate hands a printer worker the next plate its printer can take along with the plate's
+// download link. Jobs on a plate are only handed out with it, so workers poll for plates as
+// well as jobs, a 204 means no plate the printer can take is waiting
+func (h *PlateHandler) ClaimPlate(c *gin.Context) {
+	var claim structs.PrintJobClaim
+	if err := c.ShouldBindJSON(&claim); err != nil {
+		h.Logger.Errorf("invalid claim request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	plate, err := h.Service.ClaimPlate(claim.WorkerID, claim.PrinterID)
+	if errors.Is(err, services.ErrNoQueuedPlates) {
+		h.Logger.Infof("no plates queued: worker=%s, printer=%d", claim.WorkerID, claim.PrinterID)
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if errors.Is(err, services.ErrPrinterNotFound) {
+		h.Logger.Errorf("printer not found: id=%d", claim.PrinterID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Printer not found"})
+		return
+	}
+	if errors.Is(err, services.ErrPrinterUnavailable) {
+		h.Logger.Errorf("printer unavailable: id=%d", claim.PrinterID)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Printer is offline or in maintenance"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to claim plate: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to claim plate"})
+		return
+	}
+
+	h.Logger.Infof("plate claimed: id=%d, worker=%s, printer=%d", plate.PlateID, claim.WorkerID, claim.PrinterID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "plate": plate})
+}
+
+func (h *PlateHandler) PlateHeartbeat(c *gin.Context) {
+	plateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid plate id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid plate id"})
+		return
+	}
+
+	var heartbeat structs.PrintJobHeartbeat
+	if err := c.ShouldBindJSON(&heartbeat); err != nil {
+		h.Logger.Errorf("invalid heartbeat request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	plate, err := h.Service.PlateHeartbeat(plateID, heartbeat.WorkerID)
+	if err != nil {
+		h.plateError(c, plateID, "unable to extend plate lease", err)
+		return
+	}
+
+	h.Logger.Debugf("plate lease extended: id=%d, worker=%s", plateID, heartbeat.WorkerID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "plate": plate})
+}
+
+// UpdatePlate records a worker starting, finishing or failing a plate it holds
+func (h *PlateHandler) UpdatePlate(c *gin.Context) {
+	plateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid plate id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid plate id"})
+		return
+	}
+
+	var update structs.PrintJobUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		h.Logger.Errorf("invalid plate update: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	plate, err := h.Service.UpdatePlate(plateID, update)
+	if err != nil {
+		h.plateError(c, plateID, "unable to update plate", err)
+		return
+	}
+
+	h.Logger.Infof("plate updated: id=%d, worker=%s, status=%s", plateID, update.WorkerID, plate.Status)
+	c.JSON(http.StatusOK, gin.H{"success": true, "plate": plate})
+}
+
+// PlateFiles refreshes the download link of a plate once the old one has expired
+func (h *PlateHandler) PlateFiles(c *gin.Context) {
+	plateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid plate id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid plate id"})
+		return
+	}
+
+	plate, err := h.Service.PlateFiles(plateID)
+	if err != nil {
+		h.plateError(c, plateID, "unable to sign plate", err)
+		return
+	}
+
+	h.Logger.Infof("plate files listed: id=%d", plateID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "plate": plate})
+}
+
+func (h *PlateHandler) plateError(c *gin.Context, plateID int64, message string, err error) {
+	if errors.Is(err, services.ErrPlateNotFound) {
+		h.Logger.Errorf("plate not found: id=%d", plateID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Plate not found"})
+		return
+	}
+	if errors.Is(err, services.ErrPlateClosed) {
+		h.Logger.Errorf("plate already closed: id=%d", plateID)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Plate is already completed or failed"})
+		return
+	}
+	if errors.Is(err, services.ErrPlateNotHeld) {
+		h.Logger.Errorf("plate not held: id=%d", plateID)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Plate is held by another worker"})
+		return
+	}
+
+	h.Logger.Errorf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to process plate"})
+}
@@ -0,0 +1,502 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockPlatingService struct {
+	CreatePlateFn   func(bedX, bedY float64) (structs.Plate, error)
+	GetPlateFn      func(plateID int64) (structs.Plate, error)
+	CompletePlateFn func(plateID int64) (structs.Plate, error)
+	FailPlateFn     func(plateID int64, reason string) (structs.Plate, error)
+	ClaimPlateFn    func(workerID string, printerID int64) (structs.Plate, error)
+	HeartbeatFn     func(plateID int64, workerID string) (structs.Plate, error)
+	UpdatePlateFn   func(plateID int64, update structs.PrintJobUpdate) (structs.Plate, error)
+	PlateFilesFn    func(plateID int64) (structs.Plate, error)
+}
+
+func (m *MockPlatingService) CreatePlate(bedX, bedY float64) (structs.Plate, error) {
+	return m.CreatePlateFn(bedX, bedY)
+}
+
+func (m *MockPlatingService) GetPlate(plateID int64) (structs.Plate, error) {
+	return m.GetPlateFn(plateID)
+}
+
+func (m *MockPlatingService) CompletePlate(plateID int64) (structs.Plate, error) {
+	return m.CompletePlateFn(plateID)
+}
+
+func (m *MockPlatingService) FailPlate(plateID int64, reason string) (structs.Plate, error) {
+	return m.FailPlateFn(plateID, reason)
+}
+
+func (m *MockPlatingService) ClaimPlate(workerID string, printerID int64) (structs.Plate, error) {
+	return m.ClaimPlateFn(workerID, printerID)
+}
+
+func (m *MockPlatingService) PlateHeartbeat(plateID int64, workerID string) (structs.Plate, error) {
+	return m.HeartbeatFn(plateID, workerID)
+}
+
+func (m *MockPlatingService) UpdatePlate(plateID int64, update structs.PrintJobUpdate) (structs.Plate, error) {
+	return m.UpdatePlateFn(plateID, update)
+}
+
+func (m *MockPlatingService) PlateFiles(plateID int64) (structs.Plate, error) {
+	return m.PlateFilesFn(plateID)
+}
+
+var testPlate = structs.Plate{
+	PlateID: 12, Status: "created", BedX: 250, BedY: 210, FileName: "plate-12.stl", JobIDs: []int64{1, 3},
+	Instances: []structs.PlateInstance{
+		{JobID: 1, OrderID: 4, StlID: 1, FileName: "marker.stl", Copy: 1},
+		{JobID: 3, OrderID: 6, StlID: 3, FileName: "logo.stl", Copy: 1, X: 15},
+	},
+}
+
+func TestCreatePlate(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		body        string
+		mockService *MockPlatingService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc: "plate created on the configured bed",
+			mockService: &MockPlatingService{
+				CreatePlateFn: func(bedX, bedY float64) (structs.Plate, error) {
+					if bedX != 0 || bedY != 0 {
+						return structs.Plate{}, errors.New("unexpected bed size")
+					}
+					return testPlate, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "plate created: id=12, jobs=2, markers=2"}},
+		},
+		{
+			desc: "bed size overridden",
+			body: `{"bed_x_mm": 180, "bed_y_mm": 180}`,
+			mockService: &MockPlatingService{
+				CreatePlateFn: func(bedX, bedY float64) (structs.Plate, error) {
+					if bedX != 180 || bedY != 180 {
+						return structs.Plate{}, errors.New("unexpected bed size")
+					}
+					return testPlate, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "plate created: id=12"}},
+		},
+		{
+			desc:        "invalid bed size",
+			body:        `{"bed_x_mm": -1}`,
+			mockService: &MockPlatingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid plate request"}},
+		},
+		{
+			desc: "nothing to plate",
+			mockService: &MockPlatingService{
+				CreatePlateFn: func(bedX, bedY float64) (structs.Plate, error) {
+					return structs.Plate{}, services.ErrNothingToPlate
+				},
+			},
+			wantStatus: http.StatusNoContent,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "no print jobs to plate"}},
+		},
+		{
+			desc: "plating fails",
+			mockService: &MockPlatingService{
+				CreatePlateFn: func(bedX, bedY float64) (structs.Plate, error) {
+					return structs.Plate{}, errors.New("failed to save plate: disk full")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to create plate"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPlateHandler(tt.mockService, logger)
+			router.POST("/admin/plates", handler.CreatePlate)
+
+			req, _ := http.NewRequest("POST", "/admin/plates", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestCompletePlate(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		plateID     string
+		mockService *MockPlatingService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:    "plate completed",
+			plateID: "12",
+			mockService: &MockPlatingService{
+				CompletePlateFn: func(plateID int64) (structs.Plate, error) {
+					plate := testPlate
+					plate.Status = "completed"
+					return plate, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "plate completed: id=12, jobs=2"}},
+		},
+		{
+			desc:        "invalid id",
+			plateID:     "abc",
+			mockService: &MockPlatingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid plate id"}},
+		},
+		{
+			desc:    "plate not found",
+			plateID: "9",
+			mockService: &MockPlatingService{
+				CompletePlateFn: func(plateID int64) (structs.Plate, error) {
+					return structs.Plate{}, services.ErrPlateNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "plate not found: id=9"}},
+		},
+		{
+			desc:    "a job fails to complete",
+			plateID: "12",
+			mockService: &MockPlatingService{
+				CompletePlateFn: func(plateID int64) (structs.Plate, error) {
+					return structs.Plate{}, errors.New("print job 3: db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to complete plate"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPlateHandler(tt.mockService, logger)
+			router.POST("/admin/plates/:id/complete", handler.CompletePlate)
+
+			req, _ := http.NewRequest("POST", "/admin/plates/"+tt.plateID+"/complete", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestFailPlate(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		plateID     string
+		body        string
+		mockService *MockPlatingService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:    "plate failed with a reason",
+			plateID: "12",
+			body:    `{"reason": "spaghetti on the second layer"}`,
+			mockService: &MockPlatingService{
+				FailPlateFn: func(plateID int64, reason string) (structs.Plate, error) {
+					if reason != "spaghetti on the second layer" {
+						return structs.Plate{}, errors.New("unexpected reason")
+					}
+					plate := testPlate
+					plate.Status = "failed"
+					plate.FailureReason = reason
+					return plate, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "plate failed: id=12, jobs=2"}},
+		},
+		{
+			desc:    "plate failed without a reason",
+			plateID: "12",
+			mockService: &MockPlatingService{
+				FailPlateFn: func(plateID int64, reason string) (structs.Plate, error) {
+					plate := testPlate
+					plate.Status = "failed"
+					return plate, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "plate failed: id=12"}},
+		},
+		{
+			desc:        "invalid id",
+			plateID:     "abc",
+			mockService: &MockPlatingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid plate id"}},
+		},
+		{
+			desc:        "reason too long",
+			plateID:     "12",
+			body:        `{"reason": "` + strings.Repeat("x", 513) + `"}`,
+			mockService: &MockPlatingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid plate failure"}},
+		},
+		{
+			desc:    "plate already completed",
+			plateID: "12",
+			mockService: &MockPlatingService{
+				FailPlateFn: func(plateID int64, reason string) (structs.Plate, error) {
+					return structs.Plate{}, services.ErrPlateClosed
+				},
+			},
+			wantStatus: http.StatusConflict,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "plate already closed: id=12"}},
+		},
+		{
+			desc:    "plate not found",
+			plateID: "9",
+			mockService: &MockPlatingService{
+				FailPlateFn: func(plateID int64, reason string) (structs.Plate, error) {
+					return structs.Plate{}, services.ErrPlateNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "plate not found: id=9"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPlateHandler(tt.mockService, logger)
+			router.POST("/admin/plates/:id/fail", handler.FailPlate)
+
+			req, _ := http.NewRequest("POST", "/admin/plates/"+tt.plateID+"/fail", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestClaimPlate(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		body        string
+		mockService *MockPlatingService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc: "plate claimed",
+			body: `{"worker_id": "printer-1", "printer_id": 1}`,
+			mockService: &MockPlatingService{
+				ClaimPlateFn: func(workerID string, printerID int64) (structs.Plate, error) {
+					plate := testPlate
+					plate.Status = "claimed"
+					plate.WorkerID = workerID
+					plate.DownloadURL = "https://bucket.example.com/plates/plate-12.stl?signed"
+					return plate, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "plate claimed: id=12, worker=printer-1, printer=1"}},
+		},
+		{
+			desc: "nothing to print",
+			body: `{"worker_id": "printer-1", "printer_id": 1}`,
+			mockService: &MockPlatingService{
+				ClaimPlateFn: func(workerID string, printerID int64) (structs.Plate, error) {
+					return structs.Plate{}, services.ErrNoQueuedPlates
+				},
+			},
+			wantStatus: http.StatusNoContent,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "no plates queued"}},
+		},
+		{
+			desc: "printer unavailable",
+			body: `{"worker_id": "printer-1", "printer_id": 2}`,
+			mockService: &MockPlatingService{
+				ClaimPlateFn: func(workerID string, printerID int64) (structs.Plate, error) {
+					return structs.Plate{}, services.ErrPrinterUnavailable
+				},
+			},
+			wantStatus: http.StatusConflict,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "printer unavailable: id=2"}},
+		},
+		{
+			desc:        "missing worker",
+			body:        `{"printer_id": 1}`,
+			mockService: &MockPlatingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid claim request"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPlateHandler(tt.mockService, logger)
+			router.POST("/printer/plates/claim", handler.ClaimPlate)
+
+			req, _ := http.NewRequest("POST", "/printer/plates/claim", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestUpdatePlate(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		plateID     string
+		body        string
+		mockService *MockPlatingService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:    "plate completed by its worker",
+			plateID: "12",
+			body:    `{"worker_id": "printer-1", "status": "completed"}`,
+			mockService: &MockPlatingService{
+				UpdatePlateFn: func(plateID int64, update structs.PrintJobUpdate) (structs.Plate, error) {
+					plate := testPlate
+					plate.Status = update.Status
+					return plate, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "plate updated: id=12, worker=printer-1, status=completed"}},
+		},
+		{
+			desc:    "plate held by another worker",
+			plateID: "12",
+			body:    `{"worker_id": "printer-1", "status": "printing"}`,
+			mockService: &MockPlatingService{
+				UpdatePlateFn: func(plateID int64, update structs.PrintJobUpdate) (structs.Plate, error) {
+					return structs.Plate{}, services.ErrPlateNotHeld
+				},
+			},
+			wantStatus: http.StatusConflict,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "plate not held: id=12"}},
+		},
+		{
+			desc:        "unknown status",
+			plateID:     "12",
+			body:        `{"worker_id": "printer-1", "status": "queued"}`,
+			mockService: &MockPlatingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid plate update"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPlateHandler(tt.mockService, logger)
+			router.POST("/printer/plates/:id/status", handler.UpdatePlate)
+
+			req, _ := http.NewRequest("POST", "/printer/plates/"+tt.plateID+"/status", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"go.uber.org/zap"
+)
+
+type PrintQueueHandler struct {
+	Service services.PrintQueueService
+	Logger  *zap.SugaredLogger
+}
+
+func NewPrintQueueHandler(service services.PrintQueueService, logger *zap.SugaredLogger) *PrintQueueHandler {
+	return &PrintQueueHandler{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// ClaimJob hands a printer worker the next job its printer can take along with its file links,
+// workers that find nothing they can print get a 204 and poll again later
+func (h *PrintQueueHandler) ClaimJob(c *gin.Context) {
+	var claim structs.PrintJobClaim
+	if err := c.ShouldBindJSON(&claim); err != nil {
+		h.Logger.Errorf("invalid claim request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	job, err := h.Service.ClaimJob(claim.WorkerID, claim.PrinterID)
+	if errors.Is(err, services.ErrNoQueuedJobs) {
+		h.Logger.Infof("no print jobs queued: worker=%s, printer=%d", claim.WorkerID, claim.PrinterID)
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if errors.Is(err, services.ErrPrinterNotFound) {
+		h.Logger.Errorf("printer not found: id=%d", claim.PrinterID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Printer not found"})
+		return
+	}
+	if errors.Is(err, services.ErrPrinterUnavailable) {
+		h.Logger.Errorf("printer unavailable: id=%d", claim.PrinterID)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Printer is offline or in maintenance"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to claim print job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to claim print job"})
+		return
+	}
+
+	h.Logger.Infof("print job claimed: id=%d, worker=%s, printer=%d", job.JobID, claim.WorkerID, claim.PrinterID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "job": job})
+}
+
+func (h *PrintQueueHandler) Heartbeat(c *gin.Context) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid job id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid job id"})
+		return
+	}
+
+	var heartbeat structs.PrintJobHeartbeat
+	if err := c.ShouldBindJSON(&heartbeat); err != nil {
+		h.Logger.Errorf("invalid heartbeat request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	job, err := h.Service.Heartbeat(jobID, heartbeat.WorkerID)
+	if err != nil {
+		h.jobError(c, jobID, "unable to extend print job lease", err)
+		return
+	}
+
+	h.Logger.Debugf("print job lease extended: id=%d, worker=%s", jobID, heartbeat.WorkerID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "job": job})
+}
+
+// UpdateJob records a worker starting, finishing or failing a job it holds
+func (h *PrintQueueHandler) UpdateJob(c *gin.Context) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid job id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid job id"})
+		return
+	}
+
+	var update structs.PrintJobUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		h.Logger.Errorf("invalid print job update: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	job, err := h.Service.UpdateJob(jobID, update)
+	if err != nil {
+		h.jobError(c, jobID, "unable to update print job", err)
+		return
+	}
+
+	h.Logger.Infof("print job updated: id=%d, worker=%s, status=%s", jobID, update.WorkerID, job.Status)
+	c.JSON(http.StatusOK, gin.H{"success": true, "job": job})
+}
+
+// JobFiles refreshes the download links of a job's STL files once the old ones have expired
+func (h *PrintQueueHandler) JobFiles(c *gin.Context) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid job id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid job id"})
+		return
+	}
+
+	files, err := h.Service.JobFiles(jobID)
+	if err != nil {
+		h.jobError(c, jobID, "unable to list print job files", err)
+		return
+	}
+
+	h.Logger.Infof("print job files listed: id=%d, files=%d", jobID, len(files))
+	c.JSON(http.StatusOK, gin.H{"success": true, "files": files})
+}
+
+func (h *PrintQueueHandler) jobError(c *gin.Context, jobID int64, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrPrintJobNotFound):
+		h.Logger.Errorf("print job not found: id=%d", jobID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Print job not found"})
+	case errors.Is(err, services.ErrJobNotHeld):
+		h.Logger.Errorf("print job not held: id=%d", jobID)
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Print job is held by another worker"})
+	default:
+		h.Logger.Errorf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to process print job"})
+	}
+}
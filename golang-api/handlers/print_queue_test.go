@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockPrintQueueService struct {
+	ClaimJobFn  func(workerID string, printerID int64) (structs.PrintJob, error)
+	HeartbeatFn func(jobID int64, workerID string) (structs.PrintJob, error)
+	UpdateJobFn func(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error)
+	JobFilesFn  func(jobID int64) ([]structs.PrintFile, error)
+}
+
+func (m *MockPrintQueueService) ClaimJob(workerID string, printerID int64) (structs.PrintJob, error) {
+	return m.ClaimJobFn(workerID, printerID)
+}
+
+func (m *MockPrintQueueService) Heartbeat(jobID int64, workerID string) (structs.PrintJob, error) {
+	return m.HeartbeatFn(jobID, workerID)
+}
+
+func (m *MockPrintQueueService) UpdateJob(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error) {
+	return m.UpdateJobFn(jobID, update)
+}
+
+func (m *MockPrintQueueService) JobFiles(jobID int64) ([]structs.PrintFile, error) {
+	return m.JobFilesFn(jobID)
+}
+
+var markerFile = structs.PrintFile{StlID: 1, FileName: "marker.stl", Quantity: 3, DownloadURL: "https://bucket.example.com/ssid/marker.stl?signed"}
+
+func TestClaimPrintJob(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		body        string
+		mockService *MockPrintQueueService
+		wantStatus  int
+		wantFiles   int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc: "job claimed",
+			body: `{"worker_id": "printer-1", "printer_id": 1}`,
+			mockService: &MockPrintQueueService{
+				ClaimJobFn: func(workerID string, printerID int64) (structs.PrintJob, error) {
+					return structs.PrintJob{JobID: 9, OrderID: 4, Status: "claimed", WorkerID: workerID, PrinterID: printerID, Files: []structs.PrintFile{markerFile}}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantFiles:  1,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "print job claimed: id=9, worker=printer-1, printer=1"}},
+		},
+		{
+			desc: "queue is empty",
+			body: `{"worker_id": "printer-1", "printer_id": 1}`,
+			mockService: &MockPrintQueueService{
+				ClaimJobFn: func(workerID string, printerID int64) (structs.PrintJob, error) {
+					return structs.PrintJob{}, services.ErrNoQueuedJobs
+				},
+			},
+			wantStatus: http.StatusNoContent,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "no print jobs queued: worker=printer-1, printer=1"}},
+		},
+		{
+			desc: "printer isn't registered",
+			body: `{"worker_id": "printer-1", "printer_id": 3}`,
+			mockService: &MockPrintQueueService{
+				ClaimJobFn: func(workerID string, printerID int64) (structs.PrintJob, error) {
+					return structs.PrintJob{}, services.ErrPrinterNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "printer not found: id=3"}},
+		},
+		{
+			desc: "printer is in maintenance",
+			body: `{"worker_id": "printer-1", "printer_id": 2}`,
+			mockService: &MockPrintQueueService{
+				ClaimJobFn: func(workerID string, printerID int64) (structs.PrintJob, error) {
+					return structs.PrintJob{}, services.ErrPrinterUnavailable
+				},
+			},
+			wantStatus: http.StatusConflict,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "printer unavailable: id=2"}},
+		},
+		{
+			desc:        "missing printer id",
+			body:        `{"worker_id": "printer-1"}`,
+			mockService: &MockPrintQueueService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid claim request"}},
+		},
+		{
+			desc: "claim fails",
+			body: `{"worker_id": "printer-1", "printer_id": 1}`,
+			mockService: &MockPrintQueueService{
+				ClaimJobFn: func(workerID string, printerID int64) (structs.PrintJob, error) {
+					return structs.PrintJob{}, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to claim print job"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPrintQueueHandler(tt.mockService, logger)
+			router.POST("/printer/jobs/claim", handler.ClaimJob)
+
+			req, _ := http.NewRequest("POST", "/printer/jobs/claim", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response struct {
+				Job structs.PrintJob `json:"job"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Len(t, response.Job.Files, tt.wantFiles)
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestUpdatePrintJob(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		jobID       string
+		body        string
+		mockService *MockPrintQueueService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:  "job started",
+			jobID: "9",
+			body:  `{"worker_id": "printer-1", "status": "printing"}`,
+			mockService: &MockPrintQueueService{
+				UpdateJobFn: func(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error) {
+					return structs.PrintJob{JobID: jobID, Status: update.Status, WorkerID: update.WorkerID}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "print job updated: id=9, worker=printer-1, status=printing"}},
+		},
+		{
+			desc:  "failed job requeued",
+			jobID: "9",
+			body:  `{"worker_id": "printer-1", "status": "failed", "reason": "bed adhesion", "requeue": true}`,
+			mockService: &MockPrintQueueService{
+				UpdateJobFn: func(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error) {
+					if !update.Requeue || update.Reason != "bed adhesion" {
+						return structs.PrintJob{}, errors.New("unexpected update")
+					}
+					return structs.PrintJob{JobID: jobID, Status: "queued"}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "print job updated: id=9, worker=printer-1, status=queued"}},
+		},
+		{
+			desc:        "unknown status",
+			jobID:       "9",
+			body:        `{"worker_id": "printer-1", "status": "claimed"}`,
+			mockService: &MockPrintQueueService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid print job update"}},
+		},
+		{
+			desc:        "invalid id",
+			jobID:       "abc",
+			body:        `{"worker_id": "printer-1", "status": "printing"}`,
+			mockService: &MockPrintQueueService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid job id"}},
+		},
+		{
+			desc:  "lease lost to another worker",
+			jobID: "9",
+			body:  `{"worker_id": "printer-1", "status": "completed"}`,
+			mockService: &MockPrintQueueService{
+				UpdateJobFn: func(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error) {
+					return structs.PrintJob{}, services.ErrJobNotHeld
+				},
+			},
+			wantStatus: http.StatusConflict,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "print job not held: id=9"}},
+		},
+		{
+			desc:  "job not found",
+			jobID: "9",
+			body:  `{"worker_id": "printer-1", "status": "completed"}`,
+			mockService: &MockPrintQueueService{
+				UpdateJobFn: func(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error) {
+					return structs.PrintJob{}, services.ErrPrintJobNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "print job not found: id=9"}},
+		},
+		{
+			desc:  "update fails",
+			jobID: "9",
+			body:  `{"worker_id": "printer-1", "status": "completed"}`,
+			mockService: &MockPrintQueueService{
+				UpdateJobFn: func(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error) {
+					return structs.PrintJob{}, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to update print job"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPrintQueueHandler(tt.mockService, logger)
+			router.POST("/printer/jobs/:id/status", handler.UpdateJob)
+
+			req, _ := http.NewRequest("POST", "/printer/jobs/"+tt.jobID+"/status", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestPrintJobFiles(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		mockService *MockPrintQueueService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc: "links refreshed",
+			mockService: &MockPrintQueueService{
+				JobFilesFn: func(jobID int64) ([]structs.PrintFile, error) {
+					return []structs.PrintFile{markerFile}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "print job files listed: id=9, files=1"}},
+		},
+		{
+			desc: "job not found",
+			mockService: &MockPrintQueueService{
+				JobFilesFn: func(jobID int64) ([]structs.PrintFile, error) {
+					return nil, services.ErrPrintJobNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "print job not found: id=9"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPrintQueueHandler(tt.mockService, logger)
+			router.GET("/printer/jobs/:id/files", handler.JobFiles)
+
+			req, _ := http.NewRequest("GET", "/printer/jobs/9/files", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
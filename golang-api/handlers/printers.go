@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"go.uber.org/zap"
+)
+
+type PrinterHandler struct {
+	Service services.PrinterService
+	Logger  *zap.SugaredLogger
+}
+
+func NewPrinterHandler(service services.PrinterService, logger *zap.SugaredLogger) *PrinterHandler {
+	return &PrinterHandler{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// RegisterPrinter adds a printer to the fleet when it boots, registering under a known name
+// updates that printer
+func (h *PrinterHandler) RegisterPrinter(c *gin.Context) {
+	var printer structs.Printer
+	if err := c.ShouldBindJSON(&printer); err != nil {
+		h.Logger.Errorf("invalid printer registration: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	printer, err := h.Service.RegisterPrinter(printer)
+	if err != nil {
+		h.Logger.Errorf("unable to register printer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to register printer"})
+		return
+	}
+
+	h.Logger.Infof("printer registered: id=%d, name=%s", printer.PrinterID, printer.Name)
+	c.JSON(http.StatusOK, gin.H{"success": true, "printer": printer})
+}
+
+// Heartbeat records a printer's status and any spools it has swapped since it last checked in
+func (h *PrinterHandler) Heartbeat(c *gin.Context) {
+	printerID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid printer id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid printer id"})
+		return
+	}
+
+	var heartbeat structs.PrinterHeartbeat
+	if err := c.ShouldBindJSON(&heartbeat); err != nil {
+		h.Logger.Errorf("invalid printer heartbeat: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	printer, err := h.Service.PrinterHeartbeat(printerID, heartbeat)
+	if errors.Is(err, services.ErrPrinterNotFound) {
+		h.Logger.Errorf("printer not found: id=%d", printerID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Printer not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to update printer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to update printer"})
+		return
+	}
+
+	h.Logger.Debugf("printer heartbeat: id=%d, status=%s", printerID, printer.Status)
+	c.JSON(http.StatusOK, gin.H{"success": true, "printer": printer})
+}
+
+func (h *PrinterHandler) ListPrinters(c *gin.Context) {
+	printers, err := h.Service.ListPrinters()
+	if err != nil {
+		h.Logger.Errorf("unable to list printers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to list printers"})
+		return
+	}
+
+	h.Logger.Infof("printers listed: printers=%d", len(printers))
+	c.JSON(http.StatusOK, gin.H{"success": true, "printers": printers})
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockPrinterService struct {
+	RegisterPrinterFn  func(printer structs.Printer) (structs.Printer, error)
+	PrinterHeartbeatFn func(printerID int64, heartbeat structs.PrinterHeartbeat) (structs.Printer, error)
+	GetPrinterFn       func(printerID int64) (structs.Printer, error)
+	ListPrintersFn     func() ([]structs.Printer, error)
+}
+
+func (m *MockPrinterService) RegisterPrinter(printer structs.Printer) (structs.Printer, error) {
+	return m.RegisterPrinterFn(printer)
+}
+
+func (m *MockPrinterService) PrinterHeartbeat(printerID int64, heartbeat structs.PrinterHeartbeat) (structs.Printer, error) {
+	return m.PrinterHeartbeatFn(printerID, heartbeat)
+}
+
+func (m *MockPrinterService) GetPrinter(printerID int64) (structs.Printer, error) {
+	return m.GetPrinterFn(printerID)
+}
+
+func (m *MockPrinterService) ListPrinters() ([]structs.Printer, error) {
+	return m.ListPrintersFn()
+}
+
+var mk4Printer = structs.Printer{PrinterID: 3, Name: "mk4-1", BedX: 250, BedY: 210, BedZ: 220, NozzleMM: 0.4, FilamentColors: []string{"white"}, Status: "idle"}
+
+func TestRegisterPrinter(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		body        string
+		mockService *MockPrinterService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc: "printer registered",
+			body: `{"name": "mk4-1", "bed_x_mm": 250, "bed_y_mm": 210, "bed_z_mm": 220, "filament_colors": ["white"]}`,
+			mockService: &MockPrinterService{
+				RegisterPrinterFn: func(printer structs.Printer) (structs.Printer, error) {
+					return mk4Printer, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "printer registered: id=3, name=mk4-1"}},
+		},
+		{
+			desc:        "no filament loaded",
+			body:        `{"name": "mk4-1", "bed_x_mm": 250, "bed_y_mm": 210, "bed_z_mm": 220, "filament_colors": []}`,
+			mockService: &MockPrinterService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid printer registration"}},
+		},
+		{
+			desc:        "unknown status",
+			body:        `{"name": "mk4-1", "bed_x_mm": 250, "bed_y_mm": 210, "bed_z_mm": 220, "filament_colors": ["white"], "status": "asleep"}`,
+			mockService: &MockPrinterService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid printer registration"}},
+		},
+		{
+			desc: "registration fails",
+			body: `{"name": "mk4-1", "bed_x_mm": 250, "bed_y_mm": 210, "bed_z_mm": 220, "filament_colors": ["white"]}`,
+			mockService: &MockPrinterService{
+				RegisterPrinterFn: func(printer structs.Printer) (structs.Printer, error) {
+					return structs.Printer{}, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to register printer"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPrinterHandler(tt.mockService, logger)
+			router.POST("/printer/printers", handler.RegisterPrinter)
+
+			req, _ := http.NewRequest("POST", "/printer/printers", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestPrinterHeartbeat(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc        string
+		printerID   string
+		body        string
+		mockService *MockPrinterService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:      "heartbeat recorded",
+			printerID: "3",
+			body:      `{"status": "printing"}`,
+			mockService: &MockPrinterService{
+				PrinterHeartbeatFn: func(printerID int64, heartbeat structs.PrinterHeartbeat) (structs.Printer, error) {
+					printer := mk4Printer
+					printer.Status = heartbeat.Status
+					return printer, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.DebugLevel, Message: "printer heartbeat: id=3, status=printing"}},
+		},
+		{
+			desc:        "invalid id",
+			printerID:   "abc",
+			body:        `{"status": "idle"}`,
+			mockService: &MockPrinterService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid printer id"}},
+		},
+		{
+			desc:        "missing status",
+			printerID:   "3",
+			body:        `{"filament_colors": ["white"]}`,
+			mockService: &MockPrinterService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid printer heartbeat"}},
+		},
+		{
+			desc:      "printer not found",
+			printerID: "9",
+			body:      `{"status": "idle"}`,
+			mockService: &MockPrinterService{
+				PrinterHeartbeatFn: func(printerID int64, heartbeat structs.PrinterHeartbeat) (structs.Printer, error) {
+					return structs.Printer{}, services.ErrPrinterNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "printer not found: id=9"}},
+		},
+		{
+			desc:      "update fails",
+			printerID: "3",
+			body:      `{"status": "idle"}`,
+			mockService: &MockPrinterService{
+				PrinterHeartbeatFn: func(printerID int64, heartbeat structs.PrinterHeartbeat) (structs.Printer, error) {
+					return structs.Printer{}, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to update printer"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPrinterHandler(tt.mockService, logger)
+			router.POST("/printer/printers/:id/heartbeat", handler.Heartbeat)
+
+			req, _ := http.NewRequest("POST", "/printer/printers/"+tt.printerID+"/heartbeat", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestListPrinters(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc         string
+		mockService  *MockPrinterService
+		wantStatus   int
+		wantPrinters int
+		wantLog      observer.LoggedEntry
+	}{
+		{
+			desc: "printers listed",
+			mockService: &MockPrinterService{
+				ListPrintersFn: func() ([]structs.Printer, error) {
+					return []structs.Printer{mk4Printer}, nil
+				},
+			},
+			wantStatus:   http.StatusOK,
+			wantPrinters: 1,
+			wantLog:      observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "printers listed: printers=1"}},
+		},
+		{
+			desc: "list fails",
+			mockService: &MockPrinterService{
+				ListPrintersFn: func() ([]structs.Printer, error) {
+					return nil, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to list printers"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPrinterHandler(tt.mockService, logger)
+			router.GET("/admin/printers", handler.ListPrinters)
+
+			req, _ := http.NewRequest("GET", "/admin/printers", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response struct {
+				Printers []structs.Printer `json:"printers"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Len(t, response.Printers, tt.wantPrinters)
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
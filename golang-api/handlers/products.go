@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"go.uber.org/zap"
+)
+
+type ProductHandler struct {
+	Service services.PricingService
+	Logger  *zap.SugaredLogger
+}
+
+func NewProductHandler(service services.PricingService, logger *zap.SugaredLogger) *ProductHandler {
+	return &ProductHandler{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// ListActiveProducts is the public catalog the UI prices its cart from
+func (h *ProductHandler) ListActiveProducts(c *gin.Context) {
+	h.listProducts(c, true)
+}
+
+// ListProducts is the admin view of the full catalog and price history
+func (h *ProductHandler) ListProducts(c *gin.Context) {
+	h.listProducts(c, false)
+}
+
+func (h *ProductHandler) listProducts(c *gin.Context, activeOnly bool) {
+	products, err := h.Service.ListProducts(activeOnly)
+	if err != nil {
+		h.Logger.Errorf("unable to list products: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to list products"})
+		return
+	}
+
+	h.Logger.Info("products listed")
+	c.JSON(http.StatusOK, gin.H{"success": true, "products": products})
+}
+
+func (h *ProductHandler) CreateProduct(c *gin.Context) {
+	var product structs.Product
+	if err := c.ShouldBindJSON(&product); err != nil {
+		h.Logger.Errorf("invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+
+	productID, err := h.Service.CreateProduct(product)
+	if err != nil {
+		h.Logger.Errorf("unable to create product: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to create product"})
+		return
+	}
+
+	h.Logger.Infof("product created: id=%d", productID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": productID})
+}
+
+func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid product id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid product id"})
+		return
+	}
+
+	var requestBody struct {
+		Active *bool `json:"active" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		h.Logger.Errorf("invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+
+	err = h.Service.SetProductActive(productID, *requestBody.Active)
+	if errors.Is(err, services.ErrProductNotFound) {
+		h.Logger.Errorf("product not found: id=%d", productID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Product not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to update product: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to update product"})
+		return
+	}
+
+	h.Logger.Infof("product updated: id=%d, active=%t", productID, *requestBody.Active)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (h *ProductHandler) AddPrice(c *gin.Context) {
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid product id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid product id"})
+		return
+	}
+
+	var price structs.Price
+	if err := c.ShouldBindJSON(&price); err != nil {
+		h.Logger.Errorf("invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+
+	priceID, err := h.Service.SetPrice(productID, price)
+	if errors.Is(err, services.ErrProductNotFound) {
+		h.Logger.Errorf("product not found: id=%d", productID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Product not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to set price: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to set price"})
+		return
+	}
+
+	h.Logger.Infof("price set: product=%d, price=%d", productID, priceID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": priceID})
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockPricingService struct {
+	GetPriceFn         func(templateType string, sizeVariant string) (structs.Price, error)
+	PriceCartFn        func(cart []structs.CartItem) (int64, error)
+	ListProductsFn     func(activeOnly bool) ([]structs.Product, error)
+	CreateProductFn    func(product structs.Product) (int64, error)
+	SetProductActiveFn func(productID int64, active bool) error
+	SetPriceFn         func(productID int64, price structs.Price) (int64, error)
+}
+
+func (m *MockPricingService) GetPrice(templateType string, sizeVariant string) (structs.Price, error) {
+	return m.GetPriceFn(templateType, sizeVariant)
+}
+
+func (m *MockPricingService) PriceCart(cart []structs.CartItem) (int64, error) {
+	return m.PriceCartFn(cart)
+}
+
+func (m *MockPricingService) ListProducts(activeOnly bool) ([]structs.Product, error) {
+	return m.ListProductsFn(activeOnly)
+}
+
+func (m *MockPricingService) CreateProduct(product structs.Product) (int64, error) {
+	return m.CreateProductFn(product)
+}
+
+func (m *MockPricingService) SetProductActive(productID int64, active bool) error {
+	return m.SetProductActiveFn(productID, active)
+}
+
+func (m *MockPricingService) SetPrice(productID int64, price structs.Price) (int64, error) {
+	return m.SetPriceFn(productID, price)
+}
+
+func TestProductHandlers(t *testing.T) {
+	tests := []struct {
+		desc        string
+		method      string
+		path        string
+		body        string
+		mockService *MockPricingService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:   "public catalog only asks for active products",
+			method: "GET",
+			path:   "/products",
+			mockService: &MockPricingService{
+				ListProductsFn: func(activeOnly bool) ([]structs.Product, error) {
+					if !activeOnly {
+						return nil, errors.New("expected active only listing")
+					}
+					return []structs.Product{{ProductID: 1, TemplateType: "solid", Active: true}}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "products listed"}},
+		},
+		{
+			desc:   "admin catalog lists everything",
+			method: "GET",
+			path:   "/admin/products",
+			mockService: &MockPricingService{
+				ListProductsFn: func(activeOnly bool) ([]structs.Product, error) {
+					if activeOnly {
+						return nil, errors.New("expected full listing")
+					}
+					return []structs.Product{}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "products listed"}},
+		},
+		{
+			desc:   "listing fails",
+			method: "GET",
+			path:   "/products",
+			mockService: &MockPricingService{
+				ListProductsFn: func(activeOnly bool) ([]structs.Product, error) {
+					return nil, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to list products: db down"}},
+		},
+		{
+			desc:   "create product",
+			method: "POST",
+			path:   "/admin/products",
+			body:   `{"template_type": "solid", "size_variant": "xl", "name": "Solid XL", "active": true}`,
+			mockService: &MockPricingService{
+				CreateProductFn: func(product structs.Product) (int64, error) {
+					return 5, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "product created: id=5"}},
+		},
+		{
+			desc:        "create product without name",
+			method:      "POST",
+			path:        "/admin/products",
+			body:        `{"template_type": "solid"}`,
+			mockService: &MockPricingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid request body"}},
+		},
+		{
+			desc:   "deactivate product",
+			method: "PATCH",
+			path:   "/admin/products/5",
+			body:   `{"active": false}`,
+			mockService: &MockPricingService{
+				SetProductActiveFn: func(productID int64, active bool) error {
+					return nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "product updated: id=5, active=false"}},
+		},
+		{
+			desc:   "update unknown product",
+			method: "PATCH",
+			path:   "/admin/products/5",
+			body:   `{"active": true}`,
+			mockService: &MockPricingService{
+				SetProductActiveFn: func(productID int64, active bool) error {
+					return services.ErrProductNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "product not found"}},
+		},
+		{
+			desc:   "add price",
+			method: "POST",
+			path:   "/admin/products/5/prices",
+			body:   `{"unit_amount": 1599}`,
+			mockService: &MockPricingService{
+				SetPriceFn: func(productID int64, price structs.Price) (int64, error) {
+					return 8, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "price set: product=5, price=8"}},
+		},
+		{
+			desc:        "add price with invalid product id",
+			method:      "POST",
+			path:        "/admin/products/abc/prices",
+			body:        `{"unit_amount": 1599}`,
+			mockService: &MockPricingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid product id"}},
+		},
+		{
+			desc:        "add price without amount",
+			method:      "POST",
+			path:        "/admin/products/5/prices",
+			body:        `{}`,
+			mockService: &MockPricingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid request body"}},
+		},
+	}
+
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewProductHandler(tt.mockService, logger)
+			router.GET("/products", handler.ListActiveProducts)
+			router.GET("/admin/products", handler.ListProducts)
+			router.POST("/admin/products", handler.CreateProduct)
+			router.PATCH("/admin/products/:id", handler.UpdateProduct)
+			router.POST("/admin/products/:id/prices", handler.AddPrice)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Equal(t, tt.wantStatus == http.StatusOK, response["success"], "Success codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
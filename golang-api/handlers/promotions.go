@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"go.uber.org/zap"
+)
+
+type PromotionHandler struct {
+	Service services.PromotionService
+	Logger  *zap.SugaredLogger
+}
+
+func NewPromotionHandler(service services.PromotionService, logger *zap.SugaredLogger) *PromotionHandler {
+	return &PromotionHandler{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// ListPromotions is the admin view of every code and how often it has been redeemed
+func (h *PromotionHandler) ListPromotions(c *gin.Context) {
+	promotions, err := h.Service.ListPromotions()
+	if err != nil {
+		h.Logger.Errorf("unable to list promotions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to list promotions"})
+		return
+	}
+
+	h.Logger.Info("promotions listed")
+	c.JSON(http.StatusOK, gin.H{"success": true, "promotions": promotions})
+}
+
+func (h *PromotionHandler) CreatePromotion(c *gin.Context) {
+	var promo structs.Promotion
+	if err := c.ShouldBindJSON(&promo); err != nil {
+		h.Logger.Errorf("invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+
+	promoID, err := h.Service.CreatePromotion(promo)
+	if errors.Is(err, services.ErrInvalidPromotion) {
+		h.Logger.Errorf("invalid promotion: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to create promotion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to create promotion"})
+		return
+	}
+
+	h.Logger.Infof("promotion created: id=%d", promoID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": promoID})
+}
+
+func (h *PromotionHandler) UpdatePromotion(c *gin.Context) {
+	promoID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.Logger.Errorf("invalid promotion id: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid promotion id"})
+		return
+	}
+
+	var requestBody struct {
+		Active *bool `json:"active" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		h.Logger.Errorf("invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+
+	err = h.Service.SetPromotionActive(promoID, *requestBody.Active)
+	if errors.Is(err, services.ErrPromotionNotFound) {
+		h.Logger.Errorf("promotion not found: id=%d", promoID)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Promotion not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to update promotion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to update promotion"})
+		return
+	}
+
+	h.Logger.Infof("promotion updated: id=%d, active=%t", promoID, *requestBody.Active)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
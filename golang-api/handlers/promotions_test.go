@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockPromotionService struct {
+	ApplyPromotionFn     func(code string, email string, cart []structs.CartItem, shippingAmount int64) (structs.Discount, error)
+	RecordRedemptionFn   func(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error
+	AllocateDiscountFn   func(tx *sql.Tx, promotionID int64, amount int64, items []structs.OrderItem) ([]structs.OrderItem, error)
+	ListPromotionsFn     func() ([]structs.Promotion, error)
+	CreatePromotionFn    func(promo structs.Promotion) (int64, error)
+	SetPromotionActiveFn func(promoID int64, active bool) error
+}
+
+func (m *MockPromotionService) ApplyPromotion(code string, email string, cart []structs.CartItem, shippingAmount int64) (structs.Discount, error) {
+	return m.ApplyPromotionFn(code, email, cart, shippingAmount)
+}
+
+func (m *MockPromotionService) RecordRedemption(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error {
+	return m.RecordRedemptionFn(tx, orderID, orderInfo)
+}
+
+func (m *MockPromotionService) AllocateDiscount(tx *sql.Tx, promotionID int64, amount int64, items []structs.OrderItem) ([]structs.OrderItem, error) {
+	return m.AllocateDiscountFn(tx, promotionID, amount, items)
+}
+
+func (m *MockPromotionService) ListPromotions() ([]structs.Promotion, error) {
+	return m.ListPromotionsFn()
+}
+
+func (m *MockPromotionService) CreatePromotion(promo structs.Promotion) (int64, error) {
+	return m.CreatePromotionFn(promo)
+}
+
+func (m *MockPromotionService) SetPromotionActive(promoID int64, active bool) error {
+	return m.SetPromotionActiveFn(promoID, active)
+}
+
+func TestPromotionHandlers(t *testing.T) {
+	tests := []struct {
+		desc        string
+		method      string
+		path        string
+		body        string
+		mockService *MockPromotionService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:   "list promotions",
+			method: "GET",
+			path:   "/admin/promotions",
+			mockService: &MockPromotionService{
+				ListPromotionsFn: func() ([]structs.Promotion, error) {
+					return []structs.Promotion{{PromotionID: 1, Code: "FORE10", Redemptions: 4}}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "promotions listed"}},
+		},
+		{
+			desc:   "listing fails",
+			method: "GET",
+			path:   "/admin/promotions",
+			mockService: &MockPromotionService{
+				ListPromotionsFn: func() ([]structs.Promotion, error) {
+					return nil, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to list promotions: db down"}},
+		},
+		{
+			desc:   "create course coupon",
+			method: "POST",
+			path:   "/admin/promotions",
+			body:   `{"code": "pebble", "discount_type": "fixed_off", "discount_value": 500, "one_per_email": true, "active": true}`,
+			mockService: &MockPromotionService{
+				CreatePromotionFn: func(promo structs.Promotion) (int64, error) {
+					if !promo.OnePerEmail || promo.DiscountValue != 500 {
+						return -1, fmt.Errorf("unexpected promotion %+v", promo)
+					}
+					return 3, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "promotion created: id=3"}},
+		},
+		{
+			desc:        "create with unknown discount type",
+			method:      "POST",
+			path:        "/admin/promotions",
+			body:        `{"code": "pebble", "discount_type": "bogo"}`,
+			mockService: &MockPromotionService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid request body"}},
+		},
+		{
+			desc:   "create rejected by the service",
+			method: "POST",
+			path:   "/admin/promotions",
+			body:   `{"code": "half", "discount_type": "percent_off", "discount_value": 150}`,
+			mockService: &MockPromotionService{
+				CreatePromotionFn: func(promo structs.Promotion) (int64, error) {
+					return -1, fmt.Errorf("%w: percent off must be between 1 and 100", services.ErrInvalidPromotion)
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid promotion"}},
+		},
+		{
+			desc:   "deactivate promotion",
+			method: "PATCH",
+			path:   "/admin/promotions/3",
+			body:   `{"active": false}`,
+			mockService: &MockPromotionService{
+				SetPromotionActiveFn: func(promoID int64, active bool) error {
+					return nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "promotion updated: id=3, active=false"}},
+		},
+		{
+			desc:   "update unknown promotion",
+			method: "PATCH",
+			path:   "/admin/promotions/3",
+			body:   `{"active": true}`,
+			mockService: &MockPromotionService{
+				SetPromotionActiveFn: func(promoID int64, active bool) error {
+					return services.ErrPromotionNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "promotion not found"}},
+		},
+	}
+
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewPromotionHandler(tt.mockService, logger)
+			router.GET("/admin/promotions", handler.ListPromotions)
+			router.POST("/admin/promotions", handler.CreatePromotion)
+			router.PATCH("/admin/promotions/:id", handler.UpdatePromotion)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Equal(t, tt.wantStatus == http.StatusOK, response["success"], "Success codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"go.uber.org/zap"
+)
+
+type ShippingHandler struct {
+	Service services.ShippingService
+	Logger  *zap.SugaredLogger
+}
+
+func NewShippingHandler(service services.ShippingService, logger *zap.SugaredLogger) *ShippingHandler {
+	return &ShippingHandler{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// QuoteShipping returns the rates the customer can choose from before checkout, the chosen
+// shipment and rate ids are sent back with /create-payment-intent
+func (h *ShippingHandler) QuoteShipping(c *gin.Context) {
+	var request structs.ShippingQuoteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		h.Logger.Errorf("invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+
+	quote, err := h.Service.QuoteShipping(request.BrowserSSID, request.Name, *request.Address, request.Incoterm)
+	if errors.Is(err, services.ErrCountryNotServed) {
+		h.Logger.Errorf("shipping destination rejected: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrNoBoxFits) || errors.Is(err, services.ErrEmptyCart) {
+		h.Logger.Errorf("unable to pack cart: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to quote shipping: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to quote shipping"})
+		return
+	}
+
+	response := gin.H{"success": true, "shipment_id": quote.ShipmentID, "rates": quote.Rates}
+	if quote.Incoterm != "" {
+		// duties aren't part of the rate, the customer needs to know whether they'll be billed on delivery
+		response["incoterm"] = quote.Incoterm
+		response["duties_paid_by"] = quote.DutiesPaidBy
+		response["customs"] = quote.Customs
+	}
+
+	h.Logger.Infof("shipping quoted: shipment=%s, rates=%d", quote.ShipmentID, len(quote.Rates))
+	c.JSON(http.StatusOK, response)
+}
+
+// VerifyAddress lets the browser check an address before checkout, a deliverable address
+// may still come back with a suggested correction
+func (h *ShippingHandler) VerifyAddress(c *gin.Context) {
+	var address structs.AddressInfo
+	if err := c.ShouldBindJSON(&address); err != nil {
+		h.Logger.Errorf("invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body"})
+		return
+	}
+
+	verification, err := h.Service.VerifyAddress(address)
+	if errors.Is(err, services.ErrCountryNotServed) {
+		h.Logger.Infof("shipping destination rejected: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	var addressErr *services.AddressError
+	if errors.As(err, &addressErr) {
+		h.Logger.Infof("address not deliverable: %v", err)
+		respondWithAddressError(c, addressErr)
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to verify address: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to verify address"})
+		return
+	}
+
+	h.Logger.Info("address verified")
+	c.JSON(http.StatusOK, gin.H{"success": true, "address": verification})
+}
+
+// respondWithAddressError tells the customer what is wrong with their address and how the
+// carrier would correct it
+func respondWithAddressError(c *gin.Context, addressErr *services.AddressError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"success": false,
+		"error":   addressErr.Error(),
+		"address": addressErr.Verification,
+	})
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockShippingService struct {
+	QuoteShippingFn func(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error)
+	GetRateFn       func(shipmentID string, rateID string, address structs.AddressInfo) (structs.ShippingRate, error)
+	VerifyAddressFn func(address structs.AddressInfo) (structs.AddressVerification, error)
+}
+
+func (m *MockShippingService) QuoteShipping(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error) {
+	return m.QuoteShippingFn(ssid, name, address, incoterm)
+}
+
+func (m *MockShippingService) GetRate(shipmentID string, rateID string, address structs.AddressInfo) (structs.ShippingRate, error) {
+	return m.GetRateFn(shipmentID, rateID, address)
+}
+
+func (m *MockShippingService) VerifyAddress(address structs.AddressInfo) (structs.AddressVerification, error) {
+	if m.VerifyAddressFn != nil {
+		return m.VerifyAddressFn(address)
+	}
+
+	return structs.AddressVerification{Deliverable: true}, nil
+}
+
+func TestQuoteShipping(t *testing.T) {
+	tests := []struct {
+		desc        string
+		body        string
+		mockService *MockShippingService
+		wantStatus   int
+		wantRates    int
+		wantDutiesBy string
+		wantLog      observer.LoggedEntry
+	}{
+		{
+			desc: "rates quoted for the address",
+			body: `{"browser_ssid": "ssid123", "name": "John Doe", "address": {"line1": "1 Tee Box Ln", "city": "Columbus", "state": "OH", "postal_code": "43215", "country": "US"}}`,
+			mockService: &MockShippingService{
+				QuoteShippingFn: func(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error) {
+					if ssid != "ssid123" || name != "John Doe" || address.PostalCode != "43215" {
+						return structs.ShippingQuote{}, fmt.Errorf("unexpected address %+v", address)
+					}
+					return structs.ShippingQuote{ShipmentID: "shp_123", Rates: []structs.ShippingRate{
+						{RateID: "rate_1", Carrier: "USPS", Amount: 795},
+						{RateID: "rate_2", Carrier: "UPS", Amount: 1240},
+					}}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantRates:  2,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "shipping quoted: shipment=shp_123, rates=2"}},
+		},
+		{
+			desc:        "missing address",
+			body:        `{"name": "John Doe"`,
+			mockService: &MockShippingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid request body"}},
+		},
+		{
+			desc: "international quote tells the customer who pays duties",
+			body: `{"browser_ssid": "ssid123", "address": {"postal_code": "M5J 2X2", "country": "CA"}, "incoterm": "DDP"}`,
+			mockService: &MockShippingService{
+				QuoteShippingFn: func(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error) {
+					if incoterm != "DDP" {
+						return structs.ShippingQuote{}, fmt.Errorf("unexpected incoterm %q", incoterm)
+					}
+					return structs.ShippingQuote{
+						ShipmentID:   "shp_456",
+						Rates:        []structs.ShippingRate{{RateID: "rate_1", Carrier: "USPS", Amount: 2350}},
+						Incoterm:     "DDP",
+						DutiesPaidBy: "sender",
+						Customs:      []structs.CustomsItem{{Description: "Plastic golf ball markers", HSTariffNumber: "950639", Quantity: 2, Value: 2998}},
+					}, nil
+				},
+			},
+			wantStatus:   http.StatusOK,
+			wantRates:    1,
+			wantDutiesBy: "sender",
+			wantLog:      observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "shipping quoted: shipment=shp_456, rates=1"}},
+		},
+		{
+			desc:        "unknown incoterm",
+			body:        `{"browser_ssid": "ssid123", "address": {"postal_code": "M5J 2X2", "country": "CA"}, "incoterm": "EXW"}`,
+			mockService: &MockShippingService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid request body"}},
+		},
+		{
+			desc: "country not served",
+			body: `{"browser_ssid": "ssid123", "address": {"postal_code": "SW1A 1AA", "country": "GB"}}`,
+			mockService: &MockShippingService{
+				QuoteShippingFn: func(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error) {
+					return structs.ShippingQuote{}, fmt.Errorf("%w: GB", services.ErrCountryNotServed)
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "shipping destination rejected"}},
+		},
+		{
+			desc: "cart too big for any box",
+			body: `{"browser_ssid": "ssid123", "address": {"postal_code": "43215", "country": "US"}}`,
+			mockService: &MockShippingService{
+				QuoteShippingFn: func(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error) {
+					return structs.ShippingQuote{}, fmt.Errorf("%w: 400 markers", services.ErrNoBoxFits)
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to pack cart"}},
+		},
+		{
+			desc: "easypost fails",
+			body: `{"browser_ssid": "ssid123", "address": {"postal_code": "43215", "country": "US"}}`,
+			mockService: &MockShippingService{
+				QuoteShippingFn: func(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error) {
+					return structs.ShippingQuote{}, errors.New("invalid address")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to quote shipping: invalid address"}},
+		},
+	}
+
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewShippingHandler(tt.mockService, logger)
+			router.POST("/shipping/quote", handler.QuoteShipping)
+
+			req, _ := http.NewRequest("POST", "/shipping/quote", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response struct {
+				Success      bool                   `json:"success"`
+				Rates        []structs.ShippingRate `json:"rates"`
+				DutiesPaidBy string                 `json:"duties_paid_by"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Equal(t, tt.wantStatus == http.StatusOK, response.Success, "Success codes do not match")
+			assert.Len(t, response.Rates, tt.wantRates)
+			assert.Equal(t, tt.wantDutiesBy, response.DutiesPaidBy)
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
+
+func TestVerifyAddress(t *testing.T) {
+	undeliverable := structs.AddressVerification{
+		Errors:    []structs.AddressFieldError{{Field: "zip", Message: "Invalid zip code"}},
+		Suggested: &structs.AddressInfo{Line1: "1 TEE BOX LN", PostalCode: "43215", Country: "US"},
+	}
+
+	tests := []struct {
+		desc        string
+		body        string
+		mockService *MockShippingService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc:        "deliverable address",
+			body:        `{"line1": "1 Tee Box Ln", "postal_code": "43215", "country": "US"}`,
+			mockService: &MockShippingService{},
+			wantStatus:  http.StatusOK,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "address verified"}},
+		},
+		{
+			desc: "undeliverable address comes back with the suggestion",
+			body: `{"line1": "1 Tee Box Ln", "postal_code": "4321", "country": "US"}`,
+			mockService: &MockShippingService{
+				VerifyAddressFn: func(address structs.AddressInfo) (structs.AddressVerification, error) {
+					return undeliverable, &services.AddressError{Verification: undeliverable}
+				},
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "address not deliverable: address is not deliverable: Invalid zip code"}},
+		},
+		{
+			desc: "verification fails",
+			body: `{"line1": "1 Tee Box Ln", "postal_code": "43215", "country": "US"}`,
+			mockService: &MockShippingService{
+				VerifyAddressFn: func(address structs.AddressInfo) (structs.AddressVerification, error) {
+					return structs.AddressVerification{}, errors.New("easypost down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to verify address: easypost down"}},
+		},
+	}
+
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewShippingHandler(tt.mockService, logger)
+			router.POST("/address/verify", handler.VerifyAddress)
+
+			req, _ := http.NewRequest("POST", "/address/verify", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response struct {
+				Success bool                        `json:"success"`
+				Address structs.AddressVerification `json:"address"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Equal(t, tt.wantStatus == http.StatusOK, response.Success, "Success codes do not match")
+			if tt.wantStatus == http.StatusUnprocessableEntity {
+				assert.Equal(t, undeliverable, response.Address)
+			}
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"go.uber.org/zap"
+)
+
+const TAX_REPORT_DATE_FORMAT = "2006-01-02"
+
+type TaxHandler struct {
+	Service services.TaxService
+	Logger  *zap.SugaredLogger
+}
+
+func NewTaxHandler(service services.TaxService, logger *zap.SugaredLogger) *TaxHandler {
+	return &TaxHandler{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// TaxReport totals sales tax collected by state for filing, from and to are YYYY-MM-DD and
+// both days are included in the report
+func (h *TaxHandler) TaxReport(c *gin.Context) {
+	from, err := time.Parse(TAX_REPORT_DATE_FORMAT, c.Query("from"))
+	if err != nil {
+		h.Logger.Errorf("invalid report start date: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid from date"})
+		return
+	}
+
+	to, err := time.Parse(TAX_REPORT_DATE_FORMAT, c.Query("to"))
+	if err != nil || to.Before(from) {
+		h.Logger.Errorf("invalid report end date: %q", c.Query("to"))
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid to date"})
+		return
+	}
+
+	report, err := h.Service.TaxReport(from, to.AddDate(0, 0, 1))
+	if err != nil {
+		h.Logger.Errorf("unable to build tax report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to build tax report"})
+		return
+	}
+
+	h.Logger.Infof("tax report built: from=%s to=%s", c.Query("from"), c.Query("to"))
+	c.JSON(http.StatusOK, gin.H{"success": true, "report": report})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockTaxService struct {
+	CalculateTaxFn func(address structs.AddressInfo, taxableAmount int64) (int64, error)
+	TaxReportFn    func(from time.Time, to time.Time) ([]structs.TaxReportRow, error)
+}
+
+func (m *MockTaxService) CalculateTax(address structs.AddressInfo, taxableAmount int64) (int64, error) {
+	return m.CalculateTaxFn(address, taxableAmount)
+}
+
+func (m *MockTaxService) TaxReport(from time.Time, to time.Time) ([]structs.TaxReportRow, error) {
+	return m.TaxReportFn(from, to)
+}
+
+func TestTaxReport(t *testing.T) {
+	tests := []struct {
+		desc        string
+		path        string
+		mockService *MockTaxService
+		wantStatus  int
+		wantLog     observer.LoggedEntry
+	}{
+		{
+			desc: "quarter report includes the last day",
+			path: "/admin/reports/tax?from=2026-07-01&to=2026-09-30",
+			mockService: &MockTaxService{
+				TaxReportFn: func(from time.Time, to time.Time) ([]structs.TaxReportRow, error) {
+					if !from.Equal(time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+						return nil, fmt.Errorf("unexpected range %s - %s", from, to)
+					}
+					return []structs.TaxReportRow{{State: "OH", Orders: 3, TaxableSales: 14691, TaxCollected: 845}}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "tax report built: from=2026-07-01 to=2026-09-30"}},
+		},
+		{
+			desc:        "missing from date",
+			path:        "/admin/reports/tax?to=2026-09-30",
+			mockService: &MockTaxService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid report start date"}},
+		},
+		{
+			desc:        "range ends before it starts",
+			path:        "/admin/reports/tax?from=2026-07-01&to=2026-06-30",
+			mockService: &MockTaxService{},
+			wantStatus:  http.StatusBadRequest,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid report end date"}},
+		},
+		{
+			desc: "report fails",
+			path: "/admin/reports/tax?from=2026-07-01&to=2026-09-30",
+			mockService: &MockTaxService{
+				TaxReportFn: func(from time.Time, to time.Time) ([]structs.TaxReportRow, error) {
+					return nil, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to build tax report: db down"}},
+		},
+	}
+
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewTaxHandler(tt.mockService, logger)
+			router.GET("/admin/reports/tax", handler.TaxReport)
+
+			req, _ := http.NewRequest("GET", tt.path, nil)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Equal(t, tt.wantStatus == http.StatusOK, response["success"], "Success codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.Len(t, allLogs, 1, "Log counts do not match") {
+				assert.Equal(t, tt.wantLog.Entry.Level, allLogs[0].Entry.Level)
+				assert.Contains(t, allLogs[0].Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
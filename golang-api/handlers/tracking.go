@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"go.uber.org/zap"
+)
+
+const EASYPOST_SIGNATURE_HEADER = "X-Hmac-Signature"
+
+// easyPostEvent keeps the result raw until the event is known to carry a tracker
+type easyPostEvent struct {
+	ID          string          `json:"id"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+type TrackingHandler struct {
+	Service       services.TrackingService
+	WebhookSecret string
+	Logger        *zap.SugaredLogger
+}
+
+func NewTrackingHandler(service services.TrackingService, webhookSecret string, logger *zap.SugaredLogger) *TrackingHandler {
+	return &TrackingHandler{
+		Service:       service,
+		WebhookSecret: webhookSecret,
+		Logger:        logger,
+	}
+}
+
+// HandleEasyPostWebhook records carrier scans from EasyPost tracker events and moves the
+// order's shipping_status along with them. Any error response makes EasyPost retry
+func (h *TrackingHandler) HandleEasyPostWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, MAX_WEBHOOK_BYTES))
+	if err != nil {
+		h.Logger.Errorf("unable to read webhook body: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to read request body"})
+		return
+	}
+
+	// an empty secret would accept payloads signed with an empty key
+	if h.WebhookSecret == "" {
+		h.Logger.Errorf("invalid webhook signature: no webhook secret configured")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	if !validEasyPostSignature(payload, c.GetHeader(EASYPOST_SIGNATURE_HEADER), h.WebhookSecret) {
+		h.Logger.Errorf("invalid webhook signature: %s header does not match", EASYPOST_SIGNATURE_HEADER)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var event easyPostEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		h.Logger.Errorf("unable to parse webhook event: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event"})
+		return
+	}
+
+	if event.Description != "tracker.created" && event.Description != "tracker.updated" {
+		h.Logger.Infof("ignoring webhook event: description=%s", event.Description)
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return
+	}
+
+	var tracker easypost.Tracker
+	if err := json.Unmarshal(event.Result, &tracker); err != nil {
+		h.Logger.Errorf("unable to parse tracker for event %s: %v", event.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event"})
+		return
+	}
+
+	err = h.Service.RecordTracker(&tracker)
+	if errors.Is(err, services.ErrShipmentNotFound) {
+		// trackers for labels bought outside the shop have nothing to update
+		h.Logger.Infof("no shipment for tracker: tracker=%s, tracking=%s", tracker.ID, tracker.TrackingCode)
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("unable to handle webhook event %s: %v", event.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to handle event"})
+		return
+	}
+
+	h.Logger.Infof("tracking updated: tracking=%s, status=%s", tracker.TrackingCode, tracker.Status)
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// validEasyPostSignature checks the header EasyPost sends, an HMAC-SHA256 of the raw body
+// keyed with the webhook secret
+func validEasyPostSignature(payload []byte, signature string, secret string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expected := "hmac-sha256-hex=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
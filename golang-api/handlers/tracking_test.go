@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testEasyPostSecret = "easypost_test_secret"
+
+type MockTrackingService struct {
+	RecordTrackerFn func(tracker *easypost.Tracker) error
+}
+
+func (m *MockTrackingService) RecordTracker(tracker *easypost.Tracker) error {
+	return m.RecordTrackerFn(tracker)
+}
+
+const trackerUpdatedFixture = `{
+	"id": "evt_123",
+	"object": "Event",
+	"description": "tracker.updated",
+	"result": {
+		"id": "trk_123",
+		"object": "Tracker",
+		"shipment_id": "shp_123",
+		"tracking_code": "TRACK123",
+		"status": "in_transit",
+		"tracking_details": [
+			{"object": "TrackingDetail", "status": "in_transit", "datetime": "2024-05-02T12:30:00Z"}
+		]
+	}
+}`
+
+const batchUpdatedFixture = `{
+	"id": "evt_456",
+	"object": "Event",
+	"description": "batch.updated",
+	"result": {"id": "batch_123", "object": "Batch"}
+}`
+
+// signEasyPost signs a payload the way EasyPost does, an HMAC-SHA256 of the raw body
+func signEasyPost(payload string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "hmac-sha256-hex=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestEasyPostWebhook(t *testing.T) {
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		desc            string
+		payload         string
+		signature       string
+		webhookSecret   string
+		trackingService *MockTrackingService
+		wantStatus      int
+		wantLog         observer.LoggedEntry
+	}{
+		{
+			desc:          "signed with another secret",
+			payload:       trackerUpdatedFixture,
+			signature:     signEasyPost(trackerUpdatedFixture, "other_secret"),
+			webhookSecret: testEasyPostSecret,
+			wantStatus:    http.StatusBadRequest,
+			wantLog:       observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid webhook signature"}},
+		},
+		{
+			desc:          "unsigned",
+			payload:       trackerUpdatedFixture,
+			webhookSecret: testEasyPostSecret,
+			wantStatus:    http.StatusBadRequest,
+			wantLog:       observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid webhook signature"}},
+		},
+		{
+			desc:          "webhooks disabled without a secret",
+			payload:       trackerUpdatedFixture,
+			signature:     signEasyPost(trackerUpdatedFixture, ""),
+			webhookSecret: "",
+			wantStatus:    http.StatusBadRequest,
+			wantLog:       observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid webhook signature"}},
+		},
+		{
+			desc:          "tracker update is recorded",
+			payload:       trackerUpdatedFixture,
+			signature:     signEasyPost(trackerUpdatedFixture, testEasyPostSecret),
+			webhookSecret: testEasyPostSecret,
+			trackingService: &MockTrackingService{
+				RecordTrackerFn: func(tracker *easypost.Tracker) error {
+					if tracker.ShipmentID != "shp_123" || len(tracker.TrackingDetails) != 1 {
+						return errors.New("unexpected tracker")
+					}
+					return nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "tracking updated"}},
+		},
+		{
+			desc:          "tracker for a label bought elsewhere",
+			payload:       trackerUpdatedFixture,
+			signature:     signEasyPost(trackerUpdatedFixture, testEasyPostSecret),
+			webhookSecret: testEasyPostSecret,
+			trackingService: &MockTrackingService{
+				RecordTrackerFn: func(tracker *easypost.Tracker) error {
+					return services.ErrShipmentNotFound
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "no shipment for tracker"}},
+		},
+		{
+			desc:          "recording fails so EasyPost retries",
+			payload:       trackerUpdatedFixture,
+			signature:     signEasyPost(trackerUpdatedFixture, testEasyPostSecret),
+			webhookSecret: testEasyPostSecret,
+			trackingService: &MockTrackingService{
+				RecordTrackerFn: func(tracker *easypost.Tracker) error {
+					return errors.New("db error")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to handle webhook event evt_123"}},
+		},
+		{
+			desc:          "other events are ignored",
+			payload:       batchUpdatedFixture,
+			signature:     signEasyPost(batchUpdatedFixture, testEasyPostSecret),
+			webhookSecret: testEasyPostSecret,
+			wantStatus:    http.StatusOK,
+			wantLog:       observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "ignoring webhook event"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			router := gin.Default()
+			handler := NewTrackingHandler(tt.trackingService, tt.webhookSecret, logger)
+			router.POST("/webhooks/easypost", handler.HandleEasyPostWebhook)
+
+			req, _ := http.NewRequest("POST", "/webhooks/easypost", bytes.NewBufferString(tt.payload))
+			if tt.signature != "" {
+				req.Header.Set(EASYPOST_SIGNATURE_HEADER, tt.signature)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+
+			allLogs := observedLogs.All()
+			if assert.NotEmpty(t, allLogs, "Expected a log entry") {
+				last := allLogs[len(allLogs)-1]
+				assert.Equal(t, tt.wantLog.Entry.Level, last.Entry.Level)
+				assert.Contains(t, last.Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stripe/stripe-go/v75"
+	"github.com/stripe/stripe-go/v75/webhook"
+)
+
+// Stripe caps event payloads well below this
+const MAX_WEBHOOK_BYTES = 65536
+
+// HandleStripeWebhook fulfils orders from Stripe's side so an authorized intent still becomes
+// an order when the browser never calls /handle-order. Any error response makes Stripe retry
+func (h *OrderHandler) HandleStripeWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, MAX_WEBHOOK_BYTES))
+	if err != nil {
+		h.Logger.Errorf("unable to read webhook body: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to read request body"})
+		return
+	}
+
+	event, err := webhook.ConstructEvent(payload, c.GetHeader("Stripe-Signature"), h.WebhookSecret)
+	if err != nil {
+		h.Logger.Errorf("invalid webhook signature: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	switch event.Type {
+	case "payment_intent.amount_capturable_updated":
+		err = h.handleIntentAuthorized(event)
+	case "payment_intent.canceled":
+		err = h.handleIntentCanceled(event)
+	case "charge.refunded":
+		err = h.handleChargeRefunded(event)
+	default:
+		h.Logger.Infof("ignoring webhook event: type=%s", event.Type)
+	}
+
+	if err != nil {
+		h.Logger.Errorf("unable to handle webhook event %s: %v", event.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to handle event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+func (h *OrderHandler) handleIntentAuthorized(event stripe.Event) error {
+	var eventIntent stripe.PaymentIntent
+	if err := json.Unmarshal(event.Data.Raw, &eventIntent); err != nil {
+		return fmt.Errorf("unable to parse payment intent: %w", err)
+	}
+
+	// events can arrive late or out of order so act on the intent as it is now
+	intent, err := h.StripeService.GetPaymentIntent(eventIntent.ID)
+	if err != nil {
+		return err
+	}
+
+	// an order whose capture failed is captured here, an error has Stripe retry the event
+	existing, err := h.Service.GetOrderByIntent(eventIntent.ID)
+	if err == nil {
+		if _, err := h.settleExistingOrder(intent, existing); err != nil {
+			return err
+		}
+		h.Logger.Infof("Order already processed: intentID=%s", eventIntent.ID)
+		return nil
+	}
+	if !errors.Is(err, services.ErrOrderNotFound) {
+		return err
+	}
+
+	if intent.Status != "requires_capture" {
+		h.Logger.Infof("intent no longer awaiting capture: intentID=%s, status=%s", intent.ID, intent.Status)
+		return nil
+	}
+
+	orderInfo, ok := orderInfoFromIntent(intent)
+	if !ok {
+		// nothing to ship to, the browser's /handle-order call still has the details
+		h.Logger.Infof("intent is missing customer details, leaving it to the browser: intentID=%s", intent.ID)
+		return nil
+	}
+
+	// Stripe's address gets the same checks as the browser's, a country we don't ship to
+	// can't succeed on a retry so the authorization is released
+	if _, err := h.Shipping.VerifyAddress(orderInfo.Address); err != nil {
+		if errors.Is(err, services.ErrCountryNotServed) {
+			h.voidPayment(intent.ID, err)
+			h.Logger.Infof("Order rejected from webhook: intentID=%s: %v", intent.ID, err)
+			return nil
+		}
+		var addressErr *services.AddressError
+		if errors.As(err, &addressErr) {
+			// the customer can still correct the address through /handle-order
+			h.Logger.Infof("undeliverable address, leaving it to the browser: intentID=%s: %v", intent.ID, err)
+			return nil
+		}
+		return fmt.Errorf("unable to verify address: %w", err)
+	}
+
+	orderInfo, err = h.fulfillOrder(intent, orderInfo)
+	if errors.Is(err, errOrderPlaced) {
+		return nil
+	}
+	if isCheckoutRejection(err) {
+		// the authorization was released, a retry would be rejected the same way
+		h.Logger.Infof("Order rejected from webhook: intentID=%s: %v", intent.ID, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Infof("Order processed from webhook: intentID=%s, email=%s", orderInfo.PaymentIntentID, orderInfo.Email)
+	return nil
+}
+
+func (h *OrderHandler) handleIntentCanceled(event stripe.Event) error {
+	var intent stripe.PaymentIntent
+	if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+		return fmt.Errorf("unable to parse payment intent: %w", err)
+	}
+
+	return h.updatePaymentStatus(intent.ID, string(stripe.PaymentIntentStatusCanceled))
+}
+
+func (h *OrderHandler) handleChargeRefunded(event stripe.Event) error {
+	var charge stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+		return fmt.Errorf("unable to parse charge: %w", err)
+	}
+
+	if charge.PaymentIntent == nil {
+		h.Logger.Infof("refunded charge has no payment intent: chargeID=%s", charge.ID)
+		return nil
+	}
+
+	status := "partially_refunded"
+	if charge.Refunded {
+		status = "refunded"
+	}
+
+	return h.updatePaymentStatus(charge.PaymentIntent.ID, status)
+}
+
+func (h *OrderHandler) updatePaymentStatus(intentID string, status string) error {
+	err := h.Service.UpdatePaymentStatus(intentID, status)
+	if errors.Is(err, services.ErrOrderNotFound) {
+		// intents that never became orders have nothing to update
+		h.Logger.Infof("no order for payment intent: intentID=%s, status=%s", intentID, status)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Infof("payment status updated: intentID=%s, status=%s", intentID, status)
+	return nil
+}
+
+// orderInfoFromIntent rebuilds the order details the browser would have sent from what
+// Stripe collected, the cart session and email are attached as metadata at checkout. The
+// checkout was verified against the metadata email, the receipt email is only a fallback
+func orderInfoFromIntent(intent *stripe.PaymentIntent) (structs.OrderInfo, bool) {
+	email := intent.Metadata["email"]
+	if email == "" {
+		email = intent.ReceiptEmail
+	}
+
+	ssid := intent.Metadata["browser_ssid"]
+	if ssid == "" || email == "" || intent.Shipping == nil || intent.Shipping.Address == nil {
+		return structs.OrderInfo{}, false
+	}
+
+	address := intent.Shipping.Address
+	return structs.OrderInfo{
+		PaymentIntentID: intent.ID,
+		BrowserSSID:     ssid,
+		Amount:          float32(intent.Amount),
+		PaymentStatus:   string(intent.Status),
+		Name:            intent.Shipping.Name,
+		Email:           email,
+		Address: structs.AddressInfo{
+			Line1:      address.Line1,
+			Line2:      address.Line2,
+			City:       address.City,
+			State:      address.State,
+			PostalCode: address.PostalCode,
+			Country:    address.Country,
+		},
+	}, true
+}
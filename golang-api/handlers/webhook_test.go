@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/stripe-go/v75"
+	"github.com/stripe/stripe-go/v75/webhook"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func webhookEvent(eventType string, object string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"id": "evt_123",
+		"object": "event",
+		"api_version": %q,
+		"type": %q,
+		"data": {"object": %s}
+	}`, stripe.APIVersion, eventType, object))
+}
+
+const authorizedIntentFixture = `{
+	"id": "pi_123",
+	"object": "payment_intent",
+	"amount": 4897,
+	"status": "requires_capture",
+	"metadata": {"browser_ssid": "ssid123", "email": "golfer@example.com"},
+	"shipping": {
+		"name": "John Doe",
+		"address": {"line1": "123 Main St", "city": "Boston", "state": "MA", "postal_code": "02108", "country": "US"}
+	}
+}`
+
+// authorizedIntent is what Stripe returns when the handler re-reads the intent from the fixture
+func authorizedIntent(id string) *stripe.PaymentIntent {
+	return &stripe.PaymentIntent{
+		ID:       id,
+		Amount:   4897,
+		Status:   "requires_capture",
+		Metadata: map[string]string{"browser_ssid": "ssid123", "email": "golfer@example.com"},
+		Shipping: &stripe.ShippingDetails{
+			Name:    "John Doe",
+			Address: &stripe.Address{Line1: "123 Main St", City: "Boston", State: "MA", PostalCode: "02108", Country: "US"},
+		},
+	}
+}
+
+func TestStripeWebhook(t *testing.T) {
+	tests := []struct {
+		desc            string
+		payload         []byte
+		secret          string
+		timestamp       time.Time
+		stripeService   *MockStripeService
+		orderService    *MockOrderService
+		checkoutService *MockCheckoutService
+		shippingService *MockShippingService
+		wantStatus      int
+		wantLog         observer.LoggedEntry
+		wantEmailed     string
+	}{
+		{
+			desc:       "signed with another secret",
+			payload:    webhookEvent("payment_intent.canceled", `{"id": "pi_123", "object": "payment_intent"}`),
+			secret:     "whsec_other",
+			wantStatus: http.StatusBadRequest,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid webhook signature"}},
+		},
+		{
+			desc:       "replayed outside the tolerance window",
+			payload:    webhookEvent("payment_intent.canceled", `{"id": "pi_123", "object": "payment_intent"}`),
+			timestamp:  time.Now().Add(-time.Hour),
+			wantStatus: http.StatusBadRequest,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "invalid webhook signature"}},
+		},
+		{
+			desc:    "authorized intent becomes an order",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return authorizedIntent(id), nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					if info.BrowserSSID != "ssid123" || info.Name != "John Doe" || info.Address.PostalCode != "02108" {
+						return *info, fmt.Errorf("unexpected order %+v", info)
+					}
+					return *info, nil
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Order processed from webhook: intentID=pi_123, email=golfer@example.com"}},
+			wantEmailed: "golfer@example.com",
+		},
+		{
+			desc:    "checkout email wins over the receipt email",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					intent := authorizedIntent(id)
+					intent.ReceiptEmail = "receipts@example.com"
+					return intent, nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					return *info, nil
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Order processed from webhook: intentID=pi_123, email=golfer@example.com"}},
+			wantEmailed: "golfer@example.com",
+		},
+		{
+			desc:    "intent without a checkout email uses the receipt email",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					intent := authorizedIntent(id)
+					intent.Metadata = map[string]string{"browser_ssid": "ssid123"}
+					intent.ReceiptEmail = "receipts@example.com"
+					return intent, nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				ProcessOrderFn: func(info *structs.OrderInfo) (structs.OrderInfo, error) {
+					return *info, nil
+				},
+			},
+			wantStatus:  http.StatusOK,
+			wantLog:     observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Order processed from webhook: intentID=pi_123, email=receipts@example.com"}},
+			wantEmailed: "receipts@example.com",
+		},
+		{
+			desc:    "redelivered event is not fulfilled twice",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				GetOrderByIntentFn: func(intentID string) (structs.OrderInfo, error) {
+					return structs.OrderInfo{PaymentIntentID: intentID}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Order already processed: intentID=pi_123"}},
+		},
+		{
+			desc:    "order whose capture failed is captured",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return authorizedIntent(id), nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "succeeded"}, nil
+				},
+			},
+			orderService: &MockOrderService{
+				GetOrderByIntentFn: func(intentID string) (structs.OrderInfo, error) {
+					return structs.OrderInfo{OrderID: 42, PaymentIntentID: intentID, PaymentStatus: "requires_capture"}, nil
+				},
+				UpdatePaymentStatusFn: func(intentID string, status string) error {
+					if status != "succeeded" {
+						return fmt.Errorf("unexpected status %s", status)
+					}
+					return nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Order already processed: intentID=pi_123"}},
+		},
+		{
+			desc:    "capture still failing has Stripe retry",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return authorizedIntent(id), nil
+				},
+				CapturePaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return nil, errors.New("stripe unavailable")
+				},
+			},
+			orderService: &MockOrderService{
+				GetOrderByIntentFn: func(intentID string) (structs.OrderInfo, error) {
+					return structs.OrderInfo{OrderID: 42, PaymentIntentID: intentID, PaymentStatus: "requires_capture"}, nil
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "failed to capture payment: stripe unavailable"}},
+		},
+		{
+			desc:    "intent captured since the event was sent",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "succeeded"}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "intent no longer awaiting capture"}},
+		},
+		{
+			desc:    "intent without shipping details is left to the browser",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", `{"id": "pi_123", "object": "payment_intent"}`),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					intent := authorizedIntent(id)
+					intent.Shipping = nil
+					return intent, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "intent is missing customer details"}},
+		},
+		{
+			desc:    "fulfillment failure asks Stripe to retry",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return authorizedIntent(id), nil
+				},
+			},
+			checkoutService: &MockCheckoutService{
+				VerifyCheckoutFn: func(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error) {
+					return structs.Checkout{}, errors.New("failed to load checkout: connection refused")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to handle webhook event evt_123: checkout verification failed"}},
+		},
+		{
+			desc:    "rejected checkout releases the authorization",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return authorizedIntent(id), nil
+				},
+				CancelPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "canceled"}, nil
+				},
+			},
+			checkoutService: &MockCheckoutService{
+				VerifyCheckoutFn: func(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error) {
+					return structs.Checkout{}, services.ErrCartChanged
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Order rejected from webhook: intentID=pi_123: checkout verification failed: cart has changed"}},
+		},
+		{
+			desc:    "destination we don't ship to releases the authorization",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return authorizedIntent(id), nil
+				},
+				CancelPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return &stripe.PaymentIntent{ID: id, Status: "canceled"}, nil
+				},
+			},
+			checkoutService: &MockCheckoutService{
+				VerifyCheckoutFn: func(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error) {
+					return structs.Checkout{}, errors.New("checkout verified for a rejected destination")
+				},
+			},
+			shippingService: &MockShippingService{
+				VerifyAddressFn: func(address structs.AddressInfo) (structs.AddressVerification, error) {
+					return structs.AddressVerification{}, fmt.Errorf("%w: %s", services.ErrCountryNotServed, address.Country)
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "Order rejected from webhook: intentID=pi_123: we don't ship to this country: US"}},
+		},
+		{
+			desc:    "undeliverable address is left to the browser",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return authorizedIntent(id), nil
+				},
+			},
+			shippingService: &MockShippingService{
+				VerifyAddressFn: func(address structs.AddressInfo) (structs.AddressVerification, error) {
+					verification := structs.AddressVerification{Errors: []structs.AddressFieldError{{Field: "zip", Message: "Invalid zip code"}}}
+					return verification, &services.AddressError{Verification: verification}
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "undeliverable address, leaving it to the browser: intentID=pi_123"}},
+		},
+		{
+			desc:    "address verification outage is retried",
+			payload: webhookEvent("payment_intent.amount_capturable_updated", authorizedIntentFixture),
+			stripeService: &MockStripeService{
+				GetPaymentIntentFn: func(id string) (*stripe.PaymentIntent, error) {
+					return authorizedIntent(id), nil
+				},
+			},
+			shippingService: &MockShippingService{
+				VerifyAddressFn: func(address structs.AddressInfo) (structs.AddressVerification, error) {
+					return structs.AddressVerification{}, errors.New("easypost down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to verify address: easypost down"}},
+		},
+		{
+			desc:    "canceled intent updates the order",
+			payload: webhookEvent("payment_intent.canceled", `{"id": "pi_123", "object": "payment_intent", "status": "canceled"}`),
+			orderService: &MockOrderService{
+				UpdatePaymentStatusFn: func(intentID string, status string) error {
+					if intentID != "pi_123" || status != "canceled" {
+						return fmt.Errorf("unexpected update %s=%s", intentID, status)
+					}
+					return nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "payment status updated: intentID=pi_123, status=canceled"}},
+		},
+		{
+			desc:    "canceled intent that never became an order",
+			payload: webhookEvent("payment_intent.canceled", `{"id": "pi_123", "object": "payment_intent", "status": "canceled"}`),
+			orderService: &MockOrderService{
+				UpdatePaymentStatusFn: func(intentID string, status string) error {
+					return services.ErrOrderNotFound
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "no order for payment intent"}},
+		},
+		{
+			desc:    "full refund",
+			payload: webhookEvent("charge.refunded", `{"id": "ch_123", "object": "charge", "payment_intent": "pi_123", "refunded": true}`),
+			orderService: &MockOrderService{
+				UpdatePaymentStatusFn: func(intentID string, status string) error {
+					return nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "payment status updated: intentID=pi_123, status=refunded"}},
+		},
+		{
+			desc:    "partial refund",
+			payload: webhookEvent("charge.refunded", `{"id": "ch_123", "object": "charge", "payment_intent": "pi_123", "refunded": false}`),
+			orderService: &MockOrderService{
+				UpdatePaymentStatusFn: func(intentID string, status string) error {
+					return nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "status=partially_refunded"}},
+		},
+		{
+			desc:    "refund update fails",
+			payload: webhookEvent("charge.refunded", `{"id": "ch_123", "object": "charge", "payment_intent": "pi_123", "refunded": true}`),
+			orderService: &MockOrderService{
+				UpdatePaymentStatusFn: func(intentID string, status string) error {
+					return errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.ErrorLevel, Message: "unable to handle webhook event evt_123: db down"}},
+		},
+		{
+			desc:       "unhandled event type",
+			payload:    webhookEvent("customer.created", `{"id": "cus_123", "object": "customer"}`),
+			wantStatus: http.StatusOK,
+			wantLog:    observer.LoggedEntry{Entry: zapcore.Entry{Level: zapcore.InfoLevel, Message: "ignoring webhook event: type=customer.created"}},
+		},
+	}
+
+	core, observedLogs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			observedLogs.TakeAll()
+
+			secret := tt.secret
+			if secret == "" {
+				secret = testWebhookSecret
+			}
+			orderService := tt.orderService
+			if orderService == nil {
+				orderService = &MockOrderService{}
+			}
+			checkoutService := tt.checkoutService
+			if checkoutService == nil {
+				checkoutService = &MockCheckoutService{}
+			}
+			shippingService := tt.shippingService
+			if shippingService == nil {
+				shippingService = &MockShippingService{}
+			}
+
+			var emailed string
+			notificationService := &MockNotificationService{
+				SendOrderTokenFn: func(order structs.OrderInfo) error {
+					emailed = order.Email
+					return nil
+				},
+			}
+
+			router := gin.Default()
+			handler := NewOrderHandler(orderService, tt.stripeService, checkoutService, &MockFinancialService{}, shippingService, notificationService, testWebhookSecret, logger)
+			router.POST("/webhooks/stripe", handler.HandleStripeWebhook)
+
+			signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+				Payload:   tt.payload,
+				Secret:    secret,
+				Timestamp: tt.timestamp,
+			})
+
+			req, _ := http.NewRequest("POST", "/webhooks/stripe", bytes.NewBuffer(signed.Payload))
+			req.Header.Set("Stripe-Signature", signed.Header)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, "Status codes do not match")
+			assert.Equal(t, tt.wantEmailed, emailed, "order token email")
+
+			allLogs := observedLogs.All()
+			if assert.NotEmpty(t, allLogs, "Expected a log entry") {
+				last := allLogs[len(allLogs)-1]
+				assert.Equal(t, tt.wantLog.Entry.Level, last.Entry.Level)
+				assert.Contains(t, last.Entry.Message, tt.wantLog.Entry.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		desc       string
+		token      string
+		header     string
+		wantStatus int
+	}{
+		{
+			desc:       "valid token",
+			token:      "secret",
+			header:     "Bearer secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "wrong token",
+			token:      "secret",
+			header:     "Bearer guess",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "missing header",
+			token:      "secret",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "no token configured",
+			token:      "",
+			header:     "Bearer ",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/admin", AdminAuth(tt.token), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"success": true})
+			})
+
+			req, _ := http.NewRequest("GET", "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+const IDEMPOTENCY_HEADER = "Idempotency-Key"
+
+const MAX_IDEMPOTENCY_KEY_LENGTH = 255
+
+// recordingWriter keeps a copy of the response body so it can be stored for replay
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replays the stored response when a request is retried with the same
+// Idempotency-Key header. Requests without the header pass straight through, server
+// errors release the key so the client can retry for real
+func Idempotency(store services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IDEMPOTENCY_HEADER)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > MAX_IDEMPOTENCY_KEY_LENGTH {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "error": "Idempotency key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "error": "Unable to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(body)
+		route := c.FullPath()
+
+		stored, err := store.Begin(key, route, hex.EncodeToString(hash[:]))
+		if errors.Is(err, services.ErrIdempotencyKeyReused) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrRequestInProgress) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Unable to check idempotency key"})
+			return
+		}
+
+		if stored != nil {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.Status, "application/json; charset=utf-8", stored.Body)
+			c.Abort()
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		completed := false
+		defer func() {
+			// a panic or server error leaves nothing worth replaying
+			if !completed {
+				store.Release(key, route)
+			}
+		}()
+
+		c.Next()
+
+		if writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		if err := store.Complete(key, route, structs.StoredResponse{Status: writer.Status(), Body: writer.body.Bytes()}); err == nil {
+			completed = true
+		}
+	}
+}
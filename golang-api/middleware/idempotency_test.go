@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ocamp09/fairway-ink-api/golang-api/services"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockIdempotencyService struct {
+	BeginFn   func(key string, route string, requestHash string) (*structs.StoredResponse, error)
+	Completed *structs.StoredResponse
+	Released  bool
+}
+
+func (m *MockIdempotencyService) Begin(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+	if m.BeginFn != nil {
+		return m.BeginFn(key, route, requestHash)
+	}
+	return nil, nil
+}
+
+func (m *MockIdempotencyService) Complete(key string, route string, response structs.StoredResponse) error {
+	m.Completed = &response
+	return nil
+}
+
+func (m *MockIdempotencyService) Release(key string, route string) error {
+	m.Released = true
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	tests := []struct {
+		desc          string
+		key           string
+		beginFn       func(key string, route string, requestHash string) (*structs.StoredResponse, error)
+		handlerStatus int
+		wantStatus    int
+		wantBody      string
+		wantHandled   bool
+		wantCompleted bool
+		wantReleased  bool
+	}{
+		{
+			desc:          "no key passes through",
+			handlerStatus: http.StatusOK,
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"success":true}`,
+			wantHandled:   true,
+		},
+		{
+			desc: "first request is stored",
+			key:  "key-1",
+			beginFn: func(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+				if route != "/handle-order" || len(requestHash) != 64 {
+					return nil, errors.New("unexpected claim")
+				}
+				return nil, nil
+			},
+			handlerStatus: http.StatusOK,
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"success":true}`,
+			wantHandled:   true,
+			wantCompleted: true,
+		},
+		{
+			desc: "retry replays the stored response",
+			key:  "key-1",
+			beginFn: func(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+				return &structs.StoredResponse{Status: http.StatusOK, Body: []byte(`{"success":true,"order_id":1}`)}, nil
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"success":true,"order_id":1}`,
+		},
+		{
+			desc: "client errors are stored",
+			key:  "key-1",
+			beginFn: func(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+				return nil, nil
+			},
+			handlerStatus: http.StatusBadRequest,
+			wantStatus:    http.StatusBadRequest,
+			wantHandled:   true,
+			wantCompleted: true,
+		},
+		{
+			desc: "server errors release the key",
+			key:  "key-1",
+			beginFn: func(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+				return nil, nil
+			},
+			handlerStatus: http.StatusInternalServerError,
+			wantStatus:    http.StatusInternalServerError,
+			wantHandled:   true,
+			wantReleased:  true,
+		},
+		{
+			desc: "key reused with a different body",
+			key:  "key-1",
+			beginFn: func(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+				return nil, services.ErrIdempotencyKeyReused
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			desc: "first request still running",
+			key:  "key-1",
+			beginFn: func(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+				return nil, services.ErrRequestInProgress
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			desc: "store unavailable",
+			key:  "key-1",
+			beginFn: func(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+				return nil, errors.New("db down")
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			desc:       "key too long",
+			key:        strings.Repeat("k", MAX_IDEMPOTENCY_KEY_LENGTH+1),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			store := &MockIdempotencyService{BeginFn: tt.beginFn}
+			handled := false
+
+			router := gin.New()
+			router.POST("/handle-order", Idempotency(store), func(c *gin.Context) {
+				handled = true
+				c.JSON(tt.handlerStatus, gin.H{"success": tt.handlerStatus == http.StatusOK})
+			})
+
+			req, _ := http.NewRequest("POST", "/handle-order", bytes.NewBufferString(`{"intent_id":"pi_123"}`))
+			if tt.key != "" {
+				req.Header.Set(IDEMPOTENCY_HEADER, tt.key)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantHandled, handled)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String())
+			}
+			if tt.wantCompleted && assert.NotNil(t, store.Completed) {
+				assert.Equal(t, tt.wantStatus, store.Completed.Status)
+				assert.Equal(t, w.Body.Bytes(), store.Completed.Body)
+			} else {
+				assert.Nil(t, store.Completed)
+			}
+			assert.Equal(t, tt.wantReleased, store.Released)
+		})
+	}
+}
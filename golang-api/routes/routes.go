@@ -7,6 +7,7 @@ import (
 
 	"github.com/ocamp09/fairway-ink-api/golang-api/config"
 	"github.com/ocamp09/fairway-ink-api/golang-api/handlers"
+	"github.com/ocamp09/fairway-ink-api/golang-api/middleware"
 	"github.com/ocamp09/fairway-ink-api/golang-api/services"
 	"go.uber.org/zap"
 
@@ -14,21 +15,64 @@ import (
 )
 
 func RegisterRoutes(r *gin.Engine, db *sql.DB, logger *zap.SugaredLogger) {
-	cartService := services.NewCartService(db)
+	pricingService := services.NewPricingService(db)
+	cartService := services.NewCartService(db, pricingService)
+	promotionService := services.NewPromotionService(db, pricingService)
 	generateService := services.NewGenerateStlService(db, "output", runtime.GOOS)
 	designService := services.NewDesignService("./designs", "https://api.fairway-ink.com")
 	outputService := services.NewDesignService("./output", "https://api.fairway-ink.com")
 
 	easypostClient := services.NewEasyPostClient(config.EASYPOST_KEY)
+	if config.USE_FAKES {
+		easypostClient = services.NewFakeEasyPostClient()
+	}
 	stripeClient := services.NewStripeService(config.STRIPE_KEY)
-	orderService := services.NewOrderService(db, easypostClient)
+	mailer := services.NewSmtpMailer(config.SMTP_HOST, config.SMTP_PORT, config.SMTP_USER, config.SMTP_PASSWORD, config.MAIL_FROM)
+	if config.USE_FAKES {
+		mailer = services.NewFakeMailer()
+	} else if config.SMTP_HOST == "" {
+		logger.Warn("Environment variable missing: SMTP_HOST, order tokens can't be emailed")
+	}
+	packagingService := services.NewPackagingService(db, cartService, pricingService)
+	printScheduler := services.NewPrintScheduler(db, config.PRINTER_COUNT)
+	slicer := services.NewCliSlicer(config.SLICER_ENGINE, config.SLICER_PATH, config.SLICER_CONFIG)
+	if config.USE_FAKES && config.SLICER_PATH == "" {
+		slicer = services.NewFakeSlicer()
+	}
+	rateSelector, err := services.NewRateSelector(config.RATE_POLICY)
+	if err != nil {
+		logger.Fatalf("invalid RATE_POLICY: %v", err)
+	}
+	orderService := services.NewOrderService(db, easypostClient, pricingService, promotionService, packagingService, printScheduler, slicer, rateSelector, config.DEFER_LABELS)
+	taxService := services.NewTaxService(db, services.NewTaxRateTable(db))
+	shippingService := services.NewShippingService(easypostClient, packagingService)
+	checkoutService := services.NewCheckoutService(db, cartService, pricingService, promotionService, taxService, shippingService, stripeClient)
+	idempotencyService := services.NewIdempotencyService(db)
+	financialService := services.NewFinancialService(db, stripeClient, logger)
+	trackingService := services.NewTrackingService(db)
+	manifestService := services.NewManifestService(db, easypostClient)
+	printerService := services.NewPrinterService(db)
+	printQueueService := services.NewPrintQueueService(db, orderService, printScheduler, printerService)
+	platingService := services.NewPlatingService(db, orderService, printerService)
+	notificationService := services.NewNotificationService(mailer)
 
 	cartHandler := handlers.NewCartHandler(cartService, logger)
 	generateHandler := handlers.NewGenerateHandler(generateService, logger)
 	designHandler := handlers.NewDesignHandler(designService, logger)
 	outputHandler := handlers.NewDesignHandler(outputService, logger)
-	orderHandler := handlers.NewOrderHandler(orderService, stripeClient, logger)
-	checkoutHandler := handlers.NewCheckoutHandler(stripeClient, logger)
+	orderHandler := handlers.NewOrderHandler(orderService, stripeClient, checkoutService, financialService, shippingService, notificationService, config.STRIPE_WEBHOOK_SECRET, logger)
+	checkoutHandler := handlers.NewCheckoutHandler(checkoutService, logger)
+	productHandler := handlers.NewProductHandler(pricingService, logger)
+	promotionHandler := handlers.NewPromotionHandler(promotionService, logger)
+	taxHandler := handlers.NewTaxHandler(taxService, logger)
+	shippingHandler := handlers.NewShippingHandler(shippingService, logger)
+	trackingHandler := handlers.NewTrackingHandler(trackingService, config.EASYPOST_WEBHOOK_SECRET, logger)
+	manifestHandler := handlers.NewManifestHandler(manifestService, logger)
+	printQueueHandler := handlers.NewPrintQueueHandler(printQueueService, logger)
+	printerHandler := handlers.NewPrinterHandler(printerService, logger)
+	plateHandler := handlers.NewPlateHandler(platingService, logger)
+
+	idempotent := middleware.Idempotency(idempotencyService)
 
 	r.GET("/health", func(c *gin.Context) {c.JSON(http.StatusOK, gin.H{"success": true})})
 	r.GET("/designs", designHandler.ListDesigns)
@@ -36,7 +80,51 @@ func RegisterRoutes(r *gin.Engine, db *sql.DB, logger *zap.SugaredLogger) {
 	r.GET("/output/:ssid/:filename", outputHandler.GetDesign)
 	r.POST("/upload", handlers.UploadFile)
 	r.POST("/generate", generateHandler.GenerateStl)
+	r.GET("/products", productHandler.ListActiveProducts)
 	r.POST("/cart", cartHandler.AddToCart)
-	r.POST("/create-payment-intent", checkoutHandler.BeginCheckout)
-	r.POST("/handle-order", orderHandler.HandleOrder)
+	r.GET("/cart/:ssid", cartHandler.GetCart)
+	r.DELETE("/cart/:ssid", cartHandler.ClearCart)
+	r.PATCH("/cart/:ssid/items/:id", cartHandler.UpdateCartItem)
+	r.DELETE("/cart/:ssid/items/:id", cartHandler.RemoveCartItem)
+	r.POST("/shipping/quote", shippingHandler.QuoteShipping)
+	r.POST("/address/verify", shippingHandler.VerifyAddress)
+	r.POST("/create-payment-intent", idempotent, checkoutHandler.BeginCheckout)
+	r.POST("/handle-order", idempotent, orderHandler.HandleOrder)
+	r.POST("/webhooks/stripe", orderHandler.HandleStripeWebhook)
+	r.POST("/webhooks/easypost", trackingHandler.HandleEasyPostWebhook)
+	r.GET("/orders/:id", orderHandler.GetCustomerOrder)
+	r.POST("/orders/:id/token", orderHandler.ResendOrderToken)
+
+	admin := r.Group("/admin", middleware.AdminAuth(config.ADMIN_TOKEN))
+	admin.GET("/products", productHandler.ListProducts)
+	admin.POST("/products", productHandler.CreateProduct)
+	admin.PATCH("/products/:id", productHandler.UpdateProduct)
+	admin.POST("/products/:id/prices", productHandler.AddPrice)
+	admin.GET("/promotions", promotionHandler.ListPromotions)
+	admin.POST("/promotions", promotionHandler.CreatePromotion)
+	admin.PATCH("/promotions/:id", promotionHandler.UpdatePromotion)
+	admin.GET("/orders", orderHandler.ListOrders)
+	admin.GET("/orders/:id", orderHandler.GetOrder)
+	admin.POST("/jobs/:id/complete", orderHandler.CompletePrintJob)
+	admin.POST("/jobs/:id/slice", orderHandler.SliceJob)
+	admin.POST("/manifests", manifestHandler.CreateManifests)
+	admin.GET("/manifests/:id", manifestHandler.GetManifest)
+	admin.GET("/reports/tax", taxHandler.TaxReport)
+	admin.GET("/printers", printerHandler.ListPrinters)
+	admin.POST("/plates", plateHandler.CreatePlate)
+	admin.GET("/plates/:id", plateHandler.GetPlate)
+	admin.POST("/plates/:id/complete", plateHandler.CompletePlate)
+	admin.POST("/plates/:id/fail", plateHandler.FailPlate)
+
+	printer := r.Group("/printer", middleware.AdminAuth(config.PRINTER_TOKEN))
+	printer.POST("/printers", printerHandler.RegisterPrinter)
+	printer.POST("/printers/:id/heartbeat", printerHandler.Heartbeat)
+	printer.POST("/jobs/claim", printQueueHandler.ClaimJob)
+	printer.POST("/jobs/:id/heartbeat", printQueueHandler.Heartbeat)
+	printer.POST("/jobs/:id/status", printQueueHandler.UpdateJob)
+	printer.GET("/jobs/:id/files", printQueueHandler.JobFiles)
+	printer.POST("/plates/claim", plateHandler.ClaimPlate)
+	printer.POST("/plates/:id/heartbeat", plateHandler.PlateHeartbeat)
+	printer.POST("/plates/:id/status", plateHandler.UpdatePlate)
+	printer.GET("/plates/:id/files", plateHandler.PlateFiles)
 }
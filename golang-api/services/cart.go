@@ -2,20 +2,33 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
 )
 
+var ErrCartItemNotFound = errors.New("cart item not found")
+
 type CartServiceImpl struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Pricing PricingService
 }
 
-func NewCartService(db *sql.DB) CartService {
-	return &CartServiceImpl{DB: db}
+func NewCartService(db *sql.DB, pricing PricingService) CartService {
+	return &CartServiceImpl{DB: db, Pricing: pricing}
 }
 
 func (cs *CartServiceImpl) InsertCartItem(item structs.CartItem) error {
+	if item.SizeVariant == "" {
+		item.SizeVariant = DEFAULT_SIZE_VARIANT
+	}
+
+	// only products with a current price can be added to a cart
+	if _, err := cs.Pricing.GetPrice(item.TemplateType, item.SizeVariant); err != nil {
+		return err
+	}
+
 	tx, err := cs.DB.Begin()
 	if err != nil {
 		return fmt.Errorf("transaction failed: %w", err)
@@ -26,8 +39,8 @@ func (cs *CartServiceImpl) InsertCartItem(item structs.CartItem) error {
 		}
 	}()
 
-	query := `INSERT INTO cart_items (browser_ssid, stl_url, quantity, template_type) VALUES (?, ?, ?, ?)`
-	_, err = tx.Exec(query, item.SSID, item.StlURL, item.Quantity, item.TemplateType)
+	query := `INSERT INTO cart_items (browser_ssid, stl_url, quantity, template_type, size_variant) VALUES (?, ?, ?, ?, ?)`
+	_, err = tx.Exec(query, item.SSID, item.StlURL, item.Quantity, item.TemplateType, item.SizeVariant)
 	if err != nil {
 		return fmt.Errorf("insert failed: %w", err)
 	}
@@ -39,3 +52,77 @@ func (cs *CartServiceImpl) InsertCartItem(item structs.CartItem) error {
 
 	return nil
 }
+
+// GetCartItems returns every item persisted for the browser session, oldest first
+func (cs *CartServiceImpl) GetCartItems(ssid string) ([]structs.CartItem, error) {
+	query := `SELECT id, browser_ssid, stl_url, quantity, template_type, size_variant FROM cart_items WHERE browser_ssid = ? ORDER BY id`
+	rows, err := cs.DB.Query(query, ssid)
+	if err != nil {
+		return nil, fmt.Errorf("select failed: %w", err)
+	}
+	defer rows.Close()
+
+	cart := []structs.CartItem{}
+	for rows.Next() {
+		var item structs.CartItem
+		if err := rows.Scan(&item.ItemID, &item.SSID, &item.StlURL, &item.Quantity, &item.TemplateType, &item.SizeVariant); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		cart = append(cart, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration failed: %w", err)
+	}
+
+	return cart, nil
+}
+
+func (cs *CartServiceImpl) UpdateCartItemQuantity(ssid string, itemID int, quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("invalid quantity: %d", quantity)
+	}
+
+	query := `UPDATE cart_items SET quantity = ? WHERE id = ? AND browser_ssid = ?`
+	result, err := cs.DB.Exec(query, quantity, itemID, ssid)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+
+	return checkCartRowsAffected(result)
+}
+
+func (cs *CartServiceImpl) RemoveCartItem(ssid string, itemID int) error {
+	query := `DELETE FROM cart_items WHERE id = ? AND browser_ssid = ?`
+	result, err := cs.DB.Exec(query, itemID, ssid)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+
+	return checkCartRowsAffected(result)
+}
+
+// ClearCart removes every item for the browser session, an already empty cart is not an error
+func (cs *CartServiceImpl) ClearCart(ssid string) error {
+	query := `DELETE FROM cart_items WHERE browser_ssid = ?`
+	if _, err := cs.DB.Exec(query, ssid); err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+
+	return nil
+}
+
+// checkCartRowsAffected maps a statement that touched no rows to ErrCartItemNotFound,
+// items are scoped by browser_ssid so another session's item ID reads as missing
+func checkCartRowsAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to read affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrCartItemNotFound
+	}
+
+	return nil
+}
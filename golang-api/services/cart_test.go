@@ -31,7 +31,7 @@ func TestInsertCartItem(t *testing.T) {
 			mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
 				mock.ExpectExec(`INSERT INTO cart_items`).
-					WithArgs("1234", "example.com/test.stl", 1, "custom").
+					WithArgs("1234", "example.com/test.stl", 1, "custom", "standard").
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 			},
@@ -62,13 +62,25 @@ func TestInsertCartItem(t *testing.T) {
 			mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
 				mock.ExpectExec(`INSERT INTO cart_items`).
-					WithArgs("1234", "example.com/test.stl", 1, "custom").
+					WithArgs("1234", "example.com/test.stl", 1, "custom", "standard").
 					WillReturnError(errors.New("constraint violation"))
 				mock.ExpectRollback()
 			},
 			wantErr:    true,
 			wantErrMsg: "insert failed: constraint violation",
 		},
+		{
+			desc: "product not for sale",
+			input: structs.CartItem{
+				SSID:         "1234",
+				StlURL:       "example.com/test.stl",
+				Quantity:     1,
+				TemplateType: "gold",
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: "no active price for product",
+		},
 		{
 			desc: "failed to commit transaction",
 			input: structs.CartItem{
@@ -80,7 +92,7 @@ func TestInsertCartItem(t *testing.T) {
 			mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
 				mock.ExpectExec(`INSERT INTO cart_items`).
-					WithArgs("1234", "example.com/test.stl", 1, "custom").
+					WithArgs("1234", "example.com/test.stl", 1, "custom", "standard").
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit().WillReturnError(errors.New("commit error"))
 			},
@@ -101,8 +113,13 @@ func TestInsertCartItem(t *testing.T) {
 			// Set up mock expectations
 			tt.mockDB(mock)
 
+			// Only custom markers are for sale in these tests
+			pricing := new(MockPricingService)
+			pricing.On("GetPrice", "custom", "standard").Return(structs.Price{PriceID: 1, UnitAmount: 1599}, nil)
+			pricing.On("GetPrice", "gold", "standard").Return(structs.Price{}, ErrUnknownProduct)
+
 			// Create service with mock DB
-			service := NewCartService(db)
+			service := NewCartService(db, pricing)
 
 			// Call the method
 			err = service.InsertCartItem(tt.input)
@@ -121,4 +138,294 @@ func TestInsertCartItem(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestGetCartItems(t *testing.T) {
+	tests := []struct {
+		desc       string
+		ssid       string
+		mockDB     func(sqlmock.Sqlmock)
+		wantCart   []structs.CartItem
+		wantErr    bool
+		wantErrMsg string
+	}{
+		{
+			desc: "successfully read cart",
+			ssid: "1234",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "browser_ssid", "stl_url", "quantity", "template_type", "size_variant"}).
+					AddRow(1, "1234", "example.com/a.stl", 2, "solid", "standard").
+					AddRow(2, "1234", "example.com/b.stl", 1, "text", "standard")
+				mock.ExpectQuery(`SELECT id, browser_ssid, stl_url, quantity, template_type, size_variant FROM cart_items WHERE browser_ssid = \?`).
+					WithArgs("1234").
+					WillReturnRows(rows)
+			},
+			wantCart: []structs.CartItem{
+				{ItemID: 1, SSID: "1234", StlURL: "example.com/a.stl", Quantity: 2, TemplateType: "solid", SizeVariant: "standard"},
+				{ItemID: 2, SSID: "1234", StlURL: "example.com/b.stl", Quantity: 1, TemplateType: "text", SizeVariant: "standard"},
+			},
+		},
+		{
+			desc: "empty cart returns empty slice",
+			ssid: "1234",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, browser_ssid, stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WithArgs("1234").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "browser_ssid", "stl_url", "quantity", "template_type", "size_variant"}))
+			},
+			wantCart: []structs.CartItem{},
+		},
+		{
+			desc: "query fails",
+			ssid: "1234",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, browser_ssid, stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WithArgs("1234").
+					WillReturnError(errors.New("db down"))
+			},
+			wantErr:    true,
+			wantErrMsg: "select failed: db down",
+		},
+		{
+			desc: "scan fails",
+			ssid: "1234",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "browser_ssid", "stl_url", "quantity", "template_type", "size_variant"}).
+					AddRow("not-an-int", "1234", "example.com/a.stl", 2, "solid", "standard")
+				mock.ExpectQuery(`SELECT id, browser_ssid, stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WithArgs("1234").
+					WillReturnRows(rows)
+			},
+			wantErr:    true,
+			wantErrMsg: "scan failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewCartService(db, new(MockPricingService))
+			cart, err := service.GetCartItems(tt.ssid)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantCart, cart)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestUpdateCartItemQuantity(t *testing.T) {
+	tests := []struct {
+		desc       string
+		quantity   int
+		mockDB     func(sqlmock.Sqlmock)
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc:     "successful update",
+			quantity: 3,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE cart_items SET quantity = \? WHERE id = \? AND browser_ssid = \?`).
+					WithArgs(3, 7, "1234").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			desc:       "non positive quantity",
+			quantity:   0,
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErrMsg: "invalid quantity: 0",
+		},
+		{
+			desc:     "item not in this cart",
+			quantity: 3,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE cart_items`).
+					WithArgs(3, 7, "1234").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrCartItemNotFound,
+		},
+		{
+			desc:     "update fails",
+			quantity: 3,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE cart_items`).
+					WithArgs(3, 7, "1234").
+					WillReturnError(errors.New("lock timeout"))
+			},
+			wantErrMsg: "update failed: lock timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewCartService(db, new(MockPricingService))
+			err = service.UpdateCartItemQuantity("1234", 7, tt.quantity)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRemoveCartItem(t *testing.T) {
+	tests := []struct {
+		desc       string
+		mockDB     func(sqlmock.Sqlmock)
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc: "successful delete",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM cart_items WHERE id = \? AND browser_ssid = \?`).
+					WithArgs(7, "1234").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			desc: "item not in this cart",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM cart_items WHERE id = \? AND browser_ssid = \?`).
+					WithArgs(7, "1234").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrCartItemNotFound,
+		},
+		{
+			desc: "delete fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM cart_items WHERE id = \? AND browser_ssid = \?`).
+					WithArgs(7, "1234").
+					WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "delete failed: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewCartService(db, new(MockPricingService))
+			err = service.RemoveCartItem("1234", 7)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestClearCart(t *testing.T) {
+	tests := []struct {
+		desc       string
+		mockDB     func(sqlmock.Sqlmock)
+		wantErr    bool
+		wantErrMsg string
+	}{
+		{
+			desc: "successful clear",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM cart_items WHERE browser_ssid = \?`).
+					WithArgs("1234").
+					WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+		},
+		{
+			desc: "already empty cart",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM cart_items WHERE browser_ssid = \?`).
+					WithArgs("1234").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			desc: "delete fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM cart_items WHERE browser_ssid = \?`).
+					WithArgs("1234").
+					WillReturnError(errors.New("db down"))
+			},
+			wantErr:    true,
+			wantErrMsg: "delete failed: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewCartService(db, new(MockPricingService))
+			err = service.ClearCart("1234")
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
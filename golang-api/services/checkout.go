@@ -0,0 +1,240 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stripe/stripe-go/v75"
+)
+
+var (
+	ErrEmptyCart          = errors.New("cart is empty")
+	ErrCheckoutNotFound   = errors.New("no checkout found for payment intent")
+	ErrCheckoutMismatch   = errors.New("payment intent does not belong to this cart")
+	ErrAmountMismatch     = errors.New("payment amount does not match checkout total")
+	ErrCartChanged        = errors.New("cart has changed since checkout began")
+	ErrPromoEmailMismatch = errors.New("order email does not match the email the promo code was redeemed for")
+	ErrTaxChanged         = errors.New("shipping address is taxed differently than at checkout")
+	ErrAddressChanged     = errors.New("shipping address differs from the address shipping was quoted for")
+	ErrIncompleteRate     = errors.New("checkout needs a quoted shipping rate, with both its shipment and rate id")
+	ErrMissingAddress     = errors.New("checkout needs the address the order ships to")
+)
+
+type CheckoutServiceImpl struct {
+	DB         *sql.DB
+	Cart       CartService
+	Pricing    PricingService
+	Promotions PromotionService
+	Tax        TaxService
+	Shipping   ShippingService
+	Stripe     StripeService
+}
+
+func NewCheckoutService(db *sql.DB, cart CartService, pricing PricingService, promotions PromotionService, tax TaxService, shipping ShippingService, stripe StripeService) CheckoutService {
+	return &CheckoutServiceImpl{DB: db, Cart: cart, Pricing: pricing, Promotions: promotions, Tax: tax, Shipping: shipping, Stripe: stripe}
+}
+
+// CreateCheckout prices the persisted cart, adds the chosen shipping rate, applies any promo
+// code, adds sales tax for the shipping address and opens a payment intent for the result,
+// the computed amounts are stored against the intent so they can be verified before capture
+func (cs *CheckoutServiceImpl) CreateCheckout(request structs.CheckoutRequest) (*stripe.PaymentIntent, error) {
+	ssid := request.BrowserSSID
+	cart, err := cs.Cart.GetCartItems(ssid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cart: %w", err)
+	}
+
+	if len(cart) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	// tax is charged and verified on the shipping address, so there's no checkout without one
+	if request.Address == nil {
+		return nil, ErrMissingAddress
+	}
+	address := *request.Address
+
+	// there's no point taking payment for an order we can't ship
+	if err := checkDestination(address); err != nil {
+		return nil, err
+	}
+
+	subtotal, err := cs.Pricing.PriceCart(cart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to price cart: %w", err)
+	}
+
+	// the rate is priced from EasyPost again, the browser only tells us which one was picked.
+	// Every order pays for the label it ships on, so there's no checkout without a rate
+	if request.ShipmentID == "" || request.RateID == "" {
+		return nil, ErrIncompleteRate
+	}
+
+	rate, err := cs.Shipping.GetRate(request.ShipmentID, request.RateID, address)
+	if err != nil {
+		return nil, err
+	}
+	shipping := rate.Amount
+
+	var discount structs.Discount
+	if request.PromoCode != "" {
+		discount, err = cs.Promotions.ApplyPromotion(request.PromoCode, request.Email, cart, shipping)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tax, err := cs.Tax.CalculateTax(address, subtotal+shipping-discount.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate tax: %w", err)
+	}
+
+	total := subtotal + shipping - discount.Amount + tax
+
+	// the webhook rebuilds the order from the intent when the browser never reports back
+	metadata := map[string]string{"browser_ssid": ssid}
+	if request.Email != "" {
+		metadata["email"] = normalizeEmail(request.Email)
+	}
+	if discount.Code != "" {
+		metadata["promo_code"] = discount.Code
+	}
+
+	intent, err := cs.Stripe.CreatePaymentIntent(total, metadata, request.IdempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+	}
+
+	var email sql.NullString
+	if request.Email != "" {
+		email = sql.NullString{String: normalizeEmail(request.Email), Valid: true}
+	}
+	var promoID sql.NullInt64
+	if discount.PromotionID != 0 {
+		promoID = sql.NullInt64{Int64: discount.PromotionID, Valid: true}
+	}
+	// the order is held to this address, the label is bought on the shipment quoted for it
+	query := `
+		INSERT INTO checkouts (
+			stripe_ssid, browser_ssid, email, promo_id, subtotal_cents, shipping_cents,
+			discount_cents, tax_cents, total_cents, shipment_id, rate_id,
+			address_1, address_2, city, state, zipcode, country
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	if _, err := cs.DB.Exec(query, intent.ID, ssid, email, promoID, subtotal, shipping, discount.Amount, tax, total, request.ShipmentID, request.RateID,
+		address.Line1, address.Line2, address.City, address.State, address.PostalCode, address.Country); err != nil {
+		return nil, fmt.Errorf("failed to store checkout: %w", err)
+	}
+
+	return intent, nil
+}
+
+// VerifyCheckout confirms the intent was created for this cart, that Stripe is holding the
+// amount we computed and that the cart has not been edited since the intent was created.
+// A discounted checkout must be ordered with the email the code was redeemed for and the
+// order must ship to the address shipping was quoted for, and somewhere taxed the same as
+// the address tax was charged on
+func (cs *CheckoutServiceImpl) VerifyCheckout(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error) {
+	checkout := structs.Checkout{PaymentIntentID: intent.ID}
+	var checkoutEmail, promoCode, shipmentID, rateID sql.NullString
+	var line1, line2, city, state, zip, country sql.NullString
+	var promoID sql.NullInt64
+
+	query := `
+		SELECT c.browser_ssid, c.email, c.promo_id, p.code, c.subtotal_cents, c.shipping_cents,
+			c.discount_cents, c.tax_cents, c.total_cents, c.shipment_id, c.rate_id,
+			c.address_1, c.address_2, c.city, c.state, c.zipcode, c.country
+		FROM checkouts c
+		LEFT JOIN promotions p ON p.promo_id = c.promo_id
+		WHERE c.stripe_ssid = ?
+	`
+	err := cs.DB.QueryRow(query, intent.ID).Scan(
+		&checkout.BrowserSSID, &checkoutEmail, &promoID, &promoCode,
+		&checkout.Subtotal, &checkout.Shipping, &checkout.Discount.Amount, &checkout.Tax, &checkout.Total,
+		&shipmentID, &rateID, &line1, &line2, &city, &state, &zip, &country,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.Checkout{}, ErrCheckoutNotFound
+	}
+	if err != nil {
+		return structs.Checkout{}, fmt.Errorf("failed to load checkout: %w", err)
+	}
+
+	checkout.Email = checkoutEmail.String
+	checkout.Discount.PromotionID = promoID.Int64
+	checkout.Discount.Code = promoCode.String
+	checkout.ShipmentID = shipmentID.String
+	checkout.RateID = rateID.String
+	if country.Valid {
+		checkout.Address = &structs.AddressInfo{
+			Line1:      line1.String,
+			Line2:      line2.String,
+			City:       city.String,
+			State:      state.String,
+			PostalCode: zip.String,
+			Country:    country.String,
+		}
+	}
+
+	if checkout.BrowserSSID != ssid {
+		return structs.Checkout{}, ErrCheckoutMismatch
+	}
+
+	if checkout.Discount.PromotionID != 0 && checkout.Email != normalizeEmail(email) {
+		return structs.Checkout{}, ErrPromoEmailMismatch
+	}
+
+	if intent.Amount != checkout.Total {
+		return structs.Checkout{}, ErrAmountMismatch
+	}
+
+	if checkout.Address != nil && !sameAddress(*checkout.Address, address) {
+		return structs.Checkout{}, ErrAddressChanged
+	}
+
+	cart, err := cs.Cart.GetCartItems(ssid)
+	if err != nil {
+		return structs.Checkout{}, fmt.Errorf("failed to load cart: %w", err)
+	}
+
+	current, err := cs.Pricing.PriceCart(cart)
+	if err != nil {
+		return structs.Checkout{}, fmt.Errorf("failed to price cart: %w", err)
+	}
+
+	if current != checkout.Subtotal {
+		return structs.Checkout{}, ErrCartChanged
+	}
+
+	tax, err := cs.Tax.CalculateTax(address, checkout.Subtotal+checkout.Shipping-checkout.Discount.Amount)
+	if err != nil {
+		return structs.Checkout{}, fmt.Errorf("failed to calculate tax: %w", err)
+	}
+
+	if tax != checkout.Tax {
+		return structs.Checkout{}, ErrTaxChanged
+	}
+
+	return checkout, nil
+}
+
+// VoidCheckout records why a checkout's authorization was released instead of captured
+func (cs *CheckoutServiceImpl) VoidCheckout(intentID string, reason string) error {
+	query := `UPDATE checkouts SET status = 'voided', failure_reason = ? WHERE stripe_ssid = ?`
+	result, err := cs.DB.Exec(query, reason, intentID)
+	if err != nil {
+		return fmt.Errorf("failed to void checkout: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to read affected rows: %w", err)
+	}
+	if affected == 0 {
+		return ErrCheckoutNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,723 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stripe/stripe-go/v75"
+)
+
+type MockStripeService struct {
+	mock.Mock
+}
+
+func (m *MockStripeService) CreatePaymentIntent(amount int64, metadata map[string]string, idempotencyKey string) (*stripe.PaymentIntent, error) {
+	args := m.Called(amount, metadata, idempotencyKey)
+	return args.Get(0).(*stripe.PaymentIntent), args.Error(1)
+}
+
+func (m *MockStripeService) GetPaymentIntent(id string) (*stripe.PaymentIntent, error) {
+	args := m.Called(id)
+	return args.Get(0).(*stripe.PaymentIntent), args.Error(1)
+}
+
+func (m *MockStripeService) CapturePaymentIntent(id string) (*stripe.PaymentIntent, error) {
+	args := m.Called(id)
+	return args.Get(0).(*stripe.PaymentIntent), args.Error(1)
+}
+
+func (m *MockStripeService) CancelPaymentIntent(id string) (*stripe.PaymentIntent, error) {
+	args := m.Called(id)
+	return args.Get(0).(*stripe.PaymentIntent), args.Error(1)
+}
+
+func (m *MockStripeService) RefundPaymentIntent(id string) (*stripe.Refund, error) {
+	args := m.Called(id)
+	return args.Get(0).(*stripe.Refund), args.Error(1)
+}
+
+func (m *MockStripeService) GetBalanceTransaction(intentID string) (*stripe.BalanceTransaction, error) {
+	args := m.Called(intentID)
+	return args.Get(0).(*stripe.BalanceTransaction), args.Error(1)
+}
+
+type MockCartService struct {
+	mock.Mock
+}
+
+func (m *MockCartService) InsertCartItem(item structs.CartItem) error {
+	return m.Called(item).Error(0)
+}
+
+func (m *MockCartService) GetCartItems(ssid string) ([]structs.CartItem, error) {
+	args := m.Called(ssid)
+	return args.Get(0).([]structs.CartItem), args.Error(1)
+}
+
+func (m *MockCartService) UpdateCartItemQuantity(ssid string, itemID int, quantity int) error {
+	return m.Called(ssid, itemID, quantity).Error(0)
+}
+
+func (m *MockCartService) RemoveCartItem(ssid string, itemID int) error {
+	return m.Called(ssid, itemID).Error(0)
+}
+
+func (m *MockCartService) ClearCart(ssid string) error {
+	return m.Called(ssid).Error(0)
+}
+
+var testCart = []structs.CartItem{
+	{ItemID: 1, SSID: "ssid123", Quantity: 2, TemplateType: "solid"},
+	{ItemID: 2, SSID: "ssid123", Quantity: 1, TemplateType: "text"},
+}
+
+const testCartTotal = int64(2*1499 + 1899)
+
+var editedCart = []structs.CartItem{{ItemID: 1, SSID: "ssid123", Quantity: 5, TemplateType: "solid"}}
+
+func TestCreateCheckout(t *testing.T) {
+	quoted := structs.CheckoutRequest{BrowserSSID: "ssid123", Address: &ohioAddress, ShipmentID: "shp_123", RateID: "rate_2"}
+	quoteRate := func(m *MockShippingService) {
+		m.On("GetRate", "shp_123", "rate_2", ohioAddress).Return(structs.ShippingRate{RateID: "rate_2", Amount: 795}, nil)
+	}
+
+	tests := []struct {
+		desc         string
+		request      structs.CheckoutRequest
+		mockCart     func(*MockCartService)
+		mockPrice    func(*MockPricingService)
+		mockPromo    func(*MockPromotionService)
+		mockTax      func(*MockTaxService)
+		mockShipping func(*MockShippingService)
+		mockStripe   func(*MockStripeService)
+		mockDB       func(sqlmock.Sqlmock)
+		wantErr      bool
+		wantErrMsg   string
+	}{
+		{
+			desc:    "successfully create checkout",
+			request: quoted,
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: quoteRate,
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, testCartTotal+795).Return(int64(0), nil)
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("CreatePaymentIntent", testCartTotal+795, map[string]string{"browser_ssid": "ssid123"}, "").
+					Return(&stripe.PaymentIntent{ID: "pi_123", Amount: testCartTotal + 795}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT INTO checkouts`).
+					WithArgs("pi_123", "ssid123", nil, nil, testCartTotal, int64(795), int64(0), int64(0), testCartTotal+795, "shp_123", "rate_2",
+						"1 Tee Box Ln", "", "Columbus", "OH", "43215", "US").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc: "promo code lowers the intent amount",
+			request: structs.CheckoutRequest{BrowserSSID: "ssid123", Email: "Golfer@Example.com", PromoCode: "fore10", IdempotencyKey: "key-1",
+				Address: &ohioAddress, ShipmentID: "shp_123", RateID: "rate_2"},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: quoteRate,
+			mockPromo: func(m *MockPromotionService) {
+				m.On("ApplyPromotion", "fore10", "Golfer@Example.com", testCart, int64(795)).
+					Return(structs.Discount{PromotionID: 7, Code: "FORE10", Amount: 489}, nil)
+			},
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, testCartTotal+795-489).Return(int64(0), nil)
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("CreatePaymentIntent", testCartTotal+795-489, map[string]string{"browser_ssid": "ssid123", "email": "golfer@example.com", "promo_code": "FORE10"}, "key-1").
+					Return(&stripe.PaymentIntent{ID: "pi_123", Amount: testCartTotal + 795 - 489}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT INTO checkouts`).
+					WithArgs("pi_123", "ssid123", "golfer@example.com", int64(7), testCartTotal, int64(795), int64(489), int64(0), testCartTotal+795-489, "shp_123", "rate_2",
+						"1 Tee Box Ln", "", "Columbus", "OH", "43215", "US").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc: "tax is charged on the discounted amount for the shipping address",
+			request: structs.CheckoutRequest{BrowserSSID: "ssid123", Email: "golfer@example.com", PromoCode: "fore10",
+				Address: &ohioAddress, ShipmentID: "shp_123", RateID: "rate_2"},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: quoteRate,
+			mockPromo: func(m *MockPromotionService) {
+				m.On("ApplyPromotion", "fore10", "golfer@example.com", testCart, int64(795)).
+					Return(structs.Discount{PromotionID: 7, Code: "FORE10", Amount: 489}, nil)
+			},
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, testCartTotal+795-489).Return(int64(253), nil)
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("CreatePaymentIntent", testCartTotal+795-489+253, map[string]string{"browser_ssid": "ssid123", "email": "golfer@example.com", "promo_code": "FORE10"}, "").
+					Return(&stripe.PaymentIntent{ID: "pi_123", Amount: testCartTotal + 795 - 489 + 253}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT INTO checkouts`).
+					WithArgs("pi_123", "ssid123", "golfer@example.com", int64(7), testCartTotal, int64(795), int64(489), int64(253), testCartTotal+795-489+253, "shp_123", "rate_2",
+						"1 Tee Box Ln", "", "Columbus", "OH", "43215", "US").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc:    "tax lookup fails",
+			request: quoted,
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: quoteRate,
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, testCartTotal+795).Return(int64(0), errors.New("db down"))
+			},
+			mockStripe: func(m *MockStripeService) {},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: "failed to calculate tax",
+		},
+		{
+			desc:    "chosen shipping rate is charged and can be discounted",
+			request: structs.CheckoutRequest{BrowserSSID: "ssid123", Email: "golfer@example.com", PromoCode: "SHIPFREE", Address: &ohioAddress, ShipmentID: "shp_123", RateID: "rate_2"},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: func(m *MockShippingService) {
+				m.On("GetRate", "shp_123", "rate_2", ohioAddress).Return(structs.ShippingRate{RateID: "rate_2", Amount: 795}, nil)
+			},
+			mockPromo: func(m *MockPromotionService) {
+				m.On("ApplyPromotion", "SHIPFREE", "golfer@example.com", testCart, int64(795)).
+					Return(structs.Discount{PromotionID: 9, Code: "SHIPFREE", Amount: 795}, nil)
+			},
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, testCartTotal).Return(int64(282), nil)
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("CreatePaymentIntent", testCartTotal+282, map[string]string{"browser_ssid": "ssid123", "email": "golfer@example.com", "promo_code": "SHIPFREE"}, "").
+					Return(&stripe.PaymentIntent{ID: "pi_123", Amount: testCartTotal + 282}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT INTO checkouts`).
+					WithArgs("pi_123", "ssid123", "golfer@example.com", int64(9), testCartTotal, int64(795), int64(795), int64(282), testCartTotal+282, "shp_123", "rate_2",
+						"1 Tee Box Ln", "", "Columbus", "OH", "43215", "US").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc:    "rate quoted for another address",
+			request: structs.CheckoutRequest{BrowserSSID: "ssid123", Address: &ohioAddress, ShipmentID: "shp_123", RateID: "rate_2"},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: func(m *MockShippingService) {
+				m.On("GetRate", "shp_123", "rate_2", ohioAddress).Return(structs.ShippingRate{}, ErrQuoteAddressMismatch)
+			},
+			mockStripe: func(m *MockStripeService) {},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: ErrQuoteAddressMismatch.Error(),
+		},
+		{
+			desc:    "checkout without an address can't be taxed",
+			request: structs.CheckoutRequest{BrowserSSID: "ssid123", ShipmentID: "shp_123", RateID: "rate_2"},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice:  func(m *MockPricingService) {},
+			mockStripe: func(m *MockStripeService) {},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: ErrMissingAddress.Error(),
+		},
+		{
+			desc:    "checkout without a quoted rate",
+			request: structs.CheckoutRequest{BrowserSSID: "ssid123", Address: &ohioAddress},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockStripe: func(m *MockStripeService) {},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: ErrIncompleteRate.Error(),
+		},
+		{
+			desc:    "rate without its shipment",
+			request: structs.CheckoutRequest{BrowserSSID: "ssid123", Address: &ohioAddress, RateID: "rate_2"},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockStripe: func(m *MockStripeService) {},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: ErrIncompleteRate.Error(),
+		},
+		{
+			desc: "promo code rejected",
+			request: structs.CheckoutRequest{BrowserSSID: "ssid123", Email: "golfer@example.com", PromoCode: "OLD",
+				Address: &ohioAddress, ShipmentID: "shp_123", RateID: "rate_2"},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: quoteRate,
+			mockPromo: func(m *MockPromotionService) {
+				m.On("ApplyPromotion", "OLD", "golfer@example.com", testCart, int64(795)).
+					Return(structs.Discount{}, ErrPromotionExpired)
+			},
+			mockStripe: func(m *MockStripeService) {},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: ErrPromotionExpired.Error(),
+		},
+		{
+			desc: "empty cart",
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return([]structs.CartItem{}, nil)
+			},
+			mockPrice:  func(m *MockPricingService) {},
+			mockStripe: func(m *MockStripeService) {},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: ErrEmptyCart.Error(),
+		},
+		{
+			desc:    "unknown template type",
+			request: quoted,
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return([]structs.CartItem{{Quantity: 1, TemplateType: "gold"}}, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", mock.Anything).Return(int64(0), ErrUnknownProduct)
+			},
+			mockStripe: func(m *MockStripeService) {},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: "failed to price cart",
+		},
+		{
+			desc:    "stripe failure",
+			request: quoted,
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: quoteRate,
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, testCartTotal+795).Return(int64(0), nil)
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("CreatePaymentIntent", mock.Anything, mock.Anything, mock.Anything).
+					Return((*stripe.PaymentIntent)(nil), errors.New("card network down"))
+			},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: "failed to create payment intent",
+		},
+		{
+			desc:    "checkout insert fails",
+			request: quoted,
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockPrice: func(m *MockPricingService) {
+				m.On("PriceCart", testCart).Return(testCartTotal, nil)
+			},
+			mockShipping: quoteRate,
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, testCartTotal+795).Return(int64(0), nil)
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("CreatePaymentIntent", mock.Anything, mock.Anything, mock.Anything).
+					Return(&stripe.PaymentIntent{ID: "pi_123"}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT INTO checkouts`).WillReturnError(errors.New("duplicate key"))
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to store checkout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			cart := new(MockCartService)
+			tt.mockCart(cart)
+			pricing := new(MockPricingService)
+			tt.mockPrice(pricing)
+			promotions := new(MockPromotionService)
+			if tt.mockPromo != nil {
+				tt.mockPromo(promotions)
+			}
+			tax := new(MockTaxService)
+			if tt.mockTax != nil {
+				tt.mockTax(tax)
+			}
+			shipping := new(MockShippingService)
+			if tt.mockShipping != nil {
+				tt.mockShipping(shipping)
+			}
+			stripeSvc := new(MockStripeService)
+			tt.mockStripe(stripeSvc)
+
+			request := tt.request
+			if request.BrowserSSID == "" {
+				request.BrowserSSID = "ssid123"
+			}
+
+			service := NewCheckoutService(db, cart, pricing, promotions, tax, shipping, stripeSvc)
+			intent, err := service.CreateCheckout(request)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "pi_123", intent.ID)
+			}
+
+			cart.AssertExpectations(t)
+			pricing.AssertExpectations(t)
+			promotions.AssertExpectations(t)
+			tax.AssertExpectations(t)
+			shipping.AssertExpectations(t)
+			stripeSvc.AssertExpectations(t)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestVerifyCheckout(t *testing.T) {
+	cartTotal := testCartTotal
+	columns := []string{"browser_ssid", "email", "promo_id", "code", "subtotal_cents", "shipping_cents", "discount_cents", "tax_cents", "total_cents", "shipment_id", "rate_id",
+		"address_1", "address_2", "city", "state", "zipcode", "country"}
+
+	tests := []struct {
+		desc     string
+		intent   *stripe.PaymentIntent
+		ssid     string
+		email    string
+		address  structs.AddressInfo
+		mockCart func(*MockCartService)
+		mockTax  func(*MockTaxService)
+		mockDB   func(sqlmock.Sqlmock)
+		wantErr  error
+		wantShip *structs.Checkout
+	}{
+		{
+			desc:   "checkout matches",
+			intent: &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal},
+			ssid:   "ssid123",
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT (.+) FROM checkouts c LEFT JOIN promotions p ON p.promo_id = c.promo_id WHERE c.stripe_ssid = \?`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", nil, nil, nil, cartTotal, 0, 0, 0, cartTotal, nil, nil, nil, nil, nil, nil, nil, nil))
+			},
+		},
+		{
+			desc:     "unknown intent",
+			intent:   &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal},
+			ssid:     "ssid123",
+			mockCart: func(m *MockCartService) {},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns))
+			},
+			wantErr: ErrCheckoutNotFound,
+		},
+		{
+			desc:     "intent created for another session",
+			intent:   &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal},
+			ssid:     "ssid123",
+			mockCart: func(m *MockCartService) {},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("other", nil, nil, nil, cartTotal, 0, 0, 0, cartTotal, nil, nil, nil, nil, nil, nil, nil, nil))
+			},
+			wantErr: ErrCheckoutMismatch,
+		},
+		{
+			desc:     "authorized amount differs from computed total",
+			intent:   &stripe.PaymentIntent{ID: "pi_123", Amount: 100},
+			ssid:     "ssid123",
+			mockCart: func(m *MockCartService) {},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", nil, nil, nil, cartTotal, 0, 0, 0, cartTotal, nil, nil, nil, nil, nil, nil, nil, nil))
+			},
+			wantErr: ErrAmountMismatch,
+		},
+		{
+			desc:   "cart edited after checkout",
+			intent: &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal},
+			ssid:   "ssid123",
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(editedCart, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", nil, nil, nil, cartTotal, 0, 0, 0, cartTotal, nil, nil, nil, nil, nil, nil, nil, nil))
+			},
+			wantErr: ErrCartChanged,
+		},
+		{
+			desc:   "discounted checkout ordered with the redeeming email",
+			intent: &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal - 500},
+			ssid:   "ssid123",
+			email:  " Golfer@example.com",
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", "golfer@example.com", 7, "FIVEOFF", cartTotal, 0, 500, 0, cartTotal-500, nil, nil, nil, nil, nil, nil, nil, nil))
+			},
+		},
+		{
+			desc:     "discounted checkout ordered with another email",
+			intent:   &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal - 500},
+			ssid:     "ssid123",
+			email:    "friend@example.com",
+			mockCart: func(m *MockCartService) {},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", "golfer@example.com", 7, "FIVEOFF", cartTotal, 0, 500, 0, cartTotal-500, nil, nil, nil, nil, nil, nil, nil, nil))
+			},
+			wantErr: ErrPromoEmailMismatch,
+		},
+		{
+			desc:    "taxed checkout ships to the address it was taxed for",
+			intent:  &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal + 277},
+			ssid:    "ssid123",
+			address: ohioAddress,
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, cartTotal).Return(int64(277), nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", nil, nil, nil, cartTotal, 0, 0, 277, cartTotal+277, nil, nil, nil, nil, nil, nil, nil, nil))
+			},
+		},
+		{
+			desc:    "untaxed checkout ships to a taxed address",
+			intent:  &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal},
+			ssid:    "ssid123",
+			address: ohioAddress,
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, cartTotal).Return(int64(277), nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", nil, nil, nil, cartTotal, 0, 0, 0, cartTotal, nil, nil, nil, nil, nil, nil, nil, nil))
+			},
+			wantErr: ErrTaxChanged,
+		},
+		{
+			desc:    "shipping is part of the verified total",
+			intent:  &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal + 795 + 328},
+			ssid:    "ssid123",
+			address: ohioAddress,
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", ohioAddress, cartTotal+795).Return(int64(328), nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", nil, nil, nil, cartTotal, 795, 0, 328, cartTotal+795+328, "shp_123", "rate_2", "1 Tee Box Ln", nil, "Columbus", "OH", "43215", "US"))
+			},
+			wantShip: &structs.Checkout{ShipmentID: "shp_123", RateID: "rate_2", Shipping: 795},
+		},
+		{
+			desc:    "quoted address matches ignoring case and spacing",
+			intent:  &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal + 795 + 328},
+			ssid:    "ssid123",
+			address: structs.AddressInfo{Line1: "1 TEE BOX  LN", City: "columbus", State: "oh", PostalCode: "43215", Country: "US"},
+			mockCart: func(m *MockCartService) {
+				m.On("GetCartItems", "ssid123").Return(testCart, nil)
+			},
+			mockTax: func(m *MockTaxService) {
+				m.On("CalculateTax", mock.Anything, cartTotal+795).Return(int64(328), nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", nil, nil, nil, cartTotal, 795, 0, 328, cartTotal+795+328, "shp_123", "rate_2", "1 Tee Box Ln", nil, "Columbus", "OH", "43215", "US"))
+			},
+		},
+		{
+			// same zip and tax, but the label would be bought for the street that was quoted
+			desc:     "order ships somewhere other than the quoted address",
+			intent:   &stripe.PaymentIntent{ID: "pi_123", Amount: cartTotal + 795 + 328},
+			ssid:     "ssid123",
+			address:  structs.AddressInfo{Line1: "99 Fairway Dr", City: "Columbus", State: "OH", PostalCode: "43215", Country: "US"},
+			mockCart: func(m *MockCartService) {},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM checkouts c`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ssid123", nil, nil, nil, cartTotal, 795, 0, 328, cartTotal+795+328, "shp_123", "rate_2", "1 Tee Box Ln", nil, "Columbus", "OH", "43215", "US"))
+			},
+			wantErr: ErrAddressChanged,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			cart := new(MockCartService)
+			tt.mockCart(cart)
+
+			pricing := new(MockPricingService)
+			pricing.On("PriceCart", testCart).Return(testCartTotal, nil)
+			pricing.On("PriceCart", editedCart).Return(int64(5*1499), nil)
+
+			tax := new(MockTaxService)
+			if tt.mockTax != nil {
+				tt.mockTax(tax)
+			} else {
+				tax.On("CalculateTax", structs.AddressInfo{}, tt.intent.Amount).Return(int64(0), nil).Maybe()
+			}
+
+			service := NewCheckoutService(db, cart, pricing, new(MockPromotionService), tax, new(MockShippingService), new(MockStripeService))
+			checkout, err := service.VerifyCheckout(tt.intent, tt.ssid, tt.email, tt.address)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.intent.Amount, checkout.Total)
+				if tt.wantShip != nil {
+					assert.Equal(t, tt.wantShip.Shipping, checkout.Shipping)
+					assert.Equal(t, tt.wantShip.ShipmentID, checkout.ShipmentID)
+					assert.Equal(t, tt.wantShip.RateID, checkout.RateID)
+				}
+			}
+
+			cart.AssertExpectations(t)
+			tax.AssertExpectations(t)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestVoidCheckout(t *testing.T) {
+	tests := []struct {
+		desc    string
+		mockDB  func(sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			desc: "reason recorded",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE checkouts SET status = 'voided', failure_reason = \? WHERE stripe_ssid = \?`).
+					WithArgs("failed to buy shipping label", "pi_123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			desc: "unknown intent",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE checkouts`).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrCheckoutNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewCheckoutService(db, new(MockCartService), new(MockPricingService), new(MockPromotionService), new(MockTaxService), new(MockShippingService), new(MockStripeService))
+			err = service.VoidCheckout("pi_123", "failed to buy shipping label")
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
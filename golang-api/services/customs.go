@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+const (
+	// every marker is printed at the shop
+	ORIGIN_COUNTRY = "US"
+	// exports under $2,500 per HS code don't need an EEI filing
+	CUSTOMS_EEL_PFC = "NOEEI 30.37(a)"
+)
+
+var ErrCountryNotServed = errors.New("we don't ship to this country")
+
+// customsProduct is what gets declared for one marker of a product
+type customsProduct struct {
+	description    string
+	hsTariffNumber string
+	unitWeight     float64
+}
+
+// DeclareContents lists a cart's markers for the customs form of an international shipment,
+// one line per product valued at its current price
+func (ps *PackagingServiceImpl) DeclareContents(ssid string) ([]structs.CustomsItem, error) {
+	cart, err := ps.Cart.GetCartItems(ssid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cart: %w", err)
+	}
+
+	products, err := ps.customsProducts()
+	if err != nil {
+		return nil, err
+	}
+
+	prices := map[string]int64{}
+	for _, item := range cart {
+		key := productKey(item)
+		if _, ok := prices[key]; ok {
+			continue
+		}
+
+		price, err := ps.Pricing.GetPrice(item.TemplateType, item.SizeVariant)
+		if err != nil {
+			return nil, err
+		}
+		prices[key] = price.UnitAmount
+	}
+
+	return declareContents(cart, products, prices)
+}
+
+func (ps *PackagingServiceImpl) customsProducts() (map[string]customsProduct, error) {
+	query := `SELECT template_type, size_variant, customs_description, hs_tariff_number, unit_weight_oz FROM products`
+	rows, err := ps.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customs info: %w", err)
+	}
+	defer rows.Close()
+
+	products := map[string]customsProduct{}
+	for rows.Next() {
+		var templateType, sizeVariant string
+		var product customsProduct
+		if err := rows.Scan(&templateType, &sizeVariant, &product.description, &product.hsTariffNumber, &product.unitWeight); err != nil {
+			return nil, fmt.Errorf("failed to scan customs info: %w", err)
+		}
+		products[templateType+"/"+sizeVariant] = product
+	}
+
+	return products, nil
+}
+
+// declareContents merges the cart into one customs line per product, prices are the unit
+// amounts in cents keyed like products
+func declareContents(cart []structs.CartItem, products map[string]customsProduct, prices map[string]int64) ([]structs.CustomsItem, error) {
+	if len(cart) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	var items []structs.CustomsItem
+	lines := map[string]int{}
+	for _, item := range cart {
+		key := productKey(item)
+		product, ok := products[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProduct, key)
+		}
+
+		i, ok := lines[key]
+		if !ok {
+			i = len(items)
+			lines[key] = i
+			items = append(items, structs.CustomsItem{
+				Description:    product.description,
+				HSTariffNumber: product.hsTariffNumber,
+				OriginCountry:  ORIGIN_COUNTRY,
+			})
+		}
+
+		items[i].Quantity += item.Quantity
+		items[i].Value += prices[key] * int64(item.Quantity)
+		// EasyPost takes weight to a tenth of an ounce
+		items[i].Weight = math.Round(product.unitWeight*float64(items[i].Quantity)*10) / 10
+	}
+
+	return items, nil
+}
+
+func productKey(item structs.CartItem) string {
+	sizeVariant := item.SizeVariant
+	if sizeVariant == "" {
+		sizeVariant = DEFAULT_SIZE_VARIANT
+	}
+	return item.TemplateType + "/" + sizeVariant
+}
+
+// destinationCountry is the ISO code an address ships to, EasyPost treats a missing country as the US
+func destinationCountry(address structs.AddressInfo) string {
+	country := strings.ToUpper(strings.TrimSpace(address.Country))
+	if country == "" {
+		return ORIGIN_COUNTRY
+	}
+	return country
+}
+
+func isInternational(address structs.AddressInfo) bool {
+	return destinationCountry(address) != ORIGIN_COUNTRY
+}
+
+// checkDestination rejects addresses outside SHIP_TO_COUNTRIES, only domestic orders
+// are shipped when none are configured
+func checkDestination(address structs.AddressInfo) error {
+	countries := config.SHIP_TO_COUNTRIES
+	if len(countries) == 0 {
+		countries = []string{ORIGIN_COUNTRY}
+	}
+
+	country := destinationCountry(address)
+	if !slices.Contains(countries, country) {
+		return fmt.Errorf("%w: %s", ErrCountryNotServed, country)
+	}
+
+	return nil
+}
+
+// shipmentIncoterm is the requested incoterm or the shop's default
+func shipmentIncoterm(incoterm string) string {
+	if incoterm != "" {
+		return incoterm
+	}
+	if config.INCOTERM != "" {
+		return config.INCOTERM
+	}
+	return "DDU"
+}
+
+// dutiesPaidBy says who the carrier bills for duties and taxes under an incoterm
+func dutiesPaidBy(incoterm string) string {
+	if incoterm == "DDP" {
+		return "sender"
+	}
+	return "recipient"
+}
+
+// internationalShipment adds the customs declaration and incoterm to a shipment leaving the country
+func internationalShipment(shipment *easypost.Shipment, items []structs.CustomsItem, incoterm string) {
+	customs := &easypost.CustomsInfo{
+		EELPFC:            CUSTOMS_EEL_PFC,
+		ContentsType:      "merchandise",
+		CustomsCertify:    true,
+		CustomsSigner:     config.CUSTOMS_SIGNER,
+		NonDeliveryOption: "return",
+		RestrictionType:   "none",
+	}
+	for _, item := range items {
+		customs.CustomsItems = append(customs.CustomsItems, &easypost.CustomsItem{
+			Description:    item.Description,
+			Quantity:       float64(item.Quantity),
+			Value:          float64(item.Value) / 100,
+			Weight:         item.Weight,
+			HSTariffNumber: item.HSTariffNumber,
+			OriginCountry:  item.OriginCountry,
+			Currency:       "USD",
+		})
+	}
+
+	shipment.CustomsInfo = customs
+	shipment.Options = &easypost.ShipmentOptions{Incoterm: incoterm}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCustomsProducts = map[string]customsProduct{
+	"solid/standard": {description: "Plastic golf ball markers", hsTariffNumber: "950639", unitWeight: 0.45},
+	"text/standard":  {description: "Plastic golf ball markers", hsTariffNumber: "950639", unitWeight: 0.5},
+	"custom/large":   {description: "Engraved plastic golf ball markers", hsTariffNumber: "392690", unitWeight: 0.8},
+}
+
+func TestDeclareCartContents(t *testing.T) {
+	prices := map[string]int64{"solid/standard": 1499, "text/standard": 1899, "custom/large": 2499}
+
+	tests := []struct {
+		desc    string
+		cart    []structs.CartItem
+		want    []structs.CustomsItem
+		wantErr error
+	}{
+		{
+			desc: "one line per product with line totals",
+			cart: []structs.CartItem{
+				{Quantity: 2, TemplateType: "solid"},
+				{Quantity: 3, TemplateType: "custom", SizeVariant: "large"},
+				{Quantity: 1, TemplateType: "solid", SizeVariant: "standard"},
+			},
+			want: []structs.CustomsItem{
+				{Description: "Plastic golf ball markers", HSTariffNumber: "950639", Quantity: 3, Value: 4497, Weight: 1.4, OriginCountry: "US"},
+				{Description: "Engraved plastic golf ball markers", HSTariffNumber: "392690", Quantity: 3, Value: 7497, Weight: 2.4, OriginCountry: "US"},
+			},
+		},
+		{
+			desc:    "product missing from the catalog",
+			cart:    []structs.CartItem{{Quantity: 1, TemplateType: "photo"}},
+			wantErr: ErrUnknownProduct,
+		},
+		{
+			desc:    "empty cart",
+			wantErr: ErrEmptyCart,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			items, err := declareContents(tt.cart, testCustomsProducts, prices)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, items)
+			}
+		})
+	}
+}
+
+func TestDeclareContents(t *testing.T) {
+	customsColumns := []string{"template_type", "size_variant", "customs_description", "hs_tariff_number", "unit_weight_oz"}
+
+	tests := []struct {
+		desc       string
+		mockDB     func(sqlmock.Sqlmock)
+		priceErr   error
+		want       []structs.CustomsItem
+		wantErrMsg string
+	}{
+		{
+			desc: "cart valued at current prices",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT template_type, size_variant, customs_description, hs_tariff_number, unit_weight_oz FROM products`).
+					WillReturnRows(sqlmock.NewRows(customsColumns).
+						AddRow("solid", "standard", "Plastic golf ball markers", "950639", 0.45).
+						AddRow("text", "standard", "Plastic golf ball markers", "950639", 0.5))
+			},
+			want: []structs.CustomsItem{
+				{Description: "Plastic golf ball markers", HSTariffNumber: "950639", Quantity: 2, Value: 2998, Weight: 0.9, OriginCountry: "US"},
+				{Description: "Plastic golf ball markers", HSTariffNumber: "950639", Quantity: 1, Value: 1899, Weight: 0.5, OriginCountry: "US"},
+			},
+		},
+		{
+			desc: "product query fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM products`).WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "failed to list customs info: db down",
+		},
+		{
+			desc: "cart item has no price",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM products`).WillReturnRows(sqlmock.NewRows(customsColumns))
+			},
+			priceErr:   ErrUnknownProduct,
+			wantErrMsg: ErrUnknownProduct.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			cart := new(MockCartService)
+			cart.On("GetCartItems", "ssid123").Return(testCart, nil)
+			pricing := new(MockPricingService)
+			pricing.On("GetPrice", "solid", "").Return(structs.Price{UnitAmount: 1499}, tt.priceErr)
+			pricing.On("GetPrice", "text", "").Return(structs.Price{UnitAmount: 1899}, tt.priceErr)
+
+			items, err := NewPackagingService(db, cart, pricing).DeclareContents("ssid123")
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, items)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCheckDestination(t *testing.T) {
+	originalCountries := config.SHIP_TO_COUNTRIES
+	defer func() { config.SHIP_TO_COUNTRIES = originalCountries }()
+
+	tests := []struct {
+		desc      string
+		countries []string
+		country   string
+		wantErr   error
+	}{
+		{desc: "domestic", countries: []string{"US", "CA"}, country: "US"},
+		{desc: "allow-listed country", countries: []string{"US", "CA"}, country: " ca "},
+		{desc: "country not served", countries: []string{"US", "CA"}, country: "GB", wantErr: ErrCountryNotServed},
+		{desc: "missing country is domestic", countries: []string{"US"}, country: ""},
+		{desc: "only domestic without an allow-list", country: "CA", wantErr: ErrCountryNotServed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			config.SHIP_TO_COUNTRIES = tt.countries
+
+			err := checkDestination(structs.AddressInfo{Country: tt.country})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDutiesPaidBy(t *testing.T) {
+	assert.Equal(t, "recipient", dutiesPaidBy("DDU"))
+	assert.Equal(t, "sender", dutiesPaidBy("DDP"))
+}
@@ -18,6 +18,16 @@ func (e *EasyPostClientImpl) CreateShipment(shipment *easypost.Shipment) (*easyp
 	return e.client.CreateShipment(shipment)
 }
 
+func (e *EasyPostClientImpl) GetShipment(shipmentID string) (*easypost.Shipment, error) {
+	return e.client.GetShipment(shipmentID)
+}
+
+// VerifyAddress checks deliverability without failing the request, problems come back in
+// the address's delivery verification
+func (e *EasyPostClientImpl) VerifyAddress(address *easypost.Address) (*easypost.Address, error) {
+	return e.client.CreateAddress(address, &easypost.CreateAddressOptions{Verify: []string{"delivery"}})
+}
+
 func (e *EasyPostClientImpl) LowestShipmentRate(shipment *easypost.Shipment) (*easypost.Rate, error) {
 	rate, err := e.client.LowestShipmentRate(shipment)
 	if err != nil {
@@ -29,3 +39,17 @@ func (e *EasyPostClientImpl) LowestShipmentRate(shipment *easypost.Shipment) (*e
 func (e *EasyPostClientImpl) BuyShipment(shipmentID string, rate *easypost.Rate, insurance string) (*easypost.Shipment, error) {
 	return e.client.BuyShipment(shipmentID, rate, insurance)
 }
+
+func (e *EasyPostClientImpl) RefundShipment(shipmentID string) (*easypost.Shipment, error) {
+	return e.client.RefundShipment(shipmentID)
+}
+
+// CreateScanForm batches the shipments and creates the carrier's scan form for them, the
+// form may still be generating when it is returned
+func (e *EasyPostClientImpl) CreateScanForm(shipmentIDs ...string) (*easypost.ScanForm, error) {
+	return e.client.CreateScanForm(shipmentIDs...)
+}
+
+func (e *EasyPostClientImpl) GetScanForm(scanFormID string) (*easypost.ScanForm, error) {
+	return e.client.GetScanForm(scanFormID)
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/EasyPost/easypost-go/v4"
+)
+
+var usZipPattern = regexp.MustCompile(`^\d{5}(-\d{4})?$`)
+
+// FakeEasyPostClient stands in for EasyPost when running locally with USE_FAKES, it
+// rates and buys labels in memory and only rejects addresses that are obviously incomplete
+type FakeEasyPostClient struct {
+	mu        sync.Mutex
+	shipments map[string]*easypost.Shipment
+	scanForms map[string]*easypost.ScanForm
+	nextID    int
+}
+
+func NewFakeEasyPostClient() EasyPostClient {
+	return &FakeEasyPostClient{shipments: map[string]*easypost.Shipment{}, scanForms: map[string]*easypost.ScanForm{}}
+}
+
+func (f *FakeEasyPostClient) CreateShipment(shipment *easypost.Shipment) (*easypost.Shipment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	created := *shipment
+	created.ID = fmt.Sprintf("shp_fake_%d", f.nextID)
+	created.Rates = []*easypost.Rate{
+		{ID: created.ID + "_ground", ShipmentID: created.ID, Carrier: "USPS", Service: "GroundAdvantage", Rate: "5.25", EstDeliveryDays: 5},
+		{ID: created.ID + "_priority", ShipmentID: created.ID, Carrier: "USPS", Service: "Priority", Rate: "9.85", EstDeliveryDays: 2},
+	}
+	f.shipments[created.ID] = &created
+
+	return &created, nil
+}
+
+func (f *FakeEasyPostClient) GetShipment(shipmentID string) (*easypost.Shipment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	shipment, ok := f.shipments[shipmentID]
+	if !ok {
+		return nil, fmt.Errorf("shipment %s not found", shipmentID)
+	}
+	return shipment, nil
+}
+
+func (f *FakeEasyPostClient) VerifyAddress(address *easypost.Address) (*easypost.Address, error) {
+	verified := *address
+	verified.State = strings.ToUpper(strings.TrimSpace(address.State))
+	verified.Country = strings.ToUpper(strings.TrimSpace(address.Country))
+	verified.Zip = strings.TrimSpace(address.Zip)
+
+	var problems []*easypost.AddressVerificationFieldError
+	required := []struct{ field, value string }{
+		{"street1", verified.Street1}, {"city", verified.City}, {"zip", verified.Zip}, {"country", verified.Country},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			problems = append(problems, &easypost.AddressVerificationFieldError{Code: "E.ADDRESS.MISSING", Field: r.field, Message: r.field + " is required"})
+		}
+	}
+	if verified.Country == "US" && verified.Zip != "" && !usZipPattern.MatchString(verified.Zip) {
+		problems = append(problems, &easypost.AddressVerificationFieldError{Code: "E.ZIP.INVALID", Field: "zip", Message: "Invalid zip code"})
+	}
+
+	verified.Verifications = &easypost.AddressVerifications{
+		Delivery: &easypost.AddressVerification{Success: len(problems) == 0, Errors: problems},
+	}
+	return &verified, nil
+}
+
+func (f *FakeEasyPostClient) LowestShipmentRate(shipment *easypost.Shipment) (*easypost.Rate, error) {
+	if len(shipment.Rates) == 0 {
+		return nil, fmt.Errorf("shipment %s has no rates", shipment.ID)
+	}
+	return shipment.Rates[0], nil
+}
+
+func (f *FakeEasyPostClient) BuyShipment(shipmentID string, rate *easypost.Rate, insurance string) (*easypost.Shipment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	shipment, ok := f.shipments[shipmentID]
+	if !ok {
+		return nil, fmt.Errorf("shipment %s not found", shipmentID)
+	}
+
+	for _, quoted := range shipment.Rates {
+		if quoted.ID == rate.ID {
+			shipment.SelectedRate = quoted
+			shipment.TrackingCode = "FAKE" + strings.ToUpper(strings.TrimPrefix(shipmentID, "shp_fake_"))
+			shipment.PostageLabel = &easypost.PostageLabel{LabelURL: "https://example.com/labels/" + shipmentID + ".pdf"}
+			return shipment, nil
+		}
+	}
+
+	return nil, fmt.Errorf("rate %s not found on shipment %s", rate.ID, shipmentID)
+}
+
+func (f *FakeEasyPostClient) RefundShipment(shipmentID string) (*easypost.Shipment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	shipment, ok := f.shipments[shipmentID]
+	if !ok {
+		return nil, fmt.Errorf("shipment %s not found", shipmentID)
+	}
+	shipment.RefundStatus = "submitted"
+	return shipment, nil
+}
+
+func (f *FakeEasyPostClient) CreateScanForm(shipmentIDs ...string) (*easypost.ScanForm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	scanForm := &easypost.ScanForm{
+		ID:      fmt.Sprintf("sf_fake_%d", f.nextID),
+		BatchID: fmt.Sprintf("batch_fake_%d", f.nextID),
+		Status:  "created",
+	}
+	scanForm.FormURL = "https://example.com/scan_forms/" + scanForm.ID + ".pdf"
+
+	for _, shipmentID := range shipmentIDs {
+		shipment, ok := f.shipments[shipmentID]
+		if !ok || shipment.TrackingCode == "" {
+			return nil, fmt.Errorf("shipment %s has no label", shipmentID)
+		}
+		scanForm.TrackingCodes = append(scanForm.TrackingCodes, shipment.TrackingCode)
+	}
+	f.scanForms[scanForm.ID] = scanForm
+
+	return scanForm, nil
+}
+
+func (f *FakeEasyPostClient) GetScanForm(scanFormID string) (*easypost.ScanForm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	scanForm, ok := f.scanForms[scanFormID]
+	if !ok {
+		return nil, fmt.Errorf("scan form %s not found", scanFormID)
+	}
+	return scanForm, nil
+}
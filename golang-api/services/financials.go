@@ -0,0 +1,98 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+var ErrNoBalanceTransaction = errors.New("payment has no settled charge")
+
+type FinancialServiceImpl struct {
+	DB     *sql.DB
+	Stripe StripeService
+	Logger *zap.SugaredLogger
+}
+
+func NewFinancialService(db *sql.DB, stripe StripeService, logger *zap.SugaredLogger) FinancialService {
+	return &FinancialServiceImpl{DB: db, Stripe: stripe, Logger: logger}
+}
+
+// RecordTransaction writes what Stripe settled for an order's payment, the charged amount,
+// Stripe's fee and the net revenue. Recording the same payment twice keeps the first row
+func (fs *FinancialServiceImpl) RecordTransaction(intentID string) error {
+	var orderID int64
+	orderQuery := `SELECT order_id FROM orders WHERE stripe_ssid = ?`
+	err := fs.DB.QueryRow(orderQuery, intentID).Scan(&orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up order: %w", err)
+	}
+
+	balance, err := fs.Stripe.GetBalanceTransaction(intentID)
+	if err != nil {
+		return err
+	}
+
+	// financials store dollars like orders do
+	query := `INSERT IGNORE INTO financials (order_id, stripe_ssid, amount, fees, net_revenue) VALUES (?, ?, ?, ?, ?)`
+	_, err = fs.DB.Exec(query, orderID, intentID, centsToDollars(balance.Amount), centsToDollars(balance.Fee), centsToDollars(balance.Net))
+	if err != nil {
+		return fmt.Errorf("failed to insert financials: %w", err)
+	}
+
+	return nil
+}
+
+// BackfillTransactions records financials for past orders that have none and returns how
+// many were written. Orders whose payment never settled are skipped, other failures are
+// collected so one bad order doesn't stop the rest
+func (fs *FinancialServiceImpl) BackfillTransactions() (int, error) {
+	query := `
+		SELECT o.stripe_ssid
+		FROM orders o
+		LEFT JOIN financials f ON f.stripe_ssid = o.stripe_ssid
+		WHERE f.transaction_id IS NULL
+		ORDER BY o.order_id
+	`
+	rows, err := fs.DB.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find orders without financials: %w", err)
+	}
+	defer rows.Close()
+
+	var intentIDs []string
+	for rows.Next() {
+		var intentID string
+		if err := rows.Scan(&intentID); err != nil {
+			return 0, fmt.Errorf("failed to scan order: %w", err)
+		}
+		intentIDs = append(intentIDs, intentID)
+	}
+	rows.Close()
+
+	recorded := 0
+	var errs []error
+	for _, intentID := range intentIDs {
+		err := fs.RecordTransaction(intentID)
+		if errors.Is(err, ErrNoBalanceTransaction) {
+			fs.Logger.Infof("Skipping financials for %s: %v", intentID, err)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", intentID, err))
+			continue
+		}
+		recorded++
+	}
+
+	return recorded, errors.Join(errs...)
+}
+
+func centsToDollars(cents int64) float64 {
+	return float64(cents) / 100
+}
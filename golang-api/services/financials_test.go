@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/stripe-go/v75"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRecordTransaction(t *testing.T) {
+	tests := []struct {
+		desc       string
+		mockDB     func(sqlmock.Sqlmock)
+		mockStripe func(*MockStripeService)
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc: "settled charge is recorded in dollars",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT order_id FROM orders WHERE stripe_ssid = \?`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow(42))
+				mock.ExpectExec(`INSERT IGNORE INTO financials \(order_id, stripe_ssid, amount, fees, net_revenue\)`).
+					WithArgs(int64(42), "pi_123", 43.97, 1.58, 42.39).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("GetBalanceTransaction", "pi_123").Return(&stripe.BalanceTransaction{Amount: 4397, Fee: 158, Net: 4239}, nil)
+			},
+		},
+		{
+			desc: "no order for the intent",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT order_id FROM orders`).WillReturnRows(sqlmock.NewRows([]string{"order_id"}))
+			},
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			desc: "payment not captured yet",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT order_id FROM orders`).WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow(42))
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("GetBalanceTransaction", "pi_123").Return((*stripe.BalanceTransaction)(nil), ErrNoBalanceTransaction)
+			},
+			wantErr: ErrNoBalanceTransaction,
+		},
+		{
+			desc: "insert fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT order_id FROM orders`).WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow(42))
+				mock.ExpectExec(`INSERT IGNORE INTO financials`).WillReturnError(errors.New("db down"))
+			},
+			mockStripe: func(m *MockStripeService) {
+				m.On("GetBalanceTransaction", "pi_123").Return(&stripe.BalanceTransaction{Amount: 4397, Fee: 158, Net: 4239}, nil)
+			},
+			wantErrMsg: "failed to insert financials: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			stripeSvc := new(MockStripeService)
+			if tt.mockStripe != nil {
+				tt.mockStripe(stripeSvc)
+			}
+
+			service := NewFinancialService(db, stripeSvc, zap.NewNop().Sugar())
+			err = service.RecordTransaction("pi_123")
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.EqualError(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+			}
+
+			stripeSvc.AssertExpectations(t)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestBackfillTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM orders o LEFT JOIN financials f (.+) WHERE f.transaction_id IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"stripe_ssid"}).AddRow("pi_settled").AddRow("pi_uncaptured").AddRow("pi_broken"))
+
+	mock.ExpectQuery(`SELECT order_id FROM orders`).WithArgs("pi_settled").WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow(1))
+	mock.ExpectExec(`INSERT IGNORE INTO financials`).WithArgs(int64(1), "pi_settled", 10.0, 0.59, 9.41).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT order_id FROM orders`).WithArgs("pi_uncaptured").WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow(2))
+	mock.ExpectQuery(`SELECT order_id FROM orders`).WithArgs("pi_broken").WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow(3))
+
+	stripeSvc := new(MockStripeService)
+	stripeSvc.On("GetBalanceTransaction", "pi_settled").Return(&stripe.BalanceTransaction{Amount: 1000, Fee: 59, Net: 941}, nil)
+	stripeSvc.On("GetBalanceTransaction", "pi_uncaptured").Return((*stripe.BalanceTransaction)(nil), ErrNoBalanceTransaction)
+	stripeSvc.On("GetBalanceTransaction", "pi_broken").Return((*stripe.BalanceTransaction)(nil), errors.New("rate limited"))
+
+	core, observedLogs := observer.New(zap.DebugLevel)
+	service := NewFinancialService(db, stripeSvc, zap.New(core).Sugar())
+	recorded, err := service.BackfillTransactions()
+
+	assert.Equal(t, 1, recorded)
+	assert.EqualError(t, err, "pi_broken: rate limited")
+
+	skipped := observedLogs.FilterLevelExact(zapcore.InfoLevel).All()
+	if assert.Len(t, skipped, 1) {
+		assert.Equal(t, "Skipping financials for pi_uncaptured: payment has no settled charge", skipped[0].Message)
+	}
+
+	stripeSvc.AssertExpectations(t)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
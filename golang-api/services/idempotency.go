@@ -0,0 +1,83 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+var (
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	ErrRequestInProgress    = errors.New("a request with this idempotency key is still being processed")
+)
+
+type IdempotencyServiceImpl struct {
+	DB *sql.DB
+}
+
+func NewIdempotencyService(db *sql.DB) IdempotencyService {
+	return &IdempotencyServiceImpl{DB: db}
+}
+
+// Begin claims a key for a request on a route. It returns nil when the caller should handle
+// the request, or the stored response of the earlier request that used the same key
+func (is *IdempotencyServiceImpl) Begin(key string, route string, requestHash string) (*structs.StoredResponse, error) {
+	claimQuery := `INSERT IGNORE INTO idempotency_keys (idempotency_key, route, request_hash) VALUES (?, ?, ?)`
+	result, err := is.DB.Exec(claimQuery, key, route, requestHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read affected rows: %w", err)
+	}
+	if claimed == 1 {
+		return nil, nil
+	}
+
+	var storedHash string
+	var status sql.NullInt64
+	var body []byte
+	lookupQuery := `SELECT request_hash, response_status, response_body FROM idempotency_keys WHERE idempotency_key = ? AND route = ?`
+	err = is.DB.QueryRow(lookupQuery, key, route).Scan(&storedHash, &status, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the earlier request released the key between our insert and this read
+		return nil, ErrRequestInProgress
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up idempotency key: %w", err)
+	}
+
+	if storedHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	if !status.Valid {
+		return nil, ErrRequestInProgress
+	}
+
+	return &structs.StoredResponse{Status: int(status.Int64), Body: body}, nil
+}
+
+// Complete stores the response so retries with the same key are answered with it
+func (is *IdempotencyServiceImpl) Complete(key string, route string, response structs.StoredResponse) error {
+	query := `UPDATE idempotency_keys SET response_status = ?, response_body = ?, completed_at = NOW() WHERE idempotency_key = ? AND route = ?`
+	if _, err := is.DB.Exec(query, response.Status, response.Body, key, route); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+// Release frees a key whose request failed in a way worth retrying
+func (is *IdempotencyServiceImpl) Release(key string, route string) error {
+	query := `DELETE FROM idempotency_keys WHERE idempotency_key = ? AND route = ? AND response_status IS NULL`
+	if _, err := is.DB.Exec(query, key, route); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBeginIdempotentRequest(t *testing.T) {
+	tests := []struct {
+		desc         string
+		mockDB       func(sqlmock.Sqlmock)
+		wantResponse *structs.StoredResponse
+		wantErr      error
+		wantErrMsg   string
+	}{
+		{
+			desc: "new key is claimed",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).
+					WithArgs("key-1", "/handle-order", "hash").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc: "completed request is replayed",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT request_hash, response_status, response_body FROM idempotency_keys`).
+					WithArgs("key-1", "/handle-order").
+					WillReturnRows(sqlmock.NewRows([]string{"request_hash", "response_status", "response_body"}).
+						AddRow("hash", 200, []byte(`{"success":true}`)))
+			},
+			wantResponse: &structs.StoredResponse{Status: 200, Body: []byte(`{"success":true}`)},
+		},
+		{
+			desc: "key reused for another body",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT request_hash`).
+					WillReturnRows(sqlmock.NewRows([]string{"request_hash", "response_status", "response_body"}).
+						AddRow("other", 200, []byte(`{}`)))
+			},
+			wantErr: ErrIdempotencyKeyReused,
+		},
+		{
+			desc: "first request still running",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT request_hash`).
+					WillReturnRows(sqlmock.NewRows([]string{"request_hash", "response_status", "response_body"}).
+						AddRow("hash", nil, nil))
+			},
+			wantErr: ErrRequestInProgress,
+		},
+		{
+			desc: "key released between claim and lookup",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT request_hash`).
+					WillReturnRows(sqlmock.NewRows([]string{"request_hash", "response_status", "response_body"}))
+			},
+			wantErr: ErrRequestInProgress,
+		},
+		{
+			desc: "claim fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT IGNORE INTO idempotency_keys`).WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "failed to claim idempotency key: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewIdempotencyService(db)
+			response, err := service.Begin("key-1", "/handle-order", "hash")
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.EqualError(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantResponse, response)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCompleteAndReleaseIdempotentRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE idempotency_keys SET response_status = \?, response_body = \?, completed_at = NOW\(\)`).
+		WithArgs(400, []byte(`{"success":false}`), "key-1", "/handle-order").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM idempotency_keys WHERE idempotency_key = \? AND route = \? AND response_status IS NULL`).
+		WithArgs("key-2", "/handle-order").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	service := NewIdempotencyService(db)
+	assert.NoError(t, service.Complete("key-1", "/handle-order", structs.StoredResponse{Status: 400, Body: []byte(`{"success":false}`)}))
+	assert.NoError(t, service.Release("key-2", "/handle-order"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"database/sql"
 	"io"
+	"time"
 
 	"github.com/EasyPost/easypost-go/v4"
 	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
@@ -10,6 +12,10 @@ import (
 
 type CartService interface {
 	InsertCartItem(item structs.CartItem) error
+	GetCartItems(ssid string) ([]structs.CartItem, error)
+	UpdateCartItemQuantity(ssid string, itemID int, quantity int) error
+	RemoveCartItem(ssid string, itemID int) error
+	ClearCart(ssid string) error
 }
 
 type GenerateStlService interface {
@@ -22,18 +28,144 @@ type DesignService interface {
 	FileExists(path string) bool
 }
 
+type PricingService interface {
+	GetPrice(templateType string, sizeVariant string) (structs.Price, error)
+	PriceCart(cart []structs.CartItem) (int64, error)
+	ListProducts(activeOnly bool) ([]structs.Product, error)
+	CreateProduct(product structs.Product) (int64, error)
+	SetProductActive(productID int64, active bool) error
+	SetPrice(productID int64, price structs.Price) (int64, error)
+}
+
+type CheckoutService interface {
+	CreateCheckout(request structs.CheckoutRequest) (*stripe.PaymentIntent, error)
+	VerifyCheckout(intent *stripe.PaymentIntent, ssid string, email string, address structs.AddressInfo) (structs.Checkout, error)
+	VoidCheckout(intentID string, reason string) error
+}
+
+type PromotionService interface {
+	ApplyPromotion(code string, email string, cart []structs.CartItem, shippingAmount int64) (structs.Discount, error)
+	RecordRedemption(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error
+	AllocateDiscount(tx *sql.Tx, promotionID int64, amount int64, items []structs.OrderItem) ([]structs.OrderItem, error)
+	ListPromotions() ([]structs.Promotion, error)
+	CreatePromotion(promo structs.Promotion) (int64, error)
+	SetPromotionActive(promoID int64, active bool) error
+}
+
 type OrderService interface {
 	ProcessOrder(orderInfo *structs.OrderInfo) (structs.OrderInfo, error)
+	GetOrderByIntent(intentID string) (structs.OrderInfo, error)
+	GetOrder(orderID int64) (structs.OrderDetails, error)
+	GetCustomerOrder(orderID int64, email string, token string) (structs.OrderDetails, error)
+	ReissueOrderToken(orderID int64, email string) (structs.OrderInfo, error)
+	ListOrders(filter structs.OrderFilter) ([]structs.OrderDetails, error)
+	UpdatePaymentStatus(intentID string, status string) error
+	CompletePrintJob(jobID int64, workerID string) (structs.LabelPurchase, error)
+	SliceJob(jobID int64) ([]structs.PrintFile, error)
+	SliceQueuedJobs() (int, error)
+	PurchaseQueuedLabels() (int, error)
+}
+
+type TaxService interface {
+	CalculateTax(address structs.AddressInfo, taxableAmount int64) (int64, error)
+	TaxReport(from time.Time, to time.Time) ([]structs.TaxReportRow, error)
+}
+
+// TaxRateSource gives the combined sales tax rate for a ship-to address as a fraction
+type TaxRateSource interface {
+	LookupRate(address structs.AddressInfo) (float64, error)
+}
+
+type PackagingService interface {
+	PackCart(ssid string) (structs.Parcel, error)
+	DeclareContents(ssid string) ([]structs.CustomsItem, error)
+}
+
+type ShippingService interface {
+	QuoteShipping(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error)
+	GetRate(shipmentID string, rateID string, address structs.AddressInfo) (structs.ShippingRate, error)
+	VerifyAddress(address structs.AddressInfo) (structs.AddressVerification, error)
+}
+
+type ManifestService interface {
+	CreateManifests(day time.Time) ([]structs.Manifest, error)
+	GetManifest(manifestID int64) (structs.Manifest, error)
+}
+
+type PrintScheduler interface {
+	EstimatePrintSeconds(mesh MeshStats, quantity int) int
+	EstimateCompletion(tx *sql.Tx, printSeconds int) (time.Time, error)
+	Reschedule() error
+}
+
+type PrintQueueService interface {
+	ClaimJob(workerID string, printerID int64) (structs.PrintJob, error)
+	Heartbeat(jobID int64, workerID string) (structs.PrintJob, error)
+	UpdateJob(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error)
+	JobFiles(jobID int64) ([]structs.PrintFile, error)
+}
+
+type PrinterService interface {
+	RegisterPrinter(printer structs.Printer) (structs.Printer, error)
+	PrinterHeartbeat(printerID int64, heartbeat structs.PrinterHeartbeat) (structs.Printer, error)
+	GetPrinter(printerID int64) (structs.Printer, error)
+	ListPrinters() ([]structs.Printer, error)
+}
+
+type PlatingService interface {
+	CreatePlate(bedX, bedY float64) (structs.Plate, error)
+	GetPlate(plateID int64) (structs.Plate, error)
+	CompletePlate(plateID int64) (structs.Plate, error)
+	FailPlate(plateID int64, reason string) (structs.Plate, error)
+	ClaimPlate(workerID string, printerID int64) (structs.Plate, error)
+	PlateHeartbeat(plateID int64, workerID string) (structs.Plate, error)
+	UpdatePlate(plateID int64, update structs.PrintJobUpdate) (structs.Plate, error)
+	PlateFiles(plateID int64) (structs.Plate, error)
+}
+
+// Slicer turns an STL into G-code for the print farm's printers
+type Slicer interface {
+	Slice(stlPath string, gcodePath string) (structs.GcodeMeta, error)
+}
+
+type TrackingService interface {
+	RecordTracker(tracker *easypost.Tracker) error
+}
+
+type FinancialService interface {
+	RecordTransaction(intentID string) error
+	BackfillTransactions() (int, error)
+}
+
+type IdempotencyService interface {
+	Begin(key string, route string, requestHash string) (*structs.StoredResponse, error)
+	Complete(key string, route string, response structs.StoredResponse) error
+	Release(key string, route string) error
 }
 
 type EasyPostClient interface {
 	CreateShipment(shipment *easypost.Shipment) (*easypost.Shipment, error)
+	GetShipment(shipmentID string) (*easypost.Shipment, error)
+	VerifyAddress(address *easypost.Address) (*easypost.Address, error)
 	LowestShipmentRate(shipment *easypost.Shipment) (*easypost.Rate, error)
 	BuyShipment(shipmentID string, rate *easypost.Rate, insurance string) (*easypost.Shipment, error)
+	RefundShipment(shipmentID string) (*easypost.Shipment, error)
+	CreateScanForm(shipmentIDs ...string) (*easypost.ScanForm, error)
+	GetScanForm(scanFormID string) (*easypost.ScanForm, error)
 }
 
 type StripeService interface {
-	CreatePaymentIntent(cart []structs.CartItem) (*stripe.PaymentIntent, error)
+	CreatePaymentIntent(amount int64, metadata map[string]string, idempotencyKey string) (*stripe.PaymentIntent, error)
 	GetPaymentIntent(id string) (*stripe.PaymentIntent, error)
 	CapturePaymentIntent(id string) (*stripe.PaymentIntent, error)
-}
\ No newline at end of file
+	CancelPaymentIntent(id string) (*stripe.PaymentIntent, error)
+	RefundPaymentIntent(id string) (*stripe.Refund, error)
+	GetBalanceTransaction(intentID string) (*stripe.BalanceTransaction, error)
+}
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+type NotificationService interface {
+	SendOrderToken(order structs.OrderInfo) error
+}
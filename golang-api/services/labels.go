@@ -0,0 +1,438 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+// deferLabel records what the label will be bought with once the order is printed. The cart is
+// packed and declared now since the session can be reused before the print job completes
+func (os *OrderServiceImpl) deferLabel(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error {
+	if orderInfo.ShipmentID == "" || orderInfo.RateID == "" {
+		if err := checkShippingPaid(orderInfo); err != nil {
+			return err
+		}
+	}
+
+	parcel, err := os.Packaging.PackCart(orderInfo.BrowserSSID)
+	if err != nil {
+		return fmt.Errorf("failed to pack order: %w", err)
+	}
+
+	var customs sql.NullString
+	if isInternational(orderInfo.Address) {
+		items, err := os.Packaging.DeclareContents(orderInfo.BrowserSSID)
+		if err != nil {
+			return fmt.Errorf("failed to declare contents: %w", err)
+		}
+
+		declaration, err := json.Marshal(items)
+		if err != nil {
+			return fmt.Errorf("failed to encode customs items: %w", err)
+		}
+		customs = sql.NullString{String: string(declaration), Valid: true}
+	}
+
+	var ratePolicy sql.NullString
+	if orderInfo.RatePolicy != nil {
+		policy, err := json.Marshal(orderInfo.RatePolicy)
+		if err != nil {
+			return fmt.Errorf("failed to encode rate policy: %w", err)
+		}
+		ratePolicy = sql.NullString{String: string(policy), Valid: true}
+	}
+
+	var boxID sql.NullInt64
+	if parcel.BoxID != 0 {
+		boxID = sql.NullInt64{Int64: parcel.BoxID, Valid: true}
+	}
+
+	query := `
+		INSERT INTO label_purchases (
+			order_id, shipment_id, rate_id, rate_policy, box_id, length_in, width_in, height_in, weight_oz, customs_items
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(
+		query,
+		orderID, nullString(orderInfo.ShipmentID), nullString(orderInfo.RateID), ratePolicy, boxID,
+		parcel.Length, parcel.Width, parcel.Height, parcel.Weight, customs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert label purchase: %w", err)
+	}
+
+	return nil
+}
+
+// orderParcel is the parcel packed when the label was deferred, or the cart packed now
+func (os *OrderServiceImpl) orderParcel(orderInfo *structs.OrderInfo) (structs.Parcel, error) {
+	if orderInfo.Parcel != nil {
+		return *orderInfo.Parcel, nil
+	}
+
+	return os.Packaging.PackCart(orderInfo.BrowserSSID)
+}
+
+// orderCustoms is the declaration made when the label was deferred, or the cart declared now
+func (os *OrderServiceImpl) orderCustoms(orderInfo *structs.OrderInfo) ([]structs.CustomsItem, error) {
+	if orderInfo.Customs != nil {
+		return orderInfo.Customs, nil
+	}
+
+	return os.Packaging.DeclareContents(orderInfo.BrowserSSID)
+}
+
+// CompletePrintJob marks a print job completed and buys the order's deferred label. A worker
+// can only complete the job it holds, an operator completes with an empty workerID and may
+// complete any open job or one already completed again. A label EasyPost fails to sell is left
+// queued for PurchaseQueuedLabels and is not an error here, orders whose label was bought at
+// checkout return an empty LabelPurchase
+func (os *OrderServiceImpl) CompletePrintJob(jobID int64, workerID string) (structs.LabelPurchase, error) {
+	tx, err := os.DB.Begin()
+	if err != nil {
+		return structs.LabelPurchase{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	jobQuery := `
+		UPDATE print_jobs SET status = 'completed', completed_at = NOW(), lease_expires_at = NULL
+		WHERE job_id = ? AND status IN ('claimed', 'printing') AND worker_id = ?
+	`
+	args := []any{jobID, workerID}
+	if workerID == "" {
+		jobQuery = `
+			UPDATE print_jobs SET status = 'completed', completed_at = NOW(), lease_expires_at = NULL
+			WHERE job_id = ? AND status IN ('queued', 'claimed', 'printing')
+		`
+		args = []any{jobID}
+	}
+	result, err := tx.Exec(jobQuery, args...)
+	if err != nil {
+		return structs.LabelPurchase{}, fmt.Errorf("failed to complete print job: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return structs.LabelPurchase{}, fmt.Errorf("unable to read affected rows: %w", err)
+	}
+	if affected == 0 {
+		if err := completedAgain(tx, jobID, workerID); err != nil {
+			return structs.LabelPurchase{}, err
+		}
+	}
+
+	queueQuery := `
+		UPDATE label_purchases l
+		JOIN print_jobs j ON j.order_id = l.order_id
+		SET l.status = 'queued', l.next_attempt_at = NOW()
+		WHERE j.job_id = ? AND l.status = 'waiting'
+	`
+	if _, err := tx.Exec(queueQuery, jobID); err != nil {
+		return structs.LabelPurchase{}, fmt.Errorf("failed to queue label purchase: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return structs.LabelPurchase{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	label := structs.LabelPurchase{}
+	var lastError sql.NullString
+	labelQuery := `
+		SELECT l.label_purchase_id, l.order_id, l.status, l.attempts, l.last_error
+		FROM label_purchases l
+		JOIN print_jobs j ON j.order_id = l.order_id
+		WHERE j.job_id = ?
+	`
+	err = os.DB.QueryRow(labelQuery, jobID).Scan(&label.LabelPurchaseID, &label.OrderID, &label.Status, &label.Attempts, &lastError)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.LabelPurchase{}, nil
+	}
+	if err != nil {
+		return structs.LabelPurchase{}, fmt.Errorf("failed to look up label purchase: %w", err)
+	}
+	label.LastError = lastError.String
+
+	// completing a job twice leaves an already bought or retrying label alone
+	if label.Status != "queued" {
+		return label, nil
+	}
+
+	purchase, err := os.purchaseLabel(label.LabelPurchaseID)
+	if errors.Is(err, ErrLabelNotQueued) {
+		return label, nil
+	}
+	return purchase, err
+}
+
+// completedAgain explains a completion that changed nothing, only an operator may complete a
+// job that is already completed
+func completedAgain(tx *sql.Tx, jobID int64, workerID string) error {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM print_jobs WHERE job_id = ?`, jobID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPrintJobNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up print job: %w", err)
+	}
+
+	if workerID != "" || status != "completed" {
+		return ErrJobNotHeld
+	}
+
+	return nil
+}
+
+// PurchaseQueuedLabels retries the labels that are due, along with any left purchasing by a
+// run that died. It returns how many were bought and reports every label that failed outright
+// or ran out of attempts
+func (os *OrderServiceImpl) PurchaseQueuedLabels() (int, error) {
+	query := `
+		SELECT label_purchase_id FROM label_purchases
+		WHERE (status = 'queued' AND next_attempt_at <= NOW())
+			OR (status = 'purchasing' AND claimed_at <= NOW() - INTERVAL ? SECOND)
+		ORDER BY next_attempt_at
+		LIMIT ?
+	`
+	rows, err := os.DB.Query(query, int(LABEL_CLAIM_TIMEOUT.Seconds()), LABEL_BATCH_SIZE)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list queued labels: %w", err)
+	}
+	defer rows.Close()
+
+	var labelIDs []int64
+	for rows.Next() {
+		var labelID int64
+		if err := rows.Scan(&labelID); err != nil {
+			return 0, fmt.Errorf("failed to scan queued label: %w", err)
+		}
+		labelIDs = append(labelIDs, labelID)
+	}
+	rows.Close()
+
+	purchased := 0
+	var errs []error
+	for _, labelID := range labelIDs {
+		label, err := os.purchaseLabel(labelID)
+		if errors.Is(err, ErrLabelNotQueued) {
+			// another run got to it first
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("label purchase %d: %w", labelID, err))
+			continue
+		}
+
+		switch label.Status {
+		case "purchased":
+			purchased++
+		case "failed":
+			errs = append(errs, fmt.Errorf("label purchase %d gave up after %d attempts: %s", labelID, label.Attempts, label.LastError))
+		}
+	}
+
+	return purchased, errors.Join(errs...)
+}
+
+// purchaseLabel buys one queued label. The purchase is claimed first so concurrent runs can't
+// buy the same label twice, and a claim older than LABEL_CLAIM_TIMEOUT is taken back. The
+// shipment is recorded before it's bought so a label bought by a run that died is found on
+// EasyPost instead of bought again. A failed purchase is recorded on the label rather than returned
+func (os *OrderServiceImpl) purchaseLabel(labelID int64) (structs.LabelPurchase, error) {
+	label := structs.LabelPurchase{LabelPurchaseID: labelID}
+	orderInfo := structs.OrderInfo{Parcel: &structs.Parcel{}}
+	var shipmentID, rateID, ratePolicy, customs, claimedShipmentID, name, line2 sql.NullString
+	var boxID sql.NullInt64
+
+	query := `
+		SELECT l.order_id, l.shipment_id, l.rate_id, l.rate_policy, l.box_id,
+			l.length_in, l.width_in, l.height_in, l.weight_oz, l.customs_items, l.attempts, l.claimed_shipment_id,
+			o.browser_ssid, o.purchaser_name, o.address_1, o.address_2, o.city, o.state, o.zipcode, o.country
+		FROM label_purchases l
+		JOIN orders o ON o.order_id = l.order_id
+		WHERE l.label_purchase_id = ?
+	`
+	err := os.DB.QueryRow(query, labelID).Scan(
+		&label.OrderID, &shipmentID, &rateID, &ratePolicy, &boxID,
+		&orderInfo.Parcel.Length, &orderInfo.Parcel.Width, &orderInfo.Parcel.Height, &orderInfo.Parcel.Weight, &customs, &label.Attempts, &claimedShipmentID,
+		&orderInfo.BrowserSSID, &name, &orderInfo.Address.Line1, &line2, &orderInfo.Address.City,
+		&orderInfo.Address.State, &orderInfo.Address.PostalCode, &orderInfo.Address.Country,
+	)
+	if err != nil {
+		return label, fmt.Errorf("failed to load label purchase: %w", err)
+	}
+
+	orderInfo.OrderID = label.OrderID
+	orderInfo.ShipmentID = shipmentID.String
+	orderInfo.RateID = rateID.String
+	orderInfo.Parcel.BoxID = boxID.Int64
+	orderInfo.Name = name.String
+	orderInfo.Address.Line2 = line2.String
+	if ratePolicy.Valid {
+		orderInfo.RatePolicy = &structs.RatePolicy{}
+		if err := json.Unmarshal([]byte(ratePolicy.String), orderInfo.RatePolicy); err != nil {
+			return label, fmt.Errorf("failed to decode rate policy: %w", err)
+		}
+	}
+	if customs.Valid {
+		if err := json.Unmarshal([]byte(customs.String), &orderInfo.Customs); err != nil {
+			return label, fmt.Errorf("failed to decode customs items: %w", err)
+		}
+	}
+
+	claimQuery := `
+		UPDATE label_purchases SET status = 'purchasing', attempts = attempts + 1, claimed_at = NOW()
+		WHERE label_purchase_id = ? AND (
+			(status = 'queued' AND next_attempt_at <= NOW())
+			OR (status = 'purchasing' AND claimed_at <= NOW() - INTERVAL ? SECOND)
+		)
+	`
+	result, err := os.DB.Exec(claimQuery, labelID, int(LABEL_CLAIM_TIMEOUT.Seconds()))
+	if err != nil {
+		return label, fmt.Errorf("failed to claim label purchase: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return label, fmt.Errorf("unable to read affected rows: %w", err)
+	}
+	if affected == 0 {
+		return label, ErrLabelNotQueued
+	}
+	label.Attempts++
+
+	// an earlier attempt may have bought the label and died before recording it, a refunded
+	// label keeps its URL but can't ship, so its shipment is dropped and quoted again. Only a
+	// rejected refund leaves the label good to ship
+	if claimedShipmentID.Valid {
+		shipment, err := os.ShipClient.GetShipment(claimedShipmentID.String)
+		if err != nil {
+			return os.recordLabelFailure(label, fmt.Errorf("failed to look up shipment %s: %w", claimedShipmentID.String, err))
+		}
+		switch {
+		case shipment.RefundStatus != "" && shipment.RefundStatus != "rejected":
+			if orderInfo.ShipmentID == claimedShipmentID.String {
+				orderInfo.ShipmentID, orderInfo.RateID = "", ""
+			}
+		case shipment.PostageLabel != nil && shipment.PostageLabel.LabelURL != "":
+			if err := os.recordLabelPurchase(labelID, label.OrderID, shipment); err != nil {
+				return os.recordLabelFailure(label, err)
+			}
+			return purchasedLabel(label, shipment.TrackingCode), nil
+		}
+	}
+
+	if orderInfo.ShipmentID == "" || orderInfo.RateID == "" {
+		orderInfo.ShipmentID, orderInfo.RateID, err = os.quoteLabelFunc(&orderInfo)
+		if err != nil {
+			return os.recordLabelFailure(label, err)
+		}
+	}
+
+	shipmentQuery := `UPDATE label_purchases SET claimed_shipment_id = ? WHERE label_purchase_id = ?`
+	if _, err := os.DB.Exec(shipmentQuery, orderInfo.ShipmentID, labelID); err != nil {
+		return os.recordLabelFailure(label, fmt.Errorf("failed to record claimed shipment: %w", err))
+	}
+
+	shipment, shipInfo, err := os.buyShippingLabelFunc(&orderInfo)
+	if err != nil {
+		return os.recordLabelFailure(label, err)
+	}
+
+	if err := os.recordLabelPurchase(labelID, label.OrderID, shipment); err != nil {
+		if _, refundErr := os.ShipClient.RefundShipment(shipment.ID); refundErr != nil {
+			// the label still ships, the next attempt finds it through claimed_shipment_id
+			return os.recordLabelFailure(label, errors.Join(err, fmt.Errorf("failed to refund shipping label %s: %w", shipment.ID, refundErr)))
+		}
+		log.Printf("Refunded shipping label %s for label purchase %d\n", shipment.ID, labelID)
+		return os.requeueLabel(label, err, true)
+	}
+
+	return purchasedLabel(label, shipInfo.TrackingNumber), nil
+}
+
+func purchasedLabel(label structs.LabelPurchase, trackingNumber string) structs.LabelPurchase {
+	label.Status = "purchased"
+	label.LastError = ""
+	label.TrackingNumber = trackingNumber
+	return label
+}
+
+func (os *OrderServiceImpl) recordLabelPurchase(labelID int64, orderID int64, shipment *easypost.Shipment) error {
+	tx, err := os.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := os.insertShippingFunc(tx, orderID, shipment); err != nil {
+		return err
+	}
+
+	query := `UPDATE label_purchases SET status = 'purchased', purchased_at = NOW(), claimed_at = NULL, last_error = NULL WHERE label_purchase_id = ?`
+	if _, err := tx.Exec(query, labelID); err != nil {
+		return fmt.Errorf("failed to mark label purchased: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// recordLabelFailure puts a label back in the queue with a growing delay, or gives up on it
+// once it has used all of its attempts
+func (os *OrderServiceImpl) recordLabelFailure(label structs.LabelPurchase, cause error) (structs.LabelPurchase, error) {
+	return os.requeueLabel(label, cause, false)
+}
+
+// requeueLabel records a failed attempt, refunded drops the bought shipment and its quote
+// so the next attempt can't record the voided label and quotes a new one
+func (os *OrderServiceImpl) requeueLabel(label structs.LabelPurchase, cause error, refunded bool) (structs.LabelPurchase, error) {
+	label.LastError = cause.Error()
+	if len(label.LastError) > 512 {
+		label.LastError = label.LastError[:512]
+	}
+
+	var nextAttempt sql.NullTime
+	label.Status = "failed"
+	label.NextAttemptAt = nil
+	if label.Attempts < MAX_LABEL_ATTEMPTS {
+		next := time.Now().UTC().Add(labelRetryDelay(label.Attempts))
+		nextAttempt = sql.NullTime{Time: next, Valid: true}
+		label.Status = "queued"
+		label.NextAttemptAt = &next
+	}
+
+	query := `UPDATE label_purchases SET status = ?, last_error = ?, next_attempt_at = ?, claimed_at = NULL WHERE label_purchase_id = ?`
+	if refunded {
+		query = `
+			UPDATE label_purchases
+			SET status = ?, last_error = ?, next_attempt_at = ?, claimed_at = NULL,
+				claimed_shipment_id = NULL, shipment_id = NULL, rate_id = NULL
+			WHERE label_purchase_id = ?
+		`
+	}
+	if _, err := os.DB.Exec(query, label.Status, label.LastError, nextAttempt, label.LabelPurchaseID); err != nil {
+		return label, errors.Join(cause, fmt.Errorf("failed to record label failure: %w", err))
+	}
+
+	log.Printf("Label purchase %d failed on attempt %d, status %s: %v\n", label.LabelPurchaseID, label.Attempts, label.Status, cause)
+	return label, nil
+}
+
+// labelRetryDelay doubles the wait after every failed attempt, starting at LABEL_RETRY_DELAY
+func labelRetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return LABEL_RETRY_DELAY << (attempts - 1)
+}
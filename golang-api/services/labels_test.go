@@ -0,0 +1,526 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+var labelPurchaseColumns = []string{
+	"order_id", "shipment_id", "rate_id", "rate_policy", "box_id",
+	"length_in", "width_in", "height_in", "weight_oz", "customs_items", "attempts", "claimed_shipment_id",
+	"browser_ssid", "purchaser_name", "address_1", "address_2", "city", "state", "zipcode", "country",
+}
+
+func labelPurchaseRow(attempts int, ratePolicy any) *sqlmock.Rows {
+	return claimedLabelPurchaseRow(attempts, ratePolicy, nil)
+}
+
+func claimedLabelPurchaseRow(attempts int, ratePolicy any, claimedShipmentID any) *sqlmock.Rows {
+	return sqlmock.NewRows(labelPurchaseColumns).AddRow(
+		42, nil, nil, ratePolicy, 2,
+		8.0, 6.0, 4.0, 12.5, nil, attempts, claimedShipmentID,
+		"ssid123", "John Doe", "123 Main St", nil, "Boston", "MA", "02108", "US",
+	)
+}
+
+func TestDeferLabel(t *testing.T) {
+	tests := []struct {
+		desc      string
+		orderInfo structs.OrderInfo
+		packErr   error
+		mockDB    func(sqlmock.Sqlmock)
+		wantErr   string
+	}{
+		{
+			desc:      "quoted rate is kept with the packed parcel",
+			orderInfo: structs.OrderInfo{BrowserSSID: "ssid123", ShipmentID: "shp_quoted", RateID: "rate_2"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO label_purchases`).
+					WithArgs(int64(42), "shp_quoted", "rate_2", nil, int64(2), 8.0, 6.0, 4.0, 12.5, nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc: "rate policy is stored for ship time",
+			orderInfo: structs.OrderInfo{
+				BrowserSSID:    "ssid123",
+				ShippingAmount: 795,
+				RatePolicy:     &structs.RatePolicy{Strategy: RATE_STRATEGY_MAX_DELIVERY_DAYS, MaxDeliveryDays: 2},
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO label_purchases`).
+					WithArgs(int64(42), nil, nil,
+						`{"strategy":"max_delivery_days","max_amount":0,"carriers":null,"max_delivery_days":2,"carrier":"","service":""}`,
+						int64(2), 8.0, 6.0, 4.0, 12.5, nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc:      "international order is declared while the cart is still there",
+			orderInfo: structs.OrderInfo{BrowserSSID: "ssid123", ShippingAmount: 1650, Address: structs.AddressInfo{City: "Toronto", Country: "CA"}},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO label_purchases`).
+					WithArgs(int64(42), nil, nil, nil, int64(2), 8.0, 6.0, 4.0, 12.5,
+						`[{"description":"Plastic golf ball markers","hs_tariff_number":"950639","quantity":2,"value":2998,"weight":0.9,"origin_country":"US"}]`).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc:      "order too large to pack",
+			orderInfo: structs.OrderInfo{BrowserSSID: "ssid123", ShipmentID: "shp_quoted", RateID: "rate_2"},
+			packErr:   ErrNoBoxFits,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+			},
+			wantErr: "failed to pack order: " + ErrNoBoxFits.Error(),
+		},
+		{
+			desc:      "order that paid no shipping isn't shipped on the shop",
+			orderInfo: structs.OrderInfo{BrowserSSID: "ssid123"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+			},
+			wantErr: ErrShippingNotPaid.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			packaging := new(MockPackagingService)
+			packaging.On("PackCart", "ssid123").
+				Return(structs.Parcel{BoxID: 2, Box: "Small box", Length: 8, Width: 6, Height: 4, Weight: 12.5}, tt.packErr)
+			packaging.On("DeclareContents", "ssid123").
+				Return([]structs.CustomsItem{{Description: "Plastic golf ball markers", HSTariffNumber: "950639", Quantity: 2, Value: 2998, Weight: 0.9, OriginCountry: "US"}}, nil)
+			service := &OrderServiceImpl{DB: db, Packaging: packaging}
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf("failed to begin: %v", err)
+			}
+
+			err = service.deferLabel(tx, 42, &tt.orderInfo)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCompletePrintJob(t *testing.T) {
+	tests := []struct {
+		desc      string
+		workerID  string
+		buyErr    error
+		mockDB    func(sqlmock.Sqlmock)
+		wantLabel structs.LabelPurchase
+		wantErr   error
+	}{
+		{
+			desc:     "deferred label is bought",
+			workerID: "printer-1",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'completed', completed_at = NOW\(\), lease_expires_at = NULL WHERE job_id = \? AND status IN \('claimed', 'printing'\) AND worker_id = \?`).
+					WithArgs(int64(9), "printer-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases l JOIN print_jobs j (.+) SET l.status = 'queued'`).WithArgs(int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT l.label_purchase_id, l.order_id, l.status, l.attempts, l.last_error FROM label_purchases l`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id", "order_id", "status", "attempts", "last_error"}).AddRow(3, 42, "queued", 0, nil))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WithArgs(int64(3)).WillReturnRows(labelPurchaseRow(0, nil))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing', attempts = attempts \+ 1, claimed_at = NOW\(\)`).
+					WithArgs(int64(3), int(LABEL_CLAIM_TIMEOUT.Seconds())).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id = \? WHERE label_purchase_id = \?`).
+					WithArgs("shp_new", int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchased'`).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantLabel: structs.LabelPurchase{LabelPurchaseID: 3, OrderID: 42, Status: "purchased", Attempts: 1, TrackingNumber: "TRACK123"},
+		},
+		{
+			desc:   "EasyPost outage leaves the label queued",
+			buyErr: errors.New("failed to create shipping label: 503"),
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases l`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT l.label_purchase_id`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id", "order_id", "status", "attempts", "last_error"}).AddRow(3, 42, "queued", 0, nil))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WillReturnRows(labelPurchaseRow(0, nil))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET status = \?, last_error = \?, next_attempt_at = \?`).
+					WithArgs("queued", "failed to create shipping label: 503", sqlmock.AnyArg(), int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantLabel: structs.LabelPurchase{LabelPurchaseID: 3, OrderID: 42, Status: "queued", Attempts: 1, LastError: "failed to create shipping label: 503"},
+		},
+		{
+			desc: "label bought at checkout",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases l`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT l.label_purchase_id`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id", "order_id", "status", "attempts", "last_error"}))
+			},
+			wantLabel: structs.LabelPurchase{},
+		},
+		{
+			desc: "job completed again after its label was bought",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'completed', completed_at = NOW\(\), lease_expires_at = NULL WHERE job_id = \? AND status IN \('queued', 'claimed', 'printing'\)`).
+					WithArgs(int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT status FROM print_jobs WHERE job_id = \?`).WithArgs(int64(9)).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("completed"))
+				mock.ExpectExec(`UPDATE label_purchases l`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT l.label_purchase_id`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id", "order_id", "status", "attempts", "last_error"}).AddRow(3, 42, "purchased", 1, nil))
+			},
+			wantLabel: structs.LabelPurchase{LabelPurchaseID: 3, OrderID: 42, Status: "purchased", Attempts: 1},
+		},
+		{
+			desc:     "worker completing a job it doesn't hold",
+			workerID: "printer-2",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs`).WithArgs(int64(9), "printer-2").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT status FROM print_jobs`).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("printing"))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrJobNotHeld,
+		},
+		{
+			desc:     "worker completing a job that's already completed",
+			workerID: "printer-1",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT status FROM print_jobs`).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("completed"))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrJobNotHeld,
+		},
+		{
+			desc: "no such print job",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT status FROM print_jobs`).WillReturnRows(sqlmock.NewRows([]string{"status"}))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrPrintJobNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewOrderService(db, new(MockEasyPostClient), new(MockPricingService), new(MockPromotionService), new(MockPackagingService), new(MockPrintScheduler), new(MockSlicer), CheapestRate{}, true).(*OrderServiceImpl)
+			service.quoteLabelFunc = func(orderInfo *structs.OrderInfo) (string, string, error) {
+				return "shp_new", "rate_new", nil
+			}
+			service.buyShippingLabelFunc = func(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
+				if tt.buyErr != nil {
+					return nil, structs.ShippingInfo{}, tt.buyErr
+				}
+				// the packed parcel is bought rather than the cart packed again
+				if orderInfo.Parcel == nil || orderInfo.Parcel.BoxID != 2 || orderInfo.Address.City != "Boston" {
+					return nil, structs.ShippingInfo{}, errors.New("order was not rebuilt from the label purchase")
+				}
+				return boughtLabel(orderInfo)
+			}
+			service.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+				return nil
+			}
+
+			label, err := service.CompletePrintJob(9, tt.workerID)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				if tt.wantLabel.Status == "queued" {
+					assert.NotNil(t, label.NextAttemptAt)
+					label.NextAttemptAt = nil
+				}
+				assert.Equal(t, tt.wantLabel, label)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPurchaseQueuedLabels(t *testing.T) {
+	// a label bought on the checkout quote, as the retry after a refund sees it
+	quotedLabelPurchaseRow := func(claimedShipmentID any) *sqlmock.Rows {
+		return sqlmock.NewRows(labelPurchaseColumns).AddRow(
+			42, "shp_old", "rate_old", nil, 2,
+			8.0, 6.0, 4.0, 12.5, nil, 1, claimedShipmentID,
+			"ssid123", "John Doe", "123 Main St", nil, "Boston", "MA", "02108", "US",
+		)
+	}
+
+	tests := []struct {
+		desc          string
+		buyErr        error
+		insertErr     error
+		setupMocks    func(*MockEasyPostClient)
+		mockDB        func(sqlmock.Sqlmock)
+		wantPurchased int
+		wantErr       string
+	}{
+		{
+			desc: "due labels are bought and a claimed one is skipped",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases WHERE \(status = 'queued' AND next_attempt_at <= NOW\(\)\) OR \(status = 'purchasing' AND claimed_at <= NOW\(\) - INTERVAL \? SECOND\)`).
+					WithArgs(int(LABEL_CLAIM_TIMEOUT.Seconds()), LABEL_BATCH_SIZE).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id"}).AddRow(3).AddRow(4))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WithArgs(int64(3)).
+					WillReturnRows(labelPurchaseRow(2, `{"strategy":"fastest"}`))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing', attempts = attempts \+ 1, claimed_at = NOW\(\)`).
+					WithArgs(int64(3), int(LABEL_CLAIM_TIMEOUT.Seconds())).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id = \? WHERE label_purchase_id = \?`).
+					WithArgs("shp_new", int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchased'`).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				// another run claimed it between the list and the purchase
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WithArgs(int64(4)).WillReturnRows(labelPurchaseRow(0, nil))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WithArgs(int64(4), int(LABEL_CLAIM_TIMEOUT.Seconds())).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantPurchased: 1,
+		},
+		{
+			desc: "label bought by a run that died is recorded, not bought again",
+			setupMocks: func(client *MockEasyPostClient) {
+				client.On("GetShipment", "shp_old").Return(&easypost.Shipment{
+					ID:           "shp_old",
+					TrackingCode: "TRACK123",
+					SelectedRate: &easypost.Rate{Carrier: "USPS"},
+					PostageLabel: &easypost.PostageLabel{LabelURL: "https://easypost.com/label.png"},
+				}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id"}).AddRow(3))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WillReturnRows(claimedLabelPurchaseRow(1, nil, "shp_old"))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchased'`).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantPurchased: 1,
+		},
+		{
+			desc: "stale claim that never bought its label is bought on a new shipment",
+			setupMocks: func(client *MockEasyPostClient) {
+				client.On("GetShipment", "shp_old").Return(&easypost.Shipment{ID: "shp_old"}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id"}).AddRow(3))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WillReturnRows(claimedLabelPurchaseRow(1, nil, "shp_old"))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id`).WithArgs("shp_new", int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchased'`).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantPurchased: 1,
+		},
+		{
+			desc:      "label that can't be recorded is refunded and its shipment released",
+			insertErr: errors.New("db down"),
+			setupMocks: func(client *MockEasyPostClient) {
+				client.On("RefundShipment", "shp_123").Return(&easypost.Shipment{ID: "shp_123", RefundStatus: "submitted"}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id"}).AddRow(3))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WillReturnRows(labelPurchaseRow(0, nil))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id`).WithArgs("shp_new", int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+				mock.ExpectExec(`UPDATE label_purchases SET status = \?, last_error = \?, next_attempt_at = \?, claimed_at = NULL, claimed_shipment_id = NULL, shipment_id = NULL, rate_id = NULL WHERE label_purchase_id = \?`).
+					WithArgs("queued", "db down", sqlmock.AnyArg(), int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			desc:      "label that can't be recorded or refunded is kept for the next attempt",
+			insertErr: errors.New("db down"),
+			setupMocks: func(client *MockEasyPostClient) {
+				client.On("RefundShipment", "shp_123").Return((*easypost.Shipment)(nil), errors.New("label already scanned"))
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id"}).AddRow(3))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WillReturnRows(labelPurchaseRow(0, nil))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+				mock.ExpectExec(`UPDATE label_purchases SET status = \?, last_error = \?, next_attempt_at = \?, claimed_at = NULL WHERE label_purchase_id = \?`).
+					WithArgs("queued", "db down\nfailed to refund shipping label shp_123: label already scanned", sqlmock.AnyArg(), int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			desc: "retry after a refund quotes and buys a new label",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id"}).AddRow(3))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WillReturnRows(labelPurchaseRow(1, nil))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id`).WithArgs("shp_new", int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchased'`).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantPurchased: 1,
+		},
+		{
+			desc: "refunded label left on a claim is never recorded",
+			setupMocks: func(client *MockEasyPostClient) {
+				client.On("GetShipment", "shp_old").Return(&easypost.Shipment{
+					ID:           "shp_old",
+					RefundStatus: "refunded",
+					PostageLabel: &easypost.PostageLabel{LabelURL: "https://easypost.com/label.png"},
+				}, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id"}).AddRow(3))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WillReturnRows(quotedLabelPurchaseRow("shp_old"))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id`).WithArgs("shp_new", int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchased'`).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantPurchased: 1,
+		},
+		{
+			desc:   "label gives up after its last attempt",
+			buyErr: errors.New("address rejected by carrier"),
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id"}).AddRow(3))
+				mock.ExpectQuery(`FROM label_purchases l JOIN orders o`).WillReturnRows(labelPurchaseRow(MAX_LABEL_ATTEMPTS-1, nil))
+				mock.ExpectExec(`UPDATE label_purchases SET status = 'purchasing'`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET claimed_shipment_id`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases SET status = \?`).
+					WithArgs("failed", "address rejected by carrier", nil, int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: "label purchase 3 gave up after 8 attempts: address rejected by carrier",
+		},
+		{
+			desc: "list fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT label_purchase_id FROM label_purchases`).WillReturnError(errors.New("db error"))
+			},
+			wantErr: "failed to list queued labels: db error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			client := new(MockEasyPostClient)
+			if tt.setupMocks != nil {
+				tt.setupMocks(client)
+			}
+
+			service := NewOrderService(db, client, new(MockPricingService), new(MockPromotionService), new(MockPackagingService), new(MockPrintScheduler), new(MockSlicer), CheapestRate{}, true).(*OrderServiceImpl)
+			service.quoteLabelFunc = func(orderInfo *structs.OrderInfo) (string, string, error) {
+				return "shp_new", "rate_new", nil
+			}
+			service.buyShippingLabelFunc = func(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
+				if tt.buyErr != nil {
+					return nil, structs.ShippingInfo{}, tt.buyErr
+				}
+				// the shipment recorded on the claim is the one bought
+				if orderInfo.ShipmentID != "shp_new" || orderInfo.RateID != "rate_new" {
+					return nil, structs.ShippingInfo{}, errors.New("quoted shipment was not bought")
+				}
+				return boughtLabel(orderInfo)
+			}
+			service.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+				return tt.insertErr
+			}
+
+			purchased, err := service.PurchaseQueuedLabels()
+
+			assert.Equal(t, tt.wantPurchased, purchased)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			client.AssertExpectations(t)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestLabelRetryDelay(t *testing.T) {
+	assert.Equal(t, 5*time.Minute, labelRetryDelay(1))
+	assert.Equal(t, 10*time.Minute, labelRetryDelay(2))
+	assert.Equal(t, 320*time.Minute, labelRetryDelay(7))
+}
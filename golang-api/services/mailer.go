@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+var (
+	ErrInvalidEmailHeader  = errors.New("email header contains a line break")
+	ErrMailerNotConfigured = errors.New("no mail relay configured, set SMTP_HOST or USE_FAKES=true")
+)
+
+// SmtpMailer sends plain text email through an SMTP relay, Username is left empty for
+// relays that don't authenticate
+type SmtpMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+
+	sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSmtpMailer(host string, port string, username string, password string, from string) Mailer {
+	return &SmtpMailer{Host: host, Port: port, Username: username, Password: password, From: from, sendMailFunc: smtp.SendMail}
+}
+
+func (m *SmtpMailer) Send(to string, subject string, body string) error {
+	if m.Host == "" {
+		return ErrMailerNotConfigured
+	}
+
+	// the recipient comes from the customer, a line break would let them add headers
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return ErrInvalidEmailHeader
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	if err := m.sendMailFunc(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
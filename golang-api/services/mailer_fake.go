@@ -0,0 +1,16 @@
+package services
+
+import "log"
+
+// FakeMailer stands in for an SMTP relay when running locally, it writes each email to the
+// log instead of sending it
+type FakeMailer struct{}
+
+func NewFakeMailer() Mailer {
+	return &FakeMailer{}
+}
+
+func (f *FakeMailer) Send(to string, subject string, body string) error {
+	log.Printf("Email to %s: %s\n%s\n", to, subject, body)
+	return nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmtpMailer(t *testing.T) {
+	tests := []struct {
+		desc     string
+		username string
+		noHost   bool
+		to       string
+		subject  string
+		sendErr  error
+		wantAuth bool
+		wantMsg  []string
+		wantErr  error
+	}{
+		{
+			desc:     "authenticated relay",
+			username: "apikey",
+			to:       "golfer@example.com",
+			subject:  "Your Fairway Ink order #42",
+			wantAuth: true,
+			wantMsg: []string{
+				"From: Fairway Ink <orders@fairway-ink.com>\r\n",
+				"To: golfer@example.com\r\n",
+				"Subject: Your Fairway Ink order #42\r\n",
+				"\r\n\r\nline one\r\nline two\r\n",
+			},
+		},
+		{
+			desc:    "open relay",
+			to:      "golfer@example.com",
+			subject: "Your Fairway Ink order #42",
+			wantMsg: []string{"To: golfer@example.com\r\n"},
+		},
+		{
+			desc:    "header injection in the recipient",
+			to:      "golfer@example.com\r\nBcc: everyone@example.com",
+			subject: "Your Fairway Ink order #42",
+			wantErr: ErrInvalidEmailHeader,
+		},
+		{
+			desc:    "relay refuses the email",
+			to:      "golfer@example.com",
+			subject: "Your Fairway Ink order #42",
+			sendErr: errors.New("550 mailbox unavailable"),
+			wantErr: errors.New("failed to send email: 550 mailbox unavailable"),
+		},
+		{
+			desc:    "no relay configured",
+			noHost:  true,
+			to:      "golfer@example.com",
+			subject: "Your Fairway Ink order #42",
+			wantErr: ErrMailerNotConfigured,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			host := "smtp.example.com"
+			if tt.noHost {
+				host = ""
+			}
+			mailer := NewSmtpMailer(host, "587", tt.username, "secret", "Fairway Ink <orders@fairway-ink.com>").(*SmtpMailer)
+			sent := false
+			mailer.sendMailFunc = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+				sent = true
+				assert.Equal(t, "smtp.example.com:587", addr)
+				assert.Equal(t, tt.wantAuth, a != nil)
+				assert.Equal(t, []string{tt.to}, to)
+				for _, want := range tt.wantMsg {
+					assert.Contains(t, string(msg), want)
+				}
+				return tt.sendErr
+			}
+
+			err := mailer.Send(tt.to, tt.subject, "line one\nline two\n")
+			if tt.wantErr != nil {
+				assert.ErrorContains(t, err, tt.wantErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, !strings.ContainsAny(tt.to, "\r\n") && !tt.noHost, sent)
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+var ErrManifestNotFound = errors.New("manifest not found")
+
+type ManifestServiceImpl struct {
+	DB         *sql.DB
+	ShipClient EasyPostClient
+}
+
+func NewManifestService(db *sql.DB, shipClient EasyPostClient) ManifestService {
+	return &ManifestServiceImpl{DB: db, ShipClient: shipClient}
+}
+
+// manifestShipment is a bought label that hasn't been handed to its carrier yet
+type manifestShipment struct {
+	shipmentID int64
+	easypostID string
+	carrier    string
+}
+
+// CreateManifests hands off every label bought up to the end of day that isn't on a manifest
+// yet, EasyPost batches each carrier's shipments onto one scan form. A carrier whose scan form
+// fails is reported and its shipments are picked up by the next run
+func (ms *ManifestServiceImpl) CreateManifests(day time.Time) ([]structs.Manifest, error) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	query := `
+		SELECT shipment_id, easypost_id, carrier FROM shipping
+		WHERE manifest_id IS NULL AND created_at < ?
+		ORDER BY carrier, shipment_id
+	`
+	rows, err := ms.DB.Query(query, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shipments: %w", err)
+	}
+	defer rows.Close()
+
+	var carriers []string
+	byCarrier := map[string][]manifestShipment{}
+	for rows.Next() {
+		var shipment manifestShipment
+		if err := rows.Scan(&shipment.shipmentID, &shipment.easypostID, &shipment.carrier); err != nil {
+			return nil, fmt.Errorf("failed to scan shipment: %w", err)
+		}
+		if _, ok := byCarrier[shipment.carrier]; !ok {
+			carriers = append(carriers, shipment.carrier)
+		}
+		byCarrier[shipment.carrier] = append(byCarrier[shipment.carrier], shipment)
+	}
+	rows.Close()
+
+	manifests := []structs.Manifest{}
+	var errs []error
+	for _, carrier := range carriers {
+		manifest, err := ms.createManifest(day, carrier, byCarrier[carrier])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s manifest: %w", carrier, err))
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	return manifests, errors.Join(errs...)
+}
+
+func (ms *ManifestServiceImpl) createManifest(day time.Time, carrier string, shipments []manifestShipment) (structs.Manifest, error) {
+	shipmentIDs := make([]string, 0, len(shipments))
+	for _, shipment := range shipments {
+		shipmentIDs = append(shipmentIDs, shipment.easypostID)
+	}
+
+	scanForm, err := ms.ShipClient.CreateScanForm(shipmentIDs...)
+	if err != nil {
+		return structs.Manifest{}, fmt.Errorf("failed to create scan form: %w", err)
+	}
+
+	manifest := structs.Manifest{
+		Carrier:       carrier,
+		ManifestDate:  day,
+		ScanFormID:    scanForm.ID,
+		BatchID:       scanForm.BatchID,
+		FormURL:       scanForm.FormURL,
+		Status:        scanForm.Status,
+		ShipmentCount: len(shipments),
+	}
+
+	// the scan form can't be taken back, it has to be found by hand if it isn't recorded
+	manifest.ManifestID, err = ms.recordManifest(manifest, shipments)
+	if err != nil {
+		return structs.Manifest{}, fmt.Errorf("scan form %s was created but not recorded: %w", scanForm.ID, err)
+	}
+
+	return manifest, nil
+}
+
+func (ms *ManifestServiceImpl) recordManifest(manifest structs.Manifest, shipments []manifestShipment) (int64, error) {
+	tx, err := ms.DB.Begin()
+	if err != nil {
+		return -1, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO manifests (
+			carrier, manifest_date, easypost_scan_form_id, easypost_batch_id, form_url, status, shipment_count
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := tx.Exec(
+		query,
+		manifest.Carrier, manifest.ManifestDate, manifest.ScanFormID, nullString(manifest.BatchID),
+		nullString(manifest.FormURL), manifest.Status, manifest.ShipmentCount,
+	)
+	if err != nil {
+		return -1, fmt.Errorf("failed to insert manifest: %w", err)
+	}
+
+	manifestID, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("failed to retrieve manifest ID: %w", err)
+	}
+
+	handOffQuery := `UPDATE shipping SET manifest_id = ?, handed_off_at = NOW() WHERE shipment_id = ? AND manifest_id IS NULL`
+	for _, shipment := range shipments {
+		if _, err := tx.Exec(handOffQuery, manifestID, shipment.shipmentID); err != nil {
+			return -1, fmt.Errorf("failed to hand off shipment %d: %w", shipment.shipmentID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return manifestID, nil
+}
+
+// GetManifest returns a manifest, a form that was still generating when it was created is
+// looked up again so the PDF can be printed for the pickup
+func (ms *ManifestServiceImpl) GetManifest(manifestID int64) (structs.Manifest, error) {
+	manifest := structs.Manifest{ManifestID: manifestID}
+	var batchID, formURL sql.NullString
+
+	query := `
+		SELECT carrier, manifest_date, easypost_scan_form_id, easypost_batch_id, form_url, status, shipment_count
+		FROM manifests
+		WHERE manifest_id = ?
+	`
+	err := ms.DB.QueryRow(query, manifestID).Scan(
+		&manifest.Carrier, &manifest.ManifestDate, &manifest.ScanFormID, &batchID, &formURL, &manifest.Status, &manifest.ShipmentCount,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.Manifest{}, ErrManifestNotFound
+	}
+	if err != nil {
+		return structs.Manifest{}, fmt.Errorf("failed to look up manifest: %w", err)
+	}
+	manifest.BatchID = batchID.String
+	manifest.FormURL = formURL.String
+
+	if manifest.FormURL != "" {
+		return manifest, nil
+	}
+
+	scanForm, err := ms.ShipClient.GetScanForm(manifest.ScanFormID)
+	if err != nil {
+		// the stored manifest is still worth returning, the form is fetched again next time
+		log.Printf("Unable to refresh scan form %s: %v\n", manifest.ScanFormID, err)
+		return manifest, nil
+	}
+
+	return manifest, ms.refreshManifest(&manifest, scanForm)
+}
+
+func (ms *ManifestServiceImpl) refreshManifest(manifest *structs.Manifest, scanForm *easypost.ScanForm) error {
+	if scanForm.Status == manifest.Status && scanForm.FormURL == "" {
+		return nil
+	}
+
+	query := `UPDATE manifests SET form_url = ?, status = ? WHERE manifest_id = ?`
+	if _, err := ms.DB.Exec(query, nullString(scanForm.FormURL), scanForm.Status, manifest.ManifestID); err != nil {
+		return fmt.Errorf("failed to update manifest: %w", err)
+	}
+
+	manifest.FormURL = scanForm.FormURL
+	manifest.Status = scanForm.Status
+	return nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+var manifestShipmentColumns = []string{"shipment_id", "easypost_id", "carrier"}
+
+var manifestColumns = []string{
+	"carrier", "manifest_date", "easypost_scan_form_id", "easypost_batch_id", "form_url", "status", "shipment_count",
+}
+
+func TestCreateManifests(t *testing.T) {
+	day := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	uspsForm := &easypost.ScanForm{ID: "sf_usps", BatchID: "batch_usps", Status: "created", FormURL: "https://example.com/sf_usps.pdf"}
+
+	tests := []struct {
+		desc          string
+		mockDB        func(sqlmock.Sqlmock)
+		mockEasyPost  func(*MockEasyPostClient)
+		wantManifests []structs.Manifest
+		wantErrMsg    string
+	}{
+		{
+			desc: "one scan form per carrier",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT shipment_id, easypost_id, carrier FROM shipping WHERE manifest_id IS NULL AND created_at < \?`).
+					WithArgs(day.AddDate(0, 0, 1)).
+					WillReturnRows(sqlmock.NewRows(manifestShipmentColumns).
+						AddRow(7, "shp_ups", "UPS").
+						AddRow(3, "shp_1", "USPS").
+						AddRow(5, "shp_2", "USPS"))
+
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO manifests`).
+					WithArgs("UPS", day, "sf_ups", nil, nil, "creating", 1).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`UPDATE shipping SET manifest_id = \?, handed_off_at = NOW\(\) WHERE shipment_id = \? AND manifest_id IS NULL`).
+					WithArgs(int64(1), int64(7)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO manifests`).
+					WithArgs("USPS", day, "sf_usps", "batch_usps", "https://example.com/sf_usps.pdf", "created", 2).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec(`UPDATE shipping SET manifest_id`).WithArgs(int64(2), int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE shipping SET manifest_id`).WithArgs(int64(2), int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("CreateScanForm", []string{"shp_ups"}).Return(&easypost.ScanForm{ID: "sf_ups", Status: "creating"}, nil)
+				m.On("CreateScanForm", []string{"shp_1", "shp_2"}).Return(uspsForm, nil)
+			},
+			wantManifests: []structs.Manifest{
+				{ManifestID: 1, Carrier: "UPS", ManifestDate: day, ScanFormID: "sf_ups", Status: "creating", ShipmentCount: 1},
+				{ManifestID: 2, Carrier: "USPS", ManifestDate: day, ScanFormID: "sf_usps", BatchID: "batch_usps",
+					FormURL: "https://example.com/sf_usps.pdf", Status: "created", ShipmentCount: 2},
+			},
+		},
+		{
+			desc: "nothing to hand off",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).WillReturnRows(sqlmock.NewRows(manifestShipmentColumns))
+			},
+			mockEasyPost:  func(m *MockEasyPostClient) {},
+			wantManifests: []structs.Manifest{},
+		},
+		{
+			desc: "a failed carrier doesn't stop the others",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).
+					WillReturnRows(sqlmock.NewRows(manifestShipmentColumns).
+						AddRow(7, "shp_ups", "UPS").
+						AddRow(3, "shp_1", "USPS"))
+
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO manifests`).WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec(`UPDATE shipping SET manifest_id`).WithArgs(int64(2), int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("CreateScanForm", []string{"shp_ups"}).Return((*easypost.ScanForm)(nil), errors.New("carrier does not support scan forms"))
+				m.On("CreateScanForm", []string{"shp_1"}).Return(uspsForm, nil)
+			},
+			wantManifests: []structs.Manifest{
+				{ManifestID: 2, Carrier: "USPS", ManifestDate: day, ScanFormID: "sf_usps", BatchID: "batch_usps",
+					FormURL: "https://example.com/sf_usps.pdf", Status: "created", ShipmentCount: 1},
+			},
+			wantErrMsg: "UPS manifest: failed to create scan form: carrier does not support scan forms",
+		},
+		{
+			desc: "scan form can't be recorded",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).
+					WillReturnRows(sqlmock.NewRows(manifestShipmentColumns).AddRow(3, "shp_1", "USPS"))
+
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO manifests`).WillReturnError(errors.New("db down"))
+				mock.ExpectRollback()
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("CreateScanForm", []string{"shp_1"}).Return(uspsForm, nil)
+			},
+			wantManifests: []structs.Manifest{},
+			wantErrMsg:    "USPS manifest: scan form sf_usps was created but not recorded: failed to insert manifest: db down",
+		},
+		{
+			desc: "shipment query fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).WillReturnError(errors.New("db down"))
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {},
+			wantErrMsg:   "failed to list shipments: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			client := new(MockEasyPostClient)
+			tt.mockEasyPost(client)
+
+			// a time late in the day still manifests that whole day
+			manifests, err := NewManifestService(db, client).CreateManifests(day.Add(20 * time.Hour))
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantManifests, manifests)
+
+			client.AssertExpectations(t)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetManifest(t *testing.T) {
+	day := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc         string
+		mockDB       func(sqlmock.Sqlmock)
+		mockEasyPost func(*MockEasyPostClient)
+		wantManifest structs.Manifest
+		wantErr      error
+		wantErrMsg   string
+	}{
+		{
+			desc: "generated form is returned as stored",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT carrier, manifest_date, easypost_scan_form_id, easypost_batch_id, form_url, status, shipment_count FROM manifests WHERE manifest_id = \?`).
+					WithArgs(int64(2)).
+					WillReturnRows(sqlmock.NewRows(manifestColumns).
+						AddRow("USPS", day, "sf_usps", "batch_usps", "https://example.com/sf_usps.pdf", "created", 2))
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {},
+			wantManifest: structs.Manifest{ManifestID: 2, Carrier: "USPS", ManifestDate: day, ScanFormID: "sf_usps", BatchID: "batch_usps",
+				FormURL: "https://example.com/sf_usps.pdf", Status: "created", ShipmentCount: 2},
+		},
+		{
+			desc: "form that was generating is fetched again",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM manifests`).
+					WillReturnRows(sqlmock.NewRows(manifestColumns).AddRow("UPS", day, "sf_ups", nil, nil, "creating", 1))
+				mock.ExpectExec(`UPDATE manifests SET form_url = \?, status = \? WHERE manifest_id = \?`).
+					WithArgs("https://example.com/sf_ups.pdf", "created", int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("GetScanForm", "sf_ups").
+					Return(&easypost.ScanForm{ID: "sf_ups", Status: "created", FormURL: "https://example.com/sf_ups.pdf"}, nil)
+			},
+			wantManifest: structs.Manifest{ManifestID: 2, Carrier: "UPS", ManifestDate: day, ScanFormID: "sf_ups",
+				FormURL: "https://example.com/sf_ups.pdf", Status: "created", ShipmentCount: 1},
+		},
+		{
+			desc: "form still generating",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM manifests`).
+					WillReturnRows(sqlmock.NewRows(manifestColumns).AddRow("UPS", day, "sf_ups", nil, nil, "creating", 1))
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("GetScanForm", "sf_ups").Return(&easypost.ScanForm{ID: "sf_ups", Status: "creating"}, nil)
+			},
+			wantManifest: structs.Manifest{ManifestID: 2, Carrier: "UPS", ManifestDate: day, ScanFormID: "sf_ups", Status: "creating", ShipmentCount: 1},
+		},
+		{
+			desc: "easypost is down",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM manifests`).
+					WillReturnRows(sqlmock.NewRows(manifestColumns).AddRow("UPS", day, "sf_ups", nil, nil, "creating", 1))
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("GetScanForm", "sf_ups").Return((*easypost.ScanForm)(nil), errors.New("easypost down"))
+			},
+			wantManifest: structs.Manifest{ManifestID: 2, Carrier: "UPS", ManifestDate: day, ScanFormID: "sf_ups", Status: "creating", ShipmentCount: 1},
+		},
+		{
+			desc: "manifest doesn't exist",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM manifests`).WillReturnRows(sqlmock.NewRows(manifestColumns))
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {},
+			wantErr:      ErrManifestNotFound,
+		},
+		{
+			desc: "lookup fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM manifests`).WillReturnError(errors.New("db down"))
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {},
+			wantErrMsg:   "failed to look up manifest: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			client := new(MockEasyPostClient)
+			tt.mockEasyPost(client)
+
+			manifest, err := NewManifestService(db, client).GetManifest(2)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantManifest, manifest)
+			}
+
+			client.AssertExpectations(t)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+type NotificationServiceImpl struct {
+	Mailer Mailer
+}
+
+func NewNotificationService(mailer Mailer) NotificationService {
+	return &NotificationServiceImpl{Mailer: mailer}
+}
+
+// SendOrderToken emails the customer the token they look their order up with, it goes out
+// when the order is placed and again whenever the customer asks for a new one
+func (ns *NotificationServiceImpl) SendOrderToken(order structs.OrderInfo) error {
+	if order.OrderToken == "" || order.Email == "" {
+		return errors.New("order has no token or email to send")
+	}
+
+	var body strings.Builder
+	if order.Name != "" {
+		fmt.Fprintf(&body, "Hi %s,\n\n", order.Name)
+	}
+	fmt.Fprintf(&body, "Thanks for your Fairway Ink order.\n\n")
+	fmt.Fprintf(&body, "Order number: %d\n", order.OrderID)
+	fmt.Fprintf(&body, "Order token: %s\n\n", order.OrderToken)
+	fmt.Fprintf(&body, "Keep this email, the order number, this email address and the token are what you need to check on your order.\n")
+
+	subject := fmt.Sprintf("Your Fairway Ink order #%d", order.OrderID)
+	return ns.Mailer.Send(order.Email, subject, body.String())
+}
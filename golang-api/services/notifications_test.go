@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMailer struct {
+	mock.Mock
+}
+
+func (m *MockMailer) Send(to string, subject string, body string) error {
+	args := m.Called(to, subject, body)
+	return args.Error(0)
+}
+
+func TestSendOrderToken(t *testing.T) {
+	mailer := new(MockMailer)
+	mailer.On("Send", "golfer@example.com", "Your Fairway Ink order #42", mock.MatchedBy(func(body string) bool {
+		return assert.Contains(t, body, "Hi John,") &&
+			assert.Contains(t, body, "Order number: 42\n") &&
+			assert.Contains(t, body, "Order token: token123\n")
+	})).Return(nil)
+
+	service := NewNotificationService(mailer)
+	err := service.SendOrderToken(structs.OrderInfo{OrderID: 42, Name: "John", Email: "golfer@example.com", OrderToken: "token123"})
+	assert.NoError(t, err)
+	mailer.AssertExpectations(t)
+
+	// an order read back from the database only has the token's hash
+	err = service.SendOrderToken(structs.OrderInfo{OrderID: 42, Email: "golfer@example.com"})
+	assert.Error(t, err)
+	mailer.AssertNumberOfCalls(t, "Send", 1)
+}
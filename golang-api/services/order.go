@@ -1,11 +1,18 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/EasyPost/easypost-go/v4"
 	"github.com/aws/aws-sdk-go/aws"
@@ -16,22 +23,61 @@ import (
 	"github.com/ocamp09/fairway-ink-api/golang-api/utils"
 )
 
+var (
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrPrintJobNotFound = errors.New("print job not found")
+	ErrLabelNotQueued   = errors.New("label purchase is not due")
+	ErrShippingNotPaid  = errors.New("order has no quoted rate and was charged no shipping")
+)
+
+const (
+	// a label still failing after this many tries needs an operator
+	MAX_LABEL_ATTEMPTS = 8
+	LABEL_RETRY_DELAY  = 5 * time.Minute
+	// a label still purchasing after this long was claimed by a run that died and is taken back
+	LABEL_CLAIM_TIMEOUT = 15 * time.Minute
+	// labels bought per PurchaseQueuedLabels run
+	LABEL_BATCH_SIZE = 100
+	// print jobs sliced per SliceQueuedJobs run
+	SLICE_BATCH_SIZE = 20
+	// a job that still can't be sliced after this many runs is left for an operator
+	MAX_SLICE_ATTEMPTS = 5
+	SLICE_RETRY_DELAY  = 15 * time.Minute
+)
+
 type OrderServiceImpl struct {
 	DB *sql.DB
 	ShipClient EasyPostClient
+	Pricing PricingService
+	Promotions PromotionService
+	Packaging PackagingService
+	Scheduler PrintScheduler
+	Slicer Slicer
+	// used for orders that don't bring their own rate policy
+	RateSelector RateSelector
+	// buy labels when the print job completes so checkout doesn't depend on EasyPost
+	DeferLabels bool
 
 	insertOrderFunc      func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error)
 	buyShippingLabelFunc func(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error)
+	quoteLabelFunc       func(orderInfo *structs.OrderInfo) (string, string, error)
 	insertShippingFunc   func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error
-	insertJobFunc        func(tx *sql.Tx, orderID int64) (int64, error)
+	insertJobFunc        func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error)
+	deferLabelFunc       func(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error
+	uploadToS3Func       func(localPath, s3Key string) error
 }
 
-func NewOrderService(db *sql.DB, shipClient EasyPostClient) OrderService {
-	svc := &OrderServiceImpl{DB: db, ShipClient: shipClient}
+// NewOrderService builds the order service, rateSelector picks the label bought for orders
+// that weren't placed on a quoted rate and is the shop's to configure, never the customer's
+func NewOrderService(db *sql.DB, shipClient EasyPostClient, pricing PricingService, promotions PromotionService, packaging PackagingService, scheduler PrintScheduler, slicer Slicer, rateSelector RateSelector, deferLabels bool) OrderService {
+	svc := &OrderServiceImpl{DB: db, ShipClient: shipClient, Pricing: pricing, Promotions: promotions, Packaging: packaging, Scheduler: scheduler, Slicer: slicer, RateSelector: rateSelector, DeferLabels: deferLabels}
 	svc.insertOrderFunc = svc.insertOrder
 	svc.buyShippingLabelFunc = svc.buyShippingLabel
+	svc.quoteLabelFunc = svc.quoteLabel
 	svc.insertShippingFunc = svc.insertShipping
 	svc.insertJobFunc = svc.insertJob
+	svc.deferLabelFunc = svc.deferLabel
+	svc.uploadToS3Func = uploadToS3
 	return svc
 }
 
@@ -39,6 +85,13 @@ func (os *OrderServiceImpl) ProcessOrder(orderInfo *structs.OrderInfo) (structs.
 	// Extract order details
 	total := float64(orderInfo.Amount) / 100.0
 
+	// the customer needs this token to look the order up again, only its hash is kept
+	orderToken, err := newOrderToken()
+	if err != nil {
+		return *orderInfo, err
+	}
+	orderInfo.OrderToken = orderToken
+
 	tx, err := os.DB.Begin()
 	if err != nil {
 		return *orderInfo, fmt.Errorf("failed to begin transaction: %w", err)
@@ -50,29 +103,42 @@ func (os *OrderServiceImpl) ProcessOrder(orderInfo *structs.OrderInfo) (structs.
 	if err != nil {
 		return *orderInfo, err
 	}
+	orderInfo.OrderID = orderID
 
-	shipment, shipInfo, err := os.buyShippingLabelFunc(orderInfo)
-	if err != nil {
-		return *orderInfo, err
+	// the redemption is written with the order so a captured discount is always auditable
+	if orderInfo.PromotionID != 0 {
+		if err := os.Promotions.RecordRedemption(tx, orderID, orderInfo); err != nil {
+			return *orderInfo, err
+		}
 	}
 
-	orderInfo.ShippingInfo = shipInfo
+	// a deferred order has no label to refund, refundLabel passes its failures straight through
+	var shipment *easypost.Shipment
+	if os.DeferLabels {
+		if err := os.deferLabelFunc(tx, orderID, orderInfo); err != nil {
+			return *orderInfo, err
+		}
+	} else {
+		var shipInfo structs.ShippingInfo
+		shipment, shipInfo, err = os.buyShippingLabelFunc(orderInfo)
+		if err != nil {
+			return *orderInfo, err
+		}
 
-	err = os.insertShippingFunc(tx, orderID, shipment)
-	if err != nil {
-		return *orderInfo, err
-	}
-	
-	jobID, err := os.insertJobFunc(tx, orderID)
-	if err != nil {
-		return *orderInfo, err
+		orderInfo.ShippingInfo = shipInfo
+
+		// the label is paid for now, every failure below has to refund it or no order will reference it
+		err = os.insertShippingFunc(tx, orderID, shipment)
+		if err != nil {
+			return *orderInfo, os.refundLabel(shipment, err)
+		}
 	}
 
 	// Upload STL files and associate with job
-	cartQuery := `SELECT stl_url, quantity FROM cart_items WHERE browser_ssid = ?`
+	cartQuery := `SELECT stl_url, quantity, template_type, size_variant FROM cart_items WHERE browser_ssid = ?`
 	rows, err := tx.Query(cartQuery, orderInfo.BrowserSSID)
 	if err != nil {
-		return *orderInfo, fmt.Errorf("failed to retrieve cart items: %w", err)
+		return *orderInfo, os.refundLabel(shipment, fmt.Errorf("failed to retrieve cart items: %w", err))
 	}
 	defer rows.Close()
 
@@ -81,53 +147,380 @@ func (os *OrderServiceImpl) ProcessOrder(orderInfo *structs.OrderInfo) (structs.
 	// read the rows into our cart items slice
 	for rows.Next() {
 		var item structs.CartItem
-		if err := rows.Scan(&item.StlURL, &item.Quantity); err != nil {
-			return *orderInfo, fmt.Errorf("failed to scan cart item: %w", err)
+		if err := rows.Scan(&item.StlURL, &item.Quantity, &item.TemplateType, &item.SizeVariant); err != nil {
+			return *orderInfo, os.refundLabel(shipment, fmt.Errorf("failed to scan cart item: %w", err))
 		}
 		cartItems = append(cartItems, item)
 	}
 	rows.Close() 
 
+	jobID, err := os.insertJobFunc(tx, orderID, orderInfo.BrowserSSID, cartItems)
+	if err != nil {
+		return *orderInfo, os.refundLabel(shipment, err)
+	}
+
 	// loop through cart items and upload them
+	var orderItems []structs.OrderItem
 	for _, item := range cartItems {
 		filename := getFilenameFromURL(item.StlURL)
 		dir, err := getOutputDir(orderInfo.BrowserSSID, filename)
 		if err != nil {
-			return *orderInfo, err
+			return *orderInfo, os.refundLabel(shipment, err)
 		}
 
 		s3Key := fmt.Sprintf("%s/%s", orderInfo.BrowserSSID, filename)
 
-		if err := uploadToS3(dir + filename, s3Key); err != nil {
-			return *orderInfo, fmt.Errorf("failed to upload STL file: %w", err)
+		if err := os.uploadToS3Func(dir + filename, s3Key); err != nil {
+			return *orderInfo, os.refundLabel(shipment, fmt.Errorf("failed to upload STL file: %w", err))
+		}
+
+		// snapshot the price in effect so later catalog changes don't rewrite history
+		price, err := os.Pricing.GetPrice(item.TemplateType, item.SizeVariant)
+		if err != nil {
+			return *orderInfo, os.refundLabel(shipment, fmt.Errorf("failed to price STL file: %w", err))
 		}
 
 		// Insert into `stl_files` table
-		stlQuery := `INSERT INTO stl_files (browser_ssid, file_name, job_id, quantity) VALUES (?, ?, ?, ?)`
-		if _, err := tx.Exec(stlQuery, orderInfo.BrowserSSID, filename, jobID, item.Quantity); err != nil {
-			return *orderInfo, fmt.Errorf("failed to insert STL file record: %w", err)
+		stlQuery := `INSERT INTO stl_files (browser_ssid, file_name, job_id, quantity, price_id, unit_price_cents) VALUES (?, ?, ?, ?, ?, ?)`
+		stlResult, err := tx.Exec(stlQuery, orderInfo.BrowserSSID, filename, jobID, item.Quantity, price.PriceID, price.UnitAmount)
+		if err != nil {
+			return *orderInfo, os.refundLabel(shipment, fmt.Errorf("failed to insert STL file record: %w", err))
+		}
+
+		stlID, err := stlResult.LastInsertId()
+		if err != nil {
+			return *orderInfo, os.refundLabel(shipment, fmt.Errorf("failed to retrieve STL file ID: %w", err))
 		}
+
+		orderItems = append(orderItems, structs.OrderItem{
+			TemplateType: item.TemplateType,
+			SizeVariant:  item.SizeVariant,
+			FileName:     filename,
+			Quantity:     item.Quantity,
+			UnitPrice:    price.UnitAmount,
+			StlID:        stlID,
+			PriceID:      price.PriceID,
+		})
+	}
+
+	if orderInfo.PromotionID != 0 && orderInfo.DiscountAmount > 0 {
+		orderItems, err = os.Promotions.AllocateDiscount(tx, orderInfo.PromotionID, orderInfo.DiscountAmount, orderItems)
+		if err != nil {
+			return *orderInfo, os.refundLabel(shipment, err)
+		}
+	}
+
+	if err := insertOrderItems(tx, orderID, orderItems); err != nil {
+		return *orderInfo, os.refundLabel(shipment, err)
 	}
+	orderInfo.Items = orderItems
 
 	if err := tx.Commit(); err != nil {
-		return *orderInfo, fmt.Errorf("failed to commit transaction: %w", err)
+		return *orderInfo, os.refundLabel(shipment, fmt.Errorf("failed to commit transaction: %w", err))
 	}
 
+	// the job is queued with the mesh estimate, slice_jobs replaces it with the slicer's
 	return *orderInfo, nil
 }
 
+// GetOrderByIntent looks up the order created for a payment intent, both the browser
+// and the Stripe webhook use it to avoid fulfilling the same intent twice
+func (os *OrderServiceImpl) GetOrderByIntent(intentID string) (structs.OrderInfo, error) {
+	query := `
+		SELECT o.order_id, o.stripe_ssid, o.browser_ssid, o.total_amount, o.payment_status, o.purchaser_name, o.purchaser_email,
+			o.address_1, o.address_2, o.city, o.state, o.zipcode, o.country,
+			s.tracking_number, s.carrier, p.code, r.discount_cents
+		FROM orders o
+		LEFT JOIN shipping s ON s.order_id = o.order_id
+		LEFT JOIN promotion_redemptions r ON r.order_id = o.order_id
+		LEFT JOIN promotions p ON p.promo_id = r.promo_id
+		WHERE o.stripe_ssid = ?
+		LIMIT 1
+	`
+
+	var orderInfo structs.OrderInfo
+	var total float64
+	var name, line2, tracking, carrier, promoCode sql.NullString
+	var discount sql.NullInt64
+	err := os.DB.QueryRow(query, intentID).Scan(
+		&orderInfo.OrderID, &orderInfo.PaymentIntentID, &orderInfo.BrowserSSID, &total, &orderInfo.PaymentStatus, &name, &orderInfo.Email,
+		&orderInfo.Address.Line1, &line2, &orderInfo.Address.City, &orderInfo.Address.State, &orderInfo.Address.PostalCode, &orderInfo.Address.Country,
+		&tracking, &carrier, &promoCode, &discount,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.OrderInfo{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return structs.OrderInfo{}, fmt.Errorf("failed to look up order: %w", err)
+	}
+
+	// orders store dollars, the rest of the order flow works in cents
+	orderInfo.Amount = float32(math.Round(total * 100))
+	orderInfo.Name = name.String
+	orderInfo.Address.Line2 = line2.String
+	orderInfo.ShippingInfo.TrackingNumber = tracking.String
+	orderInfo.ShippingInfo.Carrier = carrier.String
+	orderInfo.PromoCode = promoCode.String
+	orderInfo.DiscountAmount = discount.Int64
+
+	return orderInfo, nil
+}
+
+const orderDetailsQuery = `
+	SELECT o.order_id, o.stripe_ssid, o.purchaser_name, o.purchaser_email,
+		o.address_1, o.address_2, o.city, o.state, o.zipcode, o.country,
+		o.total_amount, o.shipping_cents, o.tax_cents, o.payment_status, o.order_token_hash, o.created_at,
+		j.status, j.estimated_completion_time, j.completed_at,
+		s.shipping_status, s.carrier, s.tracking_number, p.code, r.discount_cents
+	FROM orders o
+	LEFT JOIN print_jobs j ON j.order_id = o.order_id
+	LEFT JOIN shipping s ON s.order_id = o.order_id
+	LEFT JOIN promotion_redemptions r ON r.order_id = o.order_id
+	LEFT JOIN promotions p ON p.promo_id = r.promo_id
+`
+
+// GetOrder returns the joined view of an order with its printed items
+func (os *OrderServiceImpl) GetOrder(orderID int64) (structs.OrderDetails, error) {
+	query := orderDetailsQuery + ` WHERE o.order_id = ? LIMIT 1`
+	order, err := scanOrderDetails(os.DB.QueryRow(query, orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.OrderDetails{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return structs.OrderDetails{}, fmt.Errorf("failed to look up order: %w", err)
+	}
+
+	itemsQuery := `
+		SELECT template_type, size_variant, file_name, quantity, unit_price_cents, discount_cents
+		FROM order_items
+		WHERE order_id = ?
+		ORDER BY order_item_id
+	`
+	rows, err := os.DB.Query(itemsQuery, orderID)
+	if err != nil {
+		return structs.OrderDetails{}, fmt.Errorf("failed to retrieve order items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item structs.OrderItem
+		// lines migrated from before prices were snapshotted may be missing these
+		var templateType, sizeVariant sql.NullString
+		var unitPrice sql.NullInt64
+		if err := rows.Scan(&templateType, &sizeVariant, &item.FileName, &item.Quantity, &unitPrice, &item.Discount); err != nil {
+			return structs.OrderDetails{}, fmt.Errorf("failed to scan order item: %w", err)
+		}
+		item.TemplateType = templateType.String
+		item.SizeVariant = sizeVariant.String
+		item.UnitPrice = unitPrice.Int64
+		order.Items = append(order.Items, item)
+	}
+	rows.Close()
+
+	trackingQuery := `
+		SELECT t.status, t.status_detail, t.message, t.city, t.state, t.country, t.occurred_at
+		FROM tracking_events t
+		JOIN shipping s ON s.shipment_id = t.shipment_id
+		WHERE s.order_id = ?
+		ORDER BY t.occurred_at, t.tracking_event_id
+	`
+	trackingRows, err := os.DB.Query(trackingQuery, orderID)
+	if err != nil {
+		return structs.OrderDetails{}, fmt.Errorf("failed to retrieve tracking events: %w", err)
+	}
+	defer trackingRows.Close()
+
+	for trackingRows.Next() {
+		var event structs.TrackingEvent
+		var statusDetail, message, city, state, country sql.NullString
+		if err := trackingRows.Scan(&event.Status, &statusDetail, &message, &city, &state, &country, &event.OccurredAt); err != nil {
+			return structs.OrderDetails{}, fmt.Errorf("failed to scan tracking event: %w", err)
+		}
+		event.StatusDetail = statusDetail.String
+		event.Message = message.String
+		event.City = city.String
+		event.State = state.String
+		event.Country = country.String
+		order.Tracking = append(order.Tracking, event)
+	}
+
+	return order, nil
+}
+
+// GetCustomerOrder returns an order only to the customer holding its email and token, a
+// mismatch looks the same as a missing order so order IDs can't be probed
+func (os *OrderServiceImpl) GetCustomerOrder(orderID int64, email string, token string) (structs.OrderDetails, error) {
+	order, err := os.GetOrder(orderID)
+	if err != nil {
+		return structs.OrderDetails{}, err
+	}
+
+	tokenHash := hashOrderToken(token)
+	if token == "" || order.TokenHash == "" || normalizeEmail(email) != normalizeEmail(order.Email) ||
+		subtle.ConstantTimeCompare([]byte(tokenHash), []byte(order.TokenHash)) != 1 {
+		return structs.OrderDetails{}, ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+// ReissueOrderToken replaces the token of an order placed with email, the old token stops
+// working. Like GetCustomerOrder a mismatch looks the same as a missing order
+func (os *OrderServiceImpl) ReissueOrderToken(orderID int64, email string) (structs.OrderInfo, error) {
+	order := structs.OrderInfo{OrderID: orderID}
+	var name sql.NullString
+	query := `SELECT purchaser_email, purchaser_name FROM orders WHERE order_id = ?`
+	err := os.DB.QueryRow(query, orderID).Scan(&order.Email, &name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.OrderInfo{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return structs.OrderInfo{}, fmt.Errorf("failed to load order: %w", err)
+	}
+	order.Name = name.String
+
+	if email == "" || normalizeEmail(email) != normalizeEmail(order.Email) {
+		return structs.OrderInfo{}, ErrOrderNotFound
+	}
+
+	order.OrderToken, err = newOrderToken()
+	if err != nil {
+		return structs.OrderInfo{}, err
+	}
+
+	updateQuery := `UPDATE orders SET order_token_hash = ? WHERE order_id = ?`
+	if _, err := os.DB.Exec(updateQuery, hashOrderToken(order.OrderToken), orderID); err != nil {
+		return structs.OrderInfo{}, fmt.Errorf("failed to update order token: %w", err)
+	}
+
+	return order, nil
+}
+
+// ListOrders returns the newest orders first for operators, items are left to GetOrder
+func (os *OrderServiceImpl) ListOrders(filter structs.OrderFilter) ([]structs.OrderDetails, error) {
+	var conditions []string
+	var args []any
+	if filter.Email != "" {
+		conditions = append(conditions, "o.purchaser_email = ?")
+		args = append(args, normalizeEmail(filter.Email))
+	}
+	if filter.PaymentStatus != "" {
+		conditions = append(conditions, "o.payment_status = ?")
+		args = append(args, filter.PaymentStatus)
+	}
+
+	query := orderDetailsQuery
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	query += ` ORDER BY o.order_id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, filter.Offset)
+
+	rows, err := os.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []structs.OrderDetails{}
+	for rows.Next() {
+		order, err := scanOrderDetails(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+type orderScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrderDetails(row orderScanner) (structs.OrderDetails, error) {
+	var order structs.OrderDetails
+	var total float64
+	var name, line2, tokenHash, printStatus, shippingStatus, carrier, tracking, promoCode sql.NullString
+	var discount sql.NullInt64
+	var estimatedCompletion, printedAt sql.NullTime
+
+	err := row.Scan(
+		&order.OrderID, &order.PaymentIntentID, &name, &order.Email,
+		&order.Address.Line1, &line2, &order.Address.City, &order.Address.State, &order.Address.PostalCode, &order.Address.Country,
+		&total, &order.ShippingAmount, &order.TaxAmount, &order.PaymentStatus, &tokenHash, &order.CreatedAt,
+		&printStatus, &estimatedCompletion, &printedAt,
+		&shippingStatus, &carrier, &tracking, &promoCode, &discount,
+	)
+	if err != nil {
+		return structs.OrderDetails{}, err
+	}
+
+	order.Total = int64(math.Round(total * 100))
+	order.Name = name.String
+	order.Address.Line2 = line2.String
+	order.TokenHash = tokenHash.String
+	order.PrintStatus = printStatus.String
+	order.ShippingStatus = shippingStatus.String
+	order.Carrier = carrier.String
+	order.TrackingNumber = tracking.String
+	order.PromoCode = promoCode.String
+	order.DiscountAmount = discount.Int64
+
+	// a printed order ships off when it actually finished, a failed one has nothing to go by
+	var printed sql.NullTime
+	switch order.PrintStatus {
+	case "queued", "claimed", "printing":
+		printed = estimatedCompletion
+		if estimatedCompletion.Valid {
+			order.EstimatedCompletion = &estimatedCompletion.Time
+		}
+	case "completed":
+		printed = printedAt
+	}
+	if printed.Valid && order.ShippingStatus != "shipped" && order.ShippingStatus != "delivered" {
+		order.ExpectedShipDate = expectedShipDate(printed.Time).Format(SHIP_DATE_FORMAT)
+	}
+
+	return order, nil
+}
+
+// UpdatePaymentStatus records what Stripe reports for an order's payment after it was placed
+func (os *OrderServiceImpl) UpdatePaymentStatus(intentID string, status string) error {
+	query := `UPDATE orders SET payment_status = ? WHERE stripe_ssid = ?`
+	result, err := os.DB.Exec(query, status, intentID)
+	if err != nil {
+		return fmt.Errorf("failed to update payment status: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to read affected rows: %w", err)
+	}
+	if affected == 0 {
+		return ErrOrderNotFound
+	}
+
+	return nil
+}
+
 func (os *OrderServiceImpl) insertOrder(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
 	// Insert into `orders` table
 	orderQuery := `
 		INSERT INTO orders (
 			purchaser_email, purchaser_name, address_1, address_2, city, state, zipcode, country,
-			browser_ssid, stripe_ssid, total_amount, payment_status
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			browser_ssid, stripe_ssid, total_amount, shipping_cents, tax_cents, payment_status, order_token_hash
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	result, err := tx.Exec(
 		orderQuery,
 		orderInfo.Email, orderInfo.Name, orderInfo.Address.Line1, orderInfo.Address.Line2, orderInfo.Address.City, orderInfo.Address.State, orderInfo.Address.PostalCode, orderInfo.Address.Country,
-		orderInfo.BrowserSSID, orderInfo.PaymentIntentID, total, orderInfo.PaymentStatus,
+		orderInfo.BrowserSSID, orderInfo.PaymentIntentID, total, orderInfo.ShippingAmount, orderInfo.TaxAmount, orderInfo.PaymentStatus, hashOrderToken(orderInfo.OrderToken),
 	)
 	if err != nil {
 		return -1, fmt.Errorf("failed to insert order into database: %w", err)
@@ -144,28 +537,22 @@ func (os *OrderServiceImpl) insertOrder(tx *sql.Tx, orderInfo *structs.OrderInfo
 
 func (os *OrderServiceImpl) buyShippingLabel(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
 	// Generate shipping label
-	toAddress := &easypost.Address{
-		Name:    orderInfo.Name,
-		Street1: orderInfo.Address.Line1,
-		Street2: orderInfo.Address.Line2,
-		City:    orderInfo.Address.City,
-		State:   orderInfo.Address.State,
-		Zip:     orderInfo.Address.PostalCode,
-		Country: orderInfo.Address.Country,
-	}
-
-	parcel := &easypost.Parcel{Length: 8, Width: 7, Height: 1.25, Weight: 15}
-	shipment, err := os.ShipClient.CreateShipment(&easypost.Shipment{FromAddress: &config.SENDER_ADDRESS, ToAddress: toAddress, Parcel: parcel})
-	if err != nil {
-		return nil, structs.ShippingInfo{}, fmt.Errorf("failed to create shipping label: %w", err)
-	}
+	toAddress := toEasyPostAddress(orderInfo.Name, orderInfo.Address)
 
-	lowestShipping, err := os.ShipClient.LowestShipmentRate(shipment)
-	if err != nil {
-		return nil, structs.ShippingInfo{}, fmt.Errorf("failed to get lowest shipping rate: %w", err)
+	// the customer paid for a quoted rate, buy exactly that one on the quoted shipment
+	shipmentID, rateID := orderInfo.ShipmentID, orderInfo.RateID
+	if shipmentID == "" || rateID == "" {
+		if err := checkShippingPaid(orderInfo); err != nil {
+			return nil, structs.ShippingInfo{}, err
+		}
+		var err error
+		shipmentID, rateID, err = os.quoteLabel(orderInfo)
+		if err != nil {
+			return nil, structs.ShippingInfo{}, err
+		}
 	}
 
-	shipment, err = os.ShipClient.BuyShipment(shipment.ID, &easypost.Rate{ID: lowestShipping.ID}, "")
+	shipment, err := os.ShipClient.BuyShipment(shipmentID, &easypost.Rate{ID: rateID}, "")
 	if err != nil {
 		return nil, structs.ShippingInfo{}, fmt.Errorf("failed to buy shipping label: %w", err)
 	}
@@ -180,6 +567,70 @@ func (os *OrderServiceImpl) buyShippingLabel(orderInfo *structs.OrderInfo) (*eas
 	return shipment, shipInfo, nil
 }
 
+// quoteLabel creates a shipment for an order that wasn't placed on a quoted rate and picks the
+// rate to buy on it with the shop's rate policy
+func (os *OrderServiceImpl) quoteLabel(orderInfo *structs.OrderInfo) (string, string, error) {
+	toAddress := toEasyPostAddress(orderInfo.Name, orderInfo.Address)
+
+	parcel, err := os.orderParcel(orderInfo)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to pack order: %w", err)
+	}
+
+	request := &easypost.Shipment{FromAddress: &config.SENDER_ADDRESS, ToAddress: toAddress, Parcel: toEasyPostParcel(parcel)}
+	if isInternational(orderInfo.Address) {
+		customs, err := os.orderCustoms(orderInfo)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to declare contents: %w", err)
+		}
+		internationalShipment(request, customs, shipmentIncoterm(""))
+	}
+
+	shipment, err := os.ShipClient.CreateShipment(request)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create shipping label: %w", err)
+	}
+
+	selector := os.RateSelector
+	if orderInfo.RatePolicy != nil {
+		selector, err = NewRateSelector(*orderInfo.RatePolicy)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	rate, err := selector.SelectRate(shipment.Rates)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to select shipping rate: %w", err)
+	}
+
+	return shipment.ID, rate.ID, nil
+}
+
+// refundLabel compensates for a label bought by an order that failed afterwards, the
+// original failure is always returned and a failed refund is reported alongside it
+// checkShippingPaid stops the shop buying a label the customer didn't pay for, an order
+// without a quoted rate is only shipped on the selector's pick when shipping was charged
+func checkShippingPaid(orderInfo *structs.OrderInfo) error {
+	if orderInfo.ShippingAmount <= 0 {
+		return ErrShippingNotPaid
+	}
+	return nil
+}
+
+func (os *OrderServiceImpl) refundLabel(shipment *easypost.Shipment, cause error) error {
+	if shipment == nil {
+		return cause
+	}
+
+	if _, err := os.ShipClient.RefundShipment(shipment.ID); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to refund shipping label %s: %w", shipment.ID, err))
+	}
+
+	log.Printf("Refunded shipping label %s for failed order\n", shipment.ID)
+	return cause
+}
+
 func (os *OrderServiceImpl) insertShipping(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) (error) {
 	// Insert into `shipping` table
 	shipQuery := `INSERT INTO shipping (order_id, easypost_id, carrier, service, tracking_number, ship_rate, shipping_label_url) VALUES(?, ?, ?, ?, ?, ?, ?)`
@@ -191,10 +642,34 @@ func (os *OrderServiceImpl) insertShipping(tx *sql.Tx, orderID int64, shipment *
 	return nil
 }
 
-func (os *OrderServiceImpl) insertJob(tx *sql.Tx, orderID int64) (int64, error) {
+// insertJob queues the cart's files for printing, the job carries what a printer needs to
+// take it and when it should be done
+func (os *OrderServiceImpl) insertJob(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+	requirements, err := os.jobRequirements(tx, ssid, items)
+	if err != nil {
+		return -1, err
+	}
+
+	// the estimate is only shown to the customer, the order isn't failed over it
+	var estimate sql.NullTime
+	completion, err := os.Scheduler.EstimateCompletion(tx, requirements.printSeconds)
+	if err != nil {
+		log.Printf("Unable to estimate completion of order %d: %v\n", orderID, err)
+	} else {
+		estimate = sql.NullTime{Time: completion, Valid: true}
+	}
+
 	// Insert print job
-	jobQuery := `INSERT INTO print_jobs (order_id, status) VALUES (?, ?)`
-	jobResult, err := tx.Exec(jobQuery, orderID, "queued")
+	jobQuery := `
+		INSERT INTO print_jobs (
+			order_id, status, estimated_print_seconds, estimated_completion_time, size_x_mm, size_y_mm, size_z_mm, filament_colors
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	jobResult, err := tx.Exec(
+		jobQuery,
+		orderID, "queued", requirements.printSeconds, estimate,
+		requirements.width, requirements.depth, requirements.height, nullString(joinColors(requirements.colors)),
+	)
 	if err != nil {
 		return -1, fmt.Errorf("failed to insert print job: %w", err)
 	}
@@ -208,6 +683,26 @@ func (os *OrderServiceImpl) insertJob(tx *sql.Tx, orderID int64) (int64, error)
 	return jobID, nil
 }
 
+// insertOrderItems records what each line sold for so the order keeps its prices after the catalog changes
+func insertOrderItems(tx *sql.Tx, orderID int64, items []structs.OrderItem) error {
+	itemQuery := `
+		INSERT INTO order_items (
+			order_id, stl_id, template_type, size_variant, file_name, quantity, price_id, unit_price_cents, discount_cents
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, item := range items {
+		_, err := tx.Exec(
+			itemQuery,
+			orderID, item.StlID, item.TemplateType, item.SizeVariant, item.FileName, item.Quantity, item.PriceID, item.UnitPrice, item.Discount,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert order item: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func uploadToS3(localPath, s3Key string) error {
 	// Initialize AWS session
 	sess, err := aws_session.NewSession(&aws.Config{
@@ -241,6 +736,19 @@ func uploadToS3(localPath, s3Key string) error {
 	return nil
 }
 
+func newOrderToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate order token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func hashOrderToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 func getFilenameFromURL(url string) string {
 	parts := strings.Split(url, "/")
 	return parts[len(parts)-1]
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/EasyPost/easypost-go/v4"
@@ -22,6 +23,16 @@ func (m *MockEasyPostClient) CreateShipment(shipment *easypost.Shipment) (*easyp
 	return args.Get(0).(*easypost.Shipment), args.Error(1)
 }
 
+func (m *MockEasyPostClient) GetShipment(shipmentID string) (*easypost.Shipment, error) {
+	args := m.Called(shipmentID)
+	return args.Get(0).(*easypost.Shipment), args.Error(1)
+}
+
+func (m *MockEasyPostClient) VerifyAddress(address *easypost.Address) (*easypost.Address, error) {
+	args := m.Called(address)
+	return args.Get(0).(*easypost.Address), args.Error(1)
+}
+
 func (m *MockEasyPostClient) LowestShipmentRate(shipment *easypost.Shipment) (*easypost.Rate, error) {
 	args := m.Called(shipment)
 	return args.Get(0).(*easypost.Rate), args.Error(1)
@@ -32,6 +43,31 @@ func (m *MockEasyPostClient) BuyShipment(shipmentID string, rate *easypost.Rate,
 	return args.Get(0).(*easypost.Shipment), args.Error(1)
 }
 
+func (m *MockEasyPostClient) RefundShipment(shipmentID string) (*easypost.Shipment, error) {
+	args := m.Called(shipmentID)
+	return args.Get(0).(*easypost.Shipment), args.Error(1)
+}
+
+func (m *MockEasyPostClient) CreateScanForm(shipmentIDs ...string) (*easypost.ScanForm, error) {
+	args := m.Called(shipmentIDs)
+	return args.Get(0).(*easypost.ScanForm), args.Error(1)
+}
+
+func (m *MockEasyPostClient) GetScanForm(scanFormID string) (*easypost.ScanForm, error) {
+	args := m.Called(scanFormID)
+	return args.Get(0).(*easypost.ScanForm), args.Error(1)
+}
+
+// boughtLabel stands in for buyShippingLabel once the label has been paid for
+func boughtLabel(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
+	shipment := &easypost.Shipment{
+		ID:           "shp_123",
+		TrackingCode: "TRACK123",
+		SelectedRate: &easypost.Rate{Carrier: "USPS", EstDeliveryDays: 2},
+	}
+	return shipment, structs.ShippingInfo{TrackingNumber: "TRACK123", Carrier: "USPS", EstimatedDelivery: 2}, nil
+}
+
 func TestProcessOrder(t *testing.T) {
     tests := []struct {
         desc         string
@@ -41,6 +77,7 @@ func TestProcessOrder(t *testing.T) {
         wantOrderInfo structs.OrderInfo
         wantErr      bool
         wantErrMsg   string
+        wantRefund   bool
     }{
         {
             desc: "successfully processed order",
@@ -68,6 +105,7 @@ func TestProcessOrder(t *testing.T) {
                 // Mock buyShippingLabel
                 svc.buyShippingLabelFunc = func(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
                     return &easypost.Shipment{
+                            ID:           "shp_123",
                             TrackingCode: "TRACK123",
                             SelectedRate: &easypost.Rate{
                                 Carrier:        "USPS",
@@ -88,19 +126,20 @@ func TestProcessOrder(t *testing.T) {
                 }
                 
                 // Mock insertJob
-                svc.insertJobFunc = func(tx *sql.Tx, orderID int64) (int64, error) {
+                svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
                     return 1, nil
                 }
             },
             mockDB: func(mock sqlmock.Sqlmock) {
                 mock.ExpectBegin()
                 // Mock the cart items query
-                mock.ExpectQuery(`SELECT stl_url, quantity FROM cart_items WHERE browser_ssid = ?`).
+                mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items WHERE browser_ssid = ?`).
                     WithArgs("ssid123").
-                    WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity"}))
+                    WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}))
                 mock.ExpectCommit()
             },
             wantOrderInfo: structs.OrderInfo{
+                OrderID:         1,
                 PaymentIntentID: "pi_123",
                 BrowserSSID:     "ssid123",
                 Amount:         1000,
@@ -153,6 +192,31 @@ func TestProcessOrder(t *testing.T) {
             wantErr:    true,
             wantErrMsg: "database error",
         },
+		{
+			desc: "promo redemption rejected",
+			orderInfo: structs.OrderInfo{
+				PaymentIntentID: "pi_123",
+				BrowserSSID:     "ssid123",
+				Email:           "test@example.com",
+				PromotionID:     7,
+				DiscountAmount:  500,
+			},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+
+				promotions := new(MockPromotionService)
+				promotions.On("RecordRedemption", mock.Anything, int64(1), mock.Anything).Return(ErrPromotionExhausted)
+				svc.Promotions = promotions
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+			wantErr:    true,
+			wantErrMsg: ErrPromotionExhausted.Error(),
+		},
 		{
 			desc: "failed to get shipping label",
             orderInfo: structs.OrderInfo{
@@ -191,6 +255,7 @@ func TestProcessOrder(t *testing.T) {
 				// Mock buyShippingLabel
                 svc.buyShippingLabelFunc = func(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
                     return &easypost.Shipment{
+                            ID:           "shp_123",
                             TrackingCode: "TRACK123",
                             SelectedRate: &easypost.Rate{
                                 Carrier:        "USPS",
@@ -216,6 +281,7 @@ func TestProcessOrder(t *testing.T) {
             },
             wantErr:    true,
             wantErrMsg: "failed to insert shipping info",
+			wantRefund: true,
         },
 		{
             desc: "job insert fail",
@@ -243,6 +309,7 @@ func TestProcessOrder(t *testing.T) {
                 // Mock buyShippingLabel
                 svc.buyShippingLabelFunc = func(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
                     return &easypost.Shipment{
+                            ID:           "shp_123",
                             TrackingCode: "TRACK123",
                             SelectedRate: &easypost.Rate{
                                 Carrier:        "USPS",
@@ -263,16 +330,19 @@ func TestProcessOrder(t *testing.T) {
                 }
                 
                 // Mock insertJob
-                svc.insertJobFunc = func(tx *sql.Tx, orderID int64) (int64, error) {
+                svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
                     return -1, errors.New("failed to insert job")
                 }
             },
             mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}))
 				mock.ExpectRollback()
 			},
             wantErr: true,
 			wantErrMsg: "failed to insert job",
+			wantRefund: true,
         },
 		{
             desc: "failed to retrieve cart items",
@@ -300,6 +370,7 @@ func TestProcessOrder(t *testing.T) {
                 // Mock buyShippingLabel
                 svc.buyShippingLabelFunc = func(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
                     return &easypost.Shipment{
+                            ID:           "shp_123",
                             TrackingCode: "TRACK123",
                             SelectedRate: &easypost.Rate{
                                 Carrier:        "USPS",
@@ -320,18 +391,19 @@ func TestProcessOrder(t *testing.T) {
                 }
                 
                 // Mock insertJob
-                svc.insertJobFunc = func(tx *sql.Tx, orderID int64) (int64, error) {
+                svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
                     return 1, nil
                 }
             },
             mockDB: func(mock sqlmock.Sqlmock) {
                 mock.ExpectBegin()
                 // Mock the cart items query
-                mock.ExpectQuery(`SELECT stl_url, quantity FROM cart_items WHERE browser_ssid = ?`).
+                mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items WHERE browser_ssid = ?`).
                     WithArgs("ssid123").WillReturnError(errors.New("db error"))
                 mock.ExpectRollback()
             },
             wantOrderInfo: structs.OrderInfo{
+                OrderID:         1,
                 PaymentIntentID: "pi_123",
                 BrowserSSID:     "ssid123",
                 Amount:         1000,
@@ -353,7 +425,293 @@ func TestProcessOrder(t *testing.T) {
             },
             wantErr: true,
 			wantErrMsg: "failed to retrieve cart items",
+			wantRefund: true,
         },
+		{
+			desc:      "upload failure refunds the label",
+			orderInfo: structs.OrderInfo{PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.buyShippingLabelFunc = boughtLabel
+				svc.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+					return nil
+				}
+				svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+					return 1, nil
+				}
+				svc.uploadToS3Func = func(localPath, s3Key string) error {
+					return errors.New("access denied")
+				}
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}).
+						AddRow("https://api.fairway-ink.com/output/ssid123/marker.stl", 2, "solid", "standard"))
+				mock.ExpectRollback()
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to upload STL file: access denied",
+			wantRefund: true,
+		},
+		{
+			desc:      "pricing failure refunds the label",
+			orderInfo: structs.OrderInfo{PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.buyShippingLabelFunc = boughtLabel
+				svc.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+					return nil
+				}
+				svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+					return 1, nil
+				}
+				svc.uploadToS3Func = func(localPath, s3Key string) error {
+					return nil
+				}
+				pricing := new(MockPricingService)
+				pricing.On("GetPrice", "solid", "standard").Return(structs.Price{}, ErrUnknownProduct)
+				svc.Pricing = pricing
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}).
+						AddRow("https://api.fairway-ink.com/output/ssid123/marker.stl", 2, "solid", "standard"))
+				mock.ExpectRollback()
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to price STL file",
+			wantRefund: true,
+		},
+		{
+			desc:      "STL record failure refunds the label",
+			orderInfo: structs.OrderInfo{PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.buyShippingLabelFunc = boughtLabel
+				svc.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+					return nil
+				}
+				svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+					return 1, nil
+				}
+				svc.uploadToS3Func = func(localPath, s3Key string) error {
+					return nil
+				}
+				pricing := new(MockPricingService)
+				pricing.On("GetPrice", "solid", "standard").Return(structs.Price{PriceID: 1, UnitAmount: 1499}, nil)
+				svc.Pricing = pricing
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}).
+						AddRow("https://api.fairway-ink.com/output/ssid123/marker.stl", 2, "solid", "standard"))
+				mock.ExpectExec(`INSERT INTO stl_files`).WillReturnError(errors.New("db error"))
+				mock.ExpectRollback()
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to insert STL file record",
+			wantRefund: true,
+		},
+		{
+			desc: "each line is recorded with its price and share of the discount",
+			orderInfo: structs.OrderInfo{
+				PaymentIntentID: "pi_123",
+				BrowserSSID:     "ssid123",
+				PromotionID:     7,
+				PromoCode:       "FORE10",
+				DiscountAmount:  300,
+			},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.buyShippingLabelFunc = boughtLabel
+				svc.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+					return nil
+				}
+				svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+					if len(items) != 1 || items[0].Quantity != 2 {
+						return -1, fmt.Errorf("unexpected items %v", items)
+					}
+					return 1, nil
+				}
+				svc.uploadToS3Func = func(localPath, s3Key string) error {
+					return nil
+				}
+				pricing := new(MockPricingService)
+				pricing.On("GetPrice", "solid", "standard").Return(structs.Price{PriceID: 1, UnitAmount: 1499}, nil)
+				svc.Pricing = pricing
+
+				priced := []structs.OrderItem{{TemplateType: "solid", SizeVariant: "standard", FileName: "marker.stl", Quantity: 2, UnitPrice: 1499, StlID: 5, PriceID: 1}}
+				discounted := []structs.OrderItem{{TemplateType: "solid", SizeVariant: "standard", FileName: "marker.stl", Quantity: 2, UnitPrice: 1499, Discount: 300, StlID: 5, PriceID: 1}}
+				promotions := new(MockPromotionService)
+				promotions.On("RecordRedemption", mock.Anything, int64(1), mock.Anything).Return(nil)
+				promotions.On("AllocateDiscount", mock.Anything, int64(7), int64(300), priced).Return(discounted, nil)
+				svc.Promotions = promotions
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}).
+						AddRow("https://api.fairway-ink.com/output/ssid123/marker.stl", 2, "solid", "standard"))
+				mock.ExpectExec(`INSERT INTO stl_files`).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(`INSERT INTO order_items`).
+					WithArgs(int64(1), int64(5), "solid", "standard", "marker.stl", 2, int64(1), int64(1499), int64(300)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			wantOrderInfo: structs.OrderInfo{
+				OrderID:         1,
+				PaymentIntentID: "pi_123",
+				BrowserSSID:     "ssid123",
+				PromotionID:     7,
+				PromoCode:       "FORE10",
+				DiscountAmount:  300,
+				ShippingInfo:    structs.ShippingInfo{TrackingNumber: "TRACK123", Carrier: "USPS", EstimatedDelivery: 2},
+				Items: []structs.OrderItem{
+					{TemplateType: "solid", SizeVariant: "standard", FileName: "marker.stl", Quantity: 2, UnitPrice: 1499, Discount: 300, StlID: 5, PriceID: 1},
+				},
+			},
+		},
+		{
+			desc:      "order item failure refunds the label",
+			orderInfo: structs.OrderInfo{PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.buyShippingLabelFunc = boughtLabel
+				svc.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+					return nil
+				}
+				svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+					return 1, nil
+				}
+				svc.uploadToS3Func = func(localPath, s3Key string) error {
+					return nil
+				}
+				pricing := new(MockPricingService)
+				pricing.On("GetPrice", "solid", "standard").Return(structs.Price{PriceID: 1, UnitAmount: 1499}, nil)
+				svc.Pricing = pricing
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}).
+						AddRow("https://api.fairway-ink.com/output/ssid123/marker.stl", 2, "solid", "standard"))
+				mock.ExpectExec(`INSERT INTO stl_files`).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(`INSERT INTO order_items`).WillReturnError(errors.New("db error"))
+				mock.ExpectRollback()
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to insert order item: db error",
+			wantRefund: true,
+		},
+		{
+			desc:      "commit failure refunds the label",
+			orderInfo: structs.OrderInfo{PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.buyShippingLabelFunc = boughtLabel
+				svc.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+					return nil
+				}
+				svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+					return 1, nil
+				}
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}))
+				mock.ExpectCommit().WillReturnError(errors.New("connection lost"))
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to commit transaction: connection lost",
+			wantRefund: true,
+		},
+		{
+			desc:      "failed refund is reported with the original error",
+			orderInfo: structs.OrderInfo{PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.buyShippingLabelFunc = boughtLabel
+				svc.insertShippingFunc = func(tx *sql.Tx, orderID int64, shipment *easypost.Shipment) error {
+					return errors.New("failed to insert shipping info")
+				}
+				client := svc.ShipClient.(*MockEasyPostClient)
+				client.On("RefundShipment", "shp_123").Return((*easypost.Shipment)(nil), errors.New("label already scanned"))
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to insert shipping info\nfailed to refund shipping label shp_123: label already scanned",
+		},
+		{
+			desc:      "label deferred to ship time",
+			orderInfo: structs.OrderInfo{PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.DeferLabels = true
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.deferLabelFunc = func(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error {
+					return nil
+				}
+				svc.buyShippingLabelFunc = func(orderInfo *structs.OrderInfo) (*easypost.Shipment, structs.ShippingInfo, error) {
+					return nil, structs.ShippingInfo{}, errors.New("label bought at order time")
+				}
+				svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+					return 1, nil
+				}
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}))
+				mock.ExpectCommit()
+			},
+			wantOrderInfo: structs.OrderInfo{OrderID: 1, PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+		},
+		{
+			desc:      "deferred order fails without a label to refund",
+			orderInfo: structs.OrderInfo{PaymentIntentID: "pi_123", BrowserSSID: "ssid123"},
+			setupMocks: func(svc *OrderServiceImpl) {
+				svc.DeferLabels = true
+				svc.insertOrderFunc = func(tx *sql.Tx, orderInfo *structs.OrderInfo, total float64) (int64, error) {
+					return 1, nil
+				}
+				svc.deferLabelFunc = func(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error {
+					return nil
+				}
+				svc.insertJobFunc = func(tx *sql.Tx, orderID int64, ssid string, items []structs.CartItem) (int64, error) {
+					return -1, errors.New("failed to insert print job")
+				}
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT stl_url, quantity, template_type, size_variant FROM cart_items`).
+					WillReturnRows(sqlmock.NewRows([]string{"stl_url", "quantity", "template_type", "size_variant"}))
+				mock.ExpectRollback()
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to insert print job",
+		},
     }
 
     for _, tt := range tests {
@@ -370,7 +728,12 @@ func TestProcessOrder(t *testing.T) {
 
             // Create service with mock EasyPost client
             mockClient := new(MockEasyPostClient)
-            service := NewOrderService(db, mockClient).(*OrderServiceImpl)
+            if tt.wantRefund {
+                mockClient.On("RefundShipment", "shp_123").Return(&easypost.Shipment{ID: "shp_123", RefundStatus: "submitted"}, nil)
+            }
+            // the order is placed without slicing, the slicer mock fails the test if it's called
+            slicer := new(MockSlicer)
+            service := NewOrderService(db, mockClient, new(MockPricingService), new(MockPromotionService), new(MockPackagingService), new(MockPrintScheduler), slicer, CheapestRate{}, false).(*OrderServiceImpl)
 
             // Override the function implementations
             tt.setupMocks(service)
@@ -384,10 +747,14 @@ func TestProcessOrder(t *testing.T) {
                 assert.Contains(t, err.Error(), tt.wantErrMsg)
             } else {
                 assert.NoError(t, err)
+                // the token is random, only its shape can be checked
+                assert.Len(t, result.OrderToken, 64)
+                result.OrderToken = ""
                 assert.Equal(t, tt.wantOrderInfo, result)
             }
 
             // Verify all expectations were met
+            mockClient.AssertExpectations(t)
             if err := mock.ExpectationsWereMet(); err != nil {
                 t.Errorf("there were unfulfilled expectations: %s", err)
             }
@@ -413,12 +780,13 @@ func TestInsertOrder(t *testing.T) {
 				BrowserSSID:    "ssid123",
 				PaymentIntentID: "pi_123",
 				PaymentStatus:  "paid",
+				OrderToken:     "token123",
 			},
 			total: 10.0,
 			mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
 				mock.ExpectExec("INSERT INTO orders").
-					WithArgs("test@example.com", "John Doe", "123 St", "", "City", "ST", "12345", "US", "ssid123", "pi_123", 10.0, "paid").
+					WithArgs("test@example.com", "John Doe", "123 St", "", "City", "ST", "12345", "US", "ssid123", "pi_123", 10.0, int64(0), int64(0), "paid", hashOrderToken("token123")).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			wantErr: false,
@@ -456,7 +824,7 @@ func TestInsertOrder(t *testing.T) {
 			mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
 				mock.ExpectExec("INSERT INTO orders").
-					WithArgs("noid@example.com", "Jake Doe", "321 St", "", "Town", "TS", "54321", "US", "ssid789", "pi_789", 30.0, "paid").
+					WithArgs("noid@example.com", "Jake Doe", "321 St", "", "Town", "TS", "54321", "US", "ssid789", "pi_789", 30.0, int64(0), int64(0), "paid", sqlmock.AnyArg()).
 					WillReturnResult(sqlmock.NewErrorResult(errors.New("last insert id error")))
 			},
 			wantErr:    true,
@@ -503,6 +871,7 @@ func TestBuyShippingLabel(t *testing.T) {
 	tests := []struct {
 		desc         string
 		orderInfo    structs.OrderInfo
+		packErr      error
 		mockEasyPost func(*MockEasyPostClient)
 		wantShipInfo structs.ShippingInfo
 		wantErr      bool
@@ -512,6 +881,7 @@ func TestBuyShippingLabel(t *testing.T) {
 			desc: "Fail create label",
 			orderInfo: structs.OrderInfo{
 				Name: "John Doe",
+				ShippingAmount: 795,
 				Address: structs.AddressInfo{
 					Line1:      "123 St",
 					Line2:      "",
@@ -534,6 +904,7 @@ func TestBuyShippingLabel(t *testing.T) {
 			desc: "successfully create label",
 			orderInfo: structs.OrderInfo{
 				Name: "John Doe",
+				ShippingAmount: 795,
 				Address: structs.AddressInfo{
 					Line1:      "123 St",
 					Line2:      "",
@@ -561,10 +932,6 @@ func TestBuyShippingLabel(t *testing.T) {
 						Rates:        []*easypost.Rate{expectedRate},
 					}, nil)
 
-				// Mock LowestShipmentRate
-				m.On("LowestShipmentRate", mock.AnythingOfType("*easypost.Shipment")).
-					Return(expectedRate, nil)
-
 				// Mock BuyShipment - use mock.MatchedBy to match the rate
 				m.On("BuyShipment", "shp_123", mock.MatchedBy(func(rate *easypost.Rate) bool {
 					return rate.ID == "rate_1"
@@ -576,9 +943,11 @@ func TestBuyShippingLabel(t *testing.T) {
 			wantErrMsg: "failed to buy shipping label",
 		},
 		{
-			desc: "successfully create label",
+			desc: "no rate matches the order's policy",
 			orderInfo: structs.OrderInfo{
 				Name: "John Doe",
+				ShippingAmount: 795,
+				RatePolicy: &structs.RatePolicy{Strategy: RATE_STRATEGY_PREFERRED_CARRIER, Carriers: []string{"UPS"}},
 				Address: structs.AddressInfo{
 					Line1:      "123 St",
 					Line2:      "",
@@ -605,19 +974,16 @@ func TestBuyShippingLabel(t *testing.T) {
 						TrackingCode: "TRACK123",
 						Rates:        []*easypost.Rate{expectedRate},
 					}, nil)
-
-				// Mock LowestShipmentRate
-				m.On("LowestShipmentRate", mock.AnythingOfType("*easypost.Shipment")).
-					Return(&easypost.Rate{}, fmt.Errorf("failed lowest rate call"))
 			},
 			wantShipInfo: structs.ShippingInfo{},
 			wantErr: true,
-			wantErrMsg: "failed to get lowest shipping rate:",
+			wantErrMsg: "failed to select shipping rate: " + ErrNoMatchingRate.Error(),
 		},
 		{
 			desc: "successfully create label",
 			orderInfo: structs.OrderInfo{
 				Name: "John Doe",
+				ShippingAmount: 795,
 				Address: structs.AddressInfo{
 					Line1:      "123 St",
 					Line2:      "",
@@ -645,10 +1011,6 @@ func TestBuyShippingLabel(t *testing.T) {
 						Rates:        []*easypost.Rate{expectedRate},
 					}, nil)
 
-				// Mock LowestShipmentRate
-				m.On("LowestShipmentRate", mock.AnythingOfType("*easypost.Shipment")).
-					Return(expectedRate, nil)
-
 				// Mock BuyShipment - use mock.MatchedBy to match the rate
 				m.On("BuyShipment", "shp_123", mock.MatchedBy(func(rate *easypost.Rate) bool {
 					return rate.ID == "rate_1"
@@ -678,13 +1040,161 @@ func TestBuyShippingLabel(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			desc: "rush order buys the fastest rate",
+			orderInfo: structs.OrderInfo{
+				Name:           "John Doe",
+				ShippingAmount: 2875,
+				RatePolicy:     &structs.RatePolicy{Strategy: RATE_STRATEGY_FASTEST},
+				Address: structs.AddressInfo{
+					Line1:      "123 St",
+					City:       "City",
+					State:      "ST",
+					PostalCode: "12345",
+					Country:    "US",
+				},
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				express := &easypost.Rate{ID: "rate_express", Carrier: "USPS", Service: "Express", Rate: "28.75", EstDeliveryDays: 1}
+
+				m.On("CreateShipment", mock.AnythingOfType("*easypost.Shipment")).
+					Return(&easypost.Shipment{
+						ID: "shp_123",
+						Rates: []*easypost.Rate{
+							{ID: "rate_ground", Carrier: "USPS", Service: "GroundAdvantage", Rate: "5.10", EstDeliveryDays: 5},
+							express,
+						},
+					}, nil)
+
+				m.On("BuyShipment", "shp_123", &easypost.Rate{ID: "rate_express"}, "").
+					Return(&easypost.Shipment{
+						ID:           "shp_123",
+						TrackingCode: "TRACK789",
+						SelectedRate: express,
+					}, nil)
+			},
+			wantShipInfo: structs.ShippingInfo{
+				TrackingNumber: "TRACK789",
+				ToAddress: easypost.Address{
+					Name:    "John Doe",
+					Street1: "123 St",
+					City:    "City",
+					State:   "ST",
+					Zip:     "12345",
+					Country: "US",
+				},
+				Carrier:           "USPS",
+				EstimatedDelivery: 1,
+			},
+		},
+		{
+			desc: "international label is declared for customs",
+			orderInfo: structs.OrderInfo{
+				Name:           "Jean Tremblay",
+				ShippingAmount: 1625,
+				// declared when the label was deferred
+				Customs: []structs.CustomsItem{{Description: "Plastic golf ball markers", HSTariffNumber: "950639", Quantity: 2, Value: 2998, Weight: 0.9, OriginCountry: "US"}},
+				Address: structs.AddressInfo{
+					Line1:      "40 Bay St",
+					City:       "Toronto",
+					State:      "ON",
+					PostalCode: "M5J 2X2",
+					Country:    "CA",
+				},
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				rate := &easypost.Rate{ID: "rate_intl", Carrier: "USPS", Service: "FirstClassPackageInternationalService", Rate: "16.25", EstDeliveryDays: 8}
+
+				m.On("CreateShipment", mock.MatchedBy(func(shipment *easypost.Shipment) bool {
+					return shipment.CustomsInfo != nil && len(shipment.CustomsInfo.CustomsItems) == 1 &&
+						shipment.CustomsInfo.CustomsItems[0].Value == 29.98 && shipment.Options.Incoterm == "DDU"
+				})).Return(&easypost.Shipment{ID: "shp_intl", Rates: []*easypost.Rate{rate}}, nil)
+
+				m.On("BuyShipment", "shp_intl", &easypost.Rate{ID: "rate_intl"}, "").
+					Return(&easypost.Shipment{ID: "shp_intl", TrackingCode: "TRACKCA", SelectedRate: rate}, nil)
+			},
+			wantShipInfo: structs.ShippingInfo{
+				TrackingNumber: "TRACKCA",
+				ToAddress: easypost.Address{
+					Name:    "Jean Tremblay",
+					Street1: "40 Bay St",
+					City:    "Toronto",
+					State:   "ON",
+					Zip:     "M5J 2X2",
+					Country: "CA",
+				},
+				Carrier:           "USPS",
+				EstimatedDelivery: 8,
+			},
+		},
+		{
+			desc: "order too large to pack",
+			orderInfo: structs.OrderInfo{
+				BrowserSSID:    "ssid123",
+				Name:           "John Doe",
+				ShippingAmount: 795,
+			},
+			packErr:      ErrNoBoxFits,
+			mockEasyPost: func(m *MockEasyPostClient) {},
+			wantErr:      true,
+			wantErrMsg:   "failed to pack order: " + ErrNoBoxFits.Error(),
+		},
+		{
+			desc: "order that paid no shipping isn't given a label on the shop",
+			orderInfo: structs.OrderInfo{
+				Name:    "John Doe",
+				Address: structs.AddressInfo{Line1: "123 St", City: "City", State: "ST", PostalCode: "12345", Country: "US"},
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {},
+			wantErr:      true,
+			wantErrMsg:   ErrShippingNotPaid.Error(),
+		},
+		{
+			desc: "quoted rate is bought on the quoted shipment",
+			orderInfo: structs.OrderInfo{
+				Name:       "John Doe",
+				ShipmentID: "shp_quoted",
+				RateID:     "rate_2",
+				Address: structs.AddressInfo{
+					Line1:      "123 St",
+					City:       "City",
+					State:      "ST",
+					PostalCode: "12345",
+					Country:    "US",
+				},
+			},
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("BuyShipment", "shp_quoted", &easypost.Rate{ID: "rate_2"}, "").
+					Return(&easypost.Shipment{
+						ID:           "shp_quoted",
+						TrackingCode: "TRACK456",
+						SelectedRate: &easypost.Rate{ID: "rate_2", Carrier: "UPS", EstDeliveryDays: 3},
+					}, nil)
+			},
+			wantShipInfo: structs.ShippingInfo{
+				TrackingNumber: "TRACK456",
+				ToAddress: easypost.Address{
+					Name:    "John Doe",
+					Street1: "123 St",
+					City:    "City",
+					State:   "ST",
+					Zip:     "12345",
+					Country: "US",
+				},
+				Carrier:           "UPS",
+				EstimatedDelivery: 3,
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.desc, func(t *testing.T) {
 			mockClient := new(MockEasyPostClient)
 			tt.mockEasyPost(mockClient)
-			service := &OrderServiceImpl{ShipClient: mockClient}
+			packaging := new(MockPackagingService)
+			packaging.On("PackCart", tt.orderInfo.BrowserSSID).
+				Return(structs.Parcel{Box: "Padded mailer", Length: 8, Width: 7, Height: 1.25, Weight: 2}, tt.packErr).Maybe()
+			service := &OrderServiceImpl{ShipClient: mockClient, Packaging: packaging, RateSelector: CheapestRate{}}
 			_, shipInfo, err := service.buyShippingLabel(&tt.orderInfo)
 			
 			if tt.wantErr {
@@ -795,29 +1305,87 @@ func TestInsertShipping(t *testing.T) {
 }
 
 func TestInsertJob(t *testing.T) {
+	completion := time.Date(2024, 5, 2, 14, 30, 0, 0, time.UTC)
+	items := []structs.CartItem{
+		{StlURL: "http://localhost/output/ssid/marker.stl", Quantity: 2, TemplateType: "solid", SizeVariant: "standard"},
+		{StlURL: "http://localhost/output/ssid/marker2.stl", Quantity: 1, TemplateType: "solid"},
+	}
+	colorQuery := `SELECT filament_color FROM products WHERE template_type = \? AND size_variant = \?`
+
 	tests := []struct {
 		desc        string
 		mockDB      func(sqlmock.Sqlmock)
 		orderID   	int64
+		items       []structs.CartItem
+		estimateErr error
 		wantErr     bool
 		wantErrMsg  string
 	}{
 		{
 			desc: "successfully insert order",
 			orderID: 7,
+			items: items,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(colorQuery).
+					WithArgs("solid", "standard").
+					WillReturnRows(sqlmock.NewRows([]string{"filament_color"}).AddRow("white"))
+				mock.ExpectExec("INSERT INTO print_jobs").
+					WithArgs(7, "queued", 900, completion, 25.0, 25.0, 3.0, "white").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantErr: false,
+		},
+		{
+			desc: "product without a color prints in any",
+			orderID: 7,
+			items: items[:1],
 			mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
+				mock.ExpectQuery(colorQuery).
+					WithArgs("solid", "standard").
+					WillReturnRows(sqlmock.NewRows([]string{"filament_color"}).AddRow(nil))
 				mock.ExpectExec("INSERT INTO print_jobs").
-					WithArgs(7, "queued").
+					WithArgs(7, "queued", 600, completion, 25.0, 25.0, 3.0, nil).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			wantErr: false,
 		},
+		{
+			desc: "job is queued without an estimate",
+			orderID: 7,
+			items: items[:1],
+			estimateErr: errors.New("db down"),
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(colorQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"filament_color"}).AddRow("white"))
+				mock.ExpectExec("INSERT INTO print_jobs").
+					WithArgs(7, "queued", 600, nil, 25.0, 25.0, 3.0, "white").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantErr: false,
+		},
+		{
+			desc: "color lookup fails",
+			orderID: 7,
+			items: items[:1],
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(colorQuery).
+					WillReturnError(errors.New("db down"))
+			},
+			wantErr:    true,
+			wantErrMsg: "failed to look up filament color:",
+		},
 		{
 			desc: "query fails",
 			orderID: 8,
+			items: items[:1],
 			mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
+				mock.ExpectQuery(colorQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"filament_color"}).AddRow("white"))
 				mock.ExpectExec("INSERT INTO print_jobs").
 					WillReturnError(errors.New("insert failed"))
 			},
@@ -827,10 +1395,13 @@ func TestInsertJob(t *testing.T) {
 		{
 			desc: "fail to get last insert id",
 			orderID: 9,
+			items: items[:1],
 			mockDB: func(mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
+				mock.ExpectQuery(colorQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"filament_color"}).AddRow("white"))
 				mock.ExpectExec("INSERT INTO print_jobs").
-				WithArgs(9, "queued").
+				WithArgs(9, "queued", 600, completion, 25.0, 25.0, 3.0, "white").
 				WillReturnResult(sqlmock.NewErrorResult(errors.New("last insert id error")))
 			},
 			wantErr:    true,
@@ -840,6 +1411,16 @@ func TestInsertJob(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.desc, func(t *testing.T) {
+			// the files aren't on disk so every one is estimated as a default marker
+			scheduler := new(MockPrintScheduler)
+			scheduler.On("EstimatePrintSeconds", DEFAULT_MARKER_MESH, 2).Return(600)
+			scheduler.On("EstimatePrintSeconds", DEFAULT_MARKER_MESH, 1).Return(300).Maybe()
+			seconds := 600
+			if len(tt.items) > 1 {
+				seconds = 900
+			}
+			scheduler.On("EstimateCompletion", mock.Anything, seconds).Return(completion, tt.estimateErr).Maybe()
+
 			db, mock, err := sqlmock.New()
 			if err != nil {
 				t.Fatalf("failed to create mock db: %v", err)
@@ -848,14 +1429,14 @@ func TestInsertJob(t *testing.T) {
 
 			tt.mockDB(mock)
 
-			service := &OrderServiceImpl{DB: db}
+			service := &OrderServiceImpl{DB: db, Scheduler: scheduler}
 			tx, err := db.Begin()
 			if err != nil {
 				t.Fatalf("failed to begin transaction: %v", err)
 			}
 
 
-			jobID, err := service.insertJob(tx, tt.orderID)
+			jobID, err := service.insertJob(tx, tt.orderID, "ssid", tt.items)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -866,9 +1447,422 @@ func TestInsertJob(t *testing.T) {
 				assert.Equal(t, int64(1), jobID)
 			}
 
+			scheduler.AssertExpectations(t)
 			if err := mock.ExpectationsWereMet(); err != nil {
 				t.Errorf("there were unfulfilled expectations: %s", err)
 			}		
 		})
 	}
 }
+
+func TestGetOrderByIntent(t *testing.T) {
+	columns := []string{
+		"order_id", "stripe_ssid", "browser_ssid", "total_amount", "payment_status", "purchaser_name", "purchaser_email",
+		"address_1", "address_2", "city", "state", "zipcode", "country",
+		"tracking_number", "carrier", "code", "discount_cents",
+	}
+
+	tests := []struct {
+		desc      string
+		mockDB    func(sqlmock.Sqlmock)
+		wantOrder structs.OrderInfo
+		wantErr   error
+	}{
+		{
+			desc: "order found",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders o (.+) WHERE o.stripe_ssid = \?`).
+					WithArgs("pi_123").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(
+						42, "pi_123", "ssid123", 43.97, "succeeded", "John Doe", "test@example.com",
+						"123 Main St", nil, "Boston", "MA", "02108", "US",
+						"TRACK123", "USPS", "FORE10", 489,
+					))
+			},
+			wantOrder: structs.OrderInfo{
+				OrderID:         42,
+				PaymentIntentID: "pi_123",
+				BrowserSSID:     "ssid123",
+				Amount:          4397,
+				PaymentStatus:   "succeeded",
+				Name:            "John Doe",
+				Email:           "test@example.com",
+				PromoCode:       "FORE10",
+				DiscountAmount:  489,
+				Address: structs.AddressInfo{
+					Line1:      "123 Main St",
+					City:       "Boston",
+					State:      "MA",
+					PostalCode: "02108",
+					Country:    "US",
+				},
+				ShippingInfo: structs.ShippingInfo{TrackingNumber: "TRACK123", Carrier: "USPS"},
+			},
+		},
+		{
+			desc: "no order for intent",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders o`).WithArgs("pi_123").WillReturnRows(sqlmock.NewRows(columns))
+			},
+			wantErr: ErrOrderNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewOrderService(db, new(MockEasyPostClient), new(MockPricingService), new(MockPromotionService), new(MockPackagingService), new(MockPrintScheduler), new(MockSlicer), CheapestRate{}, false)
+			order, err := service.GetOrderByIntent("pi_123")
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantOrder, order)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestUpdatePaymentStatus(t *testing.T) {
+	tests := []struct {
+		desc    string
+		mockDB  func(sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			desc: "status updated",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE orders SET payment_status = \? WHERE stripe_ssid = \?`).
+					WithArgs("refunded", "pi_123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			desc: "no order for intent",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE orders`).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrOrderNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewOrderService(db, new(MockEasyPostClient), new(MockPricingService), new(MockPromotionService), new(MockPackagingService), new(MockPrintScheduler), new(MockSlicer), CheapestRate{}, false)
+			err = service.UpdatePaymentStatus("pi_123", "refunded")
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+var orderDetailsColumns = []string{
+	"order_id", "stripe_ssid", "purchaser_name", "purchaser_email",
+	"address_1", "address_2", "city", "state", "zipcode", "country",
+	"total_amount", "shipping_cents", "tax_cents", "payment_status", "order_token_hash", "created_at",
+	"status", "estimated_completion_time", "completed_at",
+	"shipping_status", "carrier", "tracking_number", "code", "discount_cents",
+}
+
+var orderItemColumns = []string{"template_type", "size_variant", "file_name", "quantity", "unit_price_cents", "discount_cents"}
+
+var trackingEventColumns = []string{"status", "status_detail", "message", "city", "state", "country", "occurred_at"}
+
+func orderDetailsRow(createdAt time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows(orderDetailsColumns).AddRow(
+		42, "pi_123", "John Doe", "golfer@example.com",
+		"123 Main St", nil, "Boston", "MA", "02108", "US",
+		43.97, 0, 0, "succeeded", hashOrderToken("token123"), createdAt,
+		"printing", createdAt.Add(5*time.Hour), nil,
+		"pending", "USPS", "TRACK123", nil, nil,
+	)
+}
+
+func TestGetCustomerOrder(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	estimatedCompletion := createdAt.Add(5 * time.Hour)
+
+	tests := []struct {
+		desc      string
+		email     string
+		token     string
+		mockDB    func(sqlmock.Sqlmock)
+		wantOrder structs.OrderDetails
+		wantErr   error
+	}{
+		{
+			desc:  "email and token match",
+			email: "Golfer@Example.com",
+			token: "token123",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders o (.+) WHERE o.order_id = \?`).
+					WithArgs(int64(42)).
+					WillReturnRows(orderDetailsRow(createdAt))
+				mock.ExpectQuery(`SELECT template_type, size_variant, file_name, quantity, unit_price_cents, discount_cents FROM order_items`).
+					WithArgs(int64(42)).
+					WillReturnRows(sqlmock.NewRows(orderItemColumns).
+						AddRow("text", "standard", "marker.stl", 2, 1299, 260).
+						AddRow(nil, nil, "legacy.stl", 1, nil, 0))
+				mock.ExpectQuery(`SELECT t.status, (.+) FROM tracking_events t JOIN shipping s (.+) WHERE s.order_id = \?`).
+					WithArgs(int64(42)).
+					WillReturnRows(sqlmock.NewRows(trackingEventColumns).
+						AddRow("pre_transit", "label_created", "Shipping label created", nil, nil, nil, createdAt).
+						AddRow("in_transit", "arrived_at_facility", "Arrived at USPS facility", "Columbus", "OH", "US", createdAt.Add(24*time.Hour)))
+			},
+			wantOrder: structs.OrderDetails{
+				OrderID:         42,
+				PaymentIntentID: "pi_123",
+				Name:            "John Doe",
+				Email:           "golfer@example.com",
+				Address:         structs.AddressInfo{Line1: "123 Main St", City: "Boston", State: "MA", PostalCode: "02108", Country: "US"},
+				Total:           4397,
+				PaymentStatus:   "succeeded",
+				PrintStatus:     "printing",
+				ShippingStatus:  "pending",
+				Carrier:         "USPS",
+				TrackingNumber:  "TRACK123",
+				CreatedAt:       createdAt,
+				TokenHash:       hashOrderToken("token123"),
+				// printing finishes after the day's cutoff
+				EstimatedCompletion: &estimatedCompletion,
+				ExpectedShipDate:    "2024-05-02",
+				Items: []structs.OrderItem{
+					{TemplateType: "text", SizeVariant: "standard", FileName: "marker.stl", Quantity: 2, UnitPrice: 1299, Discount: 260},
+					{FileName: "legacy.stl", Quantity: 1},
+				},
+				Tracking: []structs.TrackingEvent{
+					{Status: "pre_transit", StatusDetail: "label_created", Message: "Shipping label created", OccurredAt: createdAt},
+					{
+						Status:       "in_transit",
+						StatusDetail: "arrived_at_facility",
+						Message:      "Arrived at USPS facility",
+						City:         "Columbus",
+						State:        "OH",
+						Country:      "US",
+						OccurredAt:   createdAt.Add(24 * time.Hour),
+					},
+				},
+			},
+		},
+		{
+			desc:  "wrong token",
+			email: "golfer@example.com",
+			token: "guess",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders o`).WillReturnRows(orderDetailsRow(createdAt))
+				mock.ExpectQuery(`FROM order_items`).WillReturnRows(sqlmock.NewRows(orderItemColumns))
+				mock.ExpectQuery(`FROM tracking_events`).WillReturnRows(sqlmock.NewRows(trackingEventColumns))
+			},
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			desc:  "wrong email",
+			email: "someone@example.com",
+			token: "token123",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders o`).WillReturnRows(orderDetailsRow(createdAt))
+				mock.ExpectQuery(`FROM order_items`).WillReturnRows(sqlmock.NewRows(orderItemColumns))
+				mock.ExpectQuery(`FROM tracking_events`).WillReturnRows(sqlmock.NewRows(trackingEventColumns))
+			},
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			desc:  "no such order",
+			email: "golfer@example.com",
+			token: "token123",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders o`).WillReturnRows(sqlmock.NewRows(orderDetailsColumns))
+			},
+			wantErr: ErrOrderNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewOrderService(db, new(MockEasyPostClient), new(MockPricingService), new(MockPromotionService), new(MockPackagingService), new(MockPrintScheduler), new(MockSlicer), CheapestRate{}, false)
+			order, err := service.GetCustomerOrder(42, tt.email, tt.token)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantOrder, order)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestReissueOrderToken(t *testing.T) {
+	tests := []struct {
+		desc    string
+		email   string
+		mockDB  func(sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			desc:  "email matches",
+			email: "Golfer@Example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT purchaser_email, purchaser_name FROM orders WHERE order_id = \?`).
+					WithArgs(int64(42)).
+					WillReturnRows(sqlmock.NewRows([]string{"purchaser_email", "purchaser_name"}).AddRow("golfer@example.com", "John Doe"))
+				mock.ExpectExec(`UPDATE orders SET order_token_hash = \? WHERE order_id = \?`).
+					WithArgs(sqlmock.AnyArg(), int64(42)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			desc:  "wrong email keeps the old token",
+			email: "someone@example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders WHERE order_id = \?`).
+					WillReturnRows(sqlmock.NewRows([]string{"purchaser_email", "purchaser_name"}).AddRow("golfer@example.com", "John Doe"))
+			},
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			desc:  "no such order",
+			email: "golfer@example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders WHERE order_id = \?`).
+					WillReturnRows(sqlmock.NewRows([]string{"purchaser_email", "purchaser_name"}))
+			},
+			wantErr: ErrOrderNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewOrderService(db, new(MockEasyPostClient), new(MockPricingService), new(MockPromotionService), new(MockPackagingService), new(MockPrintScheduler), new(MockSlicer), CheapestRate{}, false)
+			order, err := service.ReissueOrderToken(42, tt.email)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, order.OrderToken)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, int64(42), order.OrderID)
+				assert.Equal(t, "golfer@example.com", order.Email)
+				assert.Equal(t, "John Doe", order.Name)
+				assert.Len(t, order.OrderToken, 64)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestListOrders(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc       string
+		filter     structs.OrderFilter
+		mockDB     func(sqlmock.Sqlmock)
+		wantCount  int
+		wantErrMsg string
+	}{
+		{
+			desc: "default page",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders o (.+) ORDER BY o.order_id DESC LIMIT \? OFFSET \?`).
+					WithArgs(50, 0).
+					WillReturnRows(orderDetailsRow(createdAt))
+			},
+			wantCount: 1,
+		},
+		{
+			desc:   "filtered by email and status",
+			filter: structs.OrderFilter{Email: "Golfer@Example.com", PaymentStatus: "refunded", Limit: 10, Offset: 20},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`WHERE o.purchaser_email = \? AND o.payment_status = \? ORDER BY`).
+					WithArgs("golfer@example.com", "refunded", 10, 20).
+					WillReturnRows(sqlmock.NewRows(orderDetailsColumns))
+			},
+			wantCount: 0,
+		},
+		{
+			desc: "query fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM orders o`).WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "failed to list orders: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewOrderService(db, new(MockEasyPostClient), new(MockPricingService), new(MockPromotionService), new(MockPackagingService), new(MockPrintScheduler), new(MockSlicer), CheapestRate{}, false)
+			orders, err := service.ListOrders(tt.filter)
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, orders, tt.wantCount)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+var ErrNoBoxFits = errors.New("order is too large to ship in one box")
+
+type PackagingServiceImpl struct {
+	DB      *sql.DB
+	Cart    CartService
+	Pricing PricingService
+}
+
+func NewPackagingService(db *sql.DB, cart CartService, pricing PricingService) PackagingService {
+	return &PackagingServiceImpl{DB: db, Cart: cart, Pricing: pricing}
+}
+
+// box is a packaging option, boxes are tried smallest first
+type box struct {
+	id         int64
+	name       string
+	length     float64
+	width      float64
+	height     float64
+	tareWeight float64
+	maxMarkers int
+}
+
+// PackCart picks the box a browser session's cart ships in and weighs it
+func (ps *PackagingServiceImpl) PackCart(ssid string) (structs.Parcel, error) {
+	cart, err := ps.Cart.GetCartItems(ssid)
+	if err != nil {
+		return structs.Parcel{}, fmt.Errorf("failed to load cart: %w", err)
+	}
+
+	boxes, err := ps.activeBoxes()
+	if err != nil {
+		return structs.Parcel{}, err
+	}
+
+	weights, err := ps.markerWeights()
+	if err != nil {
+		return structs.Parcel{}, err
+	}
+
+	return packCart(cart, boxes, weights)
+}
+
+func (ps *PackagingServiceImpl) activeBoxes() ([]box, error) {
+	query := `
+		SELECT box_id, name, length_in, width_in, height_in, tare_weight_oz, max_markers
+		FROM boxes
+		WHERE active = TRUE
+		ORDER BY length_in * width_in * height_in, max_markers
+	`
+	rows, err := ps.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list boxes: %w", err)
+	}
+	defer rows.Close()
+
+	var boxes []box
+	for rows.Next() {
+		var b box
+		if err := rows.Scan(&b.id, &b.name, &b.length, &b.width, &b.height, &b.tareWeight, &b.maxMarkers); err != nil {
+			return nil, fmt.Errorf("failed to scan box: %w", err)
+		}
+		boxes = append(boxes, b)
+	}
+
+	return boxes, nil
+}
+
+// markerWeights maps template_type/size_variant to the weight of one marker in ounces
+func (ps *PackagingServiceImpl) markerWeights() (map[string]float64, error) {
+	rows, err := ps.DB.Query(`SELECT template_type, size_variant, unit_weight_oz FROM products`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list marker weights: %w", err)
+	}
+	defer rows.Close()
+
+	weights := map[string]float64{}
+	for rows.Next() {
+		var templateType, sizeVariant string
+		var weight float64
+		if err := rows.Scan(&templateType, &sizeVariant, &weight); err != nil {
+			return nil, fmt.Errorf("failed to scan marker weight: %w", err)
+		}
+		weights[templateType+"/"+sizeVariant] = weight
+	}
+
+	return weights, nil
+}
+
+// packCart puts the cart in the smallest box that holds every marker, boxes must already
+// be sorted smallest first. The parcel weight is the box plus each marker in it
+func packCart(cart []structs.CartItem, boxes []box, weights map[string]float64) (structs.Parcel, error) {
+	if len(cart) == 0 {
+		return structs.Parcel{}, ErrEmptyCart
+	}
+
+	var markers int
+	var weight float64
+	for _, item := range cart {
+		sizeVariant := item.SizeVariant
+		if sizeVariant == "" {
+			sizeVariant = DEFAULT_SIZE_VARIANT
+		}
+
+		unitWeight, ok := weights[item.TemplateType+"/"+sizeVariant]
+		if !ok {
+			return structs.Parcel{}, fmt.Errorf("%w: %s/%s", ErrUnknownProduct, item.TemplateType, sizeVariant)
+		}
+
+		markers += item.Quantity
+		weight += unitWeight * float64(item.Quantity)
+	}
+
+	for _, b := range boxes {
+		if b.maxMarkers < markers {
+			continue
+		}
+
+		return structs.Parcel{
+			BoxID:  b.id,
+			Box:    b.name,
+			Length: b.length,
+			Width:  b.width,
+			Height: b.height,
+			// EasyPost takes weight to a tenth of an ounce
+			Weight: math.Ceil((b.tareWeight+weight)*10) / 10,
+		}, nil
+	}
+
+	return structs.Parcel{}, fmt.Errorf("%w: %d markers", ErrNoBoxFits, markers)
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPackagingService struct {
+	mock.Mock
+}
+
+func (m *MockPackagingService) PackCart(ssid string) (structs.Parcel, error) {
+	args := m.Called(ssid)
+	return args.Get(0).(structs.Parcel), args.Error(1)
+}
+
+func (m *MockPackagingService) DeclareContents(ssid string) ([]structs.CustomsItem, error) {
+	args := m.Called(ssid)
+	items, _ := args.Get(0).([]structs.CustomsItem)
+	return items, args.Error(1)
+}
+
+var testBoxes = []box{
+	{id: 1, name: "Padded mailer", length: 8, width: 7, height: 1.25, tareWeight: 1.5, maxMarkers: 4},
+	{id: 2, name: "Small box", length: 8, width: 6, height: 4, tareWeight: 4, maxMarkers: 20},
+	{id: 3, name: "Medium box", length: 12, width: 10, height: 6, tareWeight: 8.5, maxMarkers: 60},
+}
+
+var testWeights = map[string]float64{"solid/standard": 0.45, "text/standard": 0.5, "custom/standard": 0.55}
+
+func TestPackCartIntoBox(t *testing.T) {
+	tests := []struct {
+		desc       string
+		cart       []structs.CartItem
+		want       structs.Parcel
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc: "single marker ships in a mailer",
+			cart: []structs.CartItem{{Quantity: 1, TemplateType: "text"}},
+			want: structs.Parcel{BoxID: 1, Box: "Padded mailer", Length: 8, Width: 7, Height: 1.25, Weight: 2},
+		},
+		{
+			desc: "mailer holds exactly its capacity",
+			cart: []structs.CartItem{{Quantity: 2, TemplateType: "solid"}, {Quantity: 2, TemplateType: "custom", SizeVariant: "standard"}},
+			want: structs.Parcel{BoxID: 1, Box: "Padded mailer", Length: 8, Width: 7, Height: 1.25, Weight: 3.5},
+		},
+		{
+			desc: "fifty markers need the medium box",
+			cart: []structs.CartItem{{Quantity: 30, TemplateType: "solid"}, {Quantity: 20, TemplateType: "custom"}},
+			want: structs.Parcel{BoxID: 3, Box: "Medium box", Length: 12, Width: 10, Height: 6, Weight: 33},
+		},
+		{
+			desc:    "too many markers for any box",
+			cart:    []structs.CartItem{{Quantity: 61, TemplateType: "solid"}},
+			wantErr: ErrNoBoxFits,
+		},
+		{
+			desc:    "empty cart",
+			wantErr: ErrEmptyCart,
+		},
+		{
+			desc:       "marker without a weight",
+			cart:       []structs.CartItem{{Quantity: 1, TemplateType: "gold"}},
+			wantErr:    ErrUnknownProduct,
+			wantErrMsg: "gold/standard",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			parcel, err := packCart(tt.cart, testBoxes, testWeights)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, parcel)
+		})
+	}
+}
+
+func TestPackCart(t *testing.T) {
+	boxColumns := []string{"box_id", "name", "length_in", "width_in", "height_in", "tare_weight_oz", "max_markers"}
+	weightColumns := []string{"template_type", "size_variant", "unit_weight_oz"}
+
+	tests := []struct {
+		desc       string
+		mockDB     func(sqlmock.Sqlmock)
+		cartErr    error
+		want       structs.Parcel
+		wantErrMsg string
+	}{
+		{
+			desc: "cart packed from the box and product tables",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT box_id, name, length_in, width_in, height_in, tare_weight_oz, max_markers FROM boxes WHERE active = TRUE ORDER BY`).
+					WillReturnRows(sqlmock.NewRows(boxColumns).
+						AddRow(1, "Padded mailer", 8, 7, 1.25, 1.5, 4).
+						AddRow(2, "Small box", 8, 6, 4, 4, 20))
+				mock.ExpectQuery(`SELECT template_type, size_variant, unit_weight_oz FROM products`).
+					WillReturnRows(sqlmock.NewRows(weightColumns).
+						AddRow("solid", "standard", 0.45).
+						AddRow("text", "standard", 0.5))
+			},
+			want: structs.Parcel{BoxID: 1, Box: "Padded mailer", Length: 8, Width: 7, Height: 1.25, Weight: 2.9},
+		},
+		{
+			desc:       "cart lookup fails",
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			cartErr:    errors.New("db down"),
+			wantErrMsg: "failed to load cart: db down",
+		},
+		{
+			desc: "box lookup fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM boxes`).WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "failed to list boxes: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			cart := new(MockCartService)
+			cart.On("GetCartItems", "ssid123").Return(testCart, tt.cartErr)
+
+			parcel, err := NewPackagingService(db, cart, new(MockPricingService)).PackCart("ssid123")
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, parcel)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+var (
+	ErrNoQueuedPlates = errors.New("no plates waiting to print")
+	ErrPlateNotHeld   = errors.New("plate is not held by this worker")
+)
+
+// claimablePlates matches plates waiting for a worker, including ones whose worker went quiet
+const claimablePlates = `(status = 'created' OR (status IN ('claimed', 'printing') AND lease_expires_at < NOW()))`
+
+// plateCandidate is a claimable plate that fits a printer's bed, its colors are checked
+// against the printer's spools before it's claimed
+type plateCandidate struct {
+	plateID int64
+	colors  []string
+}
+
+// ClaimPlate leases the oldest plate a printer can take to one of its workers, the same way
+// ClaimJob leases jobs. The jobs on a plate are only printed with it
+func (ps *PlatingServiceImpl) ClaimPlate(workerID string, printerID int64) (structs.Plate, error) {
+	printer, err := ps.Printers.GetPrinter(printerID)
+	if err != nil {
+		return structs.Plate{}, err
+	}
+	if printer.Status == "offline" || printer.Status == "maintenance" {
+		return structs.Plate{}, ErrPrinterUnavailable
+	}
+
+	candidates, err := ps.candidatePlates(printer)
+	if err != nil {
+		return structs.Plate{}, err
+	}
+
+	for _, candidate := range candidates {
+		if !hasColors(printer, candidate.colors) {
+			continue
+		}
+
+		claimed, err := ps.claimPlate(candidate.plateID, workerID, printerID)
+		if err != nil {
+			return structs.Plate{}, err
+		}
+		if !claimed {
+			// another worker got there first
+			continue
+		}
+
+		return ps.PlateFiles(candidate.plateID)
+	}
+
+	return structs.Plate{}, ErrNoQueuedPlates
+}
+
+// candidatePlates lists the oldest claimable plates laid out for a bed no bigger than the
+// printer's, turned a quarter turn if need be
+func (ps *PlatingServiceImpl) candidatePlates(printer structs.Printer) ([]plateCandidate, error) {
+	query := `
+		SELECT plate_id, filament_colors FROM plates
+		WHERE ` + claimablePlates + `
+			AND LEAST(bed_x_mm, bed_y_mm) <= ? AND GREATEST(bed_x_mm, bed_y_mm) <= ?
+		ORDER BY created_at, plate_id
+		LIMIT ?
+	`
+	rows, err := ps.DB.Query(query, math.Min(printer.BedX, printer.BedY), math.Max(printer.BedX, printer.BedY), CLAIM_CANDIDATES)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find queued plates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []plateCandidate
+	for rows.Next() {
+		var candidate plateCandidate
+		var colors sql.NullString
+		if err := rows.Scan(&candidate.plateID, &colors); err != nil {
+			return nil, fmt.Errorf("failed to scan queued plate: %w", err)
+		}
+		candidate.colors = splitColors(colors.String)
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, nil
+}
+
+// claimPlate leases a plate to a worker if it's still claimable, false means it was taken or
+// locked by another worker in the meantime
+func (ps *PlatingServiceImpl) claimPlate(plateID int64, workerID string, printerID int64) (bool, error) {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT plate_id FROM plates WHERE plate_id = ? AND ` + claimablePlates + ` FOR UPDATE SKIP LOCKED`
+	err = tx.QueryRow(query, plateID).Scan(&plateID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock plate: %w", err)
+	}
+
+	claimQuery := `
+		UPDATE plates
+		SET status = 'claimed', worker_id = ?, printer_id = ?, lease_expires_at = NOW() + INTERVAL ? SECOND,
+			attempts = attempts + 1
+		WHERE plate_id = ?
+	`
+	if _, err := tx.Exec(claimQuery, workerID, printerID, leaseSeconds(), plateID); err != nil {
+		return false, fmt.Errorf("failed to claim plate: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// PlateHeartbeat extends the lease of a plate the worker still holds
+func (ps *PlatingServiceImpl) PlateHeartbeat(plateID int64, workerID string) (structs.Plate, error) {
+	query := `UPDATE plates SET lease_expires_at = NOW() + INTERVAL ? SECOND WHERE plate_id = ?`
+	if err := ps.updateHeldPlate(plateID, workerID, query, leaseSeconds(), plateID); err != nil {
+		return structs.Plate{}, err
+	}
+
+	return ps.GetPlate(plateID)
+}
+
+// UpdatePlate records a worker's progress on a plate it holds. A failed plate goes back to
+// be claimed again when Requeue is set, otherwise its jobs come off it like FailPlate
+func (ps *PlatingServiceImpl) UpdatePlate(plateID int64, update structs.PrintJobUpdate) (structs.Plate, error) {
+	switch update.Status {
+	case "printing":
+		query := `UPDATE plates SET status = 'printing', lease_expires_at = NOW() + INTERVAL ? SECOND WHERE plate_id = ?`
+		if err := ps.updateHeldPlate(plateID, update.WorkerID, query, leaseSeconds(), plateID); err != nil {
+			return structs.Plate{}, err
+		}
+	case "failed":
+		if !update.Requeue {
+			return ps.failPlate(plateID, update.Reason, update.WorkerID)
+		}
+		query := `
+			UPDATE plates
+			SET status = 'created', worker_id = NULL, printer_id = NULL, lease_expires_at = NULL, failure_reason = ?
+			WHERE plate_id = ?
+		`
+		if err := ps.updateHeldPlate(plateID, update.WorkerID, query, nullString(update.Reason), plateID); err != nil {
+			return structs.Plate{}, err
+		}
+	case "completed":
+		return ps.completePlate(plateID, update.WorkerID)
+	default:
+		return structs.Plate{}, fmt.Errorf("unknown plate status: %s", update.Status)
+	}
+
+	return ps.GetPlate(plateID)
+}
+
+// PlateFiles returns a plate with a fresh download link for its STL
+func (ps *PlatingServiceImpl) PlateFiles(plateID int64) (structs.Plate, error) {
+	plate, err := ps.GetPlate(plateID)
+	if err != nil {
+		return structs.Plate{}, err
+	}
+
+	// savePlate uploads plates next to each other
+	plate.DownloadURL, err = ps.presignFunc("plates/" + plate.FileName)
+	if err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to sign %s: %w", plate.FileName, err)
+	}
+
+	return plate, nil
+}
+
+// updateHeldPlate runs query once the plate is confirmed to still be leased to the worker
+func (ps *PlatingServiceImpl) updateHeldPlate(plateID int64, workerID string, query string, args ...any) error {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	var holder sql.NullString
+	err = tx.QueryRow(`SELECT status, worker_id FROM plates WHERE plate_id = ? FOR UPDATE`, plateID).Scan(&status, &holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPlateNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up plate: %w", err)
+	}
+	if !holdsPlate(status, holder.String, workerID) {
+		return ErrPlateNotHeld
+	}
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to update plate: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// holdsPlate is whether the worker holds a plate, a worker whose lease ran out keeps the
+// plate until someone else claims it
+func holdsPlate(status string, holder string, workerID string) bool {
+	return holder == workerID && (status == "claimed" || status == "printing")
+}
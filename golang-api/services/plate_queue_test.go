@@ -0,0 +1,304 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPlateQueue(db *sql.DB) *PlatingServiceImpl {
+	printers := new(MockPrinterService)
+	printers.On("GetPrinter", int64(1)).Return(testPrinter, nil).Maybe()
+	printers.On("GetPrinter", int64(2)).Return(structs.Printer{PrinterID: 2, Status: "maintenance"}, nil).Maybe()
+	printers.On("GetPrinter", int64(3)).Return(structs.Printer{}, ErrPrinterNotFound).Maybe()
+
+	return &PlatingServiceImpl{
+		DB:       db,
+		Orders:   &OrderServiceImpl{DB: db},
+		Printers: printers,
+		presignFunc: func(s3Key string) (string, error) {
+			return "https://bucket.example.com/" + s3Key + "?signed", nil
+		},
+	}
+}
+
+// expectHeldPlate expects plate 12 to be read back, held by worker with one job on it
+func expectHeldPlate(mock sqlmock.Sqlmock, status string, worker any, lease any) {
+	created := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM plates WHERE plate_id = \?`).
+		WithArgs(int64(12)).
+		WillReturnRows(sqlmock.NewRows(plateColumns).AddRow(status, worker, 1, lease, 1, 250, 210, "white", created, nil, nil))
+	mock.ExpectQuery(`FROM plate_instances i`).
+		WithArgs(int64(12)).
+		WillReturnRows(sqlmock.NewRows(plateInstanceColumns).AddRow(1, 4, 1, "marker.stl", 1, 0, 0, false))
+}
+
+func TestClaimPlate(t *testing.T) {
+	lease := time.Date(2024, 5, 2, 12, 5, 0, 0, time.UTC)
+	candidateQuery := `SELECT plate_id, filament_colors FROM plates WHERE \(status = 'created' OR \(status IN \('claimed', 'printing'\) AND lease_expires_at < NOW\(\)\)\)`
+	lockQuery := `SELECT plate_id FROM plates WHERE plate_id = \? AND .* FOR UPDATE SKIP LOCKED`
+	candidateColumns := []string{"plate_id", "filament_colors"}
+
+	tests := []struct {
+		desc       string
+		printerID  int64
+		mockDB     func(sqlmock.Sqlmock)
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc:      "oldest plate the printer has colors for is leased with its link",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).
+					WithArgs(220.0, 250.0, CLAIM_CANDIDATES).
+					WillReturnRows(sqlmock.NewRows(candidateColumns).AddRow(11, "red").AddRow(12, "white"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs(int64(12)).
+					WillReturnRows(sqlmock.NewRows([]string{"plate_id"}).AddRow(12))
+				mock.ExpectExec(`UPDATE plates SET status = 'claimed', worker_id = \?, printer_id = \?, lease_expires_at = NOW\(\) \+ INTERVAL \? SECOND`).
+					WithArgs("printer-1", int64(1), 300, int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectHeldPlate(mock, "claimed", "printer-1", lease)
+			},
+		},
+		{
+			desc:      "plate taken by another worker is passed over",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).
+					WillReturnRows(sqlmock.NewRows(candidateColumns).AddRow(10, "white").AddRow(12, nil))
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(int64(10)).WillReturnRows(sqlmock.NewRows([]string{"plate_id"}))
+				mock.ExpectRollback()
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(int64(12)).WillReturnRows(sqlmock.NewRows([]string{"plate_id"}).AddRow(12))
+				mock.ExpectExec(`UPDATE plates SET status = 'claimed'`).
+					WithArgs("printer-1", int64(1), 300, int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectHeldPlate(mock, "claimed", "printer-1", lease)
+			},
+		},
+		{
+			desc:      "no plate matches the printer's colors",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).WillReturnRows(sqlmock.NewRows(candidateColumns).AddRow(12, "red"))
+			},
+			wantErr: ErrNoQueuedPlates,
+		},
+		{
+			desc:      "printer is in maintenance",
+			printerID: 2,
+			mockDB:    func(mock sqlmock.Sqlmock) {},
+			wantErr:   ErrPrinterUnavailable,
+		},
+		{
+			desc:      "claim fails",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).WillReturnRows(sqlmock.NewRows(candidateColumns).AddRow(12, "white"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WillReturnRows(sqlmock.NewRows([]string{"plate_id"}).AddRow(12))
+				mock.ExpectExec(`UPDATE plates SET status = 'claimed'`).WillReturnError(errors.New("db down"))
+				mock.ExpectRollback()
+			},
+			wantErrMsg: "failed to claim plate: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			plate, err := newTestPlateQueue(db).ClaimPlate("printer-1", tt.printerID)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.EqualError(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, int64(12), plate.PlateID)
+				assert.Equal(t, "claimed", plate.Status)
+				assert.Equal(t, "printer-1", plate.WorkerID)
+				assert.Equal(t, &lease, plate.LeaseExpiresAt)
+				assert.Equal(t, "https://bucket.example.com/plates/plate-12.stl?signed", plate.DownloadURL)
+				assert.Equal(t, []int64{1}, plate.JobIDs)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestUpdatePlate(t *testing.T) {
+	lease := time.Date(2024, 5, 2, 12, 5, 0, 0, time.UTC)
+	holdQuery := `SELECT status, worker_id FROM plates WHERE plate_id = \? FOR UPDATE`
+	holdColumns := []string{"status", "worker_id"}
+
+	tests := []struct {
+		desc       string
+		update     structs.PrintJobUpdate
+		mockDB     func(sqlmock.Sqlmock)
+		wantStatus string
+		wantErr    error
+	}{
+		{
+			desc:   "worker starts printing",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "printing"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(holdQuery).WithArgs(int64(12)).WillReturnRows(sqlmock.NewRows(holdColumns).AddRow("claimed", "printer-1"))
+				mock.ExpectExec(`UPDATE plates SET status = 'printing'`).
+					WithArgs(300, int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectHeldPlate(mock, "printing", "printer-1", lease)
+			},
+			wantStatus: "printing",
+		},
+		{
+			desc:   "requeued plate waits for the next worker",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "failed", Reason: "filament ran out", Requeue: true},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(holdQuery).WithArgs(int64(12)).WillReturnRows(sqlmock.NewRows(holdColumns).AddRow("printing", "printer-1"))
+				mock.ExpectExec(`UPDATE plates SET status = 'created', worker_id = NULL`).
+					WithArgs("filament ran out", int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectHeldPlate(mock, "created", nil, nil)
+			},
+			wantStatus: "created",
+		},
+		{
+			desc:   "failed plate gives its jobs back",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "failed", Reason: "first layer didn't stick"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(holdQuery).WithArgs(int64(12)).WillReturnRows(sqlmock.NewRows(holdColumns).AddRow("printing", "printer-1"))
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = NULL`).WithArgs(int64(12)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE plates SET status = 'failed'`).
+					WithArgs("first layer didn't stick", int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectHeldPlate(mock, "failed", "printer-1", nil)
+			},
+			wantStatus: "failed",
+		},
+		{
+			desc:   "finished plate completes its jobs",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "completed"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectHeldPlate(mock, "printing", "printer-1", lease)
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'completed'`).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases l`).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT l.label_purchase_id`).WithArgs(int64(1)).WillReturnError(sql.ErrNoRows)
+				mock.ExpectExec(`UPDATE plates SET status = 'completed'`).WithArgs(int64(12)).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectHeldPlate(mock, "completed", "printer-1", nil)
+			},
+			wantStatus: "completed",
+		},
+		{
+			desc:   "plate held by another worker",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "printing"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(holdQuery).WithArgs(int64(12)).WillReturnRows(sqlmock.NewRows(holdColumns).AddRow("claimed", "printer-2"))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrPlateNotHeld,
+		},
+		{
+			desc:   "another worker's plate can't be completed",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "completed"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectHeldPlate(mock, "printing", "printer-2", lease)
+			},
+			wantErr: ErrPlateNotHeld,
+		},
+		{
+			desc:   "another worker's plate can't be failed",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "failed"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(holdQuery).WithArgs(int64(12)).WillReturnRows(sqlmock.NewRows(holdColumns).AddRow("created", nil))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrPlateNotHeld,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			plate, err := newTestPlateQueue(db).UpdatePlate(12, tt.update)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantStatus, plate.Status)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPlateHeartbeat(t *testing.T) {
+	lease := time.Date(2024, 5, 2, 12, 5, 0, 0, time.UTC)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT status, worker_id FROM plates WHERE plate_id = \? FOR UPDATE`).
+		WithArgs(int64(12)).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}).AddRow("printing", "printer-1"))
+	mock.ExpectExec(`UPDATE plates SET lease_expires_at = NOW\(\) \+ INTERVAL \? SECOND WHERE plate_id = \?`).
+		WithArgs(300, int64(12)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectHeldPlate(mock, "printing", "printer-1", lease)
+
+	plate, err := newTestPlateQueue(db).PlateHeartbeat(12, "printer-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &lease, plate.LeaseExpiresAt)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,582 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+const (
+	// gap left between markers so the nozzle doesn't drag one into the next
+	PLATE_SPACING_MM = 5.0
+	// oldest queued jobs looked at when filling a plate
+	PLATE_CANDIDATES = 100
+	PLATE_OUTPUT_DIR = "./output/plates/"
+	// longest failure reason the plates table holds
+	PLATE_FAILURE_REASON_MAX = 512
+)
+
+var (
+	ErrNothingToPlate = errors.New("no queued print jobs fit on a plate")
+	ErrPlateNotFound  = errors.New("plate not found")
+	ErrPlateClosed    = errors.New("plate is already completed or failed")
+)
+
+type PlatingServiceImpl struct {
+	DB            *sql.DB
+	Orders        OrderService
+	Printers      PrinterService
+	readStlFunc   func(ssid, fileName string) ([]byte, error)
+	savePlateFunc func(fileName string, data []byte) error
+	presignFunc   func(s3Key string) (string, error)
+}
+
+func NewPlatingService(db *sql.DB, orders OrderService, printers PrinterService) PlatingService {
+	return &PlatingServiceImpl{
+		DB: db, Orders: orders, Printers: printers, readStlFunc: readOrderStl, savePlateFunc: savePlate, presignFunc: presignS3,
+	}
+}
+
+// plateJob is a queued job and the files it's waiting on
+type plateJob struct {
+	jobID   int64
+	orderID int64
+	colors  string
+	files   []plateFile
+}
+
+type plateFile struct {
+	stlID    int64
+	ssid     string
+	fileName string
+	quantity int
+}
+
+// plateMesh is an STL's faces and the box around them
+type plateMesh struct {
+	faces [][3][3]float64
+	min   [3]float64
+	max   [3]float64
+}
+
+// footprint is the space a marker takes on the bed
+type footprint struct {
+	width float64
+	depth float64
+}
+
+// placement is where packPlate put a footprint, x and y are its corner nearest the origin
+type placement struct {
+	x       float64
+	y       float64
+	rotated bool
+}
+
+// CreatePlate fills a bed with the markers of the oldest queued jobs, zero sizes use the
+// configured bed. A job only goes on a plate when every one of its markers fits and all
+// jobs on a plate print in the same filament, the plate then prints in place of each job
+func (ps *PlatingServiceImpl) CreatePlate(bedX, bedY float64) (structs.Plate, error) {
+	if bedX == 0 || bedY == 0 {
+		bedX, bedY = config.PLATE_BED_X_MM, config.PLATE_BED_Y_MM
+	}
+
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	jobs, err := queuedPlateJobs(tx)
+	if err != nil {
+		return structs.Plate{}, err
+	}
+
+	plate, meshes := ps.planPlate(bedX, bedY, jobs)
+	if len(plate.JobIDs) == 0 {
+		return structs.Plate{}, ErrNothingToPlate
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO plates (bed_x_mm, bed_y_mm, filament_colors) VALUES (?, ?, ?)`,
+		bedX, bedY, nullString(joinColors(plate.FilamentColors)),
+	)
+	if err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to insert plate: %w", err)
+	}
+
+	plate.PlateID, err = result.LastInsertId()
+	if err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to retrieve plate ID: %w", err)
+	}
+	plate.FileName = plateFileName(plate.PlateID)
+	plate.CreatedAt = time.Now().UTC()
+
+	instanceQuery := `
+		INSERT INTO plate_instances (plate_id, stl_id, job_id, order_id, copy_number, x_mm, y_mm, rotated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, instance := range plate.Instances {
+		_, err := tx.Exec(
+			instanceQuery,
+			plate.PlateID, instance.StlID, instance.JobID, instance.OrderID, instance.Copy, instance.X, instance.Y, instance.Rotated,
+		)
+		if err != nil {
+			return structs.Plate{}, fmt.Errorf("failed to insert plate instance: %w", err)
+		}
+	}
+
+	for _, jobID := range plate.JobIDs {
+		if _, err := tx.Exec(`UPDATE print_jobs SET plate_id = ? WHERE job_id = ?`, plate.PlateID, jobID); err != nil {
+			return structs.Plate{}, fmt.Errorf("failed to link print job %d: %w", jobID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// the files go out once the plate is committed so a rollback never leaves one behind,
+	// a plate whose files can't be written is failed so its jobs go back to the queue
+	if err := ps.writePlate(plate, meshes); err != nil {
+		if _, failErr := ps.FailPlate(plate.PlateID, err.Error()); failErr != nil {
+			return structs.Plate{}, errors.Join(err, fmt.Errorf("plate %d: %w", plate.PlateID, failErr))
+		}
+		return structs.Plate{}, err
+	}
+
+	return plate, nil
+}
+
+// queuedPlateJobs locks the oldest queued jobs that aren't on a plate yet, jobs a worker is
+// claiming are skipped rather than waited on
+func queuedPlateJobs(tx *sql.Tx) ([]plateJob, error) {
+	query := `
+		SELECT j.job_id, j.order_id, j.filament_colors, s.stl_id, s.browser_ssid, s.file_name, s.quantity
+		FROM (
+			SELECT job_id FROM print_jobs
+			WHERE status = 'queued' AND plate_id IS NULL
+			ORDER BY created_at, job_id
+			LIMIT ?
+		) queued
+		JOIN print_jobs j ON j.job_id = queued.job_id
+		JOIN stl_files s ON s.job_id = j.job_id
+		ORDER BY j.created_at, j.job_id, s.stl_id
+		FOR UPDATE OF j SKIP LOCKED
+	`
+	rows, err := tx.Query(query, PLATE_CANDIDATES)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queued jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []plateJob
+	for rows.Next() {
+		var job plateJob
+		var file plateFile
+		var colors sql.NullString
+		if err := rows.Scan(&job.jobID, &job.orderID, &colors, &file.stlID, &file.ssid, &file.fileName, &file.quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan queued job: %w", err)
+		}
+
+		if len(jobs) == 0 || jobs[len(jobs)-1].jobID != job.jobID {
+			job.colors = colors.String
+			jobs = append(jobs, job)
+		}
+		last := &jobs[len(jobs)-1]
+		last.files = append(last.files, file)
+	}
+
+	return jobs, nil
+}
+
+// planPlate adds jobs to the plate oldest first, a job whose markers don't all fit around
+// the ones already placed is left for another plate
+func (ps *PlatingServiceImpl) planPlate(bedX, bedY float64, jobs []plateJob) (structs.Plate, map[int64]plateMesh) {
+	plate := structs.Plate{Status: "created", BedX: bedX, BedY: bedY, FilamentColors: []string{}}
+	meshes := map[int64]plateMesh{}
+	var colors string
+	var footprints []footprint
+
+	for _, job := range jobs {
+		if len(plate.JobIDs) > 0 && job.colors != colors {
+			continue
+		}
+
+		instances, jobFootprints, err := ps.jobInstances(job, meshes)
+		if err != nil {
+			log.Printf("Unable to plate job %d: %v\n", job.jobID, err)
+			continue
+		}
+
+		placements, ok := packPlate(bedX, bedY, append(slices.Clone(footprints), jobFootprints...))
+		if !ok {
+			continue
+		}
+
+		footprints = append(footprints, jobFootprints...)
+		plate.Instances = append(plate.Instances, instances...)
+		for i := range plate.Instances {
+			plate.Instances[i].X = math.Round(placements[i].x*10) / 10
+			plate.Instances[i].Y = math.Round(placements[i].y*10) / 10
+			plate.Instances[i].Rotated = placements[i].rotated
+		}
+		plate.JobIDs = append(plate.JobIDs, job.jobID)
+		colors = job.colors
+	}
+	plate.FilamentColors = splitColors(colors)
+
+	return plate, meshes
+}
+
+// jobInstances lists a copy of each marker for every one ordered, meshes are cached by STL
+func (ps *PlatingServiceImpl) jobInstances(job plateJob, meshes map[int64]plateMesh) ([]structs.PlateInstance, []footprint, error) {
+	var instances []structs.PlateInstance
+	var footprints []footprint
+	for _, file := range job.files {
+		mesh, ok := meshes[file.stlID]
+		if !ok {
+			data, err := ps.readStlFunc(file.ssid, file.fileName)
+			if err != nil {
+				return nil, nil, err
+			}
+			mesh, err = loadPlateMesh(data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", file.fileName, err)
+			}
+			meshes[file.stlID] = mesh
+		}
+
+		for copyNumber := 1; copyNumber <= file.quantity; copyNumber++ {
+			instances = append(instances, structs.PlateInstance{
+				JobID: job.jobID, OrderID: job.orderID, StlID: file.stlID, FileName: file.fileName, Copy: copyNumber,
+			})
+			footprints = append(footprints, footprint{width: mesh.max[0] - mesh.min[0], depth: mesh.max[1] - mesh.min[1]})
+		}
+	}
+
+	return instances, footprints, nil
+}
+
+// packPlate lays footprints out in shelves across the bed, tallest first so each shelf
+// wastes as little depth as possible. Footprints are turned to lie long side along X when
+// that fits, placements come back in the order of footprints
+func packPlate(bedX, bedY float64, footprints []footprint) ([]placement, bool) {
+	type shelf struct {
+		y     float64
+		depth float64
+		x     float64
+	}
+
+	placements := make([]placement, len(footprints))
+	sizes := make([]footprint, len(footprints))
+	for i, fp := range footprints {
+		long, short := math.Max(fp.width, fp.depth), math.Min(fp.width, fp.depth)
+		switch {
+		case long <= bedX && short <= bedY:
+			sizes[i] = footprint{width: long, depth: short}
+		case short <= bedX && long <= bedY:
+			sizes[i] = footprint{width: short, depth: long}
+		default:
+			return nil, false
+		}
+		placements[i].rotated = sizes[i].width != fp.width
+	}
+
+	order := make([]int, len(footprints))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return sizes[order[a]].depth > sizes[order[b]].depth
+	})
+
+	var shelves []shelf
+	for _, i := range order {
+		size := sizes[i]
+		placed := false
+		for s := range shelves {
+			if size.depth <= shelves[s].depth && shelves[s].x+size.width <= bedX {
+				placements[i].x, placements[i].y = shelves[s].x, shelves[s].y
+				shelves[s].x += size.width + PLATE_SPACING_MM
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+
+		y := 0.0
+		if len(shelves) > 0 {
+			last := shelves[len(shelves)-1]
+			y = last.y + last.depth + PLATE_SPACING_MM
+		}
+		if y+size.depth > bedY {
+			return nil, false
+		}
+		placements[i].x, placements[i].y = 0, y
+		shelves = append(shelves, shelf{y: y, depth: size.depth, x: size.width + PLATE_SPACING_MM})
+	}
+
+	return placements, true
+}
+
+// writePlate saves the combined STL and a manifest of which order each marker belongs to
+func (ps *PlatingServiceImpl) writePlate(plate structs.Plate, meshes map[int64]plateMesh) error {
+	var faces [][3][3]float64
+	for _, instance := range plate.Instances {
+		faces = append(faces, placeMesh(meshes[instance.StlID], instance)...)
+	}
+
+	if err := ps.savePlateFunc(plate.FileName, writeBinaryStl(faces)); err != nil {
+		return fmt.Errorf("failed to save plate: %w", err)
+	}
+
+	manifest, err := json.MarshalIndent(plate, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plate manifest: %w", err)
+	}
+	if err := ps.savePlateFunc(plateManifestName(plate.PlateID), manifest); err != nil {
+		return fmt.Errorf("failed to save plate manifest: %w", err)
+	}
+
+	return nil
+}
+
+// placeMesh moves a copy of a mesh to its spot on the plate, resting on the bed
+func placeMesh(mesh plateMesh, instance structs.PlateInstance) [][3][3]float64 {
+	faces := make([][3][3]float64, len(mesh.faces))
+	for i, face := range mesh.faces {
+		for v, vertex := range face {
+			x, y := vertex[0]-mesh.min[0], vertex[1]-mesh.min[1]
+			if instance.Rotated {
+				// a quarter turn counterclockwise, shifted back onto the footprint
+				x, y = mesh.max[1]-vertex[1], vertex[0]-mesh.min[0]
+			}
+			faces[i][v] = [3]float64{x + instance.X, y + instance.Y, vertex[2] - mesh.min[2]}
+		}
+	}
+	return faces
+}
+
+func loadPlateMesh(data []byte) (plateMesh, error) {
+	var mesh plateMesh
+	var bounds meshAccumulator
+	err := readStl(data, func(a, b, c [3]float64) {
+		bounds.add(a, b, c)
+		mesh.faces = append(mesh.faces, [3][3]float64{a, b, c})
+	})
+	if err != nil {
+		return plateMesh{}, err
+	}
+	if bounds.triangles == 0 {
+		return plateMesh{}, fmt.Errorf("%w: no triangles", ErrInvalidStl)
+	}
+
+	mesh.min, mesh.max = bounds.min, bounds.max
+	return mesh, nil
+}
+
+// GetPlate returns a plate and the markers on it
+func (ps *PlatingServiceImpl) GetPlate(plateID int64) (structs.Plate, error) {
+	plate := structs.Plate{PlateID: plateID, FileName: plateFileName(plateID)}
+	var colors, failureReason, workerID sql.NullString
+	var printerID sql.NullInt64
+	var leaseExpiresAt, completedAt sql.NullTime
+
+	query := `
+		SELECT status, worker_id, printer_id, lease_expires_at, attempts, bed_x_mm, bed_y_mm, filament_colors,
+			created_at, completed_at, failure_reason
+		FROM plates WHERE plate_id = ?
+	`
+	err := ps.DB.QueryRow(query, plateID).Scan(
+		&plate.Status, &workerID, &printerID, &leaseExpiresAt, &plate.Attempts, &plate.BedX, &plate.BedY, &colors,
+		&plate.CreatedAt, &completedAt, &failureReason,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.Plate{}, ErrPlateNotFound
+	}
+	if err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to look up plate: %w", err)
+	}
+	plate.FilamentColors = splitColors(colors.String)
+	plate.FailureReason = failureReason.String
+	plate.WorkerID = workerID.String
+	plate.PrinterID = printerID.Int64
+	if leaseExpiresAt.Valid {
+		plate.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+	if completedAt.Valid {
+		plate.CompletedAt = &completedAt.Time
+	}
+
+	instanceQuery := `
+		SELECT i.job_id, i.order_id, i.stl_id, s.file_name, i.copy_number, i.x_mm, i.y_mm, i.rotated
+		FROM plate_instances i
+		JOIN stl_files s ON s.stl_id = i.stl_id
+		WHERE i.plate_id = ?
+		ORDER BY i.instance_id
+	`
+	rows, err := ps.DB.Query(instanceQuery, plateID)
+	if err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to list plate instances: %w", err)
+	}
+	defer rows.Close()
+
+	plate.JobIDs = []int64{}
+	plate.Instances = []structs.PlateInstance{}
+	for rows.Next() {
+		var instance structs.PlateInstance
+		err := rows.Scan(
+			&instance.JobID, &instance.OrderID, &instance.StlID, &instance.FileName, &instance.Copy,
+			&instance.X, &instance.Y, &instance.Rotated,
+		)
+		if err != nil {
+			return structs.Plate{}, fmt.Errorf("failed to scan plate instance: %w", err)
+		}
+		plate.Instances = append(plate.Instances, instance)
+		if !slices.Contains(plate.JobIDs, instance.JobID) {
+			plate.JobIDs = append(plate.JobIDs, instance.JobID)
+		}
+	}
+
+	return plate, nil
+}
+
+// CompletePlate completes every job printed on a plate, so their deferred labels are bought.
+// Jobs that fail to complete are reported and the plate stays open to be completed again
+func (ps *PlatingServiceImpl) CompletePlate(plateID int64) (structs.Plate, error) {
+	return ps.completePlate(plateID, "")
+}
+
+// completePlate completes a plate for the worker holding it, or for an operator when
+// workerID is empty
+func (ps *PlatingServiceImpl) completePlate(plateID int64, workerID string) (structs.Plate, error) {
+	plate, err := ps.GetPlate(plateID)
+	if err != nil {
+		return structs.Plate{}, err
+	}
+	if plate.Status == "completed" {
+		return plate, nil
+	}
+	if plate.Status == "failed" {
+		return structs.Plate{}, ErrPlateClosed
+	}
+	if workerID != "" && !holdsPlate(plate.Status, plate.WorkerID, workerID) {
+		return structs.Plate{}, ErrPlateNotHeld
+	}
+
+	var errs []error
+	for _, jobID := range plate.JobIDs {
+		if _, err := ps.Orders.CompletePrintJob(jobID, ""); err != nil {
+			errs = append(errs, fmt.Errorf("print job %d: %w", jobID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return structs.Plate{}, errors.Join(errs...)
+	}
+
+	query := `UPDATE plates SET status = 'completed', completed_at = NOW(), lease_expires_at = NULL WHERE plate_id = ?`
+	if _, err := ps.DB.Exec(query, plateID); err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to complete plate: %w", err)
+	}
+
+	return ps.GetPlate(plateID)
+}
+
+// FailPlate gives up on a plate that didn't print, its unfinished jobs are taken off it
+// and go back to the queue to be printed alone or plated again
+func (ps *PlatingServiceImpl) FailPlate(plateID int64, reason string) (structs.Plate, error) {
+	return ps.failPlate(plateID, reason, "")
+}
+
+// failPlate fails a plate for the worker holding it, or for an operator when workerID is empty
+func (ps *PlatingServiceImpl) failPlate(plateID int64, reason string, workerID string) (structs.Plate, error) {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	var holder sql.NullString
+	err = tx.QueryRow(`SELECT status, worker_id FROM plates WHERE plate_id = ? FOR UPDATE`, plateID).Scan(&status, &holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.Plate{}, ErrPlateNotFound
+	}
+	if err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to look up plate: %w", err)
+	}
+
+	switch status {
+	case "failed":
+		return ps.GetPlate(plateID)
+	case "completed":
+		return structs.Plate{}, ErrPlateClosed
+	}
+	if workerID != "" && !holdsPlate(status, holder.String, workerID) {
+		return structs.Plate{}, ErrPlateNotHeld
+	}
+
+	if _, err := tx.Exec(`UPDATE print_jobs SET plate_id = NULL WHERE plate_id = ? AND status = 'queued'`, plateID); err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to requeue plate jobs: %w", err)
+	}
+
+	if len(reason) > PLATE_FAILURE_REASON_MAX {
+		reason = reason[:PLATE_FAILURE_REASON_MAX]
+	}
+	query := `
+		UPDATE plates SET status = 'failed', completed_at = NOW(), lease_expires_at = NULL, failure_reason = ?
+		WHERE plate_id = ?
+	`
+	if _, err := tx.Exec(query, nullString(reason), plateID); err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to fail plate: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return structs.Plate{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ps.GetPlate(plateID)
+}
+
+func plateFileName(plateID int64) string {
+	return fmt.Sprintf("plate-%d.stl", plateID)
+}
+
+func plateManifestName(plateID int64) string {
+	return fmt.Sprintf("plate-%d.json", plateID)
+}
+
+// readOrderStl reads one of an order's files from where it was generated
+func readOrderStl(ssid, fileName string) ([]byte, error) {
+	dir, err := getOutputDir(ssid, fileName)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(dir + fileName)
+}
+
+// savePlate writes a plate file locally and uploads it for the printers
+func savePlate(fileName string, data []byte) error {
+	if err := os.MkdirAll(PLATE_OUTPUT_DIR, 0755); err != nil {
+		return fmt.Errorf("failed to create plate directory: %w", err)
+	}
+
+	localPath := PLATE_OUTPUT_DIR + fileName
+	if err := os.WriteFile(localPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fileName, err)
+	}
+
+	return uploadToS3(localPath, "plates/"+fileName)
+}
@@ -0,0 +1,529 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+var plateJobColumns = []string{"job_id", "order_id", "filament_colors", "stl_id", "browser_ssid", "file_name", "quantity"}
+
+var plateColumns = []string{
+	"status", "worker_id", "printer_id", "lease_expires_at", "attempts", "bed_x_mm", "bed_y_mm", "filament_colors",
+	"created_at", "completed_at", "failure_reason",
+}
+
+var plateInstanceColumns = []string{"job_id", "order_id", "stl_id", "file_name", "copy_number", "x_mm", "y_mm", "rotated"}
+
+func TestPackPlate(t *testing.T) {
+	tests := []struct {
+		desc           string
+		bedX           float64
+		bedY           float64
+		footprints     []footprint
+		wantPlacements []placement
+		wantFit        bool
+	}{
+		{
+			desc:           "markers share a shelf",
+			bedX:           100,
+			bedY:           100,
+			footprints:     []footprint{{width: 40, depth: 30}, {width: 40, depth: 30}},
+			wantPlacements: []placement{{x: 0, y: 0}, {x: 45, y: 0}},
+			wantFit:        true,
+		},
+		{
+			desc:           "long side is turned along X",
+			bedX:           100,
+			bedY:           100,
+			footprints:     []footprint{{width: 30, depth: 60}},
+			wantPlacements: []placement{{x: 0, y: 0, rotated: true}},
+			wantFit:        true,
+		},
+		{
+			desc:           "turned back to fit a narrow bed",
+			bedX:           40,
+			bedY:           100,
+			footprints:     []footprint{{width: 30, depth: 60}},
+			wantPlacements: []placement{{x: 0, y: 0}},
+			wantFit:        true,
+		},
+		{
+			desc:           "deepest markers start the shelves",
+			bedX:           100,
+			bedY:           100,
+			footprints:     []footprint{{width: 60, depth: 20}, {width: 60, depth: 40}, {width: 30, depth: 20}},
+			wantPlacements: []placement{{x: 0, y: 45}, {x: 0, y: 0}, {x: 65, y: 0}},
+			wantFit:        true,
+		},
+		{
+			desc:       "shelves run out of bed",
+			bedX:       30,
+			bedY:       30,
+			footprints: []footprint{{width: 10, depth: 10}, {width: 10, depth: 10}, {width: 10, depth: 10}, {width: 10, depth: 10}, {width: 10, depth: 10}},
+			wantFit:    false,
+		},
+		{
+			desc:       "marker bigger than the bed",
+			bedX:       30,
+			bedY:       30,
+			footprints: []footprint{{width: 40, depth: 10}},
+			wantFit:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			placements, fit := packPlate(tt.bedX, tt.bedY, tt.footprints)
+
+			assert.Equal(t, tt.wantFit, fit)
+			if tt.wantFit {
+				assert.Equal(t, tt.wantPlacements, placements)
+			}
+		})
+	}
+}
+
+func TestPlaceMesh(t *testing.T) {
+	mesh := plateMesh{
+		faces: [][3][3]float64{{{0, 0, 2}, {20, 0, 2}, {20, 10, 4}}},
+		min:   [3]float64{0, 0, 2},
+		max:   [3]float64{20, 10, 4},
+	}
+
+	placed := placeMesh(mesh, structs.PlateInstance{X: 5, Y: 5})
+	assert.Equal(t, [3][3]float64{{5, 5, 0}, {25, 5, 0}, {25, 15, 2}}, placed[0])
+
+	// turned a quarter turn the 20mm side runs along Y
+	rotated := placeMesh(mesh, structs.PlateInstance{X: 5, Y: 5, Rotated: true})
+	assert.Equal(t, [3][3]float64{{15, 5, 0}, {15, 25, 0}, {5, 25, 2}}, rotated[0])
+}
+
+func TestCreatePlate(t *testing.T) {
+	cube := binaryStl(cubeMesh())
+
+	tests := []struct {
+		desc          string
+		mockDB        func(sqlmock.Sqlmock)
+		saveErr       error
+		wantJobs      []int64
+		wantInstances []structs.PlateInstance
+		wantErr       error
+		wantErrMsg    string
+	}{
+		{
+			desc: "oldest jobs in one filament fill the plate",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT j.job_id, j.order_id, j.filament_colors, s.stl_id, s.browser_ssid, s.file_name, s.quantity .* FOR UPDATE OF j SKIP LOCKED`).
+					WithArgs(PLATE_CANDIDATES).
+					WillReturnRows(sqlmock.NewRows(plateJobColumns).
+						AddRow(1, 4, "white", 1, "ssid", "marker.stl", 2).
+						AddRow(2, 5, "red", 2, "ssid", "red.stl", 1).
+						AddRow(3, 6, "white", 3, "ssid", "logo.stl", 1).
+						AddRow(4, 7, "white", 4, "ssid", "pair.stl", 2))
+				mock.ExpectExec(`INSERT INTO plates`).
+					WithArgs(30.0, 30.0, "white").
+					WillReturnResult(sqlmock.NewResult(12, 1))
+				mock.ExpectExec(`INSERT INTO plate_instances`).
+					WithArgs(int64(12), int64(1), int64(1), int64(4), 1, 0.0, 0.0, false).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`INSERT INTO plate_instances`).
+					WithArgs(int64(12), int64(1), int64(1), int64(4), 2, 15.0, 0.0, false).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec(`INSERT INTO plate_instances`).
+					WithArgs(int64(12), int64(3), int64(3), int64(6), 1, 0.0, 15.0, false).
+					WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = \? WHERE job_id = \?`).
+					WithArgs(int64(12), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = \? WHERE job_id = \?`).
+					WithArgs(int64(12), int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantJobs: []int64{1, 3},
+			wantInstances: []structs.PlateInstance{
+				{JobID: 1, OrderID: 4, StlID: 1, FileName: "marker.stl", Copy: 1, X: 0, Y: 0},
+				{JobID: 1, OrderID: 4, StlID: 1, FileName: "marker.stl", Copy: 2, X: 15, Y: 0},
+				{JobID: 3, OrderID: 6, StlID: 3, FileName: "logo.stl", Copy: 1, X: 0, Y: 15},
+			},
+		},
+		{
+			desc: "job whose file can't be read is left queued",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM \(`).
+					WillReturnRows(sqlmock.NewRows(plateJobColumns).
+						AddRow(1, 4, nil, 1, "ssid", "missing.stl", 1).
+						AddRow(2, 5, nil, 2, "ssid", "marker.stl", 1))
+				mock.ExpectExec(`INSERT INTO plates`).
+					WithArgs(30.0, 30.0, nil).
+					WillReturnResult(sqlmock.NewResult(12, 1))
+				mock.ExpectExec(`INSERT INTO plate_instances`).
+					WithArgs(int64(12), int64(2), int64(2), int64(5), 1, 0.0, 0.0, false).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = \?`).
+					WithArgs(int64(12), int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantJobs:      []int64{2},
+			wantInstances: []structs.PlateInstance{{JobID: 2, OrderID: 5, StlID: 2, FileName: "marker.stl", Copy: 1}},
+		},
+		{
+			desc: "nothing queued fits",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM \(`).
+					WillReturnRows(sqlmock.NewRows(plateJobColumns).AddRow(1, 4, "white", 1, "ssid", "marker.stl", 5))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrNothingToPlate,
+		},
+		{
+			desc:    "plate file can't be saved",
+			saveErr: errors.New("disk full"),
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM \(`).
+					WillReturnRows(sqlmock.NewRows(plateJobColumns).AddRow(1, 4, "white", 1, "ssid", "marker.stl", 1))
+				mock.ExpectExec(`INSERT INTO plates`).WillReturnResult(sqlmock.NewResult(12, 1))
+				mock.ExpectExec(`INSERT INTO plate_instances`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = \?`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT status, worker_id FROM plates WHERE plate_id = \? FOR UPDATE`).
+					WithArgs(int64(12)).
+					WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}).AddRow("created", nil))
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = NULL WHERE plate_id = \? AND status = 'queued'`).
+					WithArgs(int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE plates SET status = 'failed'`).
+					WithArgs("failed to save plate: disk full", int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`FROM plates WHERE plate_id = \?`).
+					WillReturnRows(sqlmock.NewRows(plateColumns).
+						AddRow("failed", nil, nil, nil, 0, 30, 30, "white", time.Now(), time.Now(), "failed to save plate: disk full"))
+				mock.ExpectQuery(`FROM plate_instances i`).WillReturnRows(sqlmock.NewRows(plateInstanceColumns))
+			},
+			wantErrMsg: "failed to save plate: disk full",
+		},
+		{
+			desc:    "plate file can't be saved or failed",
+			saveErr: errors.New("disk full"),
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM \(`).
+					WillReturnRows(sqlmock.NewRows(plateJobColumns).AddRow(1, 4, "white", 1, "ssid", "marker.stl", 1))
+				mock.ExpectExec(`INSERT INTO plates`).WillReturnResult(sqlmock.NewResult(12, 1))
+				mock.ExpectExec(`INSERT INTO plate_instances`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = \?`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin().WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "failed to save plate: disk full\nplate 12: failed to begin transaction: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			saved := map[string][]byte{}
+			service := &PlatingServiceImpl{
+				DB: db,
+				readStlFunc: func(ssid, fileName string) ([]byte, error) {
+					if fileName == "missing.stl" {
+						return nil, errors.New("no such file")
+					}
+					return cube, nil
+				},
+				savePlateFunc: func(fileName string, data []byte) error {
+					saved[fileName] = data
+					return tt.saveErr
+				},
+			}
+
+			plate, err := service.CreatePlate(30, 30)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.EqualError(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, int64(12), plate.PlateID)
+				assert.Equal(t, "plate-12.stl", plate.FileName)
+				assert.Equal(t, tt.wantJobs, plate.JobIDs)
+				assert.Equal(t, tt.wantInstances, plate.Instances)
+
+				// every copy of the cube ends up on the bed
+				mesh, err := MeasureStl(saved["plate-12.stl"])
+				assert.NoError(t, err)
+				assert.InDelta(t, 1000*float64(len(tt.wantInstances)), mesh.Volume, 1e-3)
+				assert.InDelta(t, 10, mesh.Height, 1e-6)
+
+				var manifest structs.Plate
+				assert.NoError(t, json.Unmarshal(saved["plate-12.json"], &manifest))
+				assert.Equal(t, tt.wantInstances, manifest.Instances)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCompletePlate(t *testing.T) {
+	created := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	completed := time.Date(2024, 5, 2, 11, 0, 0, 0, time.UTC)
+
+	expectPlate := func(mock sqlmock.Sqlmock, status string, completedAt any) {
+		mock.ExpectQuery(`SELECT status, worker_id, printer_id, lease_expires_at, attempts, bed_x_mm, bed_y_mm, filament_colors,\s+created_at, completed_at, failure_reason\s+FROM plates WHERE plate_id = \?`).
+			WithArgs(int64(12)).
+			WillReturnRows(sqlmock.NewRows(plateColumns).AddRow(status, nil, nil, nil, 0, 250, 210, "white", created, completedAt, nil))
+		mock.ExpectQuery(`FROM plate_instances i`).
+			WithArgs(int64(12)).
+			WillReturnRows(sqlmock.NewRows(plateInstanceColumns).
+				AddRow(1, 4, 1, "marker.stl", 1, 0, 0, false).
+				AddRow(1, 4, 1, "marker.stl", 2, 15, 0, false).
+				AddRow(3, 6, 3, "logo.stl", 1, 0, 15, true))
+	}
+	expectCompleteJob := func(mock sqlmock.Sqlmock, jobID int64) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE print_jobs SET status = 'completed'`).WithArgs(jobID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE label_purchases l`).WithArgs(jobID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectQuery(`SELECT l.label_purchase_id`).WithArgs(jobID).WillReturnError(sql.ErrNoRows)
+	}
+
+	tests := []struct {
+		desc       string
+		mockDB     func(sqlmock.Sqlmock)
+		wantStatus string
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc: "every job on the plate is completed",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectPlate(mock, "created", nil)
+				expectCompleteJob(mock, 1)
+				expectCompleteJob(mock, 3)
+				mock.ExpectExec(`UPDATE plates SET status = 'completed', completed_at = NOW\(\), lease_expires_at = NULL WHERE plate_id = \?`).
+					WithArgs(int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectPlate(mock, "completed", completed)
+			},
+			wantStatus: "completed",
+		},
+		{
+			desc: "completed plate is left alone",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectPlate(mock, "completed", completed)
+			},
+			wantStatus: "completed",
+		},
+		{
+			desc: "failed plate can't be completed",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectPlate(mock, "failed", completed)
+			},
+			wantErr: ErrPlateClosed,
+		},
+		{
+			desc: "job fails to complete",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectPlate(mock, "created", nil)
+				expectCompleteJob(mock, 1)
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'completed'`).WithArgs(int64(3)).WillReturnError(errors.New("db down"))
+				mock.ExpectRollback()
+			},
+			wantErrMsg: "print job 3: failed to complete print job: db down",
+		},
+		{
+			desc: "plate not found",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM plates WHERE plate_id = \?`).WillReturnRows(sqlmock.NewRows(plateColumns))
+			},
+			wantErr: ErrPlateNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewPlatingService(db, &OrderServiceImpl{DB: db}, nil)
+			plate, err := service.CompletePlate(12)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.EqualError(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantStatus, plate.Status)
+				assert.Equal(t, []int64{1, 3}, plate.JobIDs)
+				assert.Equal(t, "plate-12.stl", plate.FileName)
+				assert.Equal(t, []string{"white"}, plate.FilamentColors)
+				assert.Len(t, plate.Instances, 3)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestFailPlate(t *testing.T) {
+	created := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	failed := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	expectStatus := func(mock sqlmock.Sqlmock, status string) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT status, worker_id FROM plates WHERE plate_id = \? FOR UPDATE`).
+			WithArgs(int64(12)).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}).AddRow(status, nil))
+	}
+	expectPlate := func(mock sqlmock.Sqlmock, reason any) {
+		mock.ExpectQuery(`FROM plates WHERE plate_id = \?`).
+			WithArgs(int64(12)).
+			WillReturnRows(sqlmock.NewRows(plateColumns).AddRow("failed", nil, nil, nil, 0, 250, 210, "white", created, failed, reason))
+		mock.ExpectQuery(`FROM plate_instances i`).
+			WithArgs(int64(12)).
+			WillReturnRows(sqlmock.NewRows(plateInstanceColumns).
+				AddRow(1, 4, 1, "marker.stl", 1, 0, 0, false).
+				AddRow(3, 6, 3, "logo.stl", 1, 0, 15, false))
+	}
+
+	tests := []struct {
+		desc       string
+		reason     string
+		mockDB     func(sqlmock.Sqlmock)
+		wantReason string
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc:   "queued jobs come off the plate",
+			reason: "first layer didn't stick",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectStatus(mock, "created")
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = NULL WHERE plate_id = \? AND status = 'queued'`).
+					WithArgs(int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`UPDATE plates SET status = 'failed', completed_at = NOW\(\), lease_expires_at = NULL, failure_reason = \?\s+WHERE plate_id = \?`).
+					WithArgs("first layer didn't stick", int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectPlate(mock, "first layer didn't stick")
+			},
+			wantReason: "first layer didn't stick",
+		},
+		{
+			desc: "no reason given",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectStatus(mock, "created")
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = NULL`).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`UPDATE plates SET status = 'failed'`).
+					WithArgs(nil, int64(12)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectPlate(mock, nil)
+			},
+		},
+		{
+			desc:   "failed plate is left alone",
+			reason: "again",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectStatus(mock, "failed")
+				expectPlate(mock, "nozzle clog")
+				mock.ExpectRollback()
+			},
+			wantReason: "nozzle clog",
+		},
+		{
+			desc: "completed plate can't fail",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectStatus(mock, "completed")
+				mock.ExpectRollback()
+			},
+			wantErr: ErrPlateClosed,
+		},
+		{
+			desc: "plate not found",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM plates WHERE plate_id = \? FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrPlateNotFound,
+		},
+		{
+			desc: "jobs can't be requeued",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				expectStatus(mock, "created")
+				mock.ExpectExec(`UPDATE print_jobs SET plate_id = NULL`).WillReturnError(errors.New("db down"))
+				mock.ExpectRollback()
+			},
+			wantErrMsg: "failed to requeue plate jobs: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewPlatingService(db, &OrderServiceImpl{DB: db}, nil)
+			plate, err := service.FailPlate(12, tt.reason)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.EqualError(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, "failed", plate.Status)
+				assert.Equal(t, tt.wantReason, plate.FailureReason)
+				assert.Equal(t, []int64{1, 3}, plate.JobIDs)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
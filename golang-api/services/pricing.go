@@ -0,0 +1,277 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+const (
+	DEFAULT_SIZE_VARIANT = "standard"
+	// ounces, used for packaging when a product is created without a weight
+	DEFAULT_MARKER_WEIGHT = 0.5
+	// declared on international shipments when a product is created without its own
+	DEFAULT_CUSTOMS_DESCRIPTION = "Plastic golf ball markers"
+	DEFAULT_HS_TARIFF_NUMBER    = "950639"
+)
+
+var (
+	ErrUnknownProduct  = errors.New("no active price for product")
+	ErrProductNotFound = errors.New("product not found")
+)
+
+type PricingServiceImpl struct {
+	DB *sql.DB
+}
+
+func NewPricingService(db *sql.DB) PricingService {
+	return &PricingServiceImpl{DB: db}
+}
+
+// GetPrice returns the price currently in effect for an active product
+func (ps *PricingServiceImpl) GetPrice(templateType string, sizeVariant string) (structs.Price, error) {
+	if sizeVariant == "" {
+		sizeVariant = DEFAULT_SIZE_VARIANT
+	}
+
+	query := `
+		SELECT pr.price_id, pr.product_id, pr.unit_amount_cents, pr.effective_from, pr.effective_to
+		FROM prices pr
+		JOIN products p ON p.product_id = pr.product_id
+		WHERE p.template_type = ? AND p.size_variant = ? AND p.active = TRUE AND pr.active = TRUE
+			AND pr.effective_from <= NOW() AND (pr.effective_to IS NULL OR pr.effective_to > NOW())
+		ORDER BY pr.effective_from DESC
+		LIMIT 1
+	`
+
+	var price structs.Price
+	var effectiveTo sql.NullTime
+	err := ps.DB.QueryRow(query, templateType, sizeVariant).
+		Scan(&price.PriceID, &price.ProductID, &price.UnitAmount, &price.EffectiveFrom, &effectiveTo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.Price{}, fmt.Errorf("%w: %s/%s", ErrUnknownProduct, templateType, sizeVariant)
+	}
+	if err != nil {
+		return structs.Price{}, fmt.Errorf("failed to look up price: %w", err)
+	}
+
+	price.Active = true
+	if effectiveTo.Valid {
+		price.EffectiveTo = &effectiveTo.Time
+	}
+
+	return price, nil
+}
+
+// PriceCart totals a cart in cents, it is the only place an order amount is computed
+func (ps *PricingServiceImpl) PriceCart(cart []structs.CartItem) (int64, error) {
+	var total int64
+	prices := map[string]int64{}
+
+	for _, item := range cart {
+		if item.Quantity <= 0 {
+			return 0, fmt.Errorf("invalid cart item: missing positive quantity")
+		}
+
+		key := item.TemplateType + "/" + item.SizeVariant
+		unitAmount, ok := prices[key]
+		if !ok {
+			price, err := ps.GetPrice(item.TemplateType, item.SizeVariant)
+			if err != nil {
+				return 0, err
+			}
+			unitAmount = price.UnitAmount
+			prices[key] = unitAmount
+		}
+
+		total += unitAmount * int64(item.Quantity)
+	}
+
+	return total, nil
+}
+
+// ListProducts returns the catalog with its price history, activeOnly trims it to
+// what a customer can currently buy and the single price in effect for each product
+func (ps *PricingServiceImpl) ListProducts(activeOnly bool) ([]structs.Product, error) {
+	productQuery := `
+		SELECT product_id, template_type, size_variant, name, unit_weight_oz, customs_description, hs_tariff_number, filament_color, active
+		FROM products
+		ORDER BY product_id
+	`
+	rows, err := ps.DB.Query(productQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []structs.Product{}
+	index := map[int64]int{}
+	for rows.Next() {
+		var product structs.Product
+		var filamentColor sql.NullString
+		if err := rows.Scan(&product.ProductID, &product.TemplateType, &product.SizeVariant, &product.Name, &product.UnitWeight, &product.CustomsDescription, &product.HSTariffNumber, &filamentColor, &product.Active); err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		product.FilamentColor = filamentColor.String
+		if activeOnly && !product.Active {
+			continue
+		}
+		product.Prices = []structs.Price{}
+		index[product.ProductID] = len(products)
+		products = append(products, product)
+	}
+	rows.Close()
+
+	priceQuery := `SELECT price_id, product_id, unit_amount_cents, active, effective_from, effective_to FROM prices ORDER BY effective_from`
+	priceRows, err := ps.DB.Query(priceQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prices: %w", err)
+	}
+	defer priceRows.Close()
+
+	now := time.Now()
+	for priceRows.Next() {
+		var price structs.Price
+		var effectiveTo sql.NullTime
+		if err := priceRows.Scan(&price.PriceID, &price.ProductID, &price.UnitAmount, &price.Active, &price.EffectiveFrom, &effectiveTo); err != nil {
+			return nil, fmt.Errorf("failed to scan price: %w", err)
+		}
+		if effectiveTo.Valid {
+			price.EffectiveTo = &effectiveTo.Time
+		}
+
+		i, ok := index[price.ProductID]
+		if !ok {
+			continue
+		}
+
+		if activeOnly {
+			if !price.Active || price.EffectiveFrom.After(now) || (price.EffectiveTo != nil && !price.EffectiveTo.After(now)) {
+				continue
+			}
+			// rows are ordered by effective_from so the latest current price wins
+			products[i].Prices = []structs.Price{price}
+			continue
+		}
+
+		products[i].Prices = append(products[i].Prices, price)
+	}
+
+	if activeOnly {
+		// a product without a current price cannot be put in a cart
+		available := []structs.Product{}
+		for _, product := range products {
+			if len(product.Prices) > 0 {
+				available = append(available, product)
+			}
+		}
+		products = available
+	}
+
+	return products, nil
+}
+
+func (ps *PricingServiceImpl) CreateProduct(product structs.Product) (int64, error) {
+	if product.SizeVariant == "" {
+		product.SizeVariant = DEFAULT_SIZE_VARIANT
+	}
+	if product.UnitWeight == 0 {
+		product.UnitWeight = DEFAULT_MARKER_WEIGHT
+	}
+	if product.CustomsDescription == "" {
+		product.CustomsDescription = DEFAULT_CUSTOMS_DESCRIPTION
+	}
+	if product.HSTariffNumber == "" {
+		product.HSTariffNumber = DEFAULT_HS_TARIFF_NUMBER
+	}
+
+	query := `
+		INSERT INTO products (template_type, size_variant, name, unit_weight_oz, customs_description, hs_tariff_number, filament_color, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := ps.DB.Exec(
+		query,
+		product.TemplateType, product.SizeVariant, product.Name, product.UnitWeight,
+		product.CustomsDescription, product.HSTariffNumber, nullString(normalizeColor(product.FilamentColor)), product.Active,
+	)
+	if err != nil {
+		return -1, fmt.Errorf("failed to insert product: %w", err)
+	}
+
+	productID, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("failed to retrieve product ID: %w", err)
+	}
+
+	return productID, nil
+}
+
+func (ps *PricingServiceImpl) SetProductActive(productID int64, active bool) error {
+	query := `UPDATE products SET active = ? WHERE product_id = ?`
+	result, err := ps.DB.Exec(query, active, productID)
+	if err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to read affected rows: %w", err)
+	}
+	if affected == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+// SetPrice schedules a new price for a product, the price it supersedes stays in
+// effect until the new one starts so historical orders keep their original price
+func (ps *PricingServiceImpl) SetPrice(productID int64, price structs.Price) (int64, error) {
+	if price.UnitAmount <= 0 {
+		return -1, fmt.Errorf("invalid unit amount: %d", price.UnitAmount)
+	}
+
+	if price.EffectiveFrom.IsZero() {
+		price.EffectiveFrom = time.Now()
+	}
+
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return -1, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`SELECT 1 FROM products WHERE product_id = ?`, productID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return -1, ErrProductNotFound
+	}
+	if err != nil {
+		return -1, fmt.Errorf("failed to look up product: %w", err)
+	}
+
+	closeQuery := `UPDATE prices SET effective_to = ? WHERE product_id = ? AND effective_to IS NULL AND effective_from <= ?`
+	if _, err := tx.Exec(closeQuery, price.EffectiveFrom, productID, price.EffectiveFrom); err != nil {
+		return -1, fmt.Errorf("failed to close current price: %w", err)
+	}
+
+	insertQuery := `INSERT INTO prices (product_id, unit_amount_cents, active, effective_from, effective_to) VALUES (?, ?, ?, ?, ?)`
+	result, err := tx.Exec(insertQuery, productID, price.UnitAmount, true, price.EffectiveFrom, price.EffectiveTo)
+	if err != nil {
+		return -1, fmt.Errorf("failed to insert price: %w", err)
+	}
+
+	priceID, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("failed to retrieve price ID: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return priceID, nil
+}
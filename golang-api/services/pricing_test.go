@@ -0,0 +1,438 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPricingService struct {
+	mock.Mock
+}
+
+func (m *MockPricingService) GetPrice(templateType string, sizeVariant string) (structs.Price, error) {
+	args := m.Called(templateType, sizeVariant)
+	return args.Get(0).(structs.Price), args.Error(1)
+}
+
+func (m *MockPricingService) PriceCart(cart []structs.CartItem) (int64, error) {
+	args := m.Called(cart)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockPricingService) ListProducts(activeOnly bool) ([]structs.Product, error) {
+	args := m.Called(activeOnly)
+	return args.Get(0).([]structs.Product), args.Error(1)
+}
+
+func (m *MockPricingService) CreateProduct(product structs.Product) (int64, error) {
+	args := m.Called(product)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockPricingService) SetProductActive(productID int64, active bool) error {
+	return m.Called(productID, active).Error(0)
+}
+
+func (m *MockPricingService) SetPrice(productID int64, price structs.Price) (int64, error) {
+	args := m.Called(productID, price)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+var priceColumns = []string{"price_id", "product_id", "unit_amount_cents", "effective_from", "effective_to"}
+
+func TestGetPrice(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc        string
+		sizeVariant string
+		mockDB      func(sqlmock.Sqlmock)
+		wantPrice   structs.Price
+		wantErr     error
+		wantErrMsg  string
+	}{
+		{
+			desc:        "current price found",
+			sizeVariant: "standard",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT pr.price_id, pr.product_id, pr.unit_amount_cents`).
+					WithArgs("solid", "standard").
+					WillReturnRows(sqlmock.NewRows(priceColumns).AddRow(4, 1, 1499, from, nil))
+			},
+			wantPrice: structs.Price{PriceID: 4, ProductID: 1, UnitAmount: 1499, Active: true, EffectiveFrom: from},
+		},
+		{
+			desc:        "size variant defaults to standard",
+			sizeVariant: "",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT pr.price_id, pr.product_id, pr.unit_amount_cents`).
+					WithArgs("solid", "standard").
+					WillReturnRows(sqlmock.NewRows(priceColumns).AddRow(4, 1, 1499, from, nil))
+			},
+			wantPrice: structs.Price{PriceID: 4, ProductID: 1, UnitAmount: 1499, Active: true, EffectiveFrom: from},
+		},
+		{
+			desc:        "no active price",
+			sizeVariant: "xl",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT pr.price_id, pr.product_id, pr.unit_amount_cents`).
+					WithArgs("solid", "xl").
+					WillReturnRows(sqlmock.NewRows(priceColumns))
+			},
+			wantErr: ErrUnknownProduct,
+		},
+		{
+			desc:        "query fails",
+			sizeVariant: "standard",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT pr.price_id, pr.product_id, pr.unit_amount_cents`).
+					WithArgs("solid", "standard").
+					WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "failed to look up price: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewPricingService(db)
+			price, err := service.GetPrice("solid", tt.sizeVariant)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantPrice, price)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPriceCart(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc       string
+		cart       []structs.CartItem
+		mockDB     func(sqlmock.Sqlmock)
+		wantTotal  int64
+		wantErr    bool
+		wantErrMsg string
+	}{
+		{
+			desc: "prices each product once",
+			cart: []structs.CartItem{
+				{Quantity: 2, TemplateType: "solid"},
+				{Quantity: 1, TemplateType: "text"},
+				{Quantity: 3, TemplateType: "solid"},
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT pr.price_id`).
+					WithArgs("solid", "standard").
+					WillReturnRows(sqlmock.NewRows(priceColumns).AddRow(1, 1, 1499, from, nil))
+				mock.ExpectQuery(`SELECT pr.price_id`).
+					WithArgs("text", "standard").
+					WillReturnRows(sqlmock.NewRows(priceColumns).AddRow(2, 2, 1899, from, nil))
+			},
+			wantTotal: 5*1499 + 1899,
+		},
+		{
+			desc:       "non positive quantity",
+			cart:       []structs.CartItem{{Quantity: 0, TemplateType: "solid"}},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErr:    true,
+			wantErrMsg: "missing positive quantity",
+		},
+		{
+			desc: "unknown product",
+			cart: []structs.CartItem{{Quantity: 1, TemplateType: "gold"}},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT pr.price_id`).
+					WithArgs("gold", "standard").
+					WillReturnRows(sqlmock.NewRows(priceColumns))
+			},
+			wantErr:    true,
+			wantErrMsg: ErrUnknownProduct.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewPricingService(db)
+			total, err := service.PriceCart(tt.cart)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantTotal, total)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestListProducts(t *testing.T) {
+	past := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	future := time.Now().Add(48 * time.Hour)
+
+	productRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"product_id", "template_type", "size_variant", "name", "unit_weight_oz", "customs_description", "hs_tariff_number", "filament_color", "active"}).
+			AddRow(1, "solid", "standard", "Solid marker", 0.45, "Plastic golf ball markers", "950639", "white", true).
+			AddRow(2, "text", "standard", "Text marker", 0.5, "Plastic golf ball markers", "950639", nil, false)
+	}
+	priceRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"price_id", "product_id", "unit_amount_cents", "active", "effective_from", "effective_to"}).
+			AddRow(1, 1, 1299, true, past, recent).
+			AddRow(2, 1, 1499, true, recent, nil).
+			AddRow(3, 1, 1699, true, future, nil).
+			AddRow(4, 2, 1899, true, past, nil)
+	}
+
+	t.Run("admin view keeps full history", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock db: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT product_id, template_type, size_variant, name, unit_weight_oz, customs_description, hs_tariff_number, filament_color, active`).WillReturnRows(productRows())
+		mock.ExpectQuery(`SELECT price_id, product_id, unit_amount_cents, active, effective_from, effective_to FROM prices`).WillReturnRows(priceRows())
+
+		products, err := NewPricingService(db).ListProducts(false)
+
+		assert.NoError(t, err)
+		assert.Len(t, products, 2)
+		assert.Len(t, products[0].Prices, 3)
+		assert.Len(t, products[1].Prices, 1)
+		assert.Equal(t, "white", products[0].FilamentColor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("public view shows current price of active products", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock db: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT product_id, template_type, size_variant, name, unit_weight_oz, customs_description, hs_tariff_number, filament_color, active`).WillReturnRows(productRows())
+		mock.ExpectQuery(`SELECT price_id, product_id, unit_amount_cents, active, effective_from, effective_to FROM prices`).WillReturnRows(priceRows())
+
+		products, err := NewPricingService(db).ListProducts(true)
+
+		assert.NoError(t, err)
+		if assert.Len(t, products, 1) && assert.Len(t, products[0].Prices, 1) {
+			assert.Equal(t, int64(1499), products[0].Prices[0].UnitAmount)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("product query fails", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock db: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT product_id`).WillReturnError(errors.New("db down"))
+
+		_, err = NewPricingService(db).ListProducts(true)
+
+		assert.ErrorContains(t, err, "failed to list products")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCreateProduct(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO products`).
+		WithArgs("custom", "standard", "Custom marker", DEFAULT_MARKER_WEIGHT, DEFAULT_CUSTOMS_DESCRIPTION, DEFAULT_HS_TARIFF_NUMBER, "glow", true).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+
+	productID, err := NewPricingService(db).CreateProduct(structs.Product{TemplateType: "custom", Name: "Custom marker", FilamentColor: " Glow ", Active: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), productID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetProductActive(t *testing.T) {
+	tests := []struct {
+		desc    string
+		mockDB  func(sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			desc: "deactivate product",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE products SET active = \? WHERE product_id = \?`).
+					WithArgs(false, 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			desc: "unknown product",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE products SET active = \? WHERE product_id = \?`).
+					WithArgs(false, 3).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrProductNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			err = NewPricingService(db).SetProductActive(3, false)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSetPrice(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc       string
+		price      structs.Price
+		mockDB     func(sqlmock.Sqlmock)
+		wantID     int64
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc:  "supersedes the open price",
+			price: structs.Price{UnitAmount: 1599, EffectiveFrom: from},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT 1 FROM products WHERE product_id = \?`).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+				mock.ExpectExec(`UPDATE prices SET effective_to = \?`).
+					WithArgs(from, 3, from).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO prices`).
+					WithArgs(3, 1599, true, from, nil).
+					WillReturnResult(sqlmock.NewResult(12, 1))
+				mock.ExpectCommit()
+			},
+			wantID: 12,
+		},
+		{
+			desc:       "rejects non positive amount",
+			price:      structs.Price{UnitAmount: 0},
+			mockDB:     func(mock sqlmock.Sqlmock) {},
+			wantErrMsg: "invalid unit amount",
+		},
+		{
+			desc:  "unknown product",
+			price: structs.Price{UnitAmount: 1599, EffectiveFrom: from},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT 1 FROM products WHERE product_id = \?`).
+					WithArgs(3).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrProductNotFound,
+		},
+		{
+			desc:  "insert fails",
+			price: structs.Price{UnitAmount: 1599, EffectiveFrom: from},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT 1 FROM products WHERE product_id = \?`).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+				mock.ExpectExec(`UPDATE prices SET effective_to = \?`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO prices`).
+					WillReturnError(errors.New("db down"))
+				mock.ExpectRollback()
+			},
+			wantErrMsg: "failed to insert price",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			priceID, err := NewPricingService(db).SetPrice(3, tt.price)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantID, priceID)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+const (
+	// workers heartbeat well inside the lease, a job whose worker goes quiet is claimed again
+	PRINT_JOB_LEASE = 5 * time.Minute
+	// download links only need to outlive the slicer fetching the file
+	STL_LINK_EXPIRY = time.Hour
+	// oldest jobs that fit a printer's bed looked at per claim, enough to see past a few
+	// waiting on a color nobody has loaded
+	CLAIM_CANDIDATES = 20
+)
+
+var (
+	ErrNoQueuedJobs = errors.New("no print jobs queued")
+	ErrJobNotHeld   = errors.New("print job is not held by this worker")
+)
+
+type PrintQueueServiceImpl struct {
+	DB          *sql.DB
+	Orders      OrderService
+	Scheduler   PrintScheduler
+	Printers    PrinterService
+	presignFunc func(s3Key string) (string, error)
+}
+
+func NewPrintQueueService(db *sql.DB, orders OrderService, scheduler PrintScheduler, printers PrinterService) PrintQueueService {
+	return &PrintQueueServiceImpl{DB: db, Orders: orders, Scheduler: scheduler, Printers: printers, presignFunc: presignS3}
+}
+
+// ClaimJob leases the oldest queued job a printer can take to one of its workers, jobs whose
+// lease ran out are handed to the next worker that asks. Locked rows are skipped so workers
+// polling together never get the same job
+func (ps *PrintQueueServiceImpl) ClaimJob(workerID string, printerID int64) (structs.PrintJob, error) {
+	printer, err := ps.Printers.GetPrinter(printerID)
+	if err != nil {
+		return structs.PrintJob{}, err
+	}
+	if printer.Status == "offline" || printer.Status == "maintenance" {
+		return structs.PrintJob{}, ErrPrinterUnavailable
+	}
+
+	candidates, err := ps.candidateJobs(printer)
+	if err != nil {
+		return structs.PrintJob{}, err
+	}
+
+	for _, candidate := range candidates {
+		if !hasColors(printer, candidate.colors) {
+			continue
+		}
+
+		claimed, err := ps.claimJob(candidate.jobID, workerID, printerID)
+		if err != nil {
+			return structs.PrintJob{}, err
+		}
+		if !claimed {
+			// another worker got there first
+			continue
+		}
+		ps.reschedule()
+
+		job, err := ps.getJob(candidate.jobID)
+		if err != nil {
+			return structs.PrintJob{}, err
+		}
+
+		job.Files, err = ps.jobFiles(candidate.jobID)
+		if err != nil {
+			return structs.PrintJob{}, err
+		}
+
+		return job, nil
+	}
+
+	return structs.PrintJob{}, ErrNoQueuedJobs
+}
+
+// claimableJobs matches jobs waiting for a worker, including ones whose worker went quiet.
+// Jobs on a plate are printed with the plate instead
+const claimableJobs = `plate_id IS NULL AND (status = 'queued' OR (status IN ('claimed', 'printing') AND lease_expires_at < NOW()))`
+
+// claimCandidate is a claimable job that fits a printer's bed, its colors are checked against
+// the printer's spools before it's claimed
+type claimCandidate struct {
+	jobID  int64
+	colors []string
+}
+
+// candidateJobs lists the oldest claimable jobs whose files fit on the printer's bed, turned
+// a quarter turn if need be, and whose G-code was sliced for the printer's nozzle. Jobs from
+// before sizes were recorded fit anywhere and jobs without G-code print on any nozzle
+func (ps *PrintQueueServiceImpl) candidateJobs(printer structs.Printer) ([]claimCandidate, error) {
+	nozzle := printer.NozzleMM
+	if nozzle == 0 {
+		nozzle = DEFAULT_NOZZLE_MM
+	}
+
+	query := `
+		SELECT job_id, filament_colors FROM print_jobs
+		WHERE ` + claimableJobs + `
+			AND (size_x_mm IS NULL OR (
+				LEAST(size_x_mm, size_y_mm) <= ? AND GREATEST(size_x_mm, size_y_mm) <= ? AND size_z_mm <= ?
+			))
+			AND (nozzle_mm IS NULL OR ABS(nozzle_mm - ?) < 0.005)
+		ORDER BY created_at, job_id
+		LIMIT ?
+	`
+	rows, err := ps.DB.Query(
+		query,
+		math.Min(printer.BedX, printer.BedY), math.Max(printer.BedX, printer.BedY), printer.BedZ, nozzle, CLAIM_CANDIDATES,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find queued jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []claimCandidate
+	for rows.Next() {
+		var candidate claimCandidate
+		var colors sql.NullString
+		if err := rows.Scan(&candidate.jobID, &colors); err != nil {
+			return nil, fmt.Errorf("failed to scan queued job: %w", err)
+		}
+		candidate.colors = splitColors(colors.String)
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, nil
+}
+
+// claimJob leases a job to a worker if it's still claimable, false means it was taken or
+// locked by another worker in the meantime
+func (ps *PrintQueueServiceImpl) claimJob(jobID int64, workerID string, printerID int64) (bool, error) {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT job_id FROM print_jobs WHERE job_id = ? AND ` + claimableJobs + ` FOR UPDATE SKIP LOCKED`
+	err = tx.QueryRow(query, jobID).Scan(&jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock print job: %w", err)
+	}
+
+	claimQuery := `
+		UPDATE print_jobs
+		SET status = 'claimed', worker_id = ?, printer_id = ?, lease_expires_at = NOW() + INTERVAL ? SECOND,
+			attempts = attempts + 1, started_at = NULL, failure_reason = NULL
+		WHERE job_id = ?
+	`
+	if _, err := tx.Exec(claimQuery, workerID, printerID, leaseSeconds(), jobID); err != nil {
+		return false, fmt.Errorf("failed to claim print job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// Heartbeat extends the lease of a job the worker still holds
+func (ps *PrintQueueServiceImpl) Heartbeat(jobID int64, workerID string) (structs.PrintJob, error) {
+	query := `UPDATE print_jobs SET lease_expires_at = NOW() + INTERVAL ? SECOND WHERE job_id = ?`
+	if err := ps.updateHeldJob(jobID, workerID, query, leaseSeconds(), jobID); err != nil {
+		return structs.PrintJob{}, err
+	}
+
+	return ps.getJob(jobID)
+}
+
+// UpdateJob records a worker's progress on a job it holds. Completing a job goes through
+// CompletePrintJob so a deferred label is bought as soon as the markers are printed
+func (ps *PrintQueueServiceImpl) UpdateJob(jobID int64, update structs.PrintJobUpdate) (structs.PrintJob, error) {
+	switch update.Status {
+	case "printing":
+		query := `
+			UPDATE print_jobs
+			SET status = 'printing', started_at = COALESCE(started_at, NOW()), lease_expires_at = NOW() + INTERVAL ? SECOND
+			WHERE job_id = ?
+		`
+		if err := ps.updateHeldJob(jobID, update.WorkerID, query, leaseSeconds(), jobID); err != nil {
+			return structs.PrintJob{}, err
+		}
+	case "failed":
+		query := `
+			UPDATE print_jobs
+			SET status = 'failed', completed_at = NOW(), lease_expires_at = NULL, failure_reason = ?
+			WHERE job_id = ?
+		`
+		if update.Requeue {
+			query = `
+				UPDATE print_jobs
+				SET status = 'queued', worker_id = NULL, printer_id = NULL, started_at = NULL, lease_expires_at = NULL, failure_reason = ?
+				WHERE job_id = ?
+			`
+		}
+		if err := ps.updateHeldJob(jobID, update.WorkerID, query, nullString(update.Reason), jobID); err != nil {
+			return structs.PrintJob{}, err
+		}
+	case "completed":
+		return ps.completeJob(jobID, update.WorkerID)
+	default:
+		return structs.PrintJob{}, fmt.Errorf("unknown print job status: %s", update.Status)
+	}
+	ps.reschedule()
+
+	return ps.getJob(jobID)
+}
+
+func (ps *PrintQueueServiceImpl) completeJob(jobID int64, workerID string) (structs.PrintJob, error) {
+	label, err := ps.Orders.CompletePrintJob(jobID, workerID)
+	if err != nil {
+		return structs.PrintJob{}, err
+	}
+	ps.reschedule()
+
+	job, err := ps.getJob(jobID)
+	if err != nil {
+		return structs.PrintJob{}, err
+	}
+	if label.LabelPurchaseID != 0 {
+		job.Label = &label
+	}
+
+	return job, nil
+}
+
+// JobFiles returns fresh download links for a job's STL files
+func (ps *PrintQueueServiceImpl) JobFiles(jobID int64) ([]structs.PrintFile, error) {
+	if _, err := ps.getJob(jobID); err != nil {
+		return nil, err
+	}
+
+	return ps.jobFiles(jobID)
+}
+
+// updateHeldJob runs query once the job is confirmed to still be leased to the worker
+func (ps *PrintQueueServiceImpl) updateHeldJob(jobID int64, workerID string, query string, args ...any) error {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := holdJob(tx, jobID, workerID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to update print job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// holdJob locks a job and checks the worker holds it, a worker whose lease ran out keeps
+// the job until someone else claims it
+func holdJob(tx *sql.Tx, jobID int64, workerID string) error {
+	var status string
+	var holder sql.NullString
+	query := `SELECT status, worker_id FROM print_jobs WHERE job_id = ? FOR UPDATE`
+	err := tx.QueryRow(query, jobID).Scan(&status, &holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPrintJobNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up print job: %w", err)
+	}
+
+	if holder.String != workerID || (status != "claimed" && status != "printing") {
+		return ErrJobNotHeld
+	}
+
+	return nil
+}
+
+func (ps *PrintQueueServiceImpl) getJob(jobID int64) (structs.PrintJob, error) {
+	job := structs.PrintJob{JobID: jobID}
+	var workerID, failureReason sql.NullString
+	var printerID sql.NullInt64
+	var leaseExpiresAt, startedAt, completedAt sql.NullTime
+
+	query := `
+		SELECT order_id, status, worker_id, printer_id, lease_expires_at, attempts, failure_reason, started_at, completed_at
+		FROM print_jobs
+		WHERE job_id = ?
+	`
+	err := ps.DB.QueryRow(query, jobID).Scan(
+		&job.OrderID, &job.Status, &workerID, &printerID, &leaseExpiresAt, &job.Attempts, &failureReason, &startedAt, &completedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.PrintJob{}, ErrPrintJobNotFound
+	}
+	if err != nil {
+		return structs.PrintJob{}, fmt.Errorf("failed to look up print job: %w", err)
+	}
+
+	job.WorkerID = workerID.String
+	job.PrinterID = printerID.Int64
+	job.FailureReason = failureReason.String
+	if leaseExpiresAt.Valid {
+		job.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+
+	return job, nil
+}
+
+func (ps *PrintQueueServiceImpl) jobFiles(jobID int64) ([]structs.PrintFile, error) {
+	query := `
+		SELECT stl_id, browser_ssid, file_name, quantity, gcode_file_name, gcode_print_seconds, gcode_filament_mm, gcode_filament_g
+		FROM stl_files WHERE job_id = ? ORDER BY stl_id
+	`
+	rows, err := ps.DB.Query(query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list STL files: %w", err)
+	}
+	defer rows.Close()
+
+	files := []structs.PrintFile{}
+	for rows.Next() {
+		var file structs.PrintFile
+		var ssid string
+		var gcodeName sql.NullString
+		var printSeconds sql.NullInt64
+		var filamentMM, filamentGrams sql.NullFloat64
+		if err := rows.Scan(&file.StlID, &ssid, &file.FileName, &file.Quantity, &gcodeName, &printSeconds, &filamentMM, &filamentGrams); err != nil {
+			return nil, fmt.Errorf("failed to scan STL file: %w", err)
+		}
+
+		// ProcessOrder uploads each file under the session it was designed in
+		file.DownloadURL, err = ps.presignFunc(fmt.Sprintf("%s/%s", ssid, file.FileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign %s: %w", file.FileName, err)
+		}
+
+		// the G-code sits next to its STL, a file that hasn't been sliced is printed from the STL
+		if gcodeName.Valid {
+			gcode := structs.GcodeFile{
+				GcodeMeta: structs.GcodeMeta{
+					PrintSeconds:  int(printSeconds.Int64),
+					FilamentMM:    filamentMM.Float64,
+					FilamentGrams: filamentGrams.Float64,
+				},
+				FileName: gcodeName.String,
+			}
+			gcode.DownloadURL, err = ps.presignFunc(fmt.Sprintf("%s/%s", ssid, gcode.FileName))
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign %s: %w", gcode.FileName, err)
+			}
+			file.Gcode = &gcode
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// reschedule moves the estimates of the jobs behind one that changed, the queue itself is
+// already updated so a failure here is only logged
+func (ps *PrintQueueServiceImpl) reschedule() {
+	if err := ps.Scheduler.Reschedule(); err != nil {
+		log.Printf("Unable to reschedule print jobs: %v\n", err)
+	}
+}
+
+func leaseSeconds() int {
+	return int(PRINT_JOB_LEASE / time.Second)
+}
+
+func presignS3(s3Key string) (string, error) {
+	sess, err := aws_session.NewSession(&aws.Config{
+		Region: aws.String(config.S3_REGION),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	req, _ := s3.New(sess).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(config.STL_S3_BUCKET),
+		Key:    aws.String(s3Key),
+	})
+	return req.Presign(STL_LINK_EXPIRY)
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+var printJobColumns = []string{
+	"order_id", "status", "worker_id", "printer_id", "lease_expires_at", "attempts", "failure_reason", "started_at", "completed_at",
+}
+
+var stlFileColumns = []string{"stl_id", "browser_ssid", "file_name", "quantity", "gcode_file_name", "gcode_print_seconds", "gcode_filament_mm", "gcode_filament_g"}
+
+// testPrinter has white and black loaded on a bed that's narrower than it is deep
+var testPrinter = structs.Printer{
+	PrinterID: 1, Name: "mk4-1", BedX: 220, BedY: 250, BedZ: 250, NozzleMM: 0.4, FilamentColors: []string{"black", "white"}, Status: "idle",
+}
+
+func newTestPrintQueue(db *sql.DB) *PrintQueueServiceImpl {
+	scheduler := new(MockPrintScheduler)
+	scheduler.On("Reschedule").Return(nil)
+
+	printers := new(MockPrinterService)
+	printers.On("GetPrinter", int64(1)).Return(testPrinter, nil).Maybe()
+	printers.On("GetPrinter", int64(2)).Return(structs.Printer{PrinterID: 2, Status: "maintenance"}, nil).Maybe()
+	printers.On("GetPrinter", int64(3)).Return(structs.Printer{}, ErrPrinterNotFound).Maybe()
+
+	return &PrintQueueServiceImpl{
+		DB:        db,
+		Orders:    &OrderServiceImpl{DB: db},
+		Scheduler: scheduler,
+		Printers:  printers,
+		presignFunc: func(s3Key string) (string, error) {
+			return "https://bucket.example.com/" + s3Key + "?signed", nil
+		},
+	}
+}
+
+func TestClaimJob(t *testing.T) {
+	lease := time.Date(2024, 5, 2, 12, 5, 0, 0, time.UTC)
+	candidateQuery := `SELECT job_id, filament_colors FROM print_jobs WHERE plate_id IS NULL AND \(status = 'queued' OR \(status IN \('claimed', 'printing'\) AND lease_expires_at < NOW\(\)\)\)`
+	lockQuery := `SELECT job_id FROM print_jobs WHERE job_id = \? AND .* FOR UPDATE SKIP LOCKED`
+	candidateColumns := []string{"job_id", "filament_colors"}
+
+	tests := []struct {
+		desc       string
+		printerID  int64
+		mockDB     func(sqlmock.Sqlmock)
+		wantJob    structs.PrintJob
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc:      "oldest job the printer has colors for is leased with its files",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).
+					WithArgs(220.0, 250.0, 250.0, 0.4, CLAIM_CANDIDATES).
+					WillReturnRows(sqlmock.NewRows(candidateColumns).AddRow(8, "red").AddRow(9, "black,white"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(9))
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'claimed', worker_id = \?, printer_id = \?, lease_expires_at = NOW\(\) \+ INTERVAL \? SECOND`).
+					WithArgs("printer-1", int64(1), 300, int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`FROM print_jobs WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(printJobColumns).AddRow(4, "claimed", "printer-1", 1, lease, 1, nil, nil, nil))
+				mock.ExpectQuery(`SELECT stl_id, browser_ssid, file_name, quantity, gcode_file_name, .* FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(stlFileColumns).
+						AddRow(1, "ssid", "marker.stl", 3, "marker.gcode", 540, 812.5, 2.42).
+						AddRow(2, "ssid", "logo.stl", 1, nil, nil, nil, nil))
+			},
+			wantJob: structs.PrintJob{
+				JobID: 9, OrderID: 4, Status: "claimed", WorkerID: "printer-1", PrinterID: 1, LeaseExpiresAt: &lease, Attempts: 1,
+				Files: []structs.PrintFile{
+					{StlID: 1, FileName: "marker.stl", Quantity: 3, DownloadURL: "https://bucket.example.com/ssid/marker.stl?signed", Gcode: &structs.GcodeFile{
+						GcodeMeta:   structs.GcodeMeta{PrintSeconds: 540, FilamentMM: 812.5, FilamentGrams: 2.42},
+						FileName:    "marker.gcode",
+						DownloadURL: "https://bucket.example.com/ssid/marker.gcode?signed",
+					}},
+					{StlID: 2, FileName: "logo.stl", Quantity: 1, DownloadURL: "https://bucket.example.com/ssid/logo.stl?signed"},
+				},
+			},
+		},
+		{
+			desc:      "job taken by another worker is passed over",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).
+					WillReturnRows(sqlmock.NewRows(candidateColumns).AddRow(9, nil).AddRow(10, "white"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(int64(9)).WillReturnRows(sqlmock.NewRows([]string{"job_id"}))
+				mock.ExpectRollback()
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(int64(10)).WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(10))
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'claimed'`).
+					WithArgs("printer-1", int64(1), 300, int64(10)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`FROM print_jobs WHERE job_id = \?`).
+					WithArgs(int64(10)).
+					WillReturnRows(sqlmock.NewRows(printJobColumns).AddRow(5, "claimed", "printer-1", 1, lease, 1, nil, nil, nil))
+				mock.ExpectQuery(`FROM stl_files`).WithArgs(int64(10)).WillReturnRows(sqlmock.NewRows(stlFileColumns))
+			},
+			wantJob: structs.PrintJob{
+				JobID: 10, OrderID: 5, Status: "claimed", WorkerID: "printer-1", PrinterID: 1, LeaseExpiresAt: &lease, Attempts: 1,
+				Files: []structs.PrintFile{},
+			},
+		},
+		{
+			desc:      "no job matches the printer's colors",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).WillReturnRows(sqlmock.NewRows(candidateColumns).AddRow(8, "red"))
+			},
+			wantErr: ErrNoQueuedJobs,
+		},
+		{
+			desc:      "queue is empty",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).WillReturnRows(sqlmock.NewRows(candidateColumns))
+			},
+			wantErr: ErrNoQueuedJobs,
+		},
+		{
+			desc:      "printer is in maintenance",
+			printerID: 2,
+			mockDB:    func(mock sqlmock.Sqlmock) {},
+			wantErr:   ErrPrinterUnavailable,
+		},
+		{
+			desc:      "printer isn't registered",
+			printerID: 3,
+			mockDB:    func(mock sqlmock.Sqlmock) {},
+			wantErr:   ErrPrinterNotFound,
+		},
+		{
+			desc:      "claim fails",
+			printerID: 1,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(candidateQuery).WillReturnRows(sqlmock.NewRows(candidateColumns).AddRow(9, "white"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(9))
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'claimed'`).WillReturnError(errors.New("db down"))
+				mock.ExpectRollback()
+			},
+			wantErrMsg: "failed to claim print job: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			job, err := newTestPrintQueue(db).ClaimJob("printer-1", tt.printerID)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.EqualError(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantJob, job)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestClaimJobStalePrinter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	// last checked in an hour ago while idle, the query reports it offline
+	mock.ExpectQuery(`IF\(last_seen_at IS NULL OR last_seen_at < NOW\(\) - INTERVAL \? SECOND, 'offline', status\)`).
+		WithArgs(300, int64(1)).
+		WillReturnRows(sqlmock.NewRows(printerColumns).
+			AddRow(1, "mk4-1", 220, 250, 250, 0.4, "black,white", "offline", time.Now().Add(-time.Hour)))
+
+	queue := newTestPrintQueue(db)
+	queue.Printers = NewPrinterService(db)
+
+	_, err = queue.ClaimJob("printer-1", 1)
+	assert.ErrorIs(t, err, ErrPrinterUnavailable)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdatePrintJob(t *testing.T) {
+	started := time.Date(2024, 5, 2, 12, 1, 0, 0, time.UTC)
+	completed := time.Date(2024, 5, 2, 13, 0, 0, 0, time.UTC)
+	lease := time.Date(2024, 5, 2, 12, 6, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc    string
+		update  structs.PrintJobUpdate
+		mockDB  func(sqlmock.Sqlmock)
+		wantJob structs.PrintJob
+		wantErr error
+	}{
+		{
+			desc:   "printing sets started_at",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "printing"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT status, worker_id FROM print_jobs WHERE job_id = \? FOR UPDATE`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}).AddRow("claimed", "printer-1"))
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'printing', started_at = COALESCE\(started_at, NOW\(\)\)`).
+					WithArgs(300, int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`FROM print_jobs WHERE job_id = \?`).
+					WillReturnRows(sqlmock.NewRows(printJobColumns).AddRow(4, "printing", "printer-1", 1, lease, 1, nil, started, nil))
+			},
+			wantJob: structs.PrintJob{JobID: 9, OrderID: 4, Status: "printing", WorkerID: "printer-1", PrinterID: 1, LeaseExpiresAt: &lease, Attempts: 1, StartedAt: &started},
+		},
+		{
+			desc:   "failed sets completed_at",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "failed", Reason: "nozzle clog"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}).AddRow("printing", "printer-1"))
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'failed', completed_at = NOW\(\), lease_expires_at = NULL, failure_reason = \?`).
+					WithArgs("nozzle clog", int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`FROM print_jobs WHERE job_id = \?`).
+					WillReturnRows(sqlmock.NewRows(printJobColumns).AddRow(4, "failed", "printer-1", 1, nil, 1, "nozzle clog", started, completed))
+			},
+			wantJob: structs.PrintJob{JobID: 9, OrderID: 4, Status: "failed", WorkerID: "printer-1", PrinterID: 1, Attempts: 1, FailureReason: "nozzle clog",
+				StartedAt: &started, CompletedAt: &completed},
+		},
+		{
+			desc:   "failed job is requeued",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "failed", Reason: "bed adhesion", Requeue: true},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}).AddRow("printing", "printer-1"))
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'queued', worker_id = NULL`).
+					WithArgs("bed adhesion", int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`FROM print_jobs WHERE job_id = \?`).
+					WillReturnRows(sqlmock.NewRows(printJobColumns).AddRow(4, "queued", nil, nil, nil, 1, "bed adhesion", nil, nil))
+			},
+			wantJob: structs.PrintJob{JobID: 9, OrderID: 4, Status: "queued", Attempts: 1, FailureReason: "bed adhesion"},
+		},
+		{
+			desc:   "completed returns the order's label",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "completed"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'completed'`).WithArgs(int64(9), "printer-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE label_purchases l`).WithArgs(int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT l.label_purchase_id`).
+					WillReturnRows(sqlmock.NewRows([]string{"label_purchase_id", "order_id", "status", "attempts", "last_error"}).
+						AddRow(2, 4, "purchased", 1, nil))
+				mock.ExpectQuery(`FROM print_jobs WHERE job_id = \?`).
+					WillReturnRows(sqlmock.NewRows(printJobColumns).AddRow(4, "completed", "printer-1", 1, nil, 1, nil, started, completed))
+			},
+			wantJob: structs.PrintJob{JobID: 9, OrderID: 4, Status: "completed", WorkerID: "printer-1", PrinterID: 1, Attempts: 1,
+				StartedAt: &started, CompletedAt: &completed, Label: &structs.LabelPurchase{LabelPurchaseID: 2, OrderID: 4, Status: "purchased", Attempts: 1}},
+		},
+		{
+			desc:   "job was claimed by another worker",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "printing"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}).AddRow("claimed", "printer-2"))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrJobNotHeld,
+		},
+		{
+			desc:   "job already finished",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "completed"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE print_jobs SET status = 'completed'`).WithArgs(int64(9), "printer-1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT status FROM print_jobs WHERE job_id = \?`).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("completed"))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrJobNotHeld,
+		},
+		{
+			desc:   "job not found",
+			update: structs.PrintJobUpdate{WorkerID: "printer-1", Status: "failed"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrPrintJobNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			job, err := newTestPrintQueue(db).UpdateJob(9, tt.update)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantJob, job)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPrintJobHeartbeat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	lease := time.Date(2024, 5, 2, 12, 10, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"status", "worker_id"}).AddRow("printing", "printer-1"))
+	mock.ExpectExec(`UPDATE print_jobs SET lease_expires_at = NOW\(\) \+ INTERVAL \? SECOND WHERE job_id = \?`).
+		WithArgs(300, int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM print_jobs WHERE job_id = \?`).
+		WillReturnRows(sqlmock.NewRows(printJobColumns).AddRow(4, "printing", "printer-1", 1, lease, 1, nil, nil, nil))
+
+	job, err := newTestPrintQueue(db).Heartbeat(9, "printer-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lease, job.LeaseExpiresAt)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
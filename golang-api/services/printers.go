@@ -0,0 +1,248 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+const (
+	DEFAULT_NOZZLE_MM = 0.4
+	// a printer that hasn't checked in for this long is treated as offline, whatever status
+	// it last reported
+	PRINTER_TIMEOUT = 5 * time.Minute
+)
+
+var (
+	ErrPrinterNotFound    = errors.New("printer not found")
+	ErrPrinterUnavailable = errors.New("printer is offline or in maintenance")
+)
+
+type PrinterServiceImpl struct {
+	DB *sql.DB
+}
+
+func NewPrinterService(db *sql.DB) PrinterService {
+	return &PrinterServiceImpl{DB: db}
+}
+
+// RegisterPrinter adds a printer to the fleet, a printer registering again under the same
+// name replaces its details so a rebuilt machine keeps its ID
+func (ps *PrinterServiceImpl) RegisterPrinter(printer structs.Printer) (structs.Printer, error) {
+	if printer.NozzleMM == 0 {
+		printer.NozzleMM = DEFAULT_NOZZLE_MM
+	}
+	if printer.Status == "" {
+		printer.Status = "idle"
+	}
+
+	query := `
+		INSERT INTO printers (name, bed_x_mm, bed_y_mm, bed_z_mm, nozzle_mm, filament_colors, status, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE
+			printer_id = LAST_INSERT_ID(printer_id), bed_x_mm = VALUES(bed_x_mm), bed_y_mm = VALUES(bed_y_mm),
+			bed_z_mm = VALUES(bed_z_mm), nozzle_mm = VALUES(nozzle_mm), filament_colors = VALUES(filament_colors),
+			status = VALUES(status), last_seen_at = NOW()
+	`
+	result, err := ps.DB.Exec(
+		query,
+		printer.Name, printer.BedX, printer.BedY, printer.BedZ, printer.NozzleMM,
+		joinColors(normalizeColors(printer.FilamentColors)), printer.Status,
+	)
+	if err != nil {
+		return structs.Printer{}, fmt.Errorf("failed to register printer: %w", err)
+	}
+
+	printerID, err := result.LastInsertId()
+	if err != nil {
+		return structs.Printer{}, fmt.Errorf("failed to retrieve printer ID: %w", err)
+	}
+
+	return ps.GetPrinter(printerID)
+}
+
+// PrinterHeartbeat records a printer checking in along with any spool it has swapped
+func (ps *PrinterServiceImpl) PrinterHeartbeat(printerID int64, heartbeat structs.PrinterHeartbeat) (structs.Printer, error) {
+	var colors sql.NullString
+	if len(heartbeat.FilamentColors) > 0 {
+		colors = nullString(joinColors(normalizeColors(heartbeat.FilamentColors)))
+	}
+
+	query := `
+		UPDATE printers SET status = ?, filament_colors = COALESCE(?, filament_colors), last_seen_at = NOW()
+		WHERE printer_id = ?
+	`
+	if _, err := ps.DB.Exec(query, heartbeat.Status, colors, printerID); err != nil {
+		return structs.Printer{}, fmt.Errorf("failed to update printer: %w", err)
+	}
+
+	return ps.GetPrinter(printerID)
+}
+
+func (ps *PrinterServiceImpl) GetPrinter(printerID int64) (structs.Printer, error) {
+	query := printerQuery + ` WHERE printer_id = ?`
+	printer, err := scanPrinter(ps.DB.QueryRow(query, printerTimeoutSeconds(), printerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.Printer{}, ErrPrinterNotFound
+	}
+	if err != nil {
+		return structs.Printer{}, fmt.Errorf("failed to look up printer: %w", err)
+	}
+
+	return printer, nil
+}
+
+func (ps *PrinterServiceImpl) ListPrinters() ([]structs.Printer, error) {
+	rows, err := ps.DB.Query(printerQuery+` ORDER BY printer_id`, printerTimeoutSeconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list printers: %w", err)
+	}
+	defer rows.Close()
+
+	printers := []structs.Printer{}
+	for rows.Next() {
+		printer, err := scanPrinter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan printer: %w", err)
+		}
+		printers = append(printers, printer)
+	}
+
+	return printers, nil
+}
+
+// printerQuery reports printers that stopped checking in as offline, so they're neither
+// handed work nor counted on
+const printerQuery = `
+	SELECT printer_id, name, bed_x_mm, bed_y_mm, bed_z_mm, nozzle_mm, filament_colors,
+		IF(last_seen_at IS NULL OR last_seen_at < NOW() - INTERVAL ? SECOND, 'offline', status), last_seen_at
+	FROM printers
+`
+
+func printerTimeoutSeconds() int {
+	return int(PRINTER_TIMEOUT / time.Second)
+}
+
+type printerScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPrinter(row printerScanner) (structs.Printer, error) {
+	var printer structs.Printer
+	var colors string
+	var lastSeen sql.NullTime
+
+	err := row.Scan(
+		&printer.PrinterID, &printer.Name, &printer.BedX, &printer.BedY, &printer.BedZ, &printer.NozzleMM,
+		&colors, &printer.Status, &lastSeen,
+	)
+	if err != nil {
+		return structs.Printer{}, err
+	}
+
+	printer.FilamentColors = splitColors(colors)
+	if lastSeen.Valid {
+		printer.LastSeenAt = &lastSeen.Time
+	}
+
+	return printer, nil
+}
+
+// printRequirements is what a printer needs to take a job, sizes are the millimetre extents
+// of its largest file and colors every filament its markers are printed in
+type printRequirements struct {
+	width        float64
+	depth        float64
+	height       float64
+	colors       []string
+	printSeconds int
+}
+
+// jobRequirements measures a cart's files and looks up the filament each product prints in
+func (os *OrderServiceImpl) jobRequirements(tx *sql.Tx, ssid string, items []structs.CartItem) (printRequirements, error) {
+	var requirements printRequirements
+	colors := map[string]string{}
+	for _, item := range items {
+		filename := getFilenameFromURL(item.StlURL)
+		dir, err := getOutputDir(ssid, filename)
+		if err != nil {
+			return printRequirements{}, err
+		}
+
+		mesh := measureStlFile(dir + filename)
+		requirements.printSeconds += os.Scheduler.EstimatePrintSeconds(mesh, item.Quantity)
+		requirements.width = math.Max(requirements.width, mesh.Width)
+		requirements.depth = math.Max(requirements.depth, mesh.Depth)
+		requirements.height = math.Max(requirements.height, mesh.Height)
+
+		key := productKey(item)
+		if _, ok := colors[key]; ok {
+			continue
+		}
+
+		sizeVariant := item.SizeVariant
+		if sizeVariant == "" {
+			sizeVariant = DEFAULT_SIZE_VARIANT
+		}
+
+		var color sql.NullString
+		query := `SELECT filament_color FROM products WHERE template_type = ? AND size_variant = ?`
+		err = tx.QueryRow(query, item.TemplateType, sizeVariant).Scan(&color)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return printRequirements{}, fmt.Errorf("failed to look up filament color: %w", err)
+		}
+		colors[key] = color.String
+	}
+
+	var required []string
+	for _, color := range colors {
+		required = append(required, color)
+	}
+	requirements.colors = normalizeColors(required)
+
+	return requirements, nil
+}
+
+// hasColors reports whether a printer has every filament a job needs loaded
+func hasColors(printer structs.Printer, colors []string) bool {
+	loaded := normalizeColors(printer.FilamentColors)
+	for _, color := range colors {
+		if !slices.Contains(loaded, color) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeColor(color string) string {
+	return strings.ToLower(strings.TrimSpace(color))
+}
+
+// normalizeColors sorts and de-duplicates colors and drops blanks, a blank color prints in anything
+func normalizeColors(colors []string) []string {
+	normalized := []string{}
+	for _, color := range colors {
+		if color = normalizeColor(color); color != "" && !slices.Contains(normalized, color) {
+			normalized = append(normalized, color)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}
+
+func joinColors(colors []string) string {
+	return strings.Join(colors, ",")
+}
+
+func splitColors(colors string) []string {
+	if colors == "" {
+		return []string{}
+	}
+	return strings.Split(colors, ",")
+}
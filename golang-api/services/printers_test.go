@@ -0,0 +1,232 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPrinterService struct {
+	mock.Mock
+}
+
+func (m *MockPrinterService) RegisterPrinter(printer structs.Printer) (structs.Printer, error) {
+	args := m.Called(printer)
+	return args.Get(0).(structs.Printer), args.Error(1)
+}
+
+func (m *MockPrinterService) PrinterHeartbeat(printerID int64, heartbeat structs.PrinterHeartbeat) (structs.Printer, error) {
+	args := m.Called(printerID, heartbeat)
+	return args.Get(0).(structs.Printer), args.Error(1)
+}
+
+func (m *MockPrinterService) GetPrinter(printerID int64) (structs.Printer, error) {
+	args := m.Called(printerID)
+	return args.Get(0).(structs.Printer), args.Error(1)
+}
+
+func (m *MockPrinterService) ListPrinters() ([]structs.Printer, error) {
+	args := m.Called()
+	return args.Get(0).([]structs.Printer), args.Error(1)
+}
+
+var printerColumns = []string{
+	"printer_id", "name", "bed_x_mm", "bed_y_mm", "bed_z_mm", "nozzle_mm", "filament_colors", "status", "last_seen_at",
+}
+
+func TestRegisterPrinter(t *testing.T) {
+	seen := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc        string
+		printer     structs.Printer
+		mockDB      func(sqlmock.Sqlmock)
+		wantPrinter structs.Printer
+		wantErrMsg  string
+	}{
+		{
+			desc:    "colors are normalized and defaults filled in",
+			printer: structs.Printer{Name: "mk4-1", BedX: 250, BedY: 210, BedZ: 220, FilamentColors: []string{" White", "black", "white"}},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT INTO printers .* ON DUPLICATE KEY UPDATE printer_id = LAST_INSERT_ID\(printer_id\)`).
+					WithArgs("mk4-1", 250.0, 210.0, 220.0, 0.4, "black,white", "idle").
+					WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectQuery(`FROM printers WHERE printer_id = \?`).
+					WithArgs(300, int64(3)).
+					WillReturnRows(sqlmock.NewRows(printerColumns).AddRow(3, "mk4-1", 250, 210, 220, 0.4, "black,white", "idle", seen))
+			},
+			wantPrinter: structs.Printer{
+				PrinterID: 3, Name: "mk4-1", BedX: 250, BedY: 210, BedZ: 220, NozzleMM: 0.4,
+				FilamentColors: []string{"black", "white"}, Status: "idle", LastSeenAt: &seen,
+			},
+		},
+		{
+			desc:    "insert fails",
+			printer: structs.Printer{Name: "mk4-1", BedX: 250, BedY: 210, BedZ: 220, FilamentColors: []string{"white"}},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`INSERT INTO printers`).WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "failed to register printer: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			printer, err := NewPrinterService(db).RegisterPrinter(tt.printer)
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantPrinter, printer)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPrinterHeartbeat(t *testing.T) {
+	tests := []struct {
+		desc       string
+		heartbeat  structs.PrinterHeartbeat
+		mockDB     func(sqlmock.Sqlmock)
+		wantColors []string
+		wantErr    error
+	}{
+		{
+			desc:      "status only keeps the loaded spools",
+			heartbeat: structs.PrinterHeartbeat{Status: "printing"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE printers SET status = \?, filament_colors = COALESCE\(\?, filament_colors\), last_seen_at = NOW\(\)`).
+					WithArgs("printing", nil, int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`FROM printers WHERE printer_id = \?`).
+					WillReturnRows(sqlmock.NewRows(printerColumns).AddRow(3, "mk4-1", 250, 210, 220, 0.4, "white", "printing", nil))
+			},
+			wantColors: []string{"white"},
+		},
+		{
+			desc:      "spool change",
+			heartbeat: structs.PrinterHeartbeat{Status: "idle", FilamentColors: []string{"Glow"}},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE printers`).
+					WithArgs("idle", "glow", int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`FROM printers WHERE printer_id = \?`).
+					WillReturnRows(sqlmock.NewRows(printerColumns).AddRow(3, "mk4-1", 250, 210, 220, 0.4, "glow", "idle", nil))
+			},
+			wantColors: []string{"glow"},
+		},
+		{
+			desc:      "printer not found",
+			heartbeat: structs.PrinterHeartbeat{Status: "idle"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE printers`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`FROM printers WHERE printer_id = \?`).WillReturnRows(sqlmock.NewRows(printerColumns))
+			},
+			wantErr: ErrPrinterNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			printer, err := NewPrinterService(db).PrinterHeartbeat(3, tt.heartbeat)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantColors, printer.FilamentColors)
+				assert.Equal(t, tt.heartbeat.Status, printer.Status)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetPrinter(t *testing.T) {
+	seen := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	staleQuery := `IF\(last_seen_at IS NULL OR last_seen_at < NOW\(\) - INTERVAL \? SECOND, 'offline', status\), last_seen_at\s+FROM printers WHERE printer_id = \?`
+
+	tests := []struct {
+		desc       string
+		status     string
+		wantStatus string
+	}{
+		{
+			desc:       "printer checking in keeps its status",
+			status:     "printing",
+			wantStatus: "printing",
+		},
+		{
+			desc:       "printer that stopped checking in is offline",
+			status:     "offline",
+			wantStatus: "offline",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			// the status is worked out by the query, the row is what MySQL returns for it
+			mock.ExpectQuery(staleQuery).
+				WithArgs(300, int64(3)).
+				WillReturnRows(sqlmock.NewRows(printerColumns).AddRow(3, "mk4-1", 250, 210, 220, 0.4, "white", tt.status, seen))
+
+			printer, err := NewPrinterService(db).GetPrinter(3)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, printer.Status)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestHasColors(t *testing.T) {
+	printer := structs.Printer{FilamentColors: []string{"black", "White"}}
+
+	assert.True(t, hasColors(printer, []string{}))
+	assert.True(t, hasColors(printer, []string{"white"}))
+	assert.True(t, hasColors(printer, []string{"black", "white"}))
+	assert.False(t, hasColors(printer, []string{"glow", "white"}))
+}
+
+func TestNormalizeColors(t *testing.T) {
+	assert.Equal(t, []string{"black", "white"}, normalizeColors([]string{" White", "", "black", "WHITE"}))
+	assert.Equal(t, "black,white", joinColors(normalizeColors([]string{"white", "black"})))
+	assert.Equal(t, []string{}, splitColors(""))
+}
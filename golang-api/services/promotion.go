@@ -0,0 +1,479 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+const (
+	PROMO_PERCENT_OFF   = "percent_off"
+	PROMO_FIXED_OFF     = "fixed_off"
+	PROMO_FREE_SHIPPING = "free_shipping"
+)
+
+// every reason a code is turned away wraps ErrPromotionRejected, the messages are
+// written to be shown to the customer as is
+var (
+	ErrPromotionRejected      = errors.New("promo code cannot be applied")
+	ErrPromotionNotFound      = fmt.Errorf("%w: code is not valid", ErrPromotionRejected)
+	ErrPromotionExpired       = fmt.Errorf("%w: code is not active right now", ErrPromotionRejected)
+	ErrPromotionExhausted     = fmt.Errorf("%w: code has been fully redeemed", ErrPromotionRejected)
+	ErrPromotionAlreadyUsed   = fmt.Errorf("%w: code has already been used with this email", ErrPromotionRejected)
+	ErrPromotionNotEligible   = fmt.Errorf("%w: cart does not qualify for this code", ErrPromotionRejected)
+	ErrPromotionEmailRequired = fmt.Errorf("%w: an email is required to redeem a code", ErrPromotionRejected)
+	ErrInvalidPromotion       = errors.New("invalid promotion")
+)
+
+type PromotionServiceImpl struct {
+	DB      *sql.DB
+	Pricing PricingService
+}
+
+func NewPromotionService(db *sql.DB, pricing PricingService) PromotionService {
+	return &PromotionServiceImpl{DB: db, Pricing: pricing}
+}
+
+// promotionLine is a priced cart line, the discount rules only need its type and totals
+type promotionLine struct {
+	TemplateType string
+	Quantity     int
+	Amount       int64
+}
+
+const promotionColumns = `
+	p.promo_id, p.code, p.discount_type, p.discount_value, p.template_type, p.min_quantity,
+	p.starts_at, p.expires_at, p.max_redemptions, p.one_per_email, p.active,
+	(SELECT COUNT(*) FROM promotion_redemptions r WHERE r.promo_id = p.promo_id),
+	(SELECT GROUP_CONCAT(CONCAT(t.min_quantity, ':', t.discount_value) ORDER BY t.min_quantity)
+		FROM promotion_tiers t WHERE t.promo_id = p.promo_id)
+`
+
+// ApplyPromotion checks a code against its rules and the cart and returns the discount
+// in cents, shippingAmount is what the customer would otherwise pay for postage
+func (ps *PromotionServiceImpl) ApplyPromotion(code string, email string, cart []structs.CartItem, shippingAmount int64) (structs.Discount, error) {
+	email = normalizeEmail(email)
+	if email == "" {
+		return structs.Discount{}, ErrPromotionEmailRequired
+	}
+
+	query := `SELECT ` + promotionColumns + ` FROM promotions p WHERE p.code = ?`
+	promo, err := scanPromotion(ps.DB.QueryRow(query, normalizePromoCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return structs.Discount{}, ErrPromotionNotFound
+	}
+	if err != nil {
+		return structs.Discount{}, fmt.Errorf("failed to look up promotion: %w", err)
+	}
+
+	if !promo.Active {
+		return structs.Discount{}, ErrPromotionNotFound
+	}
+
+	now := time.Now()
+	if (promo.StartsAt != nil && promo.StartsAt.After(now)) || (promo.ExpiresAt != nil && !promo.ExpiresAt.After(now)) {
+		return structs.Discount{}, ErrPromotionExpired
+	}
+
+	if promo.MaxRedemptions != nil && promo.Redemptions >= *promo.MaxRedemptions {
+		return structs.Discount{}, ErrPromotionExhausted
+	}
+
+	if promo.OnePerEmail {
+		var used int
+		usedQuery := `SELECT COUNT(*) FROM promotion_redemptions WHERE promo_id = ? AND purchaser_email = ?`
+		if err := ps.DB.QueryRow(usedQuery, promo.PromotionID, email).Scan(&used); err != nil {
+			return structs.Discount{}, fmt.Errorf("failed to look up redemptions: %w", err)
+		}
+		if used > 0 {
+			return structs.Discount{}, ErrPromotionAlreadyUsed
+		}
+	}
+
+	lines := make([]promotionLine, 0, len(cart))
+	for _, item := range cart {
+		price, err := ps.Pricing.GetPrice(item.TemplateType, item.SizeVariant)
+		if err != nil {
+			return structs.Discount{}, err
+		}
+		lines = append(lines, promotionLine{
+			TemplateType: item.TemplateType,
+			Quantity:     item.Quantity,
+			Amount:       price.UnitAmount * int64(item.Quantity),
+		})
+	}
+
+	amount, err := calculateDiscount(promo, lines, shippingAmount)
+	if err != nil {
+		return structs.Discount{}, err
+	}
+
+	return structs.Discount{PromotionID: promo.PromotionID, Code: promo.Code, Amount: amount}, nil
+}
+
+// calculateDiscount applies a promotion's discount rule to the lines it targets
+func calculateDiscount(promo structs.Promotion, lines []promotionLine, shippingAmount int64) (int64, error) {
+	var eligibleAmount int64
+	var eligibleQuantity int
+	for _, line := range lines {
+		if promo.TemplateType != "" && line.TemplateType != promo.TemplateType {
+			continue
+		}
+		eligibleAmount += line.Amount
+		eligibleQuantity += line.Quantity
+	}
+
+	if eligibleQuantity == 0 || eligibleQuantity < promo.MinQuantity {
+		return 0, ErrPromotionNotEligible
+	}
+
+	value := promo.DiscountValue
+	if len(promo.Tiers) > 0 {
+		tier, ok := promotionTier(promo.Tiers, eligibleQuantity)
+		if !ok {
+			return 0, ErrPromotionNotEligible
+		}
+		value = tier.DiscountValue
+	}
+
+	switch promo.DiscountType {
+	case PROMO_PERCENT_OFF:
+		return eligibleAmount * value / 100, nil
+	case PROMO_FIXED_OFF:
+		return min(value, eligibleAmount), nil
+	case PROMO_FREE_SHIPPING:
+		return shippingAmount, nil
+	}
+
+	return 0, fmt.Errorf("%w: unknown discount type %q", ErrInvalidPromotion, promo.DiscountType)
+}
+
+// promotionTier picks the highest tier the quantity reaches
+func promotionTier(tiers []structs.PromotionTier, quantity int) (structs.PromotionTier, bool) {
+	var best structs.PromotionTier
+	found := false
+	for _, tier := range tiers {
+		if quantity >= tier.MinQuantity && (!found || tier.MinQuantity > best.MinQuantity) {
+			best = tier
+			found = true
+		}
+	}
+	return best, found
+}
+
+// RecordRedemption links the discount to the order inside its transaction, the promotion
+// row is locked so two orders can't both take the last redemption or reuse a one-per-email code
+func (ps *PromotionServiceImpl) RecordRedemption(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error {
+	email := normalizeEmail(orderInfo.Email)
+
+	var maxRedemptions sql.NullInt64
+	var onePerEmail bool
+	lockQuery := `SELECT max_redemptions, one_per_email FROM promotions WHERE promo_id = ? FOR UPDATE`
+	err := tx.QueryRow(lockQuery, orderInfo.PromotionID).Scan(&maxRedemptions, &onePerEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPromotionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock promotion: %w", err)
+	}
+
+	var redeemed, redeemedByEmail int64
+	countQuery := `SELECT COUNT(*), COALESCE(SUM(purchaser_email = ?), 0) FROM promotion_redemptions WHERE promo_id = ?`
+	if err := tx.QueryRow(countQuery, email, orderInfo.PromotionID).Scan(&redeemed, &redeemedByEmail); err != nil {
+		return fmt.Errorf("failed to count redemptions: %w", err)
+	}
+
+	if maxRedemptions.Valid && redeemed >= maxRedemptions.Int64 {
+		return ErrPromotionExhausted
+	}
+	if onePerEmail && redeemedByEmail > 0 {
+		return ErrPromotionAlreadyUsed
+	}
+
+	insertQuery := `INSERT INTO promotion_redemptions (promo_id, order_id, stripe_ssid, purchaser_email, discount_cents) VALUES (?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(insertQuery, orderInfo.PromotionID, orderID, orderInfo.PaymentIntentID, email, orderInfo.DiscountAmount); err != nil {
+		return fmt.Errorf("failed to insert promotion redemption: %w", err)
+	}
+
+	return nil
+}
+
+// AllocateDiscount spreads an order's discount over the lines the promotion targets in
+// proportion to their amounts, a free shipping discount belongs to postage and no line
+func (ps *PromotionServiceImpl) AllocateDiscount(tx *sql.Tx, promotionID int64, amount int64, items []structs.OrderItem) ([]structs.OrderItem, error) {
+	var discountType string
+	var templateType sql.NullString
+	query := `SELECT discount_type, template_type FROM promotions WHERE promo_id = ?`
+	err := tx.QueryRow(query, promotionID).Scan(&discountType, &templateType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return items, ErrPromotionNotFound
+	}
+	if err != nil {
+		return items, fmt.Errorf("failed to look up promotion: %w", err)
+	}
+
+	if discountType == PROMO_FREE_SHIPPING {
+		return items, nil
+	}
+
+	lines := make([]promotionLine, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, promotionLine{
+			TemplateType: item.TemplateType,
+			Quantity:     item.Quantity,
+			Amount:       item.UnitPrice * int64(item.Quantity),
+		})
+	}
+
+	for i, discount := range allocateDiscount(templateType.String, amount, lines) {
+		items[i].Discount = discount
+	}
+
+	return items, nil
+}
+
+// allocateDiscount splits amount across the eligible lines by their share of the eligible
+// total, the rounding remainder goes to the last eligible line so the parts add up exactly
+func allocateDiscount(templateType string, amount int64, lines []promotionLine) []int64 {
+	allocated := make([]int64, len(lines))
+
+	var eligibleAmount int64
+	last := -1
+	for i, line := range lines {
+		if templateType != "" && line.TemplateType != templateType {
+			continue
+		}
+		eligibleAmount += line.Amount
+		last = i
+	}
+	if last == -1 || eligibleAmount == 0 {
+		return allocated
+	}
+
+	remaining := amount
+	for i, line := range lines {
+		if templateType != "" && line.TemplateType != templateType {
+			continue
+		}
+		if i == last {
+			allocated[i] = remaining
+			break
+		}
+		allocated[i] = amount * line.Amount / eligibleAmount
+		remaining -= allocated[i]
+	}
+
+	return allocated
+}
+
+func (ps *PromotionServiceImpl) ListPromotions() ([]structs.Promotion, error) {
+	query := `SELECT ` + promotionColumns + ` FROM promotions p ORDER BY p.promo_id`
+	rows, err := ps.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list promotions: %w", err)
+	}
+	defer rows.Close()
+
+	promotions := []structs.Promotion{}
+	for rows.Next() {
+		promo, err := scanPromotion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan promotion: %w", err)
+		}
+		promotions = append(promotions, promo)
+	}
+
+	return promotions, nil
+}
+
+func (ps *PromotionServiceImpl) CreatePromotion(promo structs.Promotion) (int64, error) {
+	promo.Code = normalizePromoCode(promo.Code)
+	if promo.Code == "" {
+		return -1, fmt.Errorf("%w: code is required", ErrInvalidPromotion)
+	}
+
+	// the lowest tier doubles as the promotion's own threshold and discount
+	if len(promo.Tiers) > 0 {
+		if promo.DiscountType == PROMO_FREE_SHIPPING {
+			return -1, fmt.Errorf("%w: free shipping has no tiers", ErrInvalidPromotion)
+		}
+		sort.Slice(promo.Tiers, func(i, j int) bool { return promo.Tiers[i].MinQuantity < promo.Tiers[j].MinQuantity })
+		for i, tier := range promo.Tiers {
+			if tier.MinQuantity <= 0 {
+				return -1, fmt.Errorf("%w: tier quantities must be positive", ErrInvalidPromotion)
+			}
+			if i > 0 && tier.MinQuantity == promo.Tiers[i-1].MinQuantity {
+				return -1, fmt.Errorf("%w: two tiers start at %d", ErrInvalidPromotion, tier.MinQuantity)
+			}
+			if err := validateDiscountValue(promo.DiscountType, tier.DiscountValue); err != nil {
+				return -1, err
+			}
+		}
+		promo.MinQuantity = promo.Tiers[0].MinQuantity
+		promo.DiscountValue = promo.Tiers[0].DiscountValue
+	}
+
+	if promo.DiscountType == PROMO_FREE_SHIPPING {
+		promo.DiscountValue = 0
+	}
+	if err := validateDiscountValue(promo.DiscountType, promo.DiscountValue); err != nil {
+		return -1, err
+	}
+
+	if promo.StartsAt != nil && promo.ExpiresAt != nil && !promo.ExpiresAt.After(*promo.StartsAt) {
+		return -1, fmt.Errorf("%w: expiry must be after the start", ErrInvalidPromotion)
+	}
+
+	if promo.MinQuantity <= 0 {
+		promo.MinQuantity = 1
+	}
+
+	var templateType sql.NullString
+	if promo.TemplateType != "" {
+		templateType = sql.NullString{String: promo.TemplateType, Valid: true}
+	}
+
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return -1, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO promotions (
+			code, discount_type, discount_value, template_type, min_quantity,
+			starts_at, expires_at, max_redemptions, one_per_email, active
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := tx.Exec(
+		query,
+		promo.Code, promo.DiscountType, promo.DiscountValue, templateType, promo.MinQuantity,
+		promo.StartsAt, promo.ExpiresAt, promo.MaxRedemptions, promo.OnePerEmail, promo.Active,
+	)
+	if err != nil {
+		return -1, fmt.Errorf("failed to insert promotion: %w", err)
+	}
+
+	promoID, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("failed to retrieve promotion ID: %w", err)
+	}
+
+	tierQuery := `INSERT INTO promotion_tiers (promo_id, min_quantity, discount_value) VALUES (?, ?, ?)`
+	for _, tier := range promo.Tiers {
+		if _, err := tx.Exec(tierQuery, promoID, tier.MinQuantity, tier.DiscountValue); err != nil {
+			return -1, fmt.Errorf("failed to insert promotion tier: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return promoID, nil
+}
+
+func validateDiscountValue(discountType string, value int64) error {
+	switch discountType {
+	case PROMO_PERCENT_OFF:
+		if value <= 0 || value > 100 {
+			return fmt.Errorf("%w: percent off must be between 1 and 100", ErrInvalidPromotion)
+		}
+	case PROMO_FIXED_OFF:
+		if value <= 0 {
+			return fmt.Errorf("%w: fixed off must be a positive amount", ErrInvalidPromotion)
+		}
+	case PROMO_FREE_SHIPPING:
+	default:
+		return fmt.Errorf("%w: unknown discount type %q", ErrInvalidPromotion, discountType)
+	}
+	return nil
+}
+
+func (ps *PromotionServiceImpl) SetPromotionActive(promoID int64, active bool) error {
+	query := `UPDATE promotions SET active = ? WHERE promo_id = ?`
+	result, err := ps.DB.Exec(query, active, promoID)
+	if err != nil {
+		return fmt.Errorf("failed to update promotion: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to read affected rows: %w", err)
+	}
+	if affected == 0 {
+		return ErrPromotionNotFound
+	}
+
+	return nil
+}
+
+type promotionScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPromotion(row promotionScanner) (structs.Promotion, error) {
+	var promo structs.Promotion
+	var templateType sql.NullString
+	var startsAt, expiresAt sql.NullTime
+	var maxRedemptions sql.NullInt64
+	var tiers sql.NullString
+
+	err := row.Scan(
+		&promo.PromotionID, &promo.Code, &promo.DiscountType, &promo.DiscountValue, &templateType, &promo.MinQuantity,
+		&startsAt, &expiresAt, &maxRedemptions, &promo.OnePerEmail, &promo.Active, &promo.Redemptions, &tiers,
+	)
+	if err != nil {
+		return structs.Promotion{}, err
+	}
+
+	if tiers.Valid {
+		promo.Tiers, err = parsePromotionTiers(tiers.String)
+		if err != nil {
+			return structs.Promotion{}, err
+		}
+	}
+
+	promo.TemplateType = templateType.String
+	if startsAt.Valid {
+		promo.StartsAt = &startsAt.Time
+	}
+	if expiresAt.Valid {
+		promo.ExpiresAt = &expiresAt.Time
+	}
+	if maxRedemptions.Valid {
+		limit := int(maxRedemptions.Int64)
+		promo.MaxRedemptions = &limit
+	}
+
+	return promo, nil
+}
+
+// parsePromotionTiers reads the quantity:discount pairs promotionColumns concatenates
+func parsePromotionTiers(value string) ([]structs.PromotionTier, error) {
+	var tiers []structs.PromotionTier
+	for _, pair := range strings.Split(value, ",") {
+		quantity, discount, found := strings.Cut(pair, ":")
+		minQuantity, errQuantity := strconv.Atoi(quantity)
+		discountValue, errDiscount := strconv.ParseInt(discount, 10, 64)
+		if !found || errQuantity != nil || errDiscount != nil {
+			return nil, fmt.Errorf("%w: malformed tier %q", ErrInvalidPromotion, pair)
+		}
+		tiers = append(tiers, structs.PromotionTier{MinQuantity: minQuantity, DiscountValue: discountValue})
+	}
+	return tiers, nil
+}
+
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,633 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPromotionService struct {
+	mock.Mock
+}
+
+func (m *MockPromotionService) ApplyPromotion(code string, email string, cart []structs.CartItem, shippingAmount int64) (structs.Discount, error) {
+	args := m.Called(code, email, cart, shippingAmount)
+	return args.Get(0).(structs.Discount), args.Error(1)
+}
+
+func (m *MockPromotionService) RecordRedemption(tx *sql.Tx, orderID int64, orderInfo *structs.OrderInfo) error {
+	return m.Called(tx, orderID, orderInfo).Error(0)
+}
+
+func (m *MockPromotionService) AllocateDiscount(tx *sql.Tx, promotionID int64, amount int64, items []structs.OrderItem) ([]structs.OrderItem, error) {
+	args := m.Called(tx, promotionID, amount, items)
+	return args.Get(0).([]structs.OrderItem), args.Error(1)
+}
+
+func (m *MockPromotionService) ListPromotions() ([]structs.Promotion, error) {
+	args := m.Called()
+	return args.Get(0).([]structs.Promotion), args.Error(1)
+}
+
+func (m *MockPromotionService) CreatePromotion(promo structs.Promotion) (int64, error) {
+	args := m.Called(promo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockPromotionService) SetPromotionActive(promoID int64, active bool) error {
+	return m.Called(promoID, active).Error(0)
+}
+
+var promotionTableColumns = []string{
+	"promo_id", "code", "discount_type", "discount_value", "template_type", "min_quantity",
+	"starts_at", "expires_at", "max_redemptions", "one_per_email", "active", "redemptions", "tiers",
+}
+
+func TestCalculateDiscount(t *testing.T) {
+	lines := []promotionLine{
+		{TemplateType: "solid", Quantity: 2, Amount: 2 * 1499},
+		{TemplateType: "text", Quantity: 1, Amount: 1899},
+	}
+
+	tests := []struct {
+		desc     string
+		promo    structs.Promotion
+		shipping int64
+		want     int64
+		wantErr  error
+	}{
+		{
+			desc:  "percent off whole cart",
+			promo: structs.Promotion{DiscountType: PROMO_PERCENT_OFF, DiscountValue: 10},
+			want:  489,
+		},
+		{
+			desc:  "percent off one template type",
+			promo: structs.Promotion{DiscountType: PROMO_PERCENT_OFF, DiscountValue: 50, TemplateType: "text"},
+			want:  949,
+		},
+		{
+			desc:  "fixed off",
+			promo: structs.Promotion{DiscountType: PROMO_FIXED_OFF, DiscountValue: 500},
+			want:  500,
+		},
+		{
+			desc:  "fixed off capped at eligible lines",
+			promo: structs.Promotion{DiscountType: PROMO_FIXED_OFF, DiscountValue: 5000, TemplateType: "text"},
+			want:  1899,
+		},
+		{
+			desc:     "free shipping",
+			promo:    structs.Promotion{DiscountType: PROMO_FREE_SHIPPING},
+			shipping: 695,
+			want:     695,
+		},
+		{
+			desc:  "quantity tier reached",
+			promo: structs.Promotion{DiscountType: PROMO_PERCENT_OFF, DiscountValue: 20, MinQuantity: 3},
+			want:  979,
+		},
+		{
+			desc:    "quantity tier not reached",
+			promo:   structs.Promotion{DiscountType: PROMO_PERCENT_OFF, DiscountValue: 20, MinQuantity: 3, TemplateType: "solid"},
+			wantErr: ErrPromotionNotEligible,
+		},
+		{
+			desc:    "no lines of the promoted type",
+			promo:   structs.Promotion{DiscountType: PROMO_PERCENT_OFF, DiscountValue: 20, TemplateType: "custom"},
+			wantErr: ErrPromotionNotEligible,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := calculateDiscount(tt.promo, lines, tt.shipping)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCalculateDiscountTiers(t *testing.T) {
+	tiers := []structs.PromotionTier{{MinQuantity: 3, DiscountValue: 10}, {MinQuantity: 5, DiscountValue: 20}, {MinQuantity: 10, DiscountValue: 30}}
+
+	tests := []struct {
+		desc     string
+		promo    structs.Promotion
+		quantity int
+		want     int64
+		wantErr  error
+	}{
+		{
+			desc:     "below the first tier",
+			promo:    structs.Promotion{DiscountType: PROMO_PERCENT_OFF, MinQuantity: 3, Tiers: tiers},
+			quantity: 2,
+			wantErr:  ErrPromotionNotEligible,
+		},
+		{
+			desc:     "first tier boundary",
+			promo:    structs.Promotion{DiscountType: PROMO_PERCENT_OFF, MinQuantity: 3, Tiers: tiers},
+			quantity: 3,
+			want:     300,
+		},
+		{
+			desc:     "just below the second tier",
+			promo:    structs.Promotion{DiscountType: PROMO_PERCENT_OFF, MinQuantity: 3, Tiers: tiers},
+			quantity: 4,
+			want:     400,
+		},
+		{
+			desc:     "second tier boundary",
+			promo:    structs.Promotion{DiscountType: PROMO_PERCENT_OFF, MinQuantity: 3, Tiers: tiers},
+			quantity: 5,
+			want:     1000,
+		},
+		{
+			desc:     "just below the top tier",
+			promo:    structs.Promotion{DiscountType: PROMO_PERCENT_OFF, MinQuantity: 3, Tiers: tiers},
+			quantity: 9,
+			want:     1800,
+		},
+		{
+			desc:     "top tier boundary",
+			promo:    structs.Promotion{DiscountType: PROMO_PERCENT_OFF, MinQuantity: 3, Tiers: tiers},
+			quantity: 10,
+			want:     3000,
+		},
+		{
+			desc:     "beyond the top tier",
+			promo:    structs.Promotion{DiscountType: PROMO_PERCENT_OFF, MinQuantity: 3, Tiers: tiers},
+			quantity: 25,
+			want:     7500,
+		},
+		{
+			desc:     "fixed off tiers",
+			promo:    structs.Promotion{DiscountType: PROMO_FIXED_OFF, MinQuantity: 3, Tiers: []structs.PromotionTier{{MinQuantity: 3, DiscountValue: 200}, {MinQuantity: 6, DiscountValue: 500}}},
+			quantity: 6,
+			want:     500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			// ten dollars a unit keeps the percentages readable
+			lines := []promotionLine{{TemplateType: "solid", Quantity: tt.quantity, Amount: int64(tt.quantity) * 1000}}
+			got, err := calculateDiscount(tt.promo, lines, 0)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCreatePromotion(t *testing.T) {
+	tests := []struct {
+		desc    string
+		promo   structs.Promotion
+		mockDB  func(sqlmock.Sqlmock)
+		wantID  int64
+		wantErr error
+	}{
+		{
+			desc: "tiers are stored lowest first",
+			promo: structs.Promotion{
+				Code:         " bulk ",
+				DiscountType: PROMO_PERCENT_OFF,
+				Tiers:        []structs.PromotionTier{{MinQuantity: 10, DiscountValue: 20}, {MinQuantity: 4, DiscountValue: 10}},
+				Active:       true,
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO promotions`).
+					WithArgs("BULK", PROMO_PERCENT_OFF, int64(10), nil, 4, nil, nil, nil, false, true).
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectExec(`INSERT INTO promotion_tiers \(promo_id, min_quantity, discount_value\) VALUES \(\?, \?, \?\)`).
+					WithArgs(int64(7), 4, int64(10)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`INSERT INTO promotion_tiers`).
+					WithArgs(int64(7), 10, int64(20)).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+			},
+			wantID: 7,
+		},
+		{
+			desc:  "untiered promotion",
+			promo: structs.Promotion{Code: "FORE10", DiscountType: PROMO_PERCENT_OFF, DiscountValue: 10},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO promotions`).
+					WithArgs("FORE10", PROMO_PERCENT_OFF, int64(10), nil, 1, nil, nil, nil, false, false).
+					WillReturnResult(sqlmock.NewResult(8, 1))
+				mock.ExpectCommit()
+			},
+			wantID: 8,
+		},
+		{
+			desc: "tier over 100 percent",
+			promo: structs.Promotion{
+				Code:         "BULK",
+				DiscountType: PROMO_PERCENT_OFF,
+				Tiers:        []structs.PromotionTier{{MinQuantity: 4, DiscountValue: 10}, {MinQuantity: 10, DiscountValue: 120}},
+			},
+			mockDB:  func(mock sqlmock.Sqlmock) {},
+			wantErr: ErrInvalidPromotion,
+		},
+		{
+			desc: "duplicate tier",
+			promo: structs.Promotion{
+				Code:         "BULK",
+				DiscountType: PROMO_FIXED_OFF,
+				Tiers:        []structs.PromotionTier{{MinQuantity: 4, DiscountValue: 100}, {MinQuantity: 4, DiscountValue: 200}},
+			},
+			mockDB:  func(mock sqlmock.Sqlmock) {},
+			wantErr: ErrInvalidPromotion,
+		},
+		{
+			desc: "free shipping can't be tiered",
+			promo: structs.Promotion{
+				Code:         "SHIPFREE",
+				DiscountType: PROMO_FREE_SHIPPING,
+				Tiers:        []structs.PromotionTier{{MinQuantity: 4, DiscountValue: 100}},
+			},
+			mockDB:  func(mock sqlmock.Sqlmock) {},
+			wantErr: ErrInvalidPromotion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+			tt.mockDB(mock)
+
+			service := NewPromotionService(db, new(MockPricingService))
+			promoID, err := service.CreatePromotion(tt.promo)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantID, promoID)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestAllocateDiscount(t *testing.T) {
+	lines := []promotionLine{
+		{TemplateType: "solid", Quantity: 2, Amount: 2 * 1499},
+		{TemplateType: "text", Quantity: 1, Amount: 1899},
+		{TemplateType: "solid", Quantity: 1, Amount: 1499},
+	}
+
+	tests := []struct {
+		desc         string
+		templateType string
+		amount       int64
+		want         []int64
+	}{
+		{
+			desc:   "split across every line",
+			amount: 639,
+			want:   []int64{299, 189, 151},
+		},
+		{
+			desc:         "only lines of the promoted type",
+			templateType: "solid",
+			amount:       449,
+			want:         []int64{299, 0, 150},
+		},
+		{
+			desc:         "no lines of the promoted type",
+			templateType: "custom",
+			amount:       500,
+			want:         []int64{0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.want, allocateDiscount(tt.templateType, tt.amount, lines))
+		})
+	}
+}
+
+func TestAllocateDiscountForPromotion(t *testing.T) {
+	items := func() []structs.OrderItem {
+		return []structs.OrderItem{
+			{TemplateType: "solid", Quantity: 2, UnitPrice: 1499},
+			{TemplateType: "text", Quantity: 1, UnitPrice: 1899},
+		}
+	}
+
+	tests := []struct {
+		desc          string
+		mockDB        func(sqlmock.Sqlmock)
+		wantDiscounts []int64
+		wantErr       error
+	}{
+		{
+			desc: "targeted promotion",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT discount_type, template_type FROM promotions WHERE promo_id = \?`).
+					WithArgs(int64(7)).
+					WillReturnRows(sqlmock.NewRows([]string{"discount_type", "template_type"}).AddRow(PROMO_PERCENT_OFF, "text"))
+			},
+			wantDiscounts: []int64{0, 400},
+		},
+		{
+			desc: "free shipping leaves the lines alone",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT discount_type, template_type FROM promotions`).
+					WillReturnRows(sqlmock.NewRows([]string{"discount_type", "template_type"}).AddRow(PROMO_FREE_SHIPPING, nil))
+			},
+			wantDiscounts: []int64{0, 0},
+		},
+		{
+			desc: "promotion deleted",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT discount_type, template_type FROM promotions`).
+					WillReturnRows(sqlmock.NewRows([]string{"discount_type", "template_type"}))
+			},
+			wantErr: ErrPromotionNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			tt.mockDB(mock)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf("failed to begin transaction: %v", err)
+			}
+
+			service := NewPromotionService(db, new(MockPricingService))
+			got, err := service.AllocateDiscount(tx, 7, 400, items())
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				for i, item := range got {
+					assert.Equal(t, tt.wantDiscounts[i], item.Discount)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestApplyPromotion(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	cart := []structs.CartItem{{Quantity: 2, TemplateType: "solid"}}
+
+	tests := []struct {
+		desc       string
+		email      string
+		mockDB     func(sqlmock.Sqlmock)
+		wantAmount int64
+		wantErr    error
+	}{
+		{
+			desc:  "valid code",
+			email: "golfer@example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM promotions p WHERE p.code = \?`).
+					WithArgs("FORE10").
+					WillReturnRows(sqlmock.NewRows(promotionTableColumns).
+						AddRow(1, "FORE10", PROMO_PERCENT_OFF, 10, nil, 1, past, future, 100, false, true, 3, nil))
+			},
+			wantAmount: 299,
+		},
+		{
+			desc:  "tiered code takes the tier the cart reaches",
+			email: "golfer@example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM promotion_tiers t WHERE t.promo_id = p.promo_id\) FROM promotions p WHERE p.code = \?`).
+					WithArgs("FORE10").
+					WillReturnRows(sqlmock.NewRows(promotionTableColumns).
+						AddRow(1, "FORE10", PROMO_PERCENT_OFF, 15, nil, 2, nil, nil, nil, false, true, 0, "2:15,5:25"))
+			},
+			wantAmount: 449,
+		},
+		{
+			desc:    "email required",
+			mockDB:  func(mock sqlmock.Sqlmock) {},
+			wantErr: ErrPromotionEmailRequired,
+		},
+		{
+			desc:  "unknown code",
+			email: "golfer@example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM promotions p`).WillReturnRows(sqlmock.NewRows(promotionTableColumns))
+			},
+			wantErr: ErrPromotionNotFound,
+		},
+		{
+			desc:  "inactive code",
+			email: "golfer@example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM promotions p`).
+					WillReturnRows(sqlmock.NewRows(promotionTableColumns).
+						AddRow(1, "FORE10", PROMO_PERCENT_OFF, 10, nil, 1, nil, nil, nil, false, false, 0, nil))
+			},
+			wantErr: ErrPromotionNotFound,
+		},
+		{
+			desc:  "expired code",
+			email: "golfer@example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM promotions p`).
+					WillReturnRows(sqlmock.NewRows(promotionTableColumns).
+						AddRow(1, "FORE10", PROMO_PERCENT_OFF, 10, nil, 1, nil, past, nil, false, true, 0, nil))
+			},
+			wantErr: ErrPromotionExpired,
+		},
+		{
+			desc:  "max redemptions reached",
+			email: "golfer@example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM promotions p`).
+					WillReturnRows(sqlmock.NewRows(promotionTableColumns).
+						AddRow(1, "FORE10", PROMO_PERCENT_OFF, 10, nil, 1, nil, nil, 5, false, true, 5, nil))
+			},
+			wantErr: ErrPromotionExhausted,
+		},
+		{
+			desc:  "one per email already used",
+			email: "Golfer@Example.com",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM promotions p`).
+					WillReturnRows(sqlmock.NewRows(promotionTableColumns).
+						AddRow(1, "COURSE", PROMO_FIXED_OFF, 500, nil, 1, nil, nil, nil, true, true, 1, nil))
+				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM promotion_redemptions WHERE promo_id = \? AND purchaser_email = \?`).
+					WithArgs(1, "golfer@example.com").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			},
+			wantErr: ErrPromotionAlreadyUsed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+			pricing := new(MockPricingService)
+			pricing.On("GetPrice", "solid", "").Return(structs.Price{PriceID: 1, UnitAmount: 1499}, nil)
+
+			service := NewPromotionService(db, pricing)
+			discount, err := service.ApplyPromotion(" fore10 ", tt.email, cart, 0)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.ErrorIs(t, err, ErrPromotionRejected)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantAmount, discount.Amount)
+				assert.Equal(t, int64(1), discount.PromotionID)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRecordRedemption(t *testing.T) {
+	orderInfo := &structs.OrderInfo{
+		PaymentIntentID: "pi_123",
+		Email:           "Golfer@Example.com",
+		PromotionID:     1,
+		DiscountAmount:  500,
+	}
+
+	tests := []struct {
+		desc       string
+		mockDB     func(sqlmock.Sqlmock)
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			desc: "redemption recorded",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT max_redemptions, one_per_email FROM promotions WHERE promo_id = \? FOR UPDATE`).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"max_redemptions", "one_per_email"}).AddRow(10, true))
+				mock.ExpectQuery(`FROM promotion_redemptions WHERE promo_id = \?`).
+					WithArgs("golfer@example.com", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"count", "by_email"}).AddRow(9, 0))
+				mock.ExpectExec(`INSERT INTO promotion_redemptions`).
+					WithArgs(1, 42, "pi_123", "golfer@example.com", 500).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			desc: "last redemption taken by a concurrent order",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FOR UPDATE`).
+					WillReturnRows(sqlmock.NewRows([]string{"max_redemptions", "one_per_email"}).AddRow(10, false))
+				mock.ExpectQuery(`FROM promotion_redemptions`).
+					WillReturnRows(sqlmock.NewRows([]string{"count", "by_email"}).AddRow(10, 0))
+			},
+			wantErr: ErrPromotionExhausted,
+		},
+		{
+			desc: "email redeemed by a concurrent order",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FOR UPDATE`).
+					WillReturnRows(sqlmock.NewRows([]string{"max_redemptions", "one_per_email"}).AddRow(nil, true))
+				mock.ExpectQuery(`FROM promotion_redemptions`).
+					WillReturnRows(sqlmock.NewRows([]string{"count", "by_email"}).AddRow(3, 1))
+			},
+			wantErr: ErrPromotionAlreadyUsed,
+		},
+		{
+			desc: "insert fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FOR UPDATE`).
+					WillReturnRows(sqlmock.NewRows([]string{"max_redemptions", "one_per_email"}).AddRow(nil, false))
+				mock.ExpectQuery(`FROM promotion_redemptions`).
+					WillReturnRows(sqlmock.NewRows([]string{"count", "by_email"}).AddRow(0, 0))
+				mock.ExpectExec(`INSERT INTO promotion_redemptions`).WillReturnError(errors.New("duplicate key"))
+			},
+			wantErrMsg: "failed to insert promotion redemption",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			tt.mockDB(mock)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf("failed to begin transaction: %v", err)
+			}
+
+			service := NewPromotionService(db, new(MockPricingService))
+			err = service.RecordRedemption(tx, 42, orderInfo)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+			default:
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+const (
+	RATE_STRATEGY_CHEAPEST          = "cheapest"
+	RATE_STRATEGY_FASTEST           = "fastest"
+	RATE_STRATEGY_PREFERRED_CARRIER = "preferred_carrier"
+	RATE_STRATEGY_MAX_DELIVERY_DAYS = "max_delivery_days"
+	RATE_STRATEGY_SERVICE           = "service"
+)
+
+var (
+	ErrNoMatchingRate      = errors.New("no shipping rate matches the rate policy")
+	ErrUnknownRateStrategy = errors.New("unknown rate strategy")
+)
+
+// RateSelector picks which of a shipment's rates the label is bought with
+type RateSelector interface {
+	SelectRate(rates []*easypost.Rate) (*easypost.Rate, error)
+}
+
+// NewRateSelector builds the selector for an order's rate policy, an empty strategy is cheapest
+func NewRateSelector(policy structs.RatePolicy) (RateSelector, error) {
+	switch policy.Strategy {
+	case "", RATE_STRATEGY_CHEAPEST:
+		return CheapestRate{}, nil
+	case RATE_STRATEGY_FASTEST:
+		return FastestRate{MaxAmount: policy.MaxAmount}, nil
+	case RATE_STRATEGY_PREFERRED_CARRIER:
+		if len(policy.Carriers) == 0 {
+			return nil, fmt.Errorf("%s needs at least one carrier", RATE_STRATEGY_PREFERRED_CARRIER)
+		}
+		return PreferredCarrierRate{Carriers: policy.Carriers}, nil
+	case RATE_STRATEGY_MAX_DELIVERY_DAYS:
+		if policy.MaxDeliveryDays <= 0 {
+			return nil, fmt.Errorf("%s needs a number of days", RATE_STRATEGY_MAX_DELIVERY_DAYS)
+		}
+		return MaxDeliveryDaysRate{Days: policy.MaxDeliveryDays}, nil
+	case RATE_STRATEGY_SERVICE:
+		if policy.Service == "" {
+			return nil, fmt.Errorf("%s needs a service", RATE_STRATEGY_SERVICE)
+		}
+		return ServiceRate{Carrier: policy.Carrier, Service: policy.Service}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownRateStrategy, policy.Strategy)
+	}
+}
+
+// CheapestRate picks the lowest priced rate
+type CheapestRate struct{}
+
+func (CheapestRate) SelectRate(rates []*easypost.Rate) (*easypost.Rate, error) {
+	return cheapest(rates, func(*easypost.Rate) bool { return true })
+}
+
+// FastestRate picks the rate with the fewest estimated delivery days that costs no more than
+// MaxAmount cents, ties go to the cheaper rate. Rates without an estimate are never fastest
+type FastestRate struct {
+	MaxAmount int64
+}
+
+func (f FastestRate) SelectRate(rates []*easypost.Rate) (*easypost.Rate, error) {
+	var best *easypost.Rate
+	var bestAmount int64
+	for _, rate := range rates {
+		amount, err := rateToCents(rate.Rate)
+		if err != nil {
+			return nil, err
+		}
+		if rate.EstDeliveryDays <= 0 || (f.MaxAmount > 0 && amount > f.MaxAmount) {
+			continue
+		}
+
+		if best == nil || rate.EstDeliveryDays < best.EstDeliveryDays ||
+			(rate.EstDeliveryDays == best.EstDeliveryDays && amount < bestAmount) {
+			best, bestAmount = rate, amount
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoMatchingRate
+	}
+	return best, nil
+}
+
+// PreferredCarrierRate picks the cheapest rate of the first carrier in Carriers that has one
+type PreferredCarrierRate struct {
+	Carriers []string
+}
+
+func (p PreferredCarrierRate) SelectRate(rates []*easypost.Rate) (*easypost.Rate, error) {
+	for _, carrier := range p.Carriers {
+		rate, err := cheapest(rates, func(rate *easypost.Rate) bool {
+			return strings.EqualFold(rate.Carrier, carrier)
+		})
+		if errors.Is(err, ErrNoMatchingRate) {
+			continue
+		}
+		return rate, err
+	}
+
+	return nil, ErrNoMatchingRate
+}
+
+// MaxDeliveryDaysRate picks the cheapest rate estimated to arrive within Days
+type MaxDeliveryDaysRate struct {
+	Days int
+}
+
+func (m MaxDeliveryDaysRate) SelectRate(rates []*easypost.Rate) (*easypost.Rate, error) {
+	return cheapest(rates, func(rate *easypost.Rate) bool {
+		return rate.EstDeliveryDays > 0 && rate.EstDeliveryDays <= m.Days
+	})
+}
+
+// ServiceRate picks the service the customer asked for, e.g. USPS Express. Carrier may be
+// left empty when the service name is enough to tell the rates apart
+type ServiceRate struct {
+	Carrier string
+	Service string
+}
+
+func (s ServiceRate) SelectRate(rates []*easypost.Rate) (*easypost.Rate, error) {
+	return cheapest(rates, func(rate *easypost.Rate) bool {
+		return strings.EqualFold(rate.Service, s.Service) &&
+			(s.Carrier == "" || strings.EqualFold(rate.Carrier, s.Carrier))
+	})
+}
+
+// cheapest returns the lowest priced rate that matches, or ErrNoMatchingRate
+func cheapest(rates []*easypost.Rate, matches func(*easypost.Rate) bool) (*easypost.Rate, error) {
+	var best *easypost.Rate
+	var bestAmount int64
+	for _, rate := range rates {
+		if !matches(rate) {
+			continue
+		}
+
+		amount, err := rateToCents(rate.Rate)
+		if err != nil {
+			return nil, err
+		}
+		if best == nil || amount < bestAmount {
+			best, bestAmount = rate, amount
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoMatchingRate
+	}
+	return best, nil
+}
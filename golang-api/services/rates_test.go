@@ -0,0 +1,175 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRates is a typical spread of rates for one parcel, the USPS Priority and UPS Ground
+// rates arrive on the same day so ties can be checked
+func fakeRates() []*easypost.Rate {
+	return []*easypost.Rate{
+		{ID: "rate_usps_ground", Carrier: "USPS", Service: "GroundAdvantage", Rate: "5.10", EstDeliveryDays: 5},
+		{ID: "rate_usps_priority", Carrier: "USPS", Service: "Priority", Rate: "9.45", EstDeliveryDays: 2},
+		{ID: "rate_usps_express", Carrier: "USPS", Service: "Express", Rate: "31.20", EstDeliveryDays: 1},
+		{ID: "rate_ups_ground", Carrier: "UPS", Service: "Ground", Rate: "11.80", EstDeliveryDays: 2},
+		{ID: "rate_ups_next_day", Carrier: "UPS", Service: "NextDayAir", Rate: "45.00", EstDeliveryDays: 1},
+		{ID: "rate_fedex_economy", Carrier: "FedEx", Service: "Economy", Rate: "7.25", EstDeliveryDays: 0},
+	}
+}
+
+func TestSelectRate(t *testing.T) {
+	tests := []struct {
+		desc     string
+		policy   structs.RatePolicy
+		rates    []*easypost.Rate
+		wantRate string
+		wantErr  error
+	}{
+		{
+			desc:     "default policy is cheapest",
+			policy:   structs.RatePolicy{},
+			rates:    fakeRates(),
+			wantRate: "rate_usps_ground",
+		},
+		{
+			desc:     "cheapest",
+			policy:   structs.RatePolicy{Strategy: RATE_STRATEGY_CHEAPEST},
+			rates:    fakeRates(),
+			wantRate: "rate_usps_ground",
+		},
+		{
+			desc:     "fastest without a budget takes the cheaper of the next day rates",
+			policy:   structs.RatePolicy{Strategy: RATE_STRATEGY_FASTEST},
+			rates:    fakeRates(),
+			wantRate: "rate_usps_express",
+		},
+		{
+			desc:     "fastest within budget",
+			policy:   structs.RatePolicy{Strategy: RATE_STRATEGY_FASTEST, MaxAmount: 1500},
+			rates:    fakeRates(),
+			wantRate: "rate_usps_priority",
+		},
+		{
+			desc:    "nothing within budget",
+			policy:  structs.RatePolicy{Strategy: RATE_STRATEGY_FASTEST, MaxAmount: 400},
+			rates:   fakeRates(),
+			wantErr: ErrNoMatchingRate,
+		},
+		{
+			desc:     "first preferred carrier with a rate wins",
+			policy:   structs.RatePolicy{Strategy: RATE_STRATEGY_PREFERRED_CARRIER, Carriers: []string{"DHL", "ups", "USPS"}},
+			rates:    fakeRates(),
+			wantRate: "rate_ups_ground",
+		},
+		{
+			desc:    "no preferred carrier rated the parcel",
+			policy:  structs.RatePolicy{Strategy: RATE_STRATEGY_PREFERRED_CARRIER, Carriers: []string{"DHL"}},
+			rates:   fakeRates(),
+			wantErr: ErrNoMatchingRate,
+		},
+		{
+			desc:     "cheapest within max delivery days",
+			policy:   structs.RatePolicy{Strategy: RATE_STRATEGY_MAX_DELIVERY_DAYS, MaxDeliveryDays: 2},
+			rates:    fakeRates(),
+			wantRate: "rate_usps_priority",
+		},
+		{
+			desc:    "rates without an estimate never meet a deadline",
+			policy:  structs.RatePolicy{Strategy: RATE_STRATEGY_MAX_DELIVERY_DAYS, MaxDeliveryDays: 3},
+			rates:   []*easypost.Rate{{ID: "rate_fedex_economy", Carrier: "FedEx", Rate: "7.25"}},
+			wantErr: ErrNoMatchingRate,
+		},
+		{
+			desc:     "customer chosen service",
+			policy:   structs.RatePolicy{Strategy: RATE_STRATEGY_SERVICE, Service: "express"},
+			rates:    fakeRates(),
+			wantRate: "rate_usps_express",
+		},
+		{
+			desc:     "customer chosen carrier and service",
+			policy:   structs.RatePolicy{Strategy: RATE_STRATEGY_SERVICE, Carrier: "UPS", Service: "Ground"},
+			rates:    fakeRates(),
+			wantRate: "rate_ups_ground",
+		},
+		{
+			desc:    "chosen service not offered",
+			policy:  structs.RatePolicy{Strategy: RATE_STRATEGY_SERVICE, Service: "SecondDayAir"},
+			rates:   fakeRates(),
+			wantErr: ErrNoMatchingRate,
+		},
+		{
+			desc:    "shipment without rates",
+			policy:  structs.RatePolicy{Strategy: RATE_STRATEGY_CHEAPEST},
+			rates:   nil,
+			wantErr: ErrNoMatchingRate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			selector, err := NewRateSelector(tt.policy)
+			assert.NoError(t, err)
+
+			rate, err := selector.SelectRate(tt.rates)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, rate)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRate, rate.ID)
+		})
+	}
+}
+
+func TestNewRateSelector(t *testing.T) {
+	tests := []struct {
+		desc    string
+		policy  structs.RatePolicy
+		wantErr string
+	}{
+		{
+			desc:    "unknown strategy",
+			policy:  structs.RatePolicy{Strategy: "slowest"},
+			wantErr: ErrUnknownRateStrategy.Error(),
+		},
+		{
+			desc:    "preferred carrier without carriers",
+			policy:  structs.RatePolicy{Strategy: RATE_STRATEGY_PREFERRED_CARRIER},
+			wantErr: "preferred_carrier needs at least one carrier",
+		},
+		{
+			desc:    "max delivery days without days",
+			policy:  structs.RatePolicy{Strategy: RATE_STRATEGY_MAX_DELIVERY_DAYS},
+			wantErr: "max_delivery_days needs a number of days",
+		},
+		{
+			desc:    "service without a service",
+			policy:  structs.RatePolicy{Strategy: RATE_STRATEGY_SERVICE, Carrier: "UPS"},
+			wantErr: "service needs a service",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			selector, err := NewRateSelector(tt.policy)
+			assert.Nil(t, selector)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSelectRateInvalidAmount(t *testing.T) {
+	rates := []*easypost.Rate{{ID: "rate_bad", Carrier: "USPS", Rate: "free", EstDeliveryDays: 2}}
+
+	_, err := CheapestRate{}.SelectRate(rates)
+	assert.ErrorContains(t, err, `invalid shipping rate "free"`)
+
+	_, err = FastestRate{}.SelectRate(rates)
+	assert.ErrorContains(t, err, `invalid shipping rate "free"`)
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// orders whose markers finish after the cutoff miss the day's pickup
+	SHIP_CUTOFF_HOUR = 15
+	SHIP_DATE_FORMAT = "2006-01-02"
+)
+
+// ThroughputModel is how fast a printer lays down a mesh, VolumeRate is cubic millimetres a
+// second and LayerHeight millimetres. LayerSeconds covers the travel and retraction of each
+// layer and SetupSeconds the heating and homing before each file
+type ThroughputModel struct {
+	VolumeRate   float64
+	LayerHeight  float64
+	LayerSeconds float64
+	SetupSeconds float64
+}
+
+var DEFAULT_THROUGHPUT = ThroughputModel{VolumeRate: 10, LayerHeight: 0.2, LayerSeconds: 2, SetupSeconds: 300}
+
+// DEFAULT_MARKER_MESH stands in for an STL that can't be read, about a 25mm marker 3mm thick
+var DEFAULT_MARKER_MESH = MeshStats{Volume: 1500, Width: 25, Depth: 25, Height: 3}
+
+// PrintSeconds estimates printing quantity copies of a mesh one after another
+func (m ThroughputModel) PrintSeconds(mesh MeshStats, quantity int) int {
+	layers := math.Ceil(mesh.Height / m.LayerHeight)
+	perCopy := mesh.Volume/m.VolumeRate + layers*m.LayerSeconds
+	return int(math.Ceil(m.SetupSeconds + perCopy*float64(quantity)))
+}
+
+// PrintSchedulerImpl estimates on the printers that are idle or printing, Printers is only
+// used while none are registered
+type PrintSchedulerImpl struct {
+	DB         *sql.DB
+	Printers   int
+	Throughput ThroughputModel
+	now        func() time.Time
+}
+
+func NewPrintScheduler(db *sql.DB, printers int) PrintScheduler {
+	return &PrintSchedulerImpl{DB: db, Printers: printers, Throughput: DEFAULT_THROUGHPUT, now: time.Now}
+}
+
+func (ps *PrintSchedulerImpl) EstimatePrintSeconds(mesh MeshStats, quantity int) int {
+	return ps.Throughput.PrintSeconds(mesh, quantity)
+}
+
+// EstimateCompletion is when a job of printSeconds added to the back of the queue would finish
+func (ps *PrintSchedulerImpl) EstimateCompletion(tx *sql.Tx, printSeconds int) (time.Time, error) {
+	jobs, err := ps.openJobs(tx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	jobs = append(jobs, scheduledJob{printSeconds: printSeconds})
+
+	printers, err := ps.activePrinters(tx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	finishes := scheduleJobs(ps.now(), printers, jobs)
+	return finishes[len(finishes)-1], nil
+}
+
+// Reschedule refreshes the completion estimate of every open job, it runs whenever a job
+// is claimed or finishes so the jobs behind it move up. The estimates are written together
+// so a concurrent reschedule can't leave the queue half updated
+func (ps *PrintSchedulerImpl) Reschedule() error {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	jobs, err := ps.openJobs(tx)
+	if err != nil {
+		return err
+	}
+
+	printers, err := ps.activePrinters(tx)
+	if err != nil {
+		return err
+	}
+
+	finishes := scheduleJobs(ps.now(), printers, jobs)
+	query := `UPDATE print_jobs SET estimated_completion_time = ? WHERE job_id = ?`
+	for i, job := range jobs {
+		if _, err := tx.Exec(query, finishes[i], job.jobID); err != nil {
+			return fmt.Errorf("failed to update estimate of print job %d: %w", job.jobID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// activePrinters counts the printers that can take work, offline printers, those in
+// maintenance and those that stopped checking in don't shorten the queue
+func (ps *PrintSchedulerImpl) activePrinters(tx *sql.Tx) (int, error) {
+	var printers int
+	query := `
+		SELECT COUNT(*) FROM printers
+		WHERE status IN ('idle', 'printing') AND last_seen_at >= NOW() - INTERVAL ? SECOND
+	`
+	if err := tx.QueryRow(query, printerTimeoutSeconds()).Scan(&printers); err != nil {
+		return 0, fmt.Errorf("failed to count printers: %w", err)
+	}
+
+	if printers == 0 {
+		return ps.Printers, nil
+	}
+	return printers, nil
+}
+
+// scheduledJob is an open job as the scheduler sees it, startedAt is set once it's printing
+type scheduledJob struct {
+	jobID        int64
+	printSeconds int
+	startedAt    sql.NullTime
+}
+
+// openJobs lists the jobs still to print in the order workers take them, jobs already on a
+// printer come first
+func (ps *PrintSchedulerImpl) openJobs(tx *sql.Tx) ([]scheduledJob, error) {
+	query := `
+		SELECT job_id, estimated_print_seconds, started_at FROM print_jobs
+		WHERE status IN ('queued', 'claimed', 'printing')
+		ORDER BY status = 'queued', created_at, job_id
+	`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list open print jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []scheduledJob
+	for rows.Next() {
+		var job scheduledJob
+		var printSeconds sql.NullInt64
+		if err := rows.Scan(&job.jobID, &printSeconds, &job.startedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan open print job: %w", err)
+		}
+
+		// jobs queued before estimates existed count as a single marker
+		job.printSeconds = int(printSeconds.Int64)
+		if !printSeconds.Valid {
+			job.printSeconds = ps.Throughput.PrintSeconds(DEFAULT_MARKER_MESH, 1)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// scheduleJobs hands each job in turn to the printer that frees up first and returns when
+// each will finish, a printing job only has what's left of its estimate to go
+func scheduleJobs(now time.Time, printers int, jobs []scheduledJob) []time.Time {
+	now = now.UTC().Truncate(time.Second)
+	if printers < 1 {
+		printers = 1
+	}
+
+	free := make([]time.Time, printers)
+	for i := range free {
+		free[i] = now
+	}
+
+	finishes := make([]time.Time, len(jobs))
+	for i, job := range jobs {
+		printer := 0
+		for p := range free {
+			if free[p].Before(free[printer]) {
+				printer = p
+			}
+		}
+
+		remaining := time.Duration(job.printSeconds) * time.Second
+		if job.startedAt.Valid {
+			remaining -= now.Sub(job.startedAt.Time)
+		}
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		free[printer] = free[printer].Add(remaining)
+		finishes[i] = free[printer]
+	}
+
+	return finishes
+}
+
+// expectedShipDate is the first weekday the markers can make the carrier pickup
+func expectedShipDate(printed time.Time) time.Time {
+	printed = printed.UTC()
+	day := time.Date(printed.Year(), printed.Month(), printed.Day(), 0, 0, 0, 0, time.UTC)
+	if printed.Hour() >= SHIP_CUTOFF_HOUR {
+		day = day.AddDate(0, 0, 1)
+	}
+	for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPrintScheduler struct {
+	mock.Mock
+}
+
+func (m *MockPrintScheduler) EstimatePrintSeconds(mesh MeshStats, quantity int) int {
+	return m.Called(mesh, quantity).Int(0)
+}
+
+func (m *MockPrintScheduler) EstimateCompletion(tx *sql.Tx, printSeconds int) (time.Time, error) {
+	args := m.Called(tx, printSeconds)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockPrintScheduler) Reschedule() error {
+	return m.Called().Error(0)
+}
+
+var openJobColumns = []string{"job_id", "estimated_print_seconds", "started_at"}
+
+func TestPrintSeconds(t *testing.T) {
+	cube := MeshStats{Volume: 1000, Height: 10}
+
+	// 100s of volume and 50 layers at 2s a copy, after 300s of setup
+	assert.Equal(t, 500, DEFAULT_THROUGHPUT.PrintSeconds(cube, 1))
+	assert.Equal(t, 700, DEFAULT_THROUGHPUT.PrintSeconds(cube, 2))
+}
+
+func TestEstimatePrintSeconds(t *testing.T) {
+	scheduler := NewPrintScheduler(nil, 1)
+
+	assert.Equal(t, 700, scheduler.EstimatePrintSeconds(MeshStats{Volume: 1000, Width: 10, Depth: 10, Height: 10}, 2))
+	assert.Equal(t, DEFAULT_THROUGHPUT.PrintSeconds(DEFAULT_MARKER_MESH, 2), scheduler.EstimatePrintSeconds(DEFAULT_MARKER_MESH, 2))
+}
+
+func TestScheduleJobs(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	started := func(ago time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-ago), Valid: true}
+	}
+
+	tests := []struct {
+		desc         string
+		printers     int
+		jobs         []scheduledJob
+		wantFinishes []time.Time
+	}{
+		{
+			desc:     "one printer works through the queue",
+			printers: 1,
+			jobs: []scheduledJob{
+				{jobID: 1, printSeconds: 1800, startedAt: started(10 * time.Minute)},
+				{jobID: 2, printSeconds: 600},
+			},
+			wantFinishes: []time.Time{now.Add(20 * time.Minute), now.Add(30 * time.Minute)},
+		},
+		{
+			desc:     "queued jobs go to the printer that frees up first",
+			printers: 2,
+			jobs: []scheduledJob{
+				{jobID: 1, printSeconds: 1800, startedAt: started(10 * time.Minute)},
+				{jobID: 2, printSeconds: 600},
+				{jobID: 3, printSeconds: 900},
+				{jobID: 4, printSeconds: 300},
+			},
+			wantFinishes: []time.Time{
+				now.Add(20 * time.Minute),
+				now.Add(10 * time.Minute),
+				now.Add(25 * time.Minute),
+				now.Add(25 * time.Minute),
+			},
+		},
+		{
+			desc:     "overdue job is expected any moment",
+			printers: 1,
+			jobs: []scheduledJob{
+				{jobID: 1, printSeconds: 600, startedAt: started(time.Hour)},
+				{jobID: 2, printSeconds: 600},
+			},
+			wantFinishes: []time.Time{now, now.Add(10 * time.Minute)},
+		},
+		{
+			desc:         "no printers configured counts as one",
+			jobs:         []scheduledJob{{jobID: 1, printSeconds: 600}},
+			wantFinishes: []time.Time{now.Add(10 * time.Minute)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.wantFinishes, scheduleJobs(now, tt.printers, tt.jobs))
+		})
+	}
+}
+
+func TestEstimateCompletion(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock db: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT job_id, estimated_print_seconds, started_at FROM print_jobs WHERE status IN \('queued', 'claimed', 'printing'\) ORDER BY status = 'queued', created_at, job_id`).
+		WillReturnRows(sqlmock.NewRows(openJobColumns).
+			AddRow(1, 1800, now.Add(-10*time.Minute)).
+			AddRow(2, nil, nil))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM printers WHERE status IN \('idle', 'printing'\) AND last_seen_at >= NOW\(\) - INTERVAL \? SECOND`).
+		WithArgs(300).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+
+	scheduler := &PrintSchedulerImpl{Printers: 1, Throughput: DEFAULT_THROUGHPUT, now: func() time.Time { return now }}
+	completion, err := scheduler.EstimateCompletion(tx, 600)
+
+	// a job queued without an estimate counts as one default marker
+	queued := time.Duration(DEFAULT_THROUGHPUT.PrintSeconds(DEFAULT_MARKER_MESH, 1)) * time.Second
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(20*time.Minute+queued+10*time.Minute), completion)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	printerCount := func(count int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"count"}).AddRow(count)
+	}
+
+	tests := []struct {
+		desc       string
+		mockDB     func(sqlmock.Sqlmock)
+		wantErrMsg string
+	}{
+		{
+			desc: "every open job is re-estimated",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM print_jobs WHERE status IN`).
+					WillReturnRows(sqlmock.NewRows(openJobColumns).
+						AddRow(1, 1800, now.Add(-10*time.Minute)).
+						AddRow(2, 600, nil))
+				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM printers WHERE status IN \('idle', 'printing'\)`).WillReturnRows(printerCount(1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_completion_time = \? WHERE job_id = \?`).
+					WithArgs(now.Add(20*time.Minute), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_completion_time = \? WHERE job_id = \?`).
+					WithArgs(now.Add(30*time.Minute), int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			desc: "jobs are spread over the printers that are up",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM print_jobs WHERE status IN`).
+					WillReturnRows(sqlmock.NewRows(openJobColumns).
+						AddRow(1, 1800, now.Add(-10*time.Minute)).
+						AddRow(2, 600, nil))
+				mock.ExpectQuery(`FROM printers`).WillReturnRows(printerCount(2))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_completion_time`).
+					WithArgs(now.Add(20*time.Minute), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_completion_time`).
+					WithArgs(now.Add(10*time.Minute), int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			desc: "no printers registered uses the configured count",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM print_jobs WHERE status IN`).
+					WillReturnRows(sqlmock.NewRows(openJobColumns).
+						AddRow(1, 1800, now.Add(-10*time.Minute)).
+						AddRow(2, 600, nil))
+				mock.ExpectQuery(`FROM printers`).WillReturnRows(printerCount(0))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_completion_time`).
+					WithArgs(now.Add(20*time.Minute), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_completion_time`).
+					WithArgs(now.Add(30*time.Minute), int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			desc: "update fails",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM print_jobs WHERE status IN`).
+					WillReturnRows(sqlmock.NewRows(openJobColumns).AddRow(2, 600, nil))
+				mock.ExpectQuery(`FROM printers`).WillReturnRows(printerCount(1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_completion_time`).WillReturnError(errors.New("db down"))
+				mock.ExpectRollback()
+			},
+			wantErrMsg: "failed to update estimate of print job 2: db down",
+		},
+		{
+			desc: "open jobs can't be listed",
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM print_jobs WHERE status IN`).WillReturnError(errors.New("db down"))
+				mock.ExpectRollback()
+			},
+			wantErrMsg: "failed to list open print jobs: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			scheduler := &PrintSchedulerImpl{DB: db, Printers: 1, Throughput: DEFAULT_THROUGHPUT, now: func() time.Time { return now }}
+			err = scheduler.Reschedule()
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestExpectedShipDate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		printed time.Time
+		want    string
+	}{
+		{desc: "printed before the cutoff", printed: time.Date(2024, 5, 1, 14, 59, 0, 0, time.UTC), want: "2024-05-01"},
+		{desc: "printed after the cutoff", printed: time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC), want: "2024-05-02"},
+		{desc: "friday evening ships monday", printed: time.Date(2024, 5, 3, 18, 0, 0, 0, time.UTC), want: "2024-05-06"},
+		{desc: "printed on the weekend", printed: time.Date(2024, 5, 4, 9, 0, 0, 0, time.UTC), want: "2024-05-06"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.want, expectedShipDate(tt.printed).Format(SHIP_DATE_FORMAT))
+		})
+	}
+}
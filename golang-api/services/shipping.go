@@ -0,0 +1,227 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+var (
+	ErrRateNotFound         = errors.New("shipping rate is not part of the quote")
+	ErrQuoteAddressMismatch = errors.New("shipping quote was made for a different address")
+)
+
+// AddressError is returned for an address the carrier can't deliver to, it carries what was
+// wrong and any suggested correction so the customer can fix the address and try again
+type AddressError struct {
+	Verification structs.AddressVerification
+}
+
+func (e *AddressError) Error() string {
+	if len(e.Verification.Errors) == 0 {
+		return "address is not deliverable"
+	}
+
+	problems := make([]string, 0, len(e.Verification.Errors))
+	for _, fieldErr := range e.Verification.Errors {
+		problems = append(problems, fieldErr.Message)
+	}
+	return "address is not deliverable: " + strings.Join(problems, ", ")
+}
+
+type ShippingServiceImpl struct {
+	ShipClient EasyPostClient
+	Packaging  PackagingService
+}
+
+func NewShippingService(shipClient EasyPostClient, packaging PackagingService) ShippingService {
+	return &ShippingServiceImpl{ShipClient: shipClient, Packaging: packaging}
+}
+
+// QuoteShipping rates the parcel a cart ships in from the shop to address, the customer
+// picks one of the returned rates and the same shipment is bought with it once the order is placed.
+// International shipments carry the cart's customs declaration and are rated under incoterm,
+// an empty incoterm uses the shop's default
+func (ss *ShippingServiceImpl) QuoteShipping(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error) {
+	if err := checkDestination(address); err != nil {
+		return structs.ShippingQuote{}, err
+	}
+
+	parcel, err := ss.Packaging.PackCart(ssid)
+	if err != nil {
+		return structs.ShippingQuote{}, err
+	}
+
+	quote := structs.ShippingQuote{Parcel: parcel, Rates: []structs.ShippingRate{}}
+	request := &easypost.Shipment{
+		FromAddress: &config.SENDER_ADDRESS,
+		ToAddress:   toEasyPostAddress(name, address),
+		Parcel:      toEasyPostParcel(parcel),
+	}
+
+	if isInternational(address) {
+		quote.Customs, err = ss.Packaging.DeclareContents(ssid)
+		if err != nil {
+			return structs.ShippingQuote{}, fmt.Errorf("failed to declare contents: %w", err)
+		}
+		quote.Incoterm = shipmentIncoterm(incoterm)
+		quote.DutiesPaidBy = dutiesPaidBy(quote.Incoterm)
+		internationalShipment(request, quote.Customs, quote.Incoterm)
+	}
+
+	shipment, err := ss.ShipClient.CreateShipment(request)
+	if err != nil {
+		return structs.ShippingQuote{}, fmt.Errorf("failed to create shipment: %w", err)
+	}
+
+	quote.ShipmentID = shipment.ID
+	for _, rate := range shipment.Rates {
+		shippingRate, err := toShippingRate(rate)
+		if err != nil {
+			return structs.ShippingQuote{}, err
+		}
+		quote.Rates = append(quote.Rates, shippingRate)
+	}
+
+	sort.SliceStable(quote.Rates, func(i, j int) bool {
+		return quote.Rates[i].Amount < quote.Rates[j].Amount
+	})
+
+	return quote, nil
+}
+
+// GetRate looks a quoted rate up again from EasyPost so the amount charged never comes
+// from the browser, the quote must have been made for the address being checked out
+func (ss *ShippingServiceImpl) GetRate(shipmentID string, rateID string, address structs.AddressInfo) (structs.ShippingRate, error) {
+	shipment, err := ss.ShipClient.GetShipment(shipmentID)
+	if err != nil {
+		return structs.ShippingRate{}, fmt.Errorf("failed to retrieve shipment: %w", err)
+	}
+
+	if shipment.ToAddress == nil || !sameAddress(fromEasyPostAddress(shipment.ToAddress), address) {
+		return structs.ShippingRate{}, ErrQuoteAddressMismatch
+	}
+
+	for _, rate := range shipment.Rates {
+		if rate.ID == rateID {
+			return toShippingRate(rate)
+		}
+	}
+
+	return structs.ShippingRate{}, ErrRateNotFound
+}
+
+// VerifyAddress asks the carrier whether address can be delivered to, an undeliverable
+// address is reported as an *AddressError alongside the verification
+func (ss *ShippingServiceImpl) VerifyAddress(address structs.AddressInfo) (structs.AddressVerification, error) {
+	if err := checkDestination(address); err != nil {
+		return structs.AddressVerification{}, err
+	}
+
+	verified, err := ss.ShipClient.VerifyAddress(toEasyPostAddress("", address))
+	if err != nil {
+		return structs.AddressVerification{}, fmt.Errorf("failed to verify address: %w", err)
+	}
+
+	var delivery *easypost.AddressVerification
+	if verified.Verifications != nil {
+		delivery = verified.Verifications.Delivery
+	}
+
+	var verification structs.AddressVerification
+	if delivery != nil {
+		verification.Deliverable = delivery.Success
+		for _, fieldErr := range delivery.Errors {
+			verification.Errors = append(verification.Errors, structs.AddressFieldError{
+				Field:      fieldErr.Field,
+				Message:    fieldErr.Message,
+				Suggestion: fieldErr.Suggestion,
+			})
+		}
+	}
+
+	suggested := fromEasyPostAddress(verified)
+	if suggested != address {
+		verification.Suggested = &suggested
+	}
+
+	if !verification.Deliverable {
+		return verification, &AddressError{Verification: verification}
+	}
+
+	return verification, nil
+}
+
+func toShippingRate(rate *easypost.Rate) (structs.ShippingRate, error) {
+	amount, err := rateToCents(rate.Rate)
+	if err != nil {
+		return structs.ShippingRate{}, err
+	}
+
+	return structs.ShippingRate{
+		RateID:       rate.ID,
+		Carrier:      rate.Carrier,
+		Service:      rate.Service,
+		Amount:       amount,
+		DeliveryDays: rate.EstDeliveryDays,
+	}, nil
+}
+
+// rateToCents converts EasyPost's dollar string, e.g. "7.58", to cents
+func rateToCents(rate string) (int64, error) {
+	dollars, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid shipping rate %q: %w", rate, err)
+	}
+
+	return int64(math.Round(dollars * 100)), nil
+}
+
+// sameAddress compares every line of two addresses, ignoring case and spacing
+func sameAddress(a structs.AddressInfo, b structs.AddressInfo) bool {
+	lines := func(address structs.AddressInfo) []string {
+		return []string{address.Line1, address.Line2, address.City, address.State, address.PostalCode, address.Country}
+	}
+
+	bLines := lines(b)
+	for i, line := range lines(a) {
+		if !strings.EqualFold(strings.Join(strings.Fields(line), " "), strings.Join(strings.Fields(bLines[i]), " ")) {
+			return false
+		}
+	}
+	return true
+}
+
+func toEasyPostAddress(name string, address structs.AddressInfo) *easypost.Address {
+	return &easypost.Address{
+		Name:    name,
+		Street1: address.Line1,
+		Street2: address.Line2,
+		City:    address.City,
+		State:   address.State,
+		Zip:     address.PostalCode,
+		Country: address.Country,
+	}
+}
+
+func fromEasyPostAddress(address *easypost.Address) structs.AddressInfo {
+	return structs.AddressInfo{
+		Line1:      address.Street1,
+		Line2:      address.Street2,
+		City:       address.City,
+		State:      address.State,
+		PostalCode: address.Zip,
+		Country:    address.Country,
+	}
+}
+
+func toEasyPostParcel(parcel structs.Parcel) *easypost.Parcel {
+	return &easypost.Parcel{Length: parcel.Length, Width: parcel.Width, Height: parcel.Height, Weight: parcel.Weight}
+}
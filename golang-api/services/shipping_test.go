@@ -0,0 +1,331 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/ocamp09/fairway-ink-api/golang-api/config"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockShippingService struct {
+	mock.Mock
+}
+
+func (m *MockShippingService) QuoteShipping(ssid string, name string, address structs.AddressInfo, incoterm string) (structs.ShippingQuote, error) {
+	args := m.Called(ssid, name, address, incoterm)
+	return args.Get(0).(structs.ShippingQuote), args.Error(1)
+}
+
+func (m *MockShippingService) GetRate(shipmentID string, rateID string, address structs.AddressInfo) (structs.ShippingRate, error) {
+	args := m.Called(shipmentID, rateID, address)
+	return args.Get(0).(structs.ShippingRate), args.Error(1)
+}
+
+func (m *MockShippingService) VerifyAddress(address structs.AddressInfo) (structs.AddressVerification, error) {
+	args := m.Called(address)
+	return args.Get(0).(structs.AddressVerification), args.Error(1)
+}
+
+var quotedRates = []*easypost.Rate{
+	{ID: "rate_2", Carrier: "UPS", Service: "Ground", Rate: "12.40", EstDeliveryDays: 3},
+	{ID: "rate_1", Carrier: "USPS", Service: "GroundAdvantage", Rate: "7.95", EstDeliveryDays: 4},
+}
+
+var torontoAddress = structs.AddressInfo{Line1: "40 Bay St", City: "Toronto", State: "ON", PostalCode: "M5J 2X2", Country: "CA"}
+
+func TestQuoteShipping(t *testing.T) {
+	originalCountries, originalIncoterm := config.SHIP_TO_COUNTRIES, config.INCOTERM
+	defer func() {
+		config.SHIP_TO_COUNTRIES, config.INCOTERM = originalCountries, originalIncoterm
+	}()
+	config.SHIP_TO_COUNTRIES = []string{"US", "CA"}
+	config.INCOTERM = "DDU"
+
+	smallBox := structs.Parcel{BoxID: 2, Box: "Small box", Length: 8, Width: 6, Height: 4, Weight: 9.5}
+	customs := []structs.CustomsItem{
+		{Description: "Plastic golf ball markers", HSTariffNumber: "950639", Quantity: 12, Value: 17988, Weight: 5.4, OriginCountry: "US"},
+	}
+	// customs values go to EasyPost in dollars
+	declared := func(shipment *easypost.Shipment) bool {
+		return shipment.CustomsInfo != nil && len(shipment.CustomsInfo.CustomsItems) == 1 &&
+			shipment.CustomsInfo.CustomsItems[0].Value == 179.88 && shipment.CustomsInfo.CustomsItems[0].HSTariffNumber == "950639" &&
+			shipment.CustomsInfo.CustomsCertify
+	}
+
+	tests := []struct {
+		desc         string
+		address      structs.AddressInfo
+		incoterm     string
+		packErr      error
+		mockEasyPost func(*MockEasyPostClient)
+		wantQuote    structs.ShippingQuote
+		wantErr      error
+		wantErrMsg   string
+	}{
+		{
+			desc: "rates are returned cheapest first in cents",
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("CreateShipment", mock.MatchedBy(func(shipment *easypost.Shipment) bool {
+					return shipment.ToAddress.Zip == "43215" && shipment.ToAddress.Name == "John Doe" &&
+						shipment.Parcel.Height == 4 && shipment.Parcel.Weight == 9.5 && shipment.CustomsInfo == nil
+				})).Return(&easypost.Shipment{ID: "shp_123", Rates: quotedRates}, nil)
+			},
+			wantQuote: structs.ShippingQuote{
+				ShipmentID: "shp_123",
+				Parcel:     smallBox,
+				Rates: []structs.ShippingRate{
+					{RateID: "rate_1", Carrier: "USPS", Service: "GroundAdvantage", Amount: 795, DeliveryDays: 4},
+					{RateID: "rate_2", Carrier: "UPS", Service: "Ground", Amount: 1240, DeliveryDays: 3},
+				},
+			},
+		},
+		{
+			desc:    "international shipment declares the cart under the default incoterm",
+			address: torontoAddress,
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("CreateShipment", mock.MatchedBy(func(shipment *easypost.Shipment) bool {
+					return declared(shipment) && shipment.Options != nil && shipment.Options.Incoterm == "DDU"
+				})).Return(&easypost.Shipment{ID: "shp_456", Rates: quotedRates[:1]}, nil)
+			},
+			wantQuote: structs.ShippingQuote{
+				ShipmentID:   "shp_456",
+				Parcel:       smallBox,
+				Rates:        []structs.ShippingRate{{RateID: "rate_2", Carrier: "UPS", Service: "Ground", Amount: 1240, DeliveryDays: 3}},
+				Incoterm:     "DDU",
+				DutiesPaidBy: "recipient",
+				Customs:      customs,
+			},
+		},
+		{
+			desc:     "duties paid by the shop",
+			address:  torontoAddress,
+			incoterm: "DDP",
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("CreateShipment", mock.MatchedBy(func(shipment *easypost.Shipment) bool {
+					return declared(shipment) && shipment.Options != nil && shipment.Options.Incoterm == "DDP"
+				})).Return(&easypost.Shipment{ID: "shp_456", Rates: quotedRates[:1]}, nil)
+			},
+			wantQuote: structs.ShippingQuote{
+				ShipmentID:   "shp_456",
+				Parcel:       smallBox,
+				Rates:        []structs.ShippingRate{{RateID: "rate_2", Carrier: "UPS", Service: "Ground", Amount: 1240, DeliveryDays: 3}},
+				Incoterm:     "DDP",
+				DutiesPaidBy: "sender",
+				Customs:      customs,
+			},
+		},
+		{
+			desc:         "country not served",
+			address:      structs.AddressInfo{City: "London", PostalCode: "SW1A 1AA", Country: "GB"},
+			mockEasyPost: func(m *MockEasyPostClient) {},
+			wantErr:      ErrCountryNotServed,
+		},
+		{
+			desc:         "cart can't be packed",
+			packErr:      ErrNoBoxFits,
+			mockEasyPost: func(m *MockEasyPostClient) {},
+			wantErrMsg:   ErrNoBoxFits.Error(),
+		},
+		{
+			desc: "shipment creation fails",
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("CreateShipment", mock.Anything).Return((*easypost.Shipment)(nil), errors.New("invalid address"))
+			},
+			wantErrMsg: "failed to create shipment: invalid address",
+		},
+		{
+			desc: "unreadable rate",
+			mockEasyPost: func(m *MockEasyPostClient) {
+				m.On("CreateShipment", mock.Anything).
+					Return(&easypost.Shipment{ID: "shp_123", Rates: []*easypost.Rate{{ID: "rate_1", Rate: "free"}}}, nil)
+			},
+			wantErrMsg: `invalid shipping rate "free"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client := new(MockEasyPostClient)
+			tt.mockEasyPost(client)
+			packaging := new(MockPackagingService)
+			packaging.On("PackCart", "ssid123").Return(smallBox, tt.packErr)
+			packaging.On("DeclareContents", "ssid123").Return(customs, nil)
+
+			address := tt.address
+			if address == (structs.AddressInfo{}) {
+				address = ohioAddress
+			}
+
+			quote, err := NewShippingService(client, packaging).QuoteShipping("ssid123", "John Doe", address, tt.incoterm)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantQuote, quote)
+			}
+
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetRate(t *testing.T) {
+	quotedShipment := &easypost.Shipment{
+		ID:        "shp_123",
+		ToAddress: toEasyPostAddress("John Doe", ohioAddress),
+		Rates:     quotedRates,
+	}
+
+	tests := []struct {
+		desc     string
+		rateID   string
+		address  structs.AddressInfo
+		shipment *easypost.Shipment
+		shipErr  error
+		wantRate structs.ShippingRate
+		wantErr  error
+	}{
+		{
+			desc:     "quoted rate",
+			rateID:   "rate_2",
+			address:  ohioAddress,
+			shipment: quotedShipment,
+			wantRate: structs.ShippingRate{RateID: "rate_2", Carrier: "UPS", Service: "Ground", Amount: 1240, DeliveryDays: 3},
+		},
+		{
+			desc:     "rate from another shipment",
+			rateID:   "rate_9",
+			address:  ohioAddress,
+			shipment: quotedShipment,
+			wantErr:  ErrRateNotFound,
+		},
+		{
+			desc:     "quote made for another zip",
+			rateID:   "rate_2",
+			address:  structs.AddressInfo{PostalCode: "97201", Country: "US"},
+			shipment: quotedShipment,
+			wantErr:  ErrQuoteAddressMismatch,
+		},
+		{
+			desc:     "quote made for another street in the same zip",
+			rateID:   "rate_2",
+			address:  structs.AddressInfo{Line1: "99 Fairway Dr", City: "Columbus", State: "OH", PostalCode: "43215", Country: "US"},
+			shipment: quotedShipment,
+			wantErr:  ErrQuoteAddressMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client := new(MockEasyPostClient)
+			client.On("GetShipment", "shp_123").Return(tt.shipment, tt.shipErr)
+
+			rate, err := NewShippingService(client, new(MockPackagingService)).GetRate("shp_123", tt.rateID, tt.address)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantRate, rate)
+			}
+
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestVerifyAddress(t *testing.T) {
+	tests := []struct {
+		desc             string
+		verified         *easypost.Address
+		verifyErr        error
+		wantVerification structs.AddressVerification
+		wantAddressErr   bool
+		wantErrMsg       string
+	}{
+		{
+			desc: "deliverable as entered",
+			verified: &easypost.Address{Street1: "1 Tee Box Ln", City: "Columbus", State: "OH", Zip: "43215", Country: "US",
+				Verifications: &easypost.AddressVerifications{Delivery: &easypost.AddressVerification{Success: true}}},
+			wantVerification: structs.AddressVerification{Deliverable: true},
+		},
+		{
+			desc: "deliverable with a corrected zip",
+			verified: &easypost.Address{Street1: "1 TEE BOX LN", City: "COLUMBUS", State: "OH", Zip: "43215-1234", Country: "US",
+				Verifications: &easypost.AddressVerifications{Delivery: &easypost.AddressVerification{Success: true}}},
+			wantVerification: structs.AddressVerification{
+				Deliverable: true,
+				Suggested:   &structs.AddressInfo{Line1: "1 TEE BOX LN", City: "COLUMBUS", State: "OH", PostalCode: "43215-1234", Country: "US"},
+			},
+		},
+		{
+			desc: "undeliverable address",
+			verified: &easypost.Address{Street1: "1 Tee Box Ln", City: "Columbus", State: "OH", Zip: "43215", Country: "US",
+				Verifications: &easypost.AddressVerifications{Delivery: &easypost.AddressVerification{
+					Errors: []*easypost.AddressVerificationFieldError{{Field: "street1", Message: "Address not found", Suggestion: "1 Tee Box Lane"}},
+				}}},
+			wantVerification: structs.AddressVerification{
+				Errors: []structs.AddressFieldError{{Field: "street1", Message: "Address not found", Suggestion: "1 Tee Box Lane"}},
+			},
+			wantAddressErr: true,
+			wantErrMsg:     "address is not deliverable: Address not found",
+		},
+		{
+			desc:       "verification request fails",
+			verifyErr:  errors.New("easypost down"),
+			wantErrMsg: "failed to verify address: easypost down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client := new(MockEasyPostClient)
+			client.On("VerifyAddress", mock.MatchedBy(func(address *easypost.Address) bool {
+				return address.Zip == "43215" && address.Street1 == "1 Tee Box Ln"
+			})).Return(tt.verified, tt.verifyErr)
+
+			verification, err := NewShippingService(client, new(MockPackagingService)).VerifyAddress(ohioAddress)
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+			var addressErr *AddressError
+			assert.Equal(t, tt.wantAddressErr, errors.As(err, &addressErr))
+			assert.Equal(t, tt.wantVerification, verification)
+
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFakeEasyPostClient(t *testing.T) {
+	client := NewFakeEasyPostClient()
+
+	verified, err := client.VerifyAddress(&easypost.Address{Street1: "1 Tee Box Ln", City: "Columbus", State: "oh", Zip: "4321", Country: "us"})
+	assert.NoError(t, err)
+	assert.Equal(t, "OH", verified.State)
+	assert.False(t, verified.Verifications.Delivery.Success)
+	assert.Equal(t, "zip", verified.Verifications.Delivery.Errors[0].Field)
+
+	shipment, err := client.CreateShipment(&easypost.Shipment{ToAddress: toEasyPostAddress("John Doe", ohioAddress), Parcel: &easypost.Parcel{Weight: 4}})
+	assert.NoError(t, err)
+	lowest, err := client.LowestShipmentRate(shipment)
+	assert.NoError(t, err)
+
+	bought, err := client.BuyShipment(shipment.ID, &easypost.Rate{ID: lowest.ID}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, lowest.ID, bought.SelectedRate.ID)
+	assert.NotEmpty(t, bought.TrackingCode)
+
+	_, err = client.BuyShipment(shipment.ID, &easypost.Rate{ID: "rate_other"}, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+var (
+	ErrInvalidGcode      = errors.New("invalid G-code")
+	ErrUnsupportedSlicer = errors.New("unsupported slicer engine")
+	// the API runs without a slicer, only slice_jobs and the admin slice route need one
+	ErrSlicerNotConfigured = errors.New("no slicer configured, set SLICER_PATH or USE_FAKES=true")
+)
+
+const (
+	SLICER_PRUSA = "prusaslicer"
+	SLICER_CURA  = "curaengine"
+
+	// 1.75mm PLA, used to weigh filament when the slicer only reports its length
+	FILAMENT_DIAMETER_MM = 1.75
+	FILAMENT_DENSITY     = 1.24
+)
+
+// CliSlicer runs PrusaSlicer or CuraEngine from the command line, ConfigPath is the printer
+// and filament profile exported from the slicer's UI
+type CliSlicer struct {
+	Engine     string
+	Path       string
+	ConfigPath string
+
+	commandExecutor func(name string, arg ...string) *exec.Cmd
+}
+
+func NewCliSlicer(engine string, path string, configPath string) Slicer {
+	return &CliSlicer{Engine: strings.ToLower(engine), Path: path, ConfigPath: configPath, commandExecutor: exec.Command}
+}
+
+// Slice writes the G-code for one copy of an STL and reads the print time and filament the
+// slicer wrote into its comments
+func (s *CliSlicer) Slice(stlPath string, gcodePath string) (structs.GcodeMeta, error) {
+	if s.Path == "" {
+		return structs.GcodeMeta{}, ErrSlicerNotConfigured
+	}
+
+	args, err := s.args(stlPath, gcodePath)
+	if err != nil {
+		return structs.GcodeMeta{}, err
+	}
+
+	cmd := s.commandExecutor(s.Path, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return structs.GcodeMeta{}, fmt.Errorf("failed to slice %s: %w: %s", stlPath, err, strings.TrimSpace(string(output)))
+	}
+
+	return readGcodeMeta(gcodePath)
+}
+
+func (s *CliSlicer) args(stlPath string, gcodePath string) ([]string, error) {
+	switch s.Engine {
+	case SLICER_PRUSA:
+		var args []string
+		if s.ConfigPath != "" {
+			args = append(args, "--load", s.ConfigPath)
+		}
+		return append(args, "--export-gcode", "--output", gcodePath, stlPath), nil
+	case SLICER_CURA:
+		args := []string{"slice"}
+		if s.ConfigPath != "" {
+			args = append(args, "-j", s.ConfigPath)
+		}
+		return append(args, "-o", gcodePath, "-l", stlPath), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedSlicer, s.Engine)
+}
+
+func readGcodeMeta(gcodePath string) (structs.GcodeMeta, error) {
+	file, err := os.Open(gcodePath)
+	if err != nil {
+		return structs.GcodeMeta{}, fmt.Errorf("failed to open G-code: %w", err)
+	}
+	defer file.Close()
+
+	return parseGcodeMeta(file)
+}
+
+// parseGcodeMeta reads the summary comments PrusaSlicer and CuraEngine write into their
+// G-code. Values for several extruders are summed, Cura only gives the length so its
+// filament is weighed as PLA
+func parseGcodeMeta(r io.Reader) (structs.GcodeMeta, error) {
+	var meta structs.GcodeMeta
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, ";") {
+			continue
+		}
+		comment := strings.TrimSpace(strings.TrimPrefix(line, ";"))
+
+		// PrusaSlicer: ; key = value
+		if key, value, found := strings.Cut(comment, " = "); found {
+			switch key {
+			case "estimated printing time (normal mode)":
+				seconds, err := parseDuration(value)
+				if err != nil {
+					return structs.GcodeMeta{}, err
+				}
+				meta.PrintSeconds = seconds
+			case "filament used [mm]":
+				meta.FilamentMM = sumValues(value, "")
+			case "filament used [g]":
+				meta.FilamentGrams = sumValues(value, "")
+			case "nozzle_diameter":
+				meta.NozzleMM = firstValue(value)
+			}
+			continue
+		}
+
+		// CuraEngine: ;KEY:value
+		if key, value, found := strings.Cut(comment, ":"); found {
+			switch key {
+			case "TIME":
+				seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					return structs.GcodeMeta{}, fmt.Errorf("%w: print time %q", ErrInvalidGcode, value)
+				}
+				meta.PrintSeconds = int(math.Ceil(seconds))
+			case "Filament used":
+				meta.FilamentMM = sumValues(value, "m") * 1000
+			case "EXTRUDER_TRAIN.0.NOZZLE.DIAMETER":
+				meta.NozzleMM = firstValue(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return structs.GcodeMeta{}, fmt.Errorf("failed to read G-code: %w", err)
+	}
+
+	if meta.PrintSeconds == 0 {
+		return structs.GcodeMeta{}, fmt.Errorf("%w: no print time", ErrInvalidGcode)
+	}
+	if meta.FilamentGrams == 0 {
+		meta.FilamentGrams = filamentGrams(meta.FilamentMM)
+	}
+	return meta, nil
+}
+
+// parseDuration reads PrusaSlicer's times such as "1d 2h 3m 4s"
+func parseDuration(value string) (int, error) {
+	units := map[byte]int{'d': 86400, 'h': 3600, 'm': 60, 's': 1}
+	seconds := 0
+	for _, part := range strings.Fields(value) {
+		unit, ok := units[part[len(part)-1]]
+		count, err := strconv.Atoi(part[:len(part)-1])
+		if !ok || err != nil {
+			return 0, fmt.Errorf("%w: print time %q", ErrInvalidGcode, value)
+		}
+		seconds += count * unit
+	}
+	return seconds, nil
+}
+
+// sumValues adds up a comma separated list of per-extruder values, skipping any that don't parse
+func sumValues(value string, suffix string) float64 {
+	total := 0.0
+	for _, part := range strings.Split(value, ",") {
+		amount, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(part), suffix), 64)
+		if err == nil {
+			total += amount
+		}
+	}
+	return total
+}
+
+// firstValue reads the first extruder's value from a comma separated list, zero if it doesn't parse
+func firstValue(value string) float64 {
+	first, _, _ := strings.Cut(value, ",")
+	amount, err := strconv.ParseFloat(strings.TrimSpace(first), 64)
+	if err != nil {
+		return 0
+	}
+	return amount
+}
+
+func filamentGrams(lengthMM float64) float64 {
+	radius := FILAMENT_DIAMETER_MM / 2
+	return lengthMM * math.Pi * radius * radius / 1000 * FILAMENT_DENSITY
+}
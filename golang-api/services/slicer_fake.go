@@ -0,0 +1,39 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+// FakeSlicer stands in for a slicer when running locally with USE_FAKES, it reports the
+// throughput model's estimate and writes no G-code, so nothing it returns can be printed
+type FakeSlicer struct {
+	Throughput ThroughputModel
+}
+
+func NewFakeSlicer() Slicer {
+	return &FakeSlicer{Throughput: DEFAULT_THROUGHPUT}
+}
+
+func (f *FakeSlicer) Slice(stlPath string, _ string) (structs.GcodeMeta, error) {
+	data, err := os.ReadFile(stlPath)
+	if err != nil {
+		return structs.GcodeMeta{}, fmt.Errorf("failed to read STL: %w", err)
+	}
+
+	mesh, err := MeasureStl(data)
+	if err != nil {
+		return structs.GcodeMeta{}, err
+	}
+
+	radius := FILAMENT_DIAMETER_MM / 2
+	return structs.GcodeMeta{
+		PrintSeconds:  f.Throughput.PrintSeconds(mesh, 1),
+		FilamentMM:    math.Round(mesh.Volume/(math.Pi*radius*radius)*10) / 10,
+		FilamentGrams: math.Round(mesh.Volume/1000*FILAMENT_DENSITY*100) / 100,
+		Estimated:     true,
+	}, nil
+}
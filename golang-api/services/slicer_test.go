@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSlicer struct {
+	mock.Mock
+}
+
+func (m *MockSlicer) Slice(stlPath string, gcodePath string) (structs.GcodeMeta, error) {
+	args := m.Called(stlPath, gcodePath)
+	return args.Get(0).(structs.GcodeMeta), args.Error(1)
+}
+
+const prusaGcode = `; generated by PrusaSlicer 2.7.1
+G28 ; home all axes
+G1 X10 Y10 E0.5
+; filament used [mm] = 812.46
+; filament used [cm3] = 1.95
+; filament used [g] = 2.42
+; total filament used [g] = 2.42
+; nozzle_diameter = 0.4,0.4
+; estimated printing time (normal mode) = 1h 2m 3s
+; estimated printing time (silent mode) = 1h 10m 0s
+`
+
+const curaGcode = `;FLAVOR:Marlin
+;TIME:3723.4
+;Filament used: 0.81246m, 0.1m
+;Layer height: 0.2
+;EXTRUDER_TRAIN.0.NOZZLE.DIAMETER:0.6
+G28
+`
+
+func TestParseGcodeMeta(t *testing.T) {
+	tests := []struct {
+		desc     string
+		gcode    string
+		wantMeta structs.GcodeMeta
+		wantErr  error
+	}{
+		{
+			desc:     "PrusaSlicer summary",
+			gcode:    prusaGcode,
+			wantMeta: structs.GcodeMeta{PrintSeconds: 3723, FilamentMM: 812.46, FilamentGrams: 2.42, NozzleMM: 0.4},
+		},
+		{
+			desc:     "CuraEngine header, filament is weighed as PLA",
+			gcode:    curaGcode,
+			wantMeta: structs.GcodeMeta{PrintSeconds: 3724, FilamentMM: 912.46, FilamentGrams: filamentGrams(912.46), NozzleMM: 0.6},
+		},
+		{
+			desc:     "days are counted",
+			gcode:    "; estimated printing time (normal mode) = 1d 0h 0m 5s\n",
+			wantMeta: structs.GcodeMeta{PrintSeconds: 86405},
+		},
+		{
+			desc:    "no print time",
+			gcode:   "G28\nG1 X10 Y10\n",
+			wantErr: ErrInvalidGcode,
+		},
+		{
+			desc:    "unreadable print time",
+			gcode:   "; estimated printing time (normal mode) = soon\n",
+			wantErr: ErrInvalidGcode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			meta, err := parseGcodeMeta(strings.NewReader(tt.gcode))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMeta.PrintSeconds, meta.PrintSeconds)
+			assert.InDelta(t, tt.wantMeta.FilamentMM, meta.FilamentMM, 0.001)
+			assert.InDelta(t, tt.wantMeta.FilamentGrams, meta.FilamentGrams, 0.001)
+			assert.Equal(t, tt.wantMeta.NozzleMM, meta.NozzleMM)
+		})
+	}
+}
+
+func TestCliSlicer(t *testing.T) {
+	tests := []struct {
+		desc       string
+		engine     string
+		configPath string
+		output     string
+		fail       bool
+		noPath     bool
+		wantArgs   []string
+		wantMeta   structs.GcodeMeta
+		wantErr    string
+	}{
+		{
+			desc:       "PrusaSlicer with a profile",
+			engine:     "PrusaSlicer",
+			configPath: "config.ini",
+			output:     prusaGcode,
+			wantArgs:   []string{"--load", "config.ini", "--export-gcode", "--output", "out.gcode", "in.stl"},
+			wantMeta:   structs.GcodeMeta{PrintSeconds: 3723, FilamentMM: 812.46, FilamentGrams: 2.42},
+		},
+		{
+			desc:     "CuraEngine without a profile",
+			engine:   SLICER_CURA,
+			output:   curaGcode,
+			wantArgs: []string{"slice", "-o", "out.gcode", "-l", "in.stl"},
+			wantMeta: structs.GcodeMeta{PrintSeconds: 3724, FilamentMM: 912.46, FilamentGrams: filamentGrams(912.46)},
+		},
+		{
+			desc:     "slicer fails",
+			engine:   SLICER_PRUSA,
+			fail:     true,
+			wantArgs: []string{"--export-gcode", "--output", "out.gcode", "in.stl"},
+			wantErr:  "Objects could not fit on the bed",
+		},
+		{
+			desc:    "unknown engine",
+			engine:  "slic3r",
+			wantErr: "unsupported slicer engine",
+		},
+		{
+			desc:    "no slicer configured",
+			engine:  SLICER_PRUSA,
+			noPath:  true,
+			wantErr: ErrSlicerNotConfigured.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			gcodePath := filepath.Join(dir, "out.gcode")
+
+			var gotArgs []string
+			path := "/opt/slicer"
+			if tt.noPath {
+				path = ""
+			}
+			slicer := NewCliSlicer(tt.engine, path, tt.configPath).(*CliSlicer)
+			slicer.commandExecutor = func(name string, arg ...string) *exec.Cmd {
+				assert.Equal(t, "/opt/slicer", name)
+				// the temp dir differs every run
+				gotArgs = append([]string{}, arg...)
+				for i := range gotArgs {
+					gotArgs[i] = strings.Replace(gotArgs[i], gcodePath, "out.gcode", 1)
+				}
+				if tt.fail {
+					return exec.Command("sh", "-c", "echo 'Objects could not fit on the bed'; exit 1")
+				}
+				return exec.Command("sh", "-c", `printf '%s' "$1" > "$2"`, "sh", tt.output, gcodePath)
+			}
+
+			meta, err := slicer.Slice("in.stl", gcodePath)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantMeta.PrintSeconds, meta.PrintSeconds)
+				assert.InDelta(t, tt.wantMeta.FilamentMM, meta.FilamentMM, 0.001)
+				assert.InDelta(t, tt.wantMeta.FilamentGrams, meta.FilamentGrams, 0.001)
+			}
+			assert.Equal(t, tt.wantArgs, gotArgs)
+		})
+	}
+}
+
+func TestFakeSlicer(t *testing.T) {
+	dir := t.TempDir()
+	stlPath := filepath.Join(dir, "marker.stl")
+	gcodePath := filepath.Join(dir, "marker.gcode")
+	if err := os.WriteFile(stlPath, binaryStl(cubeMesh()), 0644); err != nil {
+		t.Fatalf("failed to write STL: %v", err)
+	}
+
+	meta, err := NewFakeSlicer().Slice(stlPath, gcodePath)
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_THROUGHPUT.PrintSeconds(MeshStats{Volume: 1000, Height: 10}, 1), meta.PrintSeconds)
+	assert.InDelta(t, 1.24, meta.FilamentGrams, 0.001)
+	assert.True(t, meta.Estimated)
+	assert.Zero(t, meta.NozzleMM)
+
+	// an estimate must never pass for printable G-code
+	_, err = os.Stat(gcodePath)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	_, err = NewFakeSlicer().Slice(filepath.Join(dir, "missing.stl"), gcodePath)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+var ErrNotSliced = errors.New("slicer only estimated the job, there's no G-code to print")
+
+// SliceJob slices every STL of a print job and stores the G-code next to it, locally and in
+// S3. Once all of the files are sliced the job's estimate is replaced with the slicer's and
+// the job is held for printers with the nozzle it was sliced for. A file that fails is left
+// unsliced and reported, slicing the job again retries it. An estimate without G-code only
+// updates the job's estimate, the file stays unsliced
+func (os *OrderServiceImpl) SliceJob(jobID int64) ([]structs.PrintFile, error) {
+	query := `SELECT stl_id, browser_ssid, file_name, quantity FROM stl_files WHERE job_id = ? ORDER BY stl_id`
+	rows, err := os.DB.Query(query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list STL files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []structs.PrintFile
+	var ssids []string
+	for rows.Next() {
+		var file structs.PrintFile
+		var ssid string
+		if err := rows.Scan(&file.StlID, &ssid, &file.FileName, &file.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan STL file: %w", err)
+		}
+		files = append(files, file)
+		ssids = append(ssids, ssid)
+	}
+	rows.Close()
+
+	if len(files) == 0 {
+		return nil, ErrPrintJobNotFound
+	}
+
+	var errs []error
+	printSeconds := 0
+	var nozzle sql.NullFloat64
+	for i := range files {
+		gcode, err := os.sliceFile(ssids[i], files[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", files[i].FileName, err))
+			continue
+		}
+		printSeconds += gcode.PrintSeconds * files[i].Quantity
+		if gcode.Estimated {
+			continue
+		}
+		files[i].Gcode = &gcode
+
+		if gcode.NozzleMM == 0 {
+			continue
+		}
+		if nozzle.Valid && nozzle.Float64 != gcode.NozzleMM {
+			errs = append(errs, fmt.Errorf("%s: %w: sliced for a %.2fmm nozzle, the job for %.2fmm", files[i].FileName, ErrInvalidGcode, gcode.NozzleMM, nozzle.Float64))
+			continue
+		}
+		nozzle = sql.NullFloat64{Float64: gcode.NozzleMM, Valid: true}
+	}
+	if len(errs) > 0 {
+		return files, errors.Join(errs...)
+	}
+
+	estimateQuery := `
+		UPDATE print_jobs SET estimated_print_seconds = ?, nozzle_mm = ?
+		WHERE job_id = ? AND status IN ('queued', 'claimed', 'printing')
+	`
+	if _, err := os.DB.Exec(estimateQuery, printSeconds, nozzle, jobID); err != nil {
+		return files, fmt.Errorf("failed to update print estimate: %w", err)
+	}
+
+	// the G-code is stored either way, the next reschedule picks up the new estimate
+	if err := os.Scheduler.Reschedule(); err != nil {
+		log.Printf("Unable to reschedule print jobs: %v\n", err)
+	}
+
+	return files, nil
+}
+
+// SliceQueuedJobs slices the queued print jobs that still have unsliced files, oldest first.
+// It is run on a schedule so orders don't wait on the slicer, and returns how many jobs
+// were fully sliced. A job left unsliced waits longer after every run and is given up on
+// after MAX_SLICE_ATTEMPTS, so jobs that never slice can't hold up the ones behind them
+func (os *OrderServiceImpl) SliceQueuedJobs() (int, error) {
+	query := `
+		SELECT j.job_id, j.slice_attempts FROM print_jobs j
+		WHERE j.status = 'queued' AND j.slice_attempts < ?
+			AND (j.slice_next_attempt_at IS NULL OR j.slice_next_attempt_at <= NOW())
+			AND EXISTS (SELECT 1 FROM stl_files s WHERE s.job_id = j.job_id AND s.sliced_at IS NULL)
+		ORDER BY j.job_id
+		LIMIT ?
+	`
+	rows, err := os.DB.Query(query, MAX_SLICE_ATTEMPTS, SLICE_BATCH_SIZE)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list unsliced print jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobIDs []int64
+	attempts := map[int64]int{}
+	for rows.Next() {
+		var jobID int64
+		var jobAttempts int
+		if err := rows.Scan(&jobID, &jobAttempts); err != nil {
+			return 0, fmt.Errorf("failed to scan unsliced print job: %w", err)
+		}
+		jobIDs = append(jobIDs, jobID)
+		attempts[jobID] = jobAttempts
+	}
+	rows.Close()
+
+	sliced := 0
+	var errs []error
+	for _, jobID := range jobIDs {
+		files, err := os.SliceJob(jobID)
+		if err == nil && !allSliced(files) {
+			err = ErrNotSliced
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("print job %d: %w", jobID, err))
+			if recordErr := os.recordSliceFailure(jobID, attempts[jobID]+1, err); recordErr != nil {
+				errs = append(errs, fmt.Errorf("print job %d: %w", jobID, recordErr))
+			}
+			continue
+		}
+		sliced++
+	}
+
+	return sliced, errors.Join(errs...)
+}
+
+// recordSliceFailure holds a job back from the next runs with a growing delay, once it has
+// used all of its attempts only the admin route slices it
+func (os *OrderServiceImpl) recordSliceFailure(jobID int64, attempts int, cause error) error {
+	reason := cause.Error()
+	if len(reason) > 512 {
+		reason = reason[:512]
+	}
+
+	query := `
+		UPDATE print_jobs
+		SET slice_attempts = ?, slice_next_attempt_at = NOW() + INTERVAL ? SECOND, slice_error = ?
+		WHERE job_id = ?
+	`
+	delay := int((SLICE_RETRY_DELAY << (attempts - 1)).Seconds())
+	if _, err := os.DB.Exec(query, attempts, delay, reason, jobID); err != nil {
+		return fmt.Errorf("failed to record slice failure: %w", err)
+	}
+
+	log.Printf("Print job %d failed to slice on attempt %d: %v\n", jobID, attempts, cause)
+	return nil
+}
+
+// allSliced is whether every file came back with G-code, an estimate isn't printable
+func allSliced(files []structs.PrintFile) bool {
+	for _, file := range files {
+		if file.Gcode == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (os *OrderServiceImpl) sliceFile(ssid string, file structs.PrintFile) (structs.GcodeFile, error) {
+	dir, err := getOutputDir(ssid, file.FileName)
+	if err != nil {
+		return structs.GcodeFile{}, err
+	}
+
+	gcode := structs.GcodeFile{FileName: gcodeFileName(file.FileName)}
+	gcode.GcodeMeta, err = os.Slicer.Slice(dir+file.FileName, dir+gcode.FileName)
+	if err != nil {
+		return structs.GcodeFile{}, err
+	}
+	if gcode.Estimated {
+		return gcode, nil
+	}
+
+	s3Key := fmt.Sprintf("%s/%s", ssid, gcode.FileName)
+	if err := os.uploadToS3Func(dir+gcode.FileName, s3Key); err != nil {
+		return structs.GcodeFile{}, fmt.Errorf("failed to upload G-code: %w", err)
+	}
+
+	query := `
+		UPDATE stl_files
+		SET gcode_file_name = ?, gcode_print_seconds = ?, gcode_filament_mm = ?, gcode_filament_g = ?, sliced_at = NOW()
+		WHERE stl_id = ?
+	`
+	if _, err := os.DB.Exec(query, gcode.FileName, gcode.PrintSeconds, gcode.FilamentMM, gcode.FilamentGrams, file.StlID); err != nil {
+		return structs.GcodeFile{}, fmt.Errorf("failed to record G-code: %w", err)
+	}
+
+	return gcode, nil
+}
+
+func gcodeFileName(stlName string) string {
+	return strings.TrimSuffix(stlName, filepath.Ext(stlName)) + ".gcode"
+}
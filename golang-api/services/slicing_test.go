@@ -0,0 +1,318 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+var sliceFileColumns = []string{"stl_id", "browser_ssid", "file_name", "quantity"}
+
+func TestSliceJob(t *testing.T) {
+	markerMeta := structs.GcodeMeta{PrintSeconds: 600, FilamentMM: 812.5, FilamentGrams: 2.42, NozzleMM: 0.4}
+	logoMeta := structs.GcodeMeta{PrintSeconds: 900, FilamentMM: 1200, FilamentGrams: 3.58}
+	wideMeta := structs.GcodeMeta{PrintSeconds: 300, FilamentMM: 400, FilamentGrams: 1.19, NozzleMM: 0.6}
+	estimatedMeta := structs.GcodeMeta{PrintSeconds: 500, FilamentMM: 420.4, FilamentGrams: 1.24, Estimated: true}
+
+	tests := []struct {
+		desc        string
+		setupMocks  func(*MockSlicer, *MockPrintScheduler)
+		mockDB      func(sqlmock.Sqlmock)
+		uploadErr   error
+		wantUploads []string
+		wantFiles   []structs.PrintFile
+		wantErr     string
+	}{
+		{
+			desc: "every file is sliced and the estimate replaced",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(markerMeta, nil)
+				slicer.On("Slice", "./output/ssid/logo.stl", "./output/ssid/logo.gcode").Return(logoMeta, nil)
+				scheduler.On("Reschedule").Return(nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT stl_id, browser_ssid, file_name, quantity FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 3).AddRow(2, "ssid", "logo.stl", 1))
+				mock.ExpectExec(`UPDATE stl_files SET gcode_file_name = \?, gcode_print_seconds = \?, gcode_filament_mm = \?, gcode_filament_g = \?, sliced_at = NOW\(\) WHERE stl_id = \?`).
+					WithArgs("marker.gcode", 600, 812.5, 2.42, int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE stl_files SET gcode_file_name`).
+					WithArgs("logo.gcode", 900, 1200.0, 3.58, int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_print_seconds = \?, nozzle_mm = \? WHERE job_id = \? AND status IN \('queued', 'claimed', 'printing'\)`).
+					WithArgs(2700, sql.NullFloat64{Float64: 0.4, Valid: true}, int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantUploads: []string{"ssid/marker.gcode", "ssid/logo.gcode"},
+			wantFiles: []structs.PrintFile{
+				{StlID: 1, FileName: "marker.stl", Quantity: 3, Gcode: &structs.GcodeFile{GcodeMeta: markerMeta, FileName: "marker.gcode"}},
+				{StlID: 2, FileName: "logo.stl", Quantity: 1, Gcode: &structs.GcodeFile{GcodeMeta: logoMeta, FileName: "logo.gcode"}},
+			},
+		},
+		{
+			desc: "a file that fails is left unsliced and the estimate kept",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(markerMeta, nil)
+				slicer.On("Slice", "./output/ssid/logo.stl", "./output/ssid/logo.gcode").Return(structs.GcodeMeta{}, errors.New("failed to slice: no extrusions"))
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 3).AddRow(2, "ssid", "logo.stl", 1))
+				mock.ExpectExec(`UPDATE stl_files SET gcode_file_name`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantUploads: []string{"ssid/marker.gcode"},
+			wantFiles: []structs.PrintFile{
+				{StlID: 1, FileName: "marker.stl", Quantity: 3, Gcode: &structs.GcodeFile{GcodeMeta: markerMeta, FileName: "marker.gcode"}},
+				{StlID: 2, FileName: "logo.stl", Quantity: 1},
+			},
+			wantErr: "logo.stl: failed to slice: no extrusions",
+		},
+		{
+			desc: "files sliced for different nozzles keep the estimate",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(markerMeta, nil)
+				slicer.On("Slice", "./output/ssid/logo.stl", "./output/ssid/logo.gcode").Return(wideMeta, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 3).AddRow(2, "ssid", "logo.stl", 1))
+				mock.ExpectExec(`UPDATE stl_files SET gcode_file_name`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE stl_files SET gcode_file_name`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantUploads: []string{"ssid/marker.gcode", "ssid/logo.gcode"},
+			wantFiles: []structs.PrintFile{
+				{StlID: 1, FileName: "marker.stl", Quantity: 3, Gcode: &structs.GcodeFile{GcodeMeta: markerMeta, FileName: "marker.gcode"}},
+				{StlID: 2, FileName: "logo.stl", Quantity: 1, Gcode: &structs.GcodeFile{GcodeMeta: wideMeta, FileName: "logo.gcode"}},
+			},
+			wantErr: "logo.stl: invalid G-code: sliced for a 0.60mm nozzle, the job for 0.40mm",
+		},
+		{
+			desc: "an estimate updates the job but isn't recorded as G-code",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(estimatedMeta, nil)
+				scheduler.On("Reschedule").Return(nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 2))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_print_seconds = \?, nozzle_mm = \?`).
+					WithArgs(1000, sql.NullFloat64{}, int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantFiles: []structs.PrintFile{{StlID: 1, FileName: "marker.stl", Quantity: 2}},
+		},
+		{
+			desc: "upload failure isn't recorded",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(markerMeta, nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 3))
+			},
+			uploadErr:   errors.New("access denied"),
+			wantUploads: []string{"ssid/marker.gcode"},
+			wantFiles:   []structs.PrintFile{{StlID: 1, FileName: "marker.stl", Quantity: 3}},
+			wantErr:     "failed to upload G-code: access denied",
+		},
+		{
+			desc:       "job without files",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).WithArgs(int64(9)).WillReturnRows(sqlmock.NewRows(sliceFileColumns))
+			},
+			wantErr: ErrPrintJobNotFound.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			slicer := new(MockSlicer)
+			scheduler := new(MockPrintScheduler)
+			tt.setupMocks(slicer, scheduler)
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+			tt.mockDB(mock)
+
+			service := NewOrderService(db, new(MockEasyPostClient), new(MockPricingService), new(MockPromotionService), new(MockPackagingService), scheduler, slicer, CheapestRate{}, false).(*OrderServiceImpl)
+			var uploads []string
+			service.uploadToS3Func = func(localPath, s3Key string) error {
+				uploads = append(uploads, s3Key)
+				return tt.uploadErr
+			}
+
+			files, err := service.SliceJob(9)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantFiles, files)
+			assert.Equal(t, tt.wantUploads, uploads)
+
+			slicer.AssertExpectations(t)
+			scheduler.AssertExpectations(t)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+var queuedJobColumns = []string{"job_id", "slice_attempts"}
+
+func TestSliceQueuedJobs(t *testing.T) {
+	markerMeta := structs.GcodeMeta{PrintSeconds: 600, FilamentMM: 812.5, FilamentGrams: 2.42, NozzleMM: 0.4}
+
+	tests := []struct {
+		desc       string
+		setupMocks func(*MockSlicer, *MockPrintScheduler)
+		mockDB     func(sqlmock.Sqlmock)
+		wantSliced int
+		wantErr    string
+	}{
+		{
+			desc: "queued jobs with unsliced files are sliced",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(markerMeta, nil)
+				slicer.On("Slice", "./output/other/marker.stl", "./output/other/marker.gcode").Return(markerMeta, nil)
+				scheduler.On("Reschedule").Return(nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT j.job_id, j.slice_attempts FROM print_jobs j WHERE j.status = 'queued' AND j.slice_attempts < \? .* j.slice_next_attempt_at <= NOW\(\)`).
+					WithArgs(MAX_SLICE_ATTEMPTS, SLICE_BATCH_SIZE).
+					WillReturnRows(sqlmock.NewRows(queuedJobColumns).AddRow(9, 0).AddRow(10, 0))
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 1))
+				mock.ExpectExec(`UPDATE stl_files SET gcode_file_name`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_print_seconds`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(10)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(2, "other", "marker.stl", 1))
+				mock.ExpectExec(`UPDATE stl_files SET gcode_file_name`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_print_seconds`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantSliced: 2,
+		},
+		{
+			desc: "a job that fails doesn't stop the rest",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(structs.GcodeMeta{}, errors.New("failed to slice: no extrusions"))
+				slicer.On("Slice", "./output/other/marker.stl", "./output/other/marker.gcode").Return(markerMeta, nil)
+				scheduler.On("Reschedule").Return(nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT j.job_id, j.slice_attempts`).
+					WillReturnRows(sqlmock.NewRows(queuedJobColumns).AddRow(9, 2).AddRow(10, 0))
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 1))
+				mock.ExpectExec(`UPDATE print_jobs SET slice_attempts = \?, slice_next_attempt_at = NOW\(\) \+ INTERVAL \? SECOND, slice_error = \? WHERE job_id = \?`).
+					WithArgs(3, 3600, "marker.stl: failed to slice: no extrusions", int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(10)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(2, "other", "marker.stl", 1))
+				mock.ExpectExec(`UPDATE stl_files SET gcode_file_name`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_print_seconds`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantSliced: 1,
+			wantErr:    "print job 9: marker.stl: failed to slice: no extrusions",
+		},
+		{
+			desc: "an estimated job counts as an attempt",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(structs.GcodeMeta{PrintSeconds: 600, Estimated: true}, nil)
+				scheduler.On("Reschedule").Return(nil)
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT j.job_id, j.slice_attempts`).
+					WillReturnRows(sqlmock.NewRows(queuedJobColumns).AddRow(9, 0))
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 1))
+				mock.ExpectExec(`UPDATE print_jobs SET estimated_print_seconds`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE print_jobs SET slice_attempts`).
+					WithArgs(1, 900, ErrNotSliced.Error(), int64(9)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: "print job 9: " + ErrNotSliced.Error(),
+		},
+		{
+			desc: "a failure that can't be recorded is reported",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {
+				slicer.On("Slice", "./output/ssid/marker.stl", "./output/ssid/marker.gcode").Return(structs.GcodeMeta{}, errors.New("failed to slice: no extrusions"))
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT j.job_id, j.slice_attempts`).
+					WillReturnRows(sqlmock.NewRows(queuedJobColumns).AddRow(9, 0))
+				mock.ExpectQuery(`FROM stl_files WHERE job_id = \?`).
+					WithArgs(int64(9)).
+					WillReturnRows(sqlmock.NewRows(sliceFileColumns).AddRow(1, "ssid", "marker.stl", 1))
+				mock.ExpectExec(`UPDATE print_jobs SET slice_attempts`).WillReturnError(errors.New("db down"))
+			},
+			wantErr: "print job 9: marker.stl: failed to slice: no extrusions\nprint job 9: failed to record slice failure: db down",
+		},
+		{
+			desc:       "nothing to slice",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT j.job_id, j.slice_attempts`).WillReturnRows(sqlmock.NewRows(queuedJobColumns))
+			},
+		},
+		{
+			desc:       "jobs can't be listed",
+			setupMocks: func(slicer *MockSlicer, scheduler *MockPrintScheduler) {},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT j.job_id, j.slice_attempts`).WillReturnError(errors.New("db down"))
+			},
+			wantErr: "failed to list unsliced print jobs: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			slicer := new(MockSlicer)
+			scheduler := new(MockPrintScheduler)
+			tt.setupMocks(slicer, scheduler)
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+			tt.mockDB(mock)
+
+			service := NewOrderService(db, new(MockEasyPostClient), new(MockPricingService), new(MockPromotionService), new(MockPackagingService), scheduler, slicer, CheapestRate{}, false).(*OrderServiceImpl)
+			service.uploadToS3Func = func(localPath, s3Key string) error { return nil }
+
+			sliced, err := service.SliceQueuedJobs()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantSliced, sliced)
+
+			slicer.AssertExpectations(t)
+			scheduler.AssertExpectations(t)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
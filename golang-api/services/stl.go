@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidStl = errors.New("invalid STL file")
+
+// MeshStats is the size of an STL mesh, Volume is cubic millimetres and Width, Depth and
+// Height are its millimetre extents along X, Y and Z as it sits on the build plate
+type MeshStats struct {
+	Volume float64
+	Width  float64
+	Depth  float64
+	Height float64
+}
+
+// MeasureStl reads a binary or ASCII STL, the mesh has to be closed for its volume to mean anything
+func MeasureStl(data []byte) (MeshStats, error) {
+	var mesh meshAccumulator
+	if err := readStl(data, mesh.add); err != nil {
+		return MeshStats{}, err
+	}
+
+	if mesh.triangles == 0 {
+		return MeshStats{}, fmt.Errorf("%w: no triangles", ErrInvalidStl)
+	}
+
+	return MeshStats{
+		Volume: math.Abs(mesh.volume),
+		Width:  mesh.max[0] - mesh.min[0],
+		Depth:  mesh.max[1] - mesh.min[1],
+		Height: mesh.max[2] - mesh.min[2],
+	}, nil
+}
+
+// measureStlFile measures an STL on disk, a file that can't be read is taken to be a typical
+// marker since an estimate shouldn't hold up an order
+func measureStlFile(path string) MeshStats {
+	data, err := os.ReadFile(path)
+	var mesh MeshStats
+	if err == nil {
+		mesh, err = MeasureStl(data)
+	}
+	if err != nil {
+		log.Printf("Unable to measure %s, using the default estimate: %v\n", path, err)
+		return DEFAULT_MARKER_MESH
+	}
+	return mesh
+}
+
+// isBinaryStl goes by size, some exporters start binary headers with "solid" too
+func isBinaryStl(data []byte) bool {
+	if len(data) < 84 {
+		return false
+	}
+	triangles := binary.LittleEndian.Uint32(data[80:84])
+	return uint64(len(data)) == 84+50*uint64(triangles)
+}
+
+// readStl calls face with the vertices of every triangle in a binary or ASCII STL
+func readStl(data []byte, face func(a, b, c [3]float64)) error {
+	if isBinaryStl(data) {
+		readBinaryStl(data, face)
+		return nil
+	}
+	return readASCIIStl(data, face)
+}
+
+// writeBinaryStl encodes faces as a binary STL, slicers work the normals out from the
+// winding so they're left zeroed
+func writeBinaryStl(faces [][3][3]float64) []byte {
+	data := make([]byte, 84+50*len(faces))
+	copy(data, "fairway ink plate")
+	binary.LittleEndian.PutUint32(data[80:84], uint32(len(faces)))
+	for i, face := range faces {
+		out := data[84+50*i:]
+		for v := 0; v < 3; v++ {
+			for axis := 0; axis < 3; axis++ {
+				offset := 12 + 12*v + 4*axis
+				binary.LittleEndian.PutUint32(out[offset:offset+4], math.Float32bits(float32(face[v][axis])))
+			}
+		}
+	}
+	return data
+}
+
+type meshAccumulator struct {
+	triangles int
+	volume    float64
+	min       [3]float64
+	max       [3]float64
+}
+
+// add sums the signed volume of the tetrahedron each face makes with the origin
+func (m *meshAccumulator) add(a, b, c [3]float64) {
+	m.volume += (a[0]*(b[1]*c[2]-b[2]*c[1]) - a[1]*(b[0]*c[2]-b[2]*c[0]) + a[2]*(b[0]*c[1]-b[1]*c[0])) / 6
+
+	if m.triangles == 0 {
+		m.min, m.max = a, a
+	}
+	for _, vertex := range [][3]float64{a, b, c} {
+		for axis := range vertex {
+			m.min[axis] = math.Min(m.min[axis], vertex[axis])
+			m.max[axis] = math.Max(m.max[axis], vertex[axis])
+		}
+	}
+	m.triangles++
+}
+
+func readBinaryStl(data []byte, face func(a, b, c [3]float64)) {
+	count := int(binary.LittleEndian.Uint32(data[80:84]))
+	for i := 0; i < count; i++ {
+		// each face is a normal, three vertices and a two byte attribute
+		record := data[84+50*i:]
+		var vertices [3][3]float64
+		for v := 0; v < 3; v++ {
+			for axis := 0; axis < 3; axis++ {
+				offset := 12 + 12*v + 4*axis
+				vertices[v][axis] = float64(math.Float32frombits(binary.LittleEndian.Uint32(record[offset : offset+4])))
+			}
+		}
+		face(vertices[0], vertices[1], vertices[2])
+	}
+}
+
+func readASCIIStl(data []byte, face func(a, b, c [3]float64)) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return fmt.Errorf("%w: not a binary or ASCII STL", ErrInvalidStl)
+	}
+
+	var vertices [][3]float64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "outer":
+			vertices = vertices[:0]
+		case "vertex":
+			if len(fields) != 4 {
+				return fmt.Errorf("%w: malformed vertex %q", ErrInvalidStl, scanner.Text())
+			}
+			var vertex [3]float64
+			for axis := 0; axis < 3; axis++ {
+				value, err := strconv.ParseFloat(fields[axis+1], 64)
+				if err != nil {
+					return fmt.Errorf("%w: malformed vertex %q", ErrInvalidStl, scanner.Text())
+				}
+				vertex[axis] = value
+			}
+			vertices = append(vertices, vertex)
+		case "endloop":
+			if len(vertices) != 3 {
+				return fmt.Errorf("%w: face with %d vertices", ErrInvalidStl, len(vertices))
+			}
+			face(vertices[0], vertices[1], vertices[2])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidStl, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cubeMesh is a closed 10mm cube sitting 2mm above the origin
+func cubeMesh() [][3][3]float64 {
+	quads := [][4][3]float64{
+		{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}},
+		{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}},
+		{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}},
+		{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}},
+		{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}},
+		{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}},
+	}
+
+	var triangles [][3][3]float64
+	for _, quad := range quads {
+		for i := range quad {
+			quad[i] = [3]float64{quad[i][0] * 10, quad[i][1] * 10, quad[i][2]*10 + 2}
+		}
+		triangles = append(triangles, [3][3]float64{quad[0], quad[1], quad[2]}, [3][3]float64{quad[0], quad[2], quad[3]})
+	}
+	return triangles
+}
+
+func binaryStl(triangles [][3][3]float64) []byte {
+	// exporters often start the header with "solid" as well
+	data := make([]byte, 84, 84+50*len(triangles))
+	copy(data, "solid marker")
+	binary.LittleEndian.PutUint32(data[80:], uint32(len(triangles)))
+	for _, triangle := range triangles {
+		face := make([]byte, 50)
+		for v, vertex := range triangle {
+			for axis, value := range vertex {
+				binary.LittleEndian.PutUint32(face[12+12*v+4*axis:], math.Float32bits(float32(value)))
+			}
+		}
+		data = append(data, face...)
+	}
+	return data
+}
+
+func asciiStl(triangles [][3][3]float64) []byte {
+	var b strings.Builder
+	b.WriteString("solid marker\n")
+	for _, triangle := range triangles {
+		b.WriteString("  facet normal 0 0 0\n    outer loop\n")
+		for _, vertex := range triangle {
+			fmt.Fprintf(&b, "      vertex %g %g %g\n", vertex[0], vertex[1], vertex[2])
+		}
+		b.WriteString("    endloop\n  endfacet\n")
+	}
+	b.WriteString("endsolid marker\n")
+	return []byte(b.String())
+}
+
+func TestMeasureStl(t *testing.T) {
+	tests := []struct {
+		desc       string
+		data       []byte
+		wantMesh   MeshStats
+		wantErrMsg string
+	}{
+		{
+			desc:     "binary cube",
+			data:     binaryStl(cubeMesh()),
+			wantMesh: MeshStats{Volume: 1000, Width: 10, Depth: 10, Height: 10},
+		},
+		{
+			desc:     "ASCII cube",
+			data:     asciiStl(cubeMesh()),
+			wantMesh: MeshStats{Volume: 1000, Width: 10, Depth: 10, Height: 10},
+		},
+		{
+			desc:       "no triangles",
+			data:       []byte("solid empty\nendsolid empty\n"),
+			wantErrMsg: "invalid STL file: no triangles",
+		},
+		{
+			desc:       "malformed vertex",
+			data:       []byte("solid marker\nfacet normal 0 0 1\nouter loop\nvertex 0 0\n"),
+			wantErrMsg: `invalid STL file: malformed vertex "vertex 0 0"`,
+		},
+		{
+			desc:       "face missing a vertex",
+			data:       []byte("solid marker\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nendloop\n"),
+			wantErrMsg: "invalid STL file: face with 2 vertices",
+		},
+		{
+			desc:       "not an STL",
+			data:       []byte("<svg></svg>"),
+			wantErrMsg: "invalid STL file: not a binary or ASCII STL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mesh, err := MeasureStl(tt.data)
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.wantMesh.Volume, mesh.Volume, 1e-6)
+			assert.InDelta(t, tt.wantMesh.Width, mesh.Width, 1e-6)
+			assert.InDelta(t, tt.wantMesh.Depth, mesh.Depth, 1e-6)
+			assert.InDelta(t, tt.wantMesh.Height, mesh.Height, 1e-6)
+		})
+	}
+}
+
+func TestMeasureStlFile(t *testing.T) {
+	dir := t.TempDir()
+	cubePath := filepath.Join(dir, "cube.stl")
+	if err := os.WriteFile(cubePath, binaryStl(cubeMesh()), 0644); err != nil {
+		t.Fatalf("failed to write STL: %v", err)
+	}
+
+	assert.InDelta(t, 1000, measureStlFile(cubePath).Volume, 1e-6)
+	assert.Equal(t, DEFAULT_MARKER_MESH, measureStlFile(filepath.Join(dir, "missing.stl")))
+}
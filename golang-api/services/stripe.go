@@ -3,16 +3,9 @@ package services
 import (
 	"fmt"
 
-	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
-
 	"github.com/stripe/stripe-go/v75"
 	"github.com/stripe/stripe-go/v75/paymentintent"
-)
-
-const (
-	SOLID_PRICE  = 1499
-	TEXT_PRICE   = 1899
-	CUSTOM_PRICE = 1599 
+	"github.com/stripe/stripe-go/v75/refund"
 )
 
 type StripeServiceImpl struct {}
@@ -22,39 +15,28 @@ func NewStripeService(key string) StripeService {
 	return &StripeServiceImpl{}
 }
 
-// CreatePaymentIntent calls the mock function or returns an error if not set
-func (s *StripeServiceImpl) CreatePaymentIntent(cart []structs.CartItem) (*stripe.PaymentIntent, error) {
-	// Prepare line items
-	totalAmount := 0
-
-	for _, item := range cart {
-		if item.Quantity <= 0  {
-			return nil, fmt.Errorf("invalid cart item: missing positive quantity")
-		}
-
-		var price int
-		switch item.TemplateType {
-		case "solid":
-			price = SOLID_PRICE
-		case "text":
-			price = TEXT_PRICE
-		case "custom":
-			price = CUSTOM_PRICE
-		default:
-			return nil, fmt.Errorf("invalid item type in cart")
-		}
-
-		totalAmount += price * int(item.Quantity)
+// CreatePaymentIntent opens a manual capture intent for an amount already priced by the server,
+// a retried checkout with the same idempotency key gets the intent Stripe created the first time
+func (s *StripeServiceImpl) CreatePaymentIntent(amount int64, metadata map[string]string, idempotencyKey string) (*stripe.PaymentIntent, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("invalid payment amount: %d", amount)
 	}
 
 	params := &stripe.PaymentIntentParams{
-		Amount: stripe.Int64(int64(totalAmount)),
+		Amount: stripe.Int64(amount),
 		Currency: stripe.String(string(stripe.CurrencyUSD)),
 		PaymentMethodTypes: []*string{stripe.String("card")},
 		CaptureMethod: stripe.String(string(stripe.PaymentIntentCaptureMethodManual)),
 	}
 
-	
+	for key, value := range metadata {
+		params.AddMetadata(key, value)
+	}
+
+	if idempotencyKey != "" {
+		params.SetIdempotencyKey("create-intent-" + idempotencyKey)
+	}
+
 	return paymentintent.New(params)
 }
 
@@ -68,9 +50,51 @@ func (s *StripeServiceImpl) GetPaymentIntent(id string) (*stripe.PaymentIntent,
 
 func (s *StripeServiceImpl) CapturePaymentIntent(id string) (*stripe.PaymentIntent, error) {
 	params := &stripe.PaymentIntentCaptureParams{}
+	// an intent is only ever captured once so its ID makes a safe key for retries
+	params.SetIdempotencyKey("capture-" + id)
 	intent, err := paymentintent.Capture(id, params)
 	if err != nil {
 		return nil, fmt.Errorf("error capturing payment intent: %w", err)
 	}
 	return intent, nil
 }
+
+// CancelPaymentIntent releases an uncaptured authorization so the customer's funds aren't held
+func (s *StripeServiceImpl) CancelPaymentIntent(id string) (*stripe.PaymentIntent, error) {
+	params := &stripe.PaymentIntentCancelParams{
+		CancellationReason: stripe.String(string(stripe.PaymentIntentCancellationReasonAbandoned)),
+	}
+	params.SetIdempotencyKey("cancel-" + id)
+	intent, err := paymentintent.Cancel(id, params)
+	if err != nil {
+		return nil, fmt.Errorf("error canceling payment intent: %w", err)
+	}
+	return intent, nil
+}
+
+// RefundPaymentIntent returns the full captured amount of an intent
+func (s *StripeServiceImpl) RefundPaymentIntent(id string) (*stripe.Refund, error) {
+	params := &stripe.RefundParams{PaymentIntent: stripe.String(id)}
+	params.SetIdempotencyKey("refund-" + id)
+	result, err := refund.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("error refunding payment intent: %w", err)
+	}
+	return result, nil
+}
+
+// GetBalanceTransaction returns what Stripe settled for an intent's latest charge, the
+// amount, fee and net land on the charge's balance transaction once it is captured
+func (s *StripeServiceImpl) GetBalanceTransaction(intentID string) (*stripe.BalanceTransaction, error) {
+	params := &stripe.PaymentIntentParams{}
+	params.AddExpand("latest_charge.balance_transaction")
+	intent, err := paymentintent.Get(intentID, params)
+	if err != nil {
+		return nil, fmt.Errorf("error getting payment intent: %w", err)
+	}
+
+	if intent.LatestCharge == nil || intent.LatestCharge.BalanceTransaction == nil {
+		return nil, ErrNoBalanceTransaction
+	}
+	return intent.LatestCharge.BalanceTransaction, nil
+}
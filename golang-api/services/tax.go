@@ -0,0 +1,101 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+)
+
+type TaxServiceImpl struct {
+	DB    *sql.DB
+	Rates TaxRateSource
+}
+
+func NewTaxService(db *sql.DB, rates TaxRateSource) TaxService {
+	return &TaxServiceImpl{DB: db, Rates: rates}
+}
+
+// CalculateTax returns the sales tax in cents owed on taxableAmount for an order shipped
+// to address. Only US addresses are taxed, anywhere without a rate is charged nothing
+func (ts *TaxServiceImpl) CalculateTax(address structs.AddressInfo, taxableAmount int64) (int64, error) {
+	if taxableAmount <= 0 || !strings.EqualFold(strings.TrimSpace(address.Country), "US") {
+		return 0, nil
+	}
+
+	rate, err := ts.Rates.LookupRate(address)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(math.Round(float64(taxableAmount) * rate)), nil
+}
+
+// TaxReport totals tax collected by ship-to state for orders placed in [from, to). Only
+// captured payments count, refund amounts aren't kept per order so a partially refunded
+// order is reported in full
+func (ts *TaxServiceImpl) TaxReport(from time.Time, to time.Time) ([]structs.TaxReportRow, error) {
+	query := `
+		SELECT state, COUNT(*), CAST(ROUND(SUM(total_amount) * 100) AS SIGNED) - SUM(tax_cents), SUM(tax_cents)
+		FROM orders
+		WHERE country = 'US' AND created_at >= ? AND created_at < ?
+			AND payment_status IN ('succeeded', 'partially_refunded')
+		GROUP BY state
+		ORDER BY state
+	`
+	rows, err := ts.DB.Query(query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tax report: %w", err)
+	}
+	defer rows.Close()
+
+	report := []structs.TaxReportRow{}
+	for rows.Next() {
+		var row structs.TaxReportRow
+		if err := rows.Scan(&row.State, &row.Orders, &row.TaxableSales, &row.TaxCollected); err != nil {
+			return nil, fmt.Errorf("failed to scan tax report row: %w", err)
+		}
+		report = append(report, row)
+	}
+
+	return report, nil
+}
+
+// TaxRateTable is the local rate source, rates are kept per state with optional ZIP
+// prefixes for local jurisdictions and the most specific match wins
+type TaxRateTable struct {
+	DB *sql.DB
+}
+
+func NewTaxRateTable(db *sql.DB) TaxRateSource {
+	return &TaxRateTable{DB: db}
+}
+
+func (t *TaxRateTable) LookupRate(address structs.AddressInfo) (float64, error) {
+	state := strings.ToUpper(strings.TrimSpace(address.State))
+	zip := strings.TrimSpace(address.PostalCode)
+	if len(zip) > 5 {
+		zip = zip[:5]
+	}
+
+	var rate float64
+	query := `
+		SELECT rate FROM tax_rates
+		WHERE active = TRUE AND country = 'US' AND state = ? AND ? LIKE CONCAT(zip_prefix, '%')
+		ORDER BY LENGTH(zip_prefix) DESC
+		LIMIT 1
+	`
+	err := t.DB.QueryRow(query, state, zip).Scan(&rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up tax rate: %w", err)
+	}
+
+	return rate, nil
+}
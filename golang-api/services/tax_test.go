@@ -0,0 +1,220 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ocamp09/fairway-ink-api/golang-api/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockTaxService struct {
+	mock.Mock
+}
+
+func (m *MockTaxService) CalculateTax(address structs.AddressInfo, taxableAmount int64) (int64, error) {
+	args := m.Called(address, taxableAmount)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockTaxService) TaxReport(from time.Time, to time.Time) ([]structs.TaxReportRow, error) {
+	args := m.Called(from, to)
+	return args.Get(0).([]structs.TaxReportRow), args.Error(1)
+}
+
+type fakeRateSource struct {
+	rate float64
+	err  error
+}
+
+func (f fakeRateSource) LookupRate(address structs.AddressInfo) (float64, error) {
+	return f.rate, f.err
+}
+
+var ohioAddress = structs.AddressInfo{Line1: "1 Tee Box Ln", City: "Columbus", State: "OH", PostalCode: "43215", Country: "US"}
+
+func TestCalculateTax(t *testing.T) {
+	tests := []struct {
+		desc       string
+		address    structs.AddressInfo
+		amount     int64
+		rates      fakeRateSource
+		want       int64
+		wantErrMsg string
+	}{
+		{
+			desc:    "rate applied and rounded to the cent",
+			address: ohioAddress,
+			amount:  4897,
+			rates:   fakeRateSource{rate: 0.0575},
+			want:    282,
+		},
+		{
+			desc:    "state without a rate",
+			address: structs.AddressInfo{State: "OR", PostalCode: "97201", Country: "US"},
+			amount:  4897,
+			want:    0,
+		},
+		{
+			desc:    "international orders are not taxed",
+			address: structs.AddressInfo{State: "ON", PostalCode: "M5V", Country: "CA"},
+			amount:  4897,
+			rates:   fakeRateSource{err: errors.New("should not be called")},
+			want:    0,
+		},
+		{
+			desc:    "fully discounted order",
+			address: ohioAddress,
+			amount:  0,
+			rates:   fakeRateSource{err: errors.New("should not be called")},
+			want:    0,
+		},
+		{
+			desc:       "rate lookup fails",
+			address:    ohioAddress,
+			amount:     4897,
+			rates:      fakeRateSource{err: errors.New("db down")},
+			wantErrMsg: "db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			service := NewTaxService(nil, tt.rates)
+			tax, err := service.CalculateTax(tt.address, tt.amount)
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tax)
+		})
+	}
+}
+
+func TestLookupRate(t *testing.T) {
+	tests := []struct {
+		desc       string
+		address    structs.AddressInfo
+		mockDB     func(sqlmock.Sqlmock)
+		want       float64
+		wantErrMsg string
+	}{
+		{
+			desc:    "most specific rate for the zip",
+			address: structs.AddressInfo{State: " oh", PostalCode: "43215-1234", Country: "US"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT rate FROM tax_rates WHERE (.+) ORDER BY LENGTH\(zip_prefix\) DESC LIMIT 1`).
+					WithArgs("OH", "43215").
+					WillReturnRows(sqlmock.NewRows([]string{"rate"}).AddRow(0.0575))
+			},
+			want: 0.0575,
+		},
+		{
+			desc:    "no rate for the state",
+			address: structs.AddressInfo{State: "OR", PostalCode: "97201", Country: "US"},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT rate FROM tax_rates`).
+					WithArgs("OR", "97201").
+					WillReturnRows(sqlmock.NewRows([]string{"rate"}))
+			},
+			want: 0,
+		},
+		{
+			desc:    "query fails",
+			address: ohioAddress,
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT rate FROM tax_rates`).WillReturnError(errors.New("db down"))
+			},
+			wantErrMsg: "failed to look up tax rate: db down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			rate, err := NewTaxRateTable(db).LookupRate(tt.address)
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, rate)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestTaxReport(t *testing.T) {
+	from := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc       string
+		rows       *sqlmock.Rows
+		wantReport []structs.TaxReportRow
+	}{
+		{
+			desc: "totals by state",
+			rows: sqlmock.NewRows([]string{"state", "orders", "taxable", "tax"}).
+				AddRow("MI", 2, 5998, 0).
+				AddRow("OH", 3, 14691, 845),
+			wantReport: []structs.TaxReportRow{
+				{State: "MI", Orders: 2, TaxableSales: 5998, TaxCollected: 0},
+				{State: "OH", Orders: 3, TaxableSales: 14691, TaxCollected: 845},
+			},
+		},
+		{
+			// the only MI order was refunded, the filter leaves its state out of the report
+			desc: "refunded order isn't counted",
+			rows: sqlmock.NewRows([]string{"state", "orders", "taxable", "tax"}).
+				AddRow("OH", 3, 14691, 845),
+			wantReport: []structs.TaxReportRow{
+				{State: "OH", Orders: 3, TaxableSales: 14691, TaxCollected: 845},
+			},
+		},
+		{
+			desc:       "nothing captured",
+			rows:       sqlmock.NewRows([]string{"state", "orders", "taxable", "tax"}),
+			wantReport: []structs.TaxReportRow{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock db: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT state, COUNT\(\*\)(.+) FROM orders WHERE country = 'US' AND created_at >= \? AND created_at < \? AND payment_status IN \('succeeded', 'partially_refunded'\) GROUP BY state`).
+				WithArgs(from, to).
+				WillReturnRows(tt.rows)
+
+			report, err := NewTaxService(db, nil).TaxReport(from, to)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantReport, report)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
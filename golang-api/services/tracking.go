@@ -0,0 +1,106 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EasyPost/easypost-go/v4"
+)
+
+var ErrShipmentNotFound = errors.New("no shipment for tracker")
+
+// shipping_status only moves forward, a late pre_transit scan can't un-ship a parcel
+var shippingStatusRank = map[string]int{
+	"pending":   0,
+	"shipped":   1,
+	"delivered": 2,
+}
+
+type TrackingServiceImpl struct {
+	DB *sql.DB
+}
+
+func NewTrackingService(db *sql.DB) TrackingService {
+	return &TrackingServiceImpl{DB: db}
+}
+
+// RecordTracker stores a tracker's scans against the shipment it follows and advances the
+// shipment's shipping_status. Trackers are sent in full on every update so scans that were
+// already recorded are skipped
+func (ts *TrackingServiceImpl) RecordTracker(tracker *easypost.Tracker) error {
+	var shipmentID int64
+	var currentStatus string
+	query := `SELECT shipment_id, shipping_status FROM shipping WHERE easypost_id = ? OR tracking_number = ? LIMIT 1`
+	err := ts.DB.QueryRow(query, tracker.ShipmentID, tracker.TrackingCode).Scan(&shipmentID, &currentStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrShipmentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up shipment: %w", err)
+	}
+
+	tx, err := ts.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	eventQuery := `
+		INSERT IGNORE INTO tracking_events (
+			shipment_id, status, status_detail, message, city, state, country, occurred_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, detail := range tracker.TrackingDetails {
+		occurredAt, err := time.Parse(time.RFC3339, detail.DateTime)
+		if err != nil {
+			return fmt.Errorf("invalid tracking event time %q: %w", detail.DateTime, err)
+		}
+
+		var location easypost.TrackingLocation
+		if detail.TrackingLocation != nil {
+			location = *detail.TrackingLocation
+		}
+
+		_, err = tx.Exec(
+			eventQuery,
+			shipmentID, detail.Status, nullString(detail.StatusDetail), nullString(detail.Message),
+			nullString(location.City), nullString(location.State), nullString(location.Country), occurredAt.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert tracking event: %w", err)
+		}
+	}
+
+	status := shippingStatusFor(tracker.Status)
+	if shippingStatusRank[status] > shippingStatusRank[currentStatus] {
+		statusQuery := `UPDATE shipping SET shipping_status = ? WHERE shipment_id = ?`
+		if _, err := tx.Exec(statusQuery, status, shipmentID); err != nil {
+			return fmt.Errorf("failed to update shipping status: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// shippingStatusFor maps an EasyPost tracker status to the order's shipping_status, once the
+// carrier has the parcel it counts as shipped even if it is later returned
+func shippingStatusFor(trackerStatus string) string {
+	switch trackerStatus {
+	case "delivered":
+		return "delivered"
+	case "in_transit", "out_for_delivery", "available_for_pickup", "return_to_sender", "failure":
+		return "shipped"
+	default:
+		return "pending"
+	}
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EasyPost/easypost-go/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func inTransitTracker() *easypost.Tracker {
+	return &easypost.Tracker{
+		ID:           "trk_123",
+		ShipmentID:   "shp_123",
+		TrackingCode: "TRACK123",
+		Status:       "in_transit",
+		TrackingDetails: []*easypost.TrackingDetail{
+			{Status: "pre_transit", StatusDetail: "label_created", Message: "Shipping label created", DateTime: "2024-05-01T12:00:00Z"},
+			{
+				Status:           "in_transit",
+				StatusDetail:     "arrived_at_facility",
+				Message:          "Arrived at USPS facility",
+				DateTime:         "2024-05-02T08:30:00-04:00",
+				TrackingLocation: &easypost.TrackingLocation{City: "Columbus", State: "OH", Country: "US"},
+			},
+		},
+	}
+}
+
+func TestRecordTracker(t *testing.T) {
+	tests := []struct {
+		desc    string
+		tracker *easypost.Tracker
+		mockDB  func(sqlmock.Sqlmock)
+		wantErr string
+	}{
+		{
+			desc:    "first scans ship the order",
+			tracker: inTransitTracker(),
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT shipment_id, shipping_status FROM shipping WHERE easypost_id = \? OR tracking_number = \?`).
+					WithArgs("shp_123", "TRACK123").
+					WillReturnRows(sqlmock.NewRows([]string{"shipment_id", "shipping_status"}).AddRow(7, "pending"))
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT IGNORE INTO tracking_events`).
+					WithArgs(int64(7), "pre_transit", "label_created", "Shipping label created", nil, nil, nil,
+						time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`INSERT IGNORE INTO tracking_events`).
+					WithArgs(int64(7), "in_transit", "arrived_at_facility", "Arrived at USPS facility", "Columbus", "OH", "US",
+						time.Date(2024, 5, 2, 12, 30, 0, 0, time.UTC)).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec(`UPDATE shipping SET shipping_status = \? WHERE shipment_id = \?`).
+					WithArgs("shipped", int64(7)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			desc: "late scan doesn't move a delivered order back",
+			tracker: &easypost.Tracker{
+				ShipmentID:   "shp_123",
+				TrackingCode: "TRACK123",
+				Status:       "in_transit",
+				TrackingDetails: []*easypost.TrackingDetail{
+					{Status: "in_transit", DateTime: "2024-05-02T12:30:00Z"},
+				},
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).
+					WillReturnRows(sqlmock.NewRows([]string{"shipment_id", "shipping_status"}).AddRow(7, "delivered"))
+				mock.ExpectBegin()
+				// already recorded so the insert is ignored
+				mock.ExpectExec(`INSERT IGNORE INTO tracking_events`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			desc: "delivered",
+			tracker: &easypost.Tracker{
+				ShipmentID:   "shp_123",
+				TrackingCode: "TRACK123",
+				Status:       "delivered",
+				TrackingDetails: []*easypost.TrackingDetail{
+					{Status: "delivered", DateTime: "2024-05-03T15:00:00Z"},
+				},
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).
+					WillReturnRows(sqlmock.NewRows([]string{"shipment_id", "shipping_status"}).AddRow(7, "shipped"))
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT IGNORE INTO tracking_events`).WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectExec(`UPDATE shipping SET shipping_status`).
+					WithArgs("delivered", int64(7)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			desc:    "tracker for an unknown shipment",
+			tracker: inTransitTracker(),
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).WillReturnRows(sqlmock.NewRows([]string{"shipment_id", "shipping_status"}))
+			},
+			wantErr: ErrShipmentNotFound.Error(),
+		},
+		{
+			desc: "unparseable scan time",
+			tracker: &easypost.Tracker{
+				ShipmentID:      "shp_123",
+				Status:          "in_transit",
+				TrackingDetails: []*easypost.TrackingDetail{{Status: "in_transit", DateTime: "yesterday"}},
+			},
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).
+					WillReturnRows(sqlmock.NewRows([]string{"shipment_id", "shipping_status"}).AddRow(7, "pending"))
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+			wantErr: `invalid tracking event time "yesterday"`,
+		},
+		{
+			desc:    "insert fails",
+			tracker: inTransitTracker(),
+			mockDB: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM shipping`).
+					WillReturnRows(sqlmock.NewRows([]string{"shipment_id", "shipping_status"}).AddRow(7, "pending"))
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT IGNORE INTO tracking_events`).WillReturnError(errors.New("db error"))
+				mock.ExpectRollback()
+			},
+			wantErr: "failed to insert tracking event: db error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to mock db: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockDB(mock)
+
+			service := NewTrackingService(db)
+			err = service.RecordTracker(tt.tracker)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestShippingStatusFor(t *testing.T) {
+	tests := map[string]string{
+		"pre_transit":          "pending",
+		"unknown":              "pending",
+		"in_transit":           "shipped",
+		"out_for_delivery":     "shipped",
+		"available_for_pickup": "shipped",
+		"return_to_sender":     "shipped",
+		"delivered":            "delivered",
+	}
+
+	for trackerStatus, want := range tests {
+		assert.Equal(t, want, shippingStatusFor(trackerStatus), trackerStatus)
+	}
+}
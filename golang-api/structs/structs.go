@@ -1,16 +1,34 @@
 package structs
 
-import "github.com/EasyPost/easypost-go/v4"
+import (
+	"time"
+
+	"github.com/EasyPost/easypost-go/v4"
+)
 
 type OrderInfo struct {
+	OrderID         int64   `json:"order_id,omitempty"`
+	OrderToken      string  `json:"order_token,omitempty"`
 	PaymentIntentID string  `json:"intent_id"`
 	BrowserSSID     string  `json:"browser_ssid"`
 	Amount          float32 `json:"amount"`
 	PaymentStatus   string  `json:"payment_status"`
 	Name            string  `json:"name"`
 	Email           string  `json:"email"`
+	PromotionID     int64   `json:"-"`
+	PromoCode       string  `json:"promo_code,omitempty"`
+	DiscountAmount  int64   `json:"discount_amount"`
+	TaxAmount       int64   `json:"tax_amount"`
+	ShippingAmount  int64   `json:"shipping_amount"`
+	ShipmentID      string  `json:"-"`
+	RateID          string  `json:"-"`
+	RatePolicy      *RatePolicy `json:"-"`
+	// set when the label is bought after the order was packed, otherwise the cart is packed
+	Parcel        *Parcel     `json:"-"`
+	Customs       []CustomsItem `json:"-"`
 	Address       AddressInfo
 	ShippingInfo ShippingInfo `json:"shipping_info"`
+	Items        []OrderItem  `json:"items,omitempty"`
 }
 
 type AddressInfo struct {
@@ -35,4 +53,387 @@ type CartItem struct {
 	StlURL       string `json:"stlUrl" binding:"required"`
 	Quantity     int    `json:"quantity" binding:"required"`
 	TemplateType string `json:"templateType" binding:"required"`
-}
\ No newline at end of file
+	SizeVariant  string `json:"sizeVariant"`
+}
+
+type Product struct {
+	ProductID    int64   `json:"id"`
+	TemplateType string  `json:"template_type" binding:"required"`
+	SizeVariant  string  `json:"size_variant"`
+	Name         string  `json:"name" binding:"required"`
+	UnitWeight   float64 `json:"unit_weight" binding:"min=0"`
+	// declared on the customs form of international shipments
+	CustomsDescription string `json:"customs_description"`
+	HSTariffNumber     string `json:"hs_tariff_number" binding:"omitempty,numeric,min=6,max=10"`
+	// markers without a color print in whatever filament is loaded
+	FilamentColor string `json:"filament_color,omitempty" binding:"max=30"`
+	Active       bool    `json:"active"`
+	Prices       []Price `json:"prices"`
+}
+
+type Price struct {
+	PriceID       int64      `json:"id"`
+	ProductID     int64      `json:"product_id"`
+	UnitAmount    int64      `json:"unit_amount" binding:"required,min=1"`
+	Active        bool       `json:"active"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+}
+
+
+type Promotion struct {
+	PromotionID    int64           `json:"id"`
+	Code           string          `json:"code" binding:"required"`
+	DiscountType   string          `json:"discount_type" binding:"required,oneof=percent_off fixed_off free_shipping"`
+	DiscountValue  int64           `json:"discount_value" binding:"min=0"`
+	TemplateType   string          `json:"template_type"`
+	MinQuantity    int             `json:"min_quantity" binding:"min=0"`
+	Tiers          []PromotionTier `json:"tiers,omitempty" binding:"dive"`
+	StartsAt       *time.Time      `json:"starts_at"`
+	ExpiresAt      *time.Time      `json:"expires_at"`
+	MaxRedemptions *int            `json:"max_redemptions"`
+	OnePerEmail    bool            `json:"one_per_email"`
+	Active         bool            `json:"active"`
+	Redemptions    int             `json:"redemptions"`
+}
+
+// PromotionTier is the discount a cart gets once it holds at least MinQuantity eligible units,
+// a promotion with tiers takes the highest one met in place of its own MinQuantity and DiscountValue
+type PromotionTier struct {
+	MinQuantity   int   `json:"min_quantity" binding:"min=1"`
+	DiscountValue int64 `json:"discount_value" binding:"min=1"`
+}
+
+type Discount struct {
+	PromotionID int64  `json:"-"`
+	Code        string `json:"code"`
+	Amount      int64  `json:"amount"`
+}
+
+type CheckoutRequest struct {
+	BrowserSSID string `json:"browser_ssid" binding:"required"`
+	Email       string `json:"email"`
+	PromoCode   string `json:"promo_code"`
+	// sales tax is charged on the address the order will ship to
+	Address *AddressInfo `json:"address"`
+	// the rate picked from a shipping quote, it is charged with the order
+	ShipmentID     string `json:"shipment_id"`
+	RateID         string `json:"rate_id"`
+	IdempotencyKey string `json:"-"`
+}
+
+type Checkout struct {
+	PaymentIntentID string   `json:"intent_id"`
+	BrowserSSID     string   `json:"browser_ssid"`
+	Email           string   `json:"email"`
+	Subtotal        int64    `json:"subtotal"`
+	Shipping        int64    `json:"shipping"`
+	Discount        Discount `json:"discount"`
+	Tax             int64    `json:"tax"`
+	Total           int64    `json:"total"`
+	ShipmentID      string   `json:"shipment_id"`
+	RateID          string   `json:"rate_id"`
+
+	// the address shipping was quoted and tax charged for, nil when checkout had none
+	Address *AddressInfo `json:"address,omitempty"`
+}
+
+type StoredResponse struct {
+	Status int
+	Body   []byte
+}
+
+// OrderDetails is the joined view of an order that customers and operators look up after checkout
+type OrderDetails struct {
+	OrderID         int64       `json:"order_id"`
+	PaymentIntentID string      `json:"intent_id"`
+	Name            string      `json:"name"`
+	Email           string      `json:"email"`
+	Address         AddressInfo `json:"address"`
+	Total           int64       `json:"total"`
+	PromoCode       string      `json:"promo_code,omitempty"`
+	DiscountAmount  int64       `json:"discount_amount"`
+	ShippingAmount  int64       `json:"shipping_amount"`
+	TaxAmount       int64       `json:"tax_amount"`
+	PaymentStatus   string      `json:"payment_status"`
+	PrintStatus     string      `json:"print_status"`
+	ShippingStatus  string      `json:"shipping_status"`
+	Carrier         string      `json:"carrier"`
+	TrackingNumber  string      `json:"tracking_number"`
+	CreatedAt       time.Time   `json:"created_at"`
+	Items           []OrderItem `json:"items,omitempty"`
+	Tracking        []TrackingEvent `json:"tracking,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+	// ExpectedShipDate is YYYY-MM-DD, empty once the parcel has shipped
+	ExpectedShipDate string `json:"expected_ship_date,omitempty"`
+	TokenHash       string      `json:"-"`
+}
+
+// TrackingEvent is one carrier scan of an order's parcel, Status is the carrier's tracking
+// status e.g. in_transit rather than the order's shipping_status
+type TrackingEvent struct {
+	Status       string    `json:"status"`
+	StatusDetail string    `json:"status_detail,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	City         string    `json:"city,omitempty"`
+	State        string    `json:"state,omitempty"`
+	Country      string    `json:"country,omitempty"`
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+// OrderItem is one ordered line with the price and discount it was sold at
+type OrderItem struct {
+	TemplateType string `json:"template_type,omitempty"`
+	SizeVariant  string `json:"size_variant,omitempty"`
+	FileName     string `json:"file_name"`
+	Quantity     int    `json:"quantity"`
+	UnitPrice    int64  `json:"unit_price"`
+	Discount     int64  `json:"discount"`
+	StlID        int64  `json:"-"`
+	PriceID      int64  `json:"-"`
+}
+
+type OrderFilter struct {
+	Email         string `form:"email"`
+	PaymentStatus string `form:"payment_status"`
+	Limit         int    `form:"limit" binding:"omitempty,min=1,max=200"`
+	Offset        int    `form:"offset" binding:"omitempty,min=0"`
+}
+
+// TaxReportRow totals the orders shipped to one state, amounts are in cents
+type TaxReportRow struct {
+	State        string `json:"state"`
+	Orders       int    `json:"orders"`
+	TaxableSales int64  `json:"taxable_sales"`
+	TaxCollected int64  `json:"tax_collected"`
+}
+
+// ShippingQuote is the set of rates a customer can pick from for one address, the
+// shipment it was rated on is bought later with the chosen rate
+type ShippingQuote struct {
+	ShipmentID string         `json:"shipment_id"`
+	Parcel     Parcel         `json:"parcel"`
+	Rates      []ShippingRate `json:"rates"`
+	// only set for international shipments
+	Incoterm     string        `json:"incoterm,omitempty"`
+	DutiesPaidBy string        `json:"duties_paid_by,omitempty"`
+	Customs      []CustomsItem `json:"customs,omitempty"`
+}
+
+type ShippingRate struct {
+	RateID       string `json:"rate_id"`
+	Carrier      string `json:"carrier"`
+	Service      string `json:"service"`
+	Amount       int64  `json:"amount"`
+	DeliveryDays int    `json:"delivery_days"`
+}
+
+type ShippingQuoteRequest struct {
+	BrowserSSID string       `json:"browser_ssid" binding:"required"`
+	Name        string       `json:"name"`
+	Address     *AddressInfo `json:"address" binding:"required"`
+	// international shipments default to the shop's incoterm
+	Incoterm string `json:"incoterm" binding:"omitempty,oneof=DDU DDP"`
+}
+
+// AddressFieldError is one problem the carrier found with an address
+type AddressFieldError struct {
+	Field      string `json:"field"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// AddressVerification is the result of checking an address is deliverable, Suggested is
+// the carrier's corrected form of the address when it differs from the one sent
+type AddressVerification struct {
+	Deliverable bool                `json:"deliverable"`
+	Suggested   *AddressInfo        `json:"suggested_address,omitempty"`
+	Errors      []AddressFieldError `json:"errors,omitempty"`
+}
+
+// RatePolicy picks the label bought for an order that wasn't shipped on a quoted rate,
+// amounts are in cents and zero limits are ignored
+type RatePolicy struct {
+	Strategy        string   `json:"strategy" binding:"omitempty,oneof=cheapest fastest preferred_carrier max_delivery_days service"`
+	MaxAmount       int64    `json:"max_amount" binding:"min=0"`
+	Carriers        []string `json:"carriers"`
+	MaxDeliveryDays int      `json:"max_delivery_days" binding:"min=0"`
+	Carrier         string   `json:"carrier"`
+	Service         string   `json:"service"`
+}
+
+// LabelPurchase is a shipping label waiting to be bought once the order's print job completes,
+// a purchase that fails is retried at NextAttemptAt until it runs out of attempts
+type LabelPurchase struct {
+	LabelPurchaseID int64      `json:"id"`
+	OrderID         int64      `json:"order_id"`
+	Status          string     `json:"status"`
+	Attempts        int        `json:"attempts"`
+	LastError       string     `json:"last_error,omitempty"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty"`
+	TrackingNumber  string     `json:"tracking_number,omitempty"`
+}
+
+// CustomsItem is one line of the customs declaration on an international shipment, Value is
+// the line total in cents and Weight the line total in ounces
+type CustomsItem struct {
+	Description    string  `json:"description"`
+	HSTariffNumber string  `json:"hs_tariff_number"`
+	Quantity       int     `json:"quantity"`
+	Value          int64   `json:"value"`
+	Weight         float64 `json:"weight"`
+	OriginCountry  string  `json:"origin_country"`
+}
+
+// Manifest is the scan form handed to one carrier at pickup for the day's shipments, FormURL
+// is empty until EasyPost has finished generating the form
+type Manifest struct {
+	ManifestID    int64     `json:"id"`
+	Carrier       string    `json:"carrier"`
+	ManifestDate  time.Time `json:"manifest_date"`
+	ScanFormID    string    `json:"scan_form_id"`
+	BatchID       string    `json:"batch_id,omitempty"`
+	FormURL       string    `json:"form_url,omitempty"`
+	Status        string    `json:"status"`
+	ShipmentCount int       `json:"shipment_count"`
+}
+
+// PrintJob is an order's markers on the production floor, a worker holds the job while its
+// lease is current and loses it to the next claim once the lease runs out
+type PrintJob struct {
+	JobID          int64          `json:"id"`
+	OrderID        int64          `json:"order_id"`
+	Status         string         `json:"status"`
+	WorkerID       string         `json:"worker_id,omitempty"`
+	PrinterID      int64          `json:"printer_id,omitempty"`
+	LeaseExpiresAt *time.Time     `json:"lease_expires_at,omitempty"`
+	Attempts       int            `json:"attempts"`
+	FailureReason  string         `json:"failure_reason,omitempty"`
+	StartedAt      *time.Time     `json:"started_at,omitempty"`
+	CompletedAt    *time.Time     `json:"completed_at,omitempty"`
+	Files          []PrintFile    `json:"files,omitempty"`
+	Label          *LabelPurchase `json:"label,omitempty"`
+}
+
+// PrintFile is one STL of a job, DownloadURL is a presigned link that expires. Gcode is
+// only set once the file has been sliced
+type PrintFile struct {
+	StlID       int64      `json:"id"`
+	FileName    string     `json:"file_name"`
+	Quantity    int        `json:"quantity"`
+	DownloadURL string     `json:"download_url"`
+	Gcode       *GcodeFile `json:"gcode,omitempty"`
+}
+
+// GcodeMeta is what the slicer reports for one copy of an STL, filament is the length
+// pulled through the extruder and its weight. NozzleMM is the nozzle it was sliced for,
+// zero when the slicer didn't say. Estimated means nothing was sliced and there's no
+// G-code to print, only the numbers
+type GcodeMeta struct {
+	PrintSeconds  int     `json:"print_seconds"`
+	FilamentMM    float64 `json:"filament_mm"`
+	FilamentGrams float64 `json:"filament_g"`
+	NozzleMM      float64 `json:"nozzle_mm,omitempty"`
+	Estimated     bool    `json:"estimated,omitempty"`
+}
+
+// GcodeFile is the sliced G-code stored next to a job's STL
+type GcodeFile struct {
+	GcodeMeta
+	FileName    string `json:"file_name"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// PrintJobClaim is a worker asking for the next job its printer can take
+type PrintJobClaim struct {
+	WorkerID  string `json:"worker_id" binding:"required,max=255"`
+	PrinterID int64  `json:"printer_id" binding:"required,min=1"`
+}
+
+type PrintJobHeartbeat struct {
+	WorkerID string `json:"worker_id" binding:"required,max=255"`
+}
+
+// PrintJobUpdate is a worker reporting progress, a failed job goes back in the queue when Requeue is set
+type PrintJobUpdate struct {
+	WorkerID string `json:"worker_id" binding:"required,max=255"`
+	Status   string `json:"status" binding:"required,oneof=printing completed failed"`
+	Reason   string `json:"reason" binding:"max=512"`
+	Requeue  bool   `json:"requeue"`
+}
+
+// Printer is one machine on the production floor, bed sizes are millimetres and FilamentColors
+// lists every spool it can print from, more than one when it has a multi-material unit
+type Printer struct {
+	PrinterID      int64      `json:"id"`
+	Name           string     `json:"name" binding:"required,max=255"`
+	BedX           float64    `json:"bed_x_mm" binding:"required,gt=0"`
+	BedY           float64    `json:"bed_y_mm" binding:"required,gt=0"`
+	BedZ           float64    `json:"bed_z_mm" binding:"required,gt=0"`
+	NozzleMM       float64    `json:"nozzle_mm" binding:"omitempty,gt=0"`
+	FilamentColors []string   `json:"filament_colors" binding:"required,min=1,dive,required,max=30"`
+	Status         string     `json:"status" binding:"omitempty,oneof=idle printing offline maintenance"`
+	LastSeenAt     *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// PrinterHeartbeat is a printer checking in, FilamentColors is only sent after a spool change
+type PrinterHeartbeat struct {
+	Status         string   `json:"status" binding:"required,oneof=idle printing offline maintenance"`
+	FilamentColors []string `json:"filament_colors" binding:"omitempty,min=1,dive,required,max=30"`
+}
+
+// Plate is one combined STL holding the markers of several queued jobs, printing it
+// completes every job on it. Workers lease plates like jobs, DownloadURL is only set for
+// the worker holding it
+type Plate struct {
+	PlateID        int64           `json:"id"`
+	Status         string          `json:"status"`
+	WorkerID       string          `json:"worker_id,omitempty"`
+	PrinterID      int64           `json:"printer_id,omitempty"`
+	LeaseExpiresAt *time.Time      `json:"lease_expires_at,omitempty"`
+	Attempts       int             `json:"attempts"`
+	BedX           float64         `json:"bed_x_mm"`
+	BedY           float64         `json:"bed_y_mm"`
+	FileName       string          `json:"file_name"`
+	DownloadURL    string          `json:"download_url,omitempty"`
+	FilamentColors []string        `json:"filament_colors"`
+	JobIDs         []int64         `json:"job_ids"`
+	Instances      []PlateInstance `json:"instances"`
+	CreatedAt      time.Time       `json:"created_at"`
+	CompletedAt    *time.Time      `json:"completed_at,omitempty"`
+	FailureReason  string          `json:"failure_reason,omitempty"`
+}
+
+// PlateInstance is one copy of an order's marker on a plate, X and Y are the millimetre
+// corner of its footprint and Rotated means it was turned a quarter turn to fit
+type PlateInstance struct {
+	JobID    int64   `json:"job_id"`
+	OrderID  int64   `json:"order_id"`
+	StlID    int64   `json:"stl_id"`
+	FileName string  `json:"file_name"`
+	Copy     int     `json:"copy"`
+	X        float64 `json:"x_mm"`
+	Y        float64 `json:"y_mm"`
+	Rotated  bool    `json:"rotated"`
+}
+
+// PlateRequest overrides the configured bed size for one plate
+type PlateRequest struct {
+	BedX float64 `json:"bed_x_mm" binding:"omitempty,gt=0"`
+	BedY float64 `json:"bed_y_mm" binding:"omitempty,gt=0"`
+}
+
+// PlateFailure says why a plate didn't print
+type PlateFailure struct {
+	Reason string `json:"reason" binding:"max=512"`
+}
+
+// Parcel is the box an order ships in, dimensions are inches and weight is ounces
+type Parcel struct {
+	BoxID  int64   `json:"box_id"`
+	Box    string  `json:"box"`
+	Length float64 `json:"length"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Weight float64 `json:"weight"`
+}